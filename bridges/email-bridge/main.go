@@ -123,6 +123,16 @@ func (bridge *EmailBridge) Process(msg []byte) {
 		panic(err)
 	}
 
+	// Informational results are collected for trend data, never alerted on
+	if testResult.Informational {
+		return
+	}
+
+	// Tests skipped as a test they depend on is failing only repeat its alert
+	if testResult.Classification == "skipped-dependency" {
+		return
+	}
+
 	// If the test passed then we don't care, unless otherwise defined
 	shouldSend := true
 	if testResult.Error == nil {
@@ -24,6 +24,7 @@ type enqueueCmd struct {
 	RedisPassword    string
 	RedisSocket      string
 	RedisDialTimeout time.Duration
+	JobsQueue        string
 	_r               *redis.Client
 }
 
@@ -35,6 +36,8 @@ func (*enqueueCmd) Synopsis() string { return "Enqueue a parsed configuration fi
 func (*enqueueCmd) Usage() string {
 	return `enqueue :
   Add the tests from a parsed configuration file to a central redis queue.
+  Files ending in .yaml, .yml or .json define the tests as an array of
+  objects, instead of as lines.
 `
 }
 
@@ -55,6 +58,7 @@ func (p *enqueueCmd) SetFlags(f *flag.FlagSet) {
 	defaults.RedisDB = 0
 	defaults.RedisSocket = ""
 	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.JobsQueue = defaultJobsQueue
 
 	//
 	// If we have a configuration file then load it
@@ -77,6 +81,7 @@ func (p *enqueueCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
 	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
 	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.StringVar(&p.JobsQueue, "jobs-queue", defaults.JobsQueue, "The queue the tests are added to, which the workers pull them from.")
 }
 
 //
@@ -84,7 +89,11 @@ func (p *enqueueCmd) SetFlags(f *flag.FlagSet) {
 // has been successfully parsed.
 //
 func (p *enqueueCmd) enqueueTest(tst test.Test) error {
-	_, err := p._r.RPush("overseer.jobs", tst.Input).Result()
+	queue := p.JobsQueue
+	if queue == "" {
+		queue = defaultJobsQueue
+	}
+	_, err := p._r.RPush(queue, tst.Input).Result()
 	return err
 }
 
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"github.com/google/subcommands"
+)
+
+func TestEnqueueStructured(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "enqueue")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tests.yaml")
+	tests := `
+- target: pass.example.com
+  type: dumb-test
+  arguments:
+    fail-at: 1
+    dumb-duration-max: 0s
+- target: fail.example.com
+  type: dumb-test
+  arguments:
+    fail-at: 0
+    dumb-duration-max: 0s
+    severity: warning
+`
+	if err = ioutil.WriteFile(path, []byte(tests), 0644); err != nil {
+		t.Fatalf("failed to write the tests: %s", err)
+	}
+
+	enqueue := &enqueueCmd{_r: p._r}
+	if err = parser.New().ParseFile(path, enqueue.enqueueTest); err != nil {
+		t.Fatalf("failed to enqueue the tests: %s", err)
+	}
+
+	// The tests are queued as lines, which the worker runs like any other
+	if status := p.runOnce(&test.Options{}, parser.New()); status != subcommands.ExitSuccess {
+		t.Fatalf("unexpected exit status %d", status)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, j := range results {
+		result, errJSON := test.ResultFromJSON([]byte(j))
+		if errJSON != nil {
+			t.Fatalf("failed to decode result: %s", errJSON)
+		}
+
+		switch result.Target {
+		case "pass.example.com":
+			if result.Error != nil {
+				t.Errorf("expected the first test to pass, got %s", *result.Error)
+			}
+		case "fail.example.com":
+			if result.Error == nil || result.Severity != "warning" {
+				t.Errorf("expected the second test to fail as a warning, got %v %s", result.Error, result.Severity)
+			}
+		default:
+			t.Errorf("unexpected result for %s", result.Target)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Silence
+//
+// The silence sub-command silences targets, e.g. during incidents, so
+// that the workers skip their tests, reporting them as silenced, instead
+// of alerting about them.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+type silenceCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+
+	// How long the entries are silenced for, forever if zero
+	TTL time.Duration
+
+	// If true, the entries are removed instead of added
+	Remove bool
+
+	// If true, the silenced entries are listed
+	List bool
+
+	_r *redis.Client
+}
+
+//
+// Glue
+//
+func (*silenceCmd) Name() string     { return "silence" }
+func (*silenceCmd) Synopsis() string { return "Silence targets, so that their tests are skipped." }
+func (*silenceCmd) Usage() string {
+	return `silence [-ttl 2h] [-remove] [-list] 'type target' ... :
+  Add, or remove, entries in the overseer.silenced set. The tests whose
+  type and target, as written in the tests rather than as resolved, match
+  an entry are not run by the workers, which report them as silenced
+  instead. Entries may use '*' and '?' as wildcards, e.g.
+
+     overseer silence -ttl 2h 'http https://example.com/*'
+`
+}
+
+//
+// Flag setup.
+//
+func (p *silenceCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults silenceCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+
+	f.DurationVar(&p.TTL, "ttl", 0, "How long to silence the entries for, forever if unset.")
+	f.BoolVar(&p.Remove, "remove", false, "Remove the given entries, instead of adding them.")
+	f.BoolVar(&p.List, "list", false, "List the silenced entries.")
+}
+
+// showSilences writes the silenced entries as a table, sorted by entry.
+func showSilences(w io.Writer, silences map[string]time.Time, now time.Time) error {
+	var entries []string
+	for entry := range silences {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENTRY\tEXPIRES")
+
+	for _, entry := range entries {
+		expires := "never"
+		if expiry := silences[entry]; !expiry.IsZero() {
+			expires = fmt.Sprintf("in %s", expiry.Sub(now).Truncate(time.Second))
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", entry, expires)
+	}
+
+	return tw.Flush()
+}
+
+//
+// Entry-point.
+//
+func (p *silenceCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	if f.NArg() == 0 && !p.List {
+		fmt.Printf("Please specify the entries to silence, as 'type target'.\n")
+		return subcommands.ExitFailure
+	}
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	now := time.Now()
+	for _, entry := range f.Args() {
+		var err error
+		if p.Remove {
+			err = removeSilence(p._r, entry)
+		} else {
+			err = addSilence(p._r, entry, p.TTL, now)
+		}
+		if err != nil {
+			fmt.Printf("Failed to update '%s': %s\n", entry, err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	if p.List {
+		silences, err := activeSilences(p._r, now)
+		if err != nil {
+			fmt.Printf("Failed to fetch the silenced entries: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+		if err = showSilences(out, silences, now); err != nil {
+			fmt.Printf("Failed to show the silenced entries: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	return subcommands.ExitSuccess
+}
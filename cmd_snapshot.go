@@ -0,0 +1,184 @@
+// Snapshot
+//
+// The snapshot sub-command dumps, as JSON, the effective configuration of
+// the worker, the registered protocols, the queues and our version.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"runtime"
+	"sort"
+
+	"github.com/cmaster11/overseer/protocols"
+	"github.com/google/subcommands"
+)
+
+// snapshot describes a deployment, e.g. to be attached to bug reports, or
+// diffed against other deployments.
+type snapshot struct {
+	Version   string                 `json:"version"`
+	Build     snapshotBuild          `json:"build"`
+	Config    map[string]interface{} `json:"config"`
+	Queues    snapshotQueues         `json:"queues"`
+	Protocols []snapshotProtocol     `json:"protocols"`
+}
+
+type snapshotBuild struct {
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+type snapshotQueues struct {
+	Jobs    string `json:"jobs"`
+	Results string `json:"results"`
+}
+
+type snapshotProtocol struct {
+	Name                  string            `json:"name"`
+	Arguments             map[string]string `json:"arguments"`
+	ShouldResolveHostname bool              `json:"shouldResolveHostname"`
+}
+
+type snapshotCmd struct {
+	// Where the snapshot is written to, stdout if empty
+	Output string
+
+	// The configuration of the worker, loaded like the worker does
+	worker workerCmd
+}
+
+//
+// Glue
+//
+func (*snapshotCmd) Name() string     { return "snapshot" }
+func (*snapshotCmd) Synopsis() string { return "Dump a JSON snapshot of our configuration." }
+func (*snapshotCmd) Usage() string {
+	return `snapshot :
+  Dump, as JSON, the effective worker configuration, the registered
+  protocols along with their arguments, the queue names, and our version.
+
+  The worker flags are accepted, so the configuration can be inspected
+  exactly as a worker started with them would see it.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *snapshotCmd) SetFlags(f *flag.FlagSet) {
+	p.worker.SetFlags(f)
+
+	f.StringVar(&p.Output, "output", "", "Write the snapshot to this file, instead of stdout.")
+}
+
+// snapshotSecrets are the fields of the configuration which are censored
+// in the snapshots, as they may be shared, e.g. in bug reports.
+var snapshotSecrets = []string{
+	"KafkaPassword",
+	"RedisPassword",
+}
+
+// buildSnapshot returns the snapshot of the given worker configuration.
+func buildSnapshot(worker *workerCmd) (*snapshot, error) {
+
+	//
+	// The configuration is dumped with the same keys the configuration
+	// file uses, so a snapshot can be used as one.
+	//
+	raw, err := json.Marshal(worker)
+	if err != nil {
+		return nil, err
+	}
+
+	var config map[string]interface{}
+	if err = json.Unmarshal(raw, &config); err != nil {
+		return nil, err
+	}
+
+	for _, field := range snapshotSecrets {
+		if value, _ := config[field].(string); value != "" {
+			config[field] = "CENSORED"
+		}
+	}
+	if worker.RedisURL != "" {
+		config["RedisURL"] = censorURL(worker.RedisURL)
+	}
+
+	s := &snapshot{
+		Version: version,
+		Build: snapshotBuild{
+			GoVersion: runtime.Version(),
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+		},
+		Config: config,
+		Queues: snapshotQueues{
+			Jobs:    worker.jobsQueue(),
+			Results: worker.resultQueueTemplate(),
+		},
+	}
+
+	handlers := protocols.Handlers()
+	sort.Strings(handlers)
+
+	for _, name := range handlers {
+		handler := protocols.ProtocolHandler(name)
+		s.Protocols = append(s.Protocols, snapshotProtocol{
+			Name:                  name,
+			Arguments:             handler.Arguments(),
+			ShouldResolveHostname: handler.ShouldResolveHostname(),
+		})
+	}
+
+	return s, nil
+}
+
+// censorURL returns the URL with its password, if any, censored. URLs
+// which cannot be parsed are censored altogether.
+func censorURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "CENSORED"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "CENSORED")
+	}
+	return u.String()
+}
+
+//
+// Entry-point.
+//
+func (p *snapshotCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	s, err := buildSnapshot(&p.worker)
+	if err != nil {
+		fmt.Printf("Failed to build the snapshot: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	j, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		fmt.Printf("Failed to encode the snapshot: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	j = append(j, '\n')
+
+	if p.Output == "" {
+		out.Write(j)
+		return subcommands.ExitSuccess
+	}
+
+	if err = ioutil.WriteFile(p.Output, j, 0644); err != nil {
+		fmt.Printf("Failed to write the snapshot: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
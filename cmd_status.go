@@ -0,0 +1,168 @@
+// Status
+//
+// The status sub-command shows the latest result of each target, as
+// recorded by workers started with -record-status.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+type statusCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+
+	// If true, only failing targets are shown
+	Failed bool
+
+	_r *redis.Client
+}
+
+//
+// Glue
+//
+func (*statusCmd) Name() string     { return "status" }
+func (*statusCmd) Synopsis() string { return "Show the latest result of each target." }
+func (*statusCmd) Usage() string {
+	return `status :
+  Show, as a table, the latest result of each target, as recorded in the
+  overseer.status hash by workers started with -record-status.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *statusCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults statusCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+
+	f.BoolVar(&p.Failed, "failed", false, "Only show the targets whose latest result is a failure.")
+}
+
+// showStatus writes the recorded statuses as a table, sorted by type and
+// target.
+func showStatus(w io.Writer, statuses map[string]string, failedOnly bool, now time.Time) error {
+	var fields []string
+	for field := range statuses {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tTARGET\tSTATUS\tLAST RUN\tERROR")
+
+	for _, field := range fields {
+		result, err := test.ResultFromJSON([]byte(statuses[field]))
+		if err != nil {
+			fmt.Fprintf(tw, "?\t%s\tINVALID\t-\t%s\n", field, err.Error())
+			continue
+		}
+
+		if failedOnly && result.Error == nil {
+			continue
+		}
+
+		status := "OK"
+		errorString := "-"
+		if result.Error != nil {
+			status = "FAILED"
+			// Keep the table on a single line per target
+			errorString = strings.Join(strings.Fields(*result.Error), " ")
+		}
+
+		age := now.Sub(time.Unix(result.Time, 0)).Truncate(time.Second)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s ago\t%s\n", result.Type, result.Target, status, age, errorString)
+	}
+
+	return tw.Flush()
+}
+
+//
+// Entry-point.
+//
+func (p *statusCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	statuses, err := p._r.HGetAll(statusKey).Result()
+	if err != nil {
+		fmt.Printf("Failed to fetch the statuses: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	if err = showStatus(out, statuses, p.Failed, time.Now()); err != nil {
+		fmt.Printf("Failed to show the statuses: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
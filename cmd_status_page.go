@@ -0,0 +1,301 @@
+// Status Page
+//
+// The status-page sub-command renders the latest result of each target,
+// as recorded by workers started with -record-status, as a static HTML
+// page, written to a file or served over HTTP.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+type statusPageCmd struct {
+	RedisDB          int
+	RedisHost        string
+	RedisPassword    string
+	RedisSocket      string
+	RedisDialTimeout time.Duration
+
+	// The file the page is written to
+	Output string
+
+	// If > 0, the file is written again with this period
+	Refresh time.Duration
+
+	// If set, the address the page is served on, instead of being written to a file
+	Listen string
+
+	// The title of the page
+	Title string
+
+	_r *redis.Client
+}
+
+//
+// Glue
+//
+func (*statusPageCmd) Name() string     { return "status-page" }
+func (*statusPageCmd) Synopsis() string { return "Render the latest result of each target as an HTML page." }
+func (*statusPageCmd) Usage() string {
+	return `status-page :
+  Render the latest result of each target, as recorded in the overseer.status
+  hash by workers started with -record-status, as a static HTML page with a
+  green/red grid of the targets and test types.
+
+  The page is written to the -output file, once or every -refresh period,
+  or served on the -listen address.
+`
+}
+
+//
+// Flag setup.
+//
+func (p *statusPageCmd) SetFlags(f *flag.FlagSet) {
+
+	//
+	// Create the default options here
+	//
+	// This is done so we can load defaults via a configuration-file
+	// if present.
+	//
+	var defaults statusPageCmd
+	defaults.RedisHost = "localhost:6379"
+	defaults.RedisPassword = ""
+	defaults.RedisDB = 0
+	defaults.RedisSocket = ""
+	defaults.RedisDialTimeout = 5 * time.Second
+	defaults.Output = "status.html"
+	defaults.Title = "Status"
+
+	//
+	// If we have a configuration file then load it
+	//
+	if len(os.Getenv("OVERSEER")) > 0 {
+		cfg, err := ioutil.ReadFile(os.Getenv("OVERSEER"))
+		if err == nil {
+			err = json.Unmarshal(cfg, &defaults)
+			if err != nil {
+				fmt.Printf("WARNING: Error loading overseer.json - %s\n",
+					err.Error())
+			}
+		} else {
+			fmt.Printf("WARNING: Failed to read configuration-file - %s\n", err.Error())
+		}
+	}
+
+	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
+	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
+	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
+	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+
+	f.StringVar(&p.Output, "output", defaults.Output, "The file the page is written to.")
+	f.DurationVar(&p.Refresh, "refresh", defaults.Refresh, "If > 0, write the page again with this period, instead of only once.")
+	f.StringVar(&p.Listen, "listen", defaults.Listen, "If set, serve the page on this address (e.g. ':8080'), rendering it on each request, instead of writing it to a file.")
+	f.StringVar(&p.Title, "title", defaults.Title, "The title of the page.")
+}
+
+// statusPageCell is the latest result of a test type against a target.
+type statusPageCell struct {
+	Result *test.Result
+	Age    time.Duration
+}
+
+// statusPageRow holds the results of all the test types against a target.
+type statusPageRow struct {
+	Target string
+	Cells  []*statusPageCell
+}
+
+var statusPageTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.4em 0.8em; text-align: left; }
+td.ok { background: #4caf50; color: #fff; }
+td.failed { background: #e53935; color: #fff; }
+td.none { background: #eee; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Failed}} of {{.Total}} tests failing, generated at {{.Generated}}.</p>
+<table>
+<tr><th>Target</th>{{range .Types}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr class="target"><td>{{.Target}}</td>{{range .Cells}}{{if not .}}<td class="none">-</td>{{else if .Result.Error}}<td class="failed" title="{{.Result.Error}}">FAILED ({{.Age}} ago)</td>{{else}}<td class="ok">OK ({{.Age}} ago)</td>{{end}}{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// renderStatusPage writes the recorded statuses as an HTML page, with a
+// row for each target, and a column for each test type.
+func renderStatusPage(w io.Writer, title string, statuses map[string]string, now time.Time) error {
+	results := map[string]map[string]*test.Result{}
+	typesSeen := map[string]bool{}
+	total, failed := 0, 0
+
+	for _, raw := range statuses {
+		result, err := test.ResultFromJSON([]byte(raw))
+		if err != nil {
+			continue
+		}
+		if results[result.Target] == nil {
+			results[result.Target] = map[string]*test.Result{}
+		}
+		results[result.Target][result.Type] = result
+		typesSeen[result.Type] = true
+		total++
+		if result.Error != nil {
+			failed++
+		}
+	}
+
+	var types []string
+	for testType := range typesSeen {
+		types = append(types, testType)
+	}
+	sort.Strings(types)
+
+	var targets []string
+	for target := range results {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var rows []statusPageRow
+	for _, target := range targets {
+		row := statusPageRow{Target: target}
+		for _, testType := range types {
+			var cell *statusPageCell
+			if result := results[target][testType]; result != nil {
+				cell = &statusPageCell{Result: result, Age: now.Sub(time.Unix(result.Time, 0)).Truncate(time.Second)}
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	return statusPageTemplate.Execute(w, map[string]interface{}{
+		"Title":     title,
+		"Types":     types,
+		"Rows":      rows,
+		"Failed":    failed,
+		"Total":     total,
+		"Generated": now.Format(time.RFC1123),
+	})
+}
+
+// render renders the page from the current statuses.
+func (p *statusPageCmd) render(w io.Writer) error {
+	statuses, err := p._r.HGetAll(statusKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to fetch the statuses: %s", err.Error())
+	}
+	return renderStatusPage(w, p.Title, statuses, time.Now())
+}
+
+// writePage writes the page to the output file, replacing it at once, so
+// that it is never served half-written.
+func (p *statusPageCmd) writePage() error {
+	buf := &bytes.Buffer{}
+	if err := p.render(buf); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p.Output), ".status-page")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.Output)
+}
+
+//
+// Entry-point.
+//
+func (p *statusPageCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+
+	//
+	// Connect to the redis-host.
+	//
+	if p.RedisSocket != "" {
+		p._r = redis.NewClient(&redis.Options{
+			Network:     "unix",
+			Addr:        p.RedisSocket,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	} else {
+		p._r = redis.NewClient(&redis.Options{
+			Addr:        p.RedisHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+		})
+	}
+
+	if p.Listen != "" {
+		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			buf := &bytes.Buffer{}
+			if err := p.render(buf); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(buf.Bytes())
+		})
+
+		fmt.Printf("Serving the status page on %s\n", p.Listen)
+		if err := http.ListenAndServe(p.Listen, nil); err != nil {
+			fmt.Printf("Failed to serve the status page: %s\n", err.Error())
+		}
+		return subcommands.ExitFailure
+	}
+
+	for {
+		if err := p.writePage(); err != nil {
+			fmt.Printf("Failed to write the status page: %s\n", err.Error())
+			if p.Refresh == 0 {
+				return subcommands.ExitFailure
+			}
+		}
+
+		if p.Refresh == 0 {
+			return subcommands.ExitSuccess
+		}
+		time.Sleep(p.Refresh)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestRenderStatusPage(t *testing.T) {
+	now := time.Now()
+	refused := "connection <refused>"
+
+	statuses := map[string]string{}
+	for _, result := range []*test.Result{
+		{Type: "http", Target: "www.example.com", Time: now.Add(-time.Minute).Unix()},
+		{Type: "ssh", Target: "www.example.com", Time: now.Add(-time.Minute).Unix(), Error: &refused},
+		{Type: "http", Target: "api.example.com", Time: now.Add(-2 * time.Minute).Unix()},
+	} {
+		j, _ := json.Marshal(result)
+		statuses[statusField(result)] = string(j)
+	}
+	statuses["ssh broken"] = "not json"
+
+	buf := &bytes.Buffer{}
+	if err := renderStatusPage(buf, "Example status", statuses, now); err != nil {
+		t.Fatalf("failed to render the page: %s", err)
+	}
+	page := buf.String()
+
+	expected := []string{
+		"<title>Example status</title>",
+		"1 of 3 tests failing",
+		"<tr><th>Target</th><th>http</th><th>ssh</th></tr>",
+		// Sorted by target, with an empty cell for the missing ssh test
+		`<tr class="target"><td>api.example.com</td><td class="ok">OK (2m0s ago)</td><td class="none">-</td></tr>`,
+		`<tr class="target"><td>www.example.com</td><td class="ok">OK (1m0s ago)</td><td class="failed" title="connection &lt;refused&gt;">FAILED (1m0s ago)</td></tr>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(page, e) {
+			t.Errorf("expected the page to contain %q, got:\n%s", e, page)
+		}
+	}
+	if strings.Count(page, `<tr class="target">`) != 2 {
+		t.Errorf("expected a row for each of the 2 targets, got:\n%s", page)
+	}
+}
+
+func TestWriteStatusPage(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.RecordStatus = true
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "192.0.2.1", Type: "ssh"}, nil, nil, nil)
+
+	dir, err := ioutil.TempDir("", "overseer-status-page")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	page := &statusPageCmd{Output: filepath.Join(dir, "status.html"), Title: "Status", _r: p._r}
+	if err = page.writePage(); err != nil {
+		t.Fatalf("failed to write the page: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(page.Output)
+	if err != nil {
+		t.Fatalf("failed to read the page: %s", err)
+	}
+	if !strings.Contains(string(content), "<td>192.0.2.1</td><td class=\"ok\">") {
+		t.Errorf("expected the target row in the page, got:\n%s", content)
+	}
+}
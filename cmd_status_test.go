@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/google/subcommands"
+)
+
+func TestRecordStatus(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.RecordStatus = true
+
+	tst := test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh"}
+	p.notify(tst, nil, errors.New("connection refused"), nil)
+
+	field := "ssh 1.2.3.4"
+	raw := server.HGet(statusKey, field)
+	result, err := test.ResultFromJSON([]byte(raw))
+	if err != nil {
+		t.Fatalf("failed to decode the recorded status: %s", err)
+	}
+	if result.Error == nil || *result.Error != "connection refused" {
+		t.Errorf("expected the failure to be recorded, got %v", deref(result.Error))
+	}
+
+	// The latest result replaces the previous one
+	p.notify(tst, nil, nil, nil)
+	result, _ = test.ResultFromJSON([]byte(server.HGet(statusKey, field)))
+	if result == nil || result.Error != nil {
+		t.Errorf("expected the recovery to be recorded, got %+v", result)
+	}
+
+	if keys, _ := server.HKeys(statusKey); len(keys) != 1 {
+		t.Errorf("expected a single status for the target, got %v", keys)
+	}
+}
+
+func TestRecordStatusDisabled(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh"}, nil, nil, nil)
+
+	if server.Exists(statusKey) {
+		t.Errorf("expected no status to be recorded by default")
+	}
+}
+
+func TestStatusCommand(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.RecordStatus = true
+
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh"}, nil, nil, nil)
+	p.notify(test.Test{Input: "example.com must run ftp", Target: "1.2.3.4", Type: "ftp"}, nil, errors.New("connection\nrefused"), nil)
+
+	run := func(args ...string) string {
+		var buf bytes.Buffer
+		previous := out
+		out = &buf
+		defer func() { out = previous }()
+
+		cmd := &statusCmd{}
+		f := flag.NewFlagSet("status", flag.ContinueOnError)
+		cmd.SetFlags(f)
+		if err := f.Parse(append([]string{"-redis-host", server.Addr()}, args...)); err != nil {
+			t.Fatalf("failed to parse flags: %s", err)
+		}
+		if status := cmd.Execute(context.Background(), f); status != subcommands.ExitSuccess {
+			t.Fatalf("expected the status command to succeed, got %d", status)
+		}
+		return buf.String()
+	}
+
+	lines := strings.Split(strings.TrimSpace(run()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and two statuses, got:\n%s", strings.Join(lines, "\n"))
+	}
+	if !strings.HasPrefix(lines[0], "TYPE") {
+		t.Errorf("expected a header, got %s", lines[0])
+	}
+	// Sorted by type, with the error on a single line
+	if !strings.HasPrefix(lines[1], "ftp") || !strings.Contains(lines[1], "FAILED") || !strings.Contains(lines[1], "connection refused") {
+		t.Errorf("unexpected ftp status: %s", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "ssh") || !strings.Contains(lines[2], "OK") {
+		t.Errorf("unexpected ssh status: %s", lines[2])
+	}
+
+	lines = strings.Split(strings.TrimSpace(run("-failed")), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "ftp") {
+		t.Errorf("expected only the failing target, got:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestShowStatusAge(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	statuses := map[string]string{
+		"ssh 1.2.3.4": `{"type":"ssh","target":"1.2.3.4","time":1599999910,"error":null}`,
+	}
+
+	var buf bytes.Buffer
+	if err := showStatus(&buf, statuses, false, now); err != nil {
+		t.Fatalf("failed to show statuses: %s", err)
+	}
+	if !strings.Contains(buf.String(), "1m30s ago") {
+		t.Errorf("expected the age of the result, got:\n%s", buf.String())
+	}
+}
@@ -5,10 +5,12 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/url"
 	"os"
@@ -28,6 +30,7 @@ import (
 	"github.com/google/subcommands"
 	"github.com/marpaia/graphite-golang"
 	_ "github.com/skx/golang-metrics"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // This is our structure, largely populated by command-line arguments
@@ -50,12 +53,24 @@ type workerCmd struct {
 	// Prior to retrying a failed test how long should we pause?
 	RetryDelay time.Duration
 
+	// If true, the pause doubles after each failed attempt, up to
+	// RetryMaxDelay if > 0
+	RetryBackoff  bool
+	RetryMaxDelay time.Duration
+
+	// If > 0, a random duration up to this value is added to each pause
+	// between attempts
+	RetryJitter time.Duration
+
 	// Default min duration
 	MinDuration time.Duration
 
 	// Default min duration cache lifetime factor
 	MinDurationCacheFactor uint
 
+	// How many consecutive failed runs are needed before a failure is notified
+	FailuresBeforeNotify uint
+
 	// Default deduplication duration
 	DedupDuration time.Duration
 
@@ -68,12 +83,33 @@ type workerCmd struct {
 	// The (optional) redis-password we'll use.
 	RedisPassword string
 
+	// If set, a redis:// (or rediss:// for TLS) URL overriding the
+	// redis-host, redis-database and redis-password
+	RedisURL string
+
 	// The redis-sockt we're going to use. (If used, we ignore the specified host / port)
 	RedisSocket string
 
 	// Redis connection timeout
 	RedisDialTimeout time.Duration
 
+	// If set, a warm standby redis-host results are buffered on while the primary one is unreachable
+	RedisFallbackHost string
+
+	// If true, RedisHost is a comma-separated list of the sentinels
+	// monitoring the master named RedisMasterName
+	RedisSentinel   bool
+	RedisMasterName string
+
+	// If true, redis is connected to over TLS, verified with RedisTLSCA
+	// if given, and with the client certificate RedisTLSCert and its key
+	// RedisTLSKey if given
+	RedisTLS           bool
+	RedisTLSCA         string
+	RedisTLSCert       string
+	RedisTLSKey        string
+	RedisTLSSkipVerify bool
+
 	// Tag applied to all results
 	Tag string
 
@@ -89,11 +125,198 @@ type workerCmd struct {
 	// Default period test threshold percentage, if not overridden by specific test setting
 	PeriodTestThreshold float32
 
+	// If > 0, the number of active workers is reduced while the host load average is above this value
+	MaxLoadAvg float64
+
+	// The maximum random delay before the worker starts pulling jobs
+	StartupJitter time.Duration
+
+	// If > 0, the maximum number of protocol-tests running at once
+	MaxInflight uint
+
+	// If > 0, bounds the total time of a job, across all of its targets and retries
+	JobDeadline time.Duration
+
+	// A PEM bundle of certificate authorities trusted by TLS-capable tests
+	CAFile string
+
+	// The queue jobs are pulled from
+	JobsQueue string
+
+	// Deprecated alias of ResultsQueue, used only if it is not set
+	ResultQueueTemplate string
+
+	// The queue results are published to, supporting placeholders like {type}
+	ResultsQueue string
+
+	// If set, a comma-separated list of resolvers which must agree on the addresses of the targets
+	CompareResolvers string
+
+	// If > 0, the maximum time the addresses of the targets are cached for,
+	// and the maximum number of targets cached
+	DNSCacheTTL  time.Duration
+	DNSCacheSize int
+
+	// If true, the results of a test against all of its targets are notified at once
+	CoalesceResults bool
+
+	// If true, the latest result of each target is stored in the overseer.status hash
+	RecordStatus bool
+
+	// If > 0, the success rate of each test over this many runs is added to its results
+	SuccessRateWindow uint
+
+	// If true, the latest result of each test from this region (the tag) is stored in an overseer.matrix.* hash
+	RecordMatrix bool
+
+	// If > 0, status entries and consecutive failure counts not updated for this long are removed
+	StatusTTL time.Duration
+
+	// If > 0, the fraction of all the results published to the analytics queue
+	AnalyticsSampleRate float64
+
+	// The queue sampled results are published to
+	AnalyticsQueue string
+
+	// If set, the queue jobs which cannot be executed are routed to
+	DeadLetterQueue string
+
+	// If set, the queue holding the jobs being run by this worker, until
+	// their result is notified
+	ProcessingQueue string
+
+	// Patterns of the text to mask in the free-text fields of results
+	RedactPatterns []string
+
+	// If set, a comma-separated list of the only fields of the published
+	// results
+	ResultFields string
+
+	// If set, the address of a StatsD server metrics of each result are sent to
+	NotifyStatsd string
+
+	// The prefix of the StatsD metrics
+	StatsdPrefix string
+
+	// If set, the OTLP/HTTP endpoint of an OpenTelemetry collector the
+	// trace of each test is exported to
+	OTLPEndpoint string
+
+	// If set, the comma-separated Kafka brokers each result is published to
+	NotifyKafka string
+
+	// The Kafka topic results are published to
+	KafkaTopic string
+
+	// If true, the Kafka brokers are connected to over TLS
+	KafkaTLS bool
+
+	// If set, the SASL/PLAIN credentials used to login to the Kafka brokers
+	KafkaUsername string
+	KafkaPassword string
+
+	// The maximum number of results waiting to be published to Kafka
+	KafkaBuffer uint
+
+	// If true, process the jobs currently in the queue and exit
+	Once bool
+
+	// In once-mode, a test which must pass before the queued jobs are processed
+	Canary string
+
+	// In once-mode, how long the queue must stay empty before exiting,
+	// polling it with an increasing delay up to IdleBackoffMax
+	OnceIdleWait   time.Duration
+	IdleBackoffMax time.Duration
+
+	// If true, tests are executed but their results are never notified
+	Shadow bool
+
+	// If true, port-scan tests are allowed
+	AllowPortScan bool
+
+	// If true, mock tests are allowed
+	AllowMock bool
+
+	// If set, the comma-separated Kubernetes namespaces the k8s testers
+	// may query, any other being refused
+	K8sAllowedNamespaces string
+
+	// If set, the range of the local ports outbound connections are made from
+	LocalPortRange string
+
+	// A shell command run before each test, or once at startup
+	PreTestHook string
+
+	// If true, the pre-test hook is run once at startup, instead of before each test
+	PreTestHookOnce bool
+
+	// If true, a test is failed when its pre-test hook fails, instead of being run anyway
+	PreTestHookAbort bool
+
+	// If true, hooks running arbitrary commands are allowed
+	AllowHooks bool
+
 	// The handle to our redis-server
 	_r *redis.Client
 
+	// The handle to the fallback redis-server, if any
+	_fallback *redis.Client
+
 	// The handle to our graphite-server
 	_g *graphite.Graphite
+
+	// Sends the metrics of each result to StatsD, if enabled
+	_statsd *statsdEmitter
+
+	// Traces each test, if enabled
+	_tracer trace.Tracer
+
+	// Publishes each result to Kafka, if enabled
+	_kafka *kafkaSink
+
+	// Samples the results published to the analytics queue, if enabled
+	_analytics *resultSampler
+
+	// Shrinks the worker pool under high host load
+	_loadLimiter *loadLimiter
+
+	// Caps the protocol-tests running at once
+	_inflight inflightLimiter
+
+	// The compiled redact patterns
+	_redact []*regexp.Regexp
+
+	// The fields kept in the published results, all of them if nil
+	_resultFields map[string]bool
+
+	// Resolves hostnames, replaceable for testing
+	_lookupIP func(host string) ([]net.IP, error)
+
+	// Returns the current time, replaceable for testing
+	_now func() time.Time
+
+	// Pauses between the attempts of a test, replaceable for testing
+	_sleep func(d time.Duration)
+
+	// The parent of the contexts of the tests, cancelled to abort them
+	_ctx context.Context
+
+	// Receives the signals asking the worker to exit, replaceable for
+	// testing
+	_signals chan os.Signal
+
+	// Exits the process, replaceable for testing
+	_exit func(code int)
+
+	// The hostname of the machine, identifying the worker in the results
+	_hostname string
+
+	// Spreads the pauses between attempts, if enabled
+	_retryJitter *retryJitter
+
+	// Caches the addresses of the targets, if enabled
+	_dnsCache *dnsCache
 }
 
 //
@@ -173,7 +396,7 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 	defaults.IPv4 = true
 	defaults.IPv6 = true
 	defaults.Retry = true
-	defaults.RetryCount = 5
+	defaults.RetryCount = 4
 	defaults.RetryDelay = 5 * time.Second
 	defaults.MinDuration = 0
 	defaults.MinDurationCacheFactor = 10
@@ -187,6 +410,13 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 	defaults.RedisDialTimeout = 5 * time.Second
 	defaults.PeriodTestSleep = 5 * time.Second
 	defaults.PeriodTestThreshold = 0
+	defaults.JobsQueue = defaultJobsQueue
+	defaults.StatsdPrefix = "overseer"
+	defaults.KafkaTopic = "overseer.results"
+	defaults.KafkaBuffer = 1000
+	defaults.IdleBackoffMax = 5 * time.Second
+	defaults.DNSCacheSize = 1000
+	defaults.AnalyticsQueue = defaultAnalyticsQueue
 
 	//
 	// If we have a configuration file then load it
@@ -210,33 +440,104 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 	//
 	// Worker
 	f.UintVar(&p.Parallel, "parallel", defaults.Parallel, "Number of parallel tests the worker can be handled at the same time.")
+	f.Float64Var(&p.MaxLoadAvg, "max-loadavg", defaults.MaxLoadAvg, "If > 0, reduce the number of parallel tests while the host load average is above this value.")
+	f.UintVar(&p.MaxInflight, "max-inflight", defaults.MaxInflight, "If > 0, the maximum number of protocol-tests running at once across the worker, including the parallel tests against the targets of each job.")
+	f.DurationVar(&p.StartupJitter, "startup-jitter", defaults.StartupJitter, "If > 0, sleep a random duration up to this value before pulling jobs, to avoid all the workers of a fleet starting at once.")
 
 	// Verbose
 	f.BoolVar(&p.Verbose, "verbose", defaults.Verbose, "Show more output.")
 
+	// Once
+	f.BoolVar(&p.Once, "once", defaults.Once, "Process the jobs currently in the queue, then exit.")
+	f.DurationVar(&p.OnceIdleWait, "once-idle-wait", defaults.OnceIdleWait, "If > 0, in once-mode, keep polling the queue until it has been empty for this long before exiting, e.g. while the jobs are still being enqueued.")
+	f.DurationVar(&p.IdleBackoffMax, "idle-backoff-max", defaults.IdleBackoffMax, "The maximum delay between the polls of an empty queue, with -once-idle-wait. The delay doubles after each empty poll, and is reset once a job is found.")
+	f.StringVar(&p.Canary, "canary", defaults.Canary, "In -once mode, a test (e.g. 'example.com must run http') which must pass before processing the queued jobs. If it fails, the batch is aborted.")
+
+	// Shadow
+	f.BoolVar(&p.Shadow, "shadow", defaults.Shadow, "Execute tests and record their metrics, but never notify their results.")
+
+	// Results
+	f.BoolVar(&p.RecordStatus, "record-status", defaults.RecordStatus, "Store the latest result of each target in the overseer.status redis hash, which can be shown with the status sub-command.")
+	f.UintVar(&p.SuccessRateWindow, "success-rate-window", defaults.SuccessRateWindow, "If > 0, keep the outcomes of the latest N runs of each test in redis, and add the success rate of the test over them to its results, and to the StatsD metrics.")
+	f.BoolVar(&p.RecordMatrix, "record-matrix", defaults.RecordMatrix, "Store the latest result of each test in the overseer.matrix.<type>.<target> redis hash, in the field named after the -tag of the worker, to compare the results across regions.")
+	f.DurationVar(&p.StatusTTL, "status-ttl", defaults.StatusTTL, "If > 0, periodically remove the entries of the overseer.status hash not updated for this long, e.g. of decommissioned targets, and expire the consecutive failure counts, and the values kept by tests across runs, after it.")
+	f.BoolVar(&p.CoalesceResults, "coalesce-results", defaults.CoalesceResults, "Emit a single notification for a test, summarizing its results against all the addresses of its target, instead of one for each address.")
+	p.RedactPatterns = defaults.RedactPatterns
+	f.Var((*stringsFlag)(&p.RedactPatterns), "redact-pattern", "A regular expression of sensitive text (e.g. tokens) to mask in the errors, details, captures, inputs and targets of results before they are notified. Can be repeated.")
+	f.StringVar(&p.ResultFields, "result-fields", defaults.ResultFields, "If set, a comma-separated list of the only fields (e.g. 'input,target,error') included in the published results, the others being dropped.")
+	f.Float64Var(&p.AnalyticsSampleRate, "analytics-sample-rate", defaults.AnalyticsSampleRate, "If > 0, the fraction (e.g. 0.1) of all the results, passing ones included, published to the analytics queue. Passing results are then no longer published to the results queue, except for recoveries.")
+	f.StringVar(&p.AnalyticsQueue, "analytics-queue", defaults.AnalyticsQueue, "The queue sampled results are published to, for analytics.")
+	f.StringVar(&p.DeadLetterQueue, "dead-letter-queue", defaults.DeadLetterQueue, "If set, the redis queue jobs which cannot be executed (e.g. of a test type unknown to this worker) are pushed to, to be inspected later.")
+	f.StringVar(&p.ProcessingQueue, "processing-queue", defaults.ProcessingQueue, "If set, the redis queue, unique to this worker (e.g. 'overseer.processing.$HOSTNAME'), holding the jobs it is running until their result is notified. The jobs left in it by a crash are requeued on startup.")
+
+	// Metrics
+	f.StringVar(&p.NotifyStatsd, "notify-statsd", defaults.NotifyStatsd, "If set, the address of a StatsD server (e.g. 'localhost:8125') to send a duration timing and a passed/failed counter to, for each result.")
+	f.StringVar(&p.StatsdPrefix, "statsd-prefix", defaults.StatsdPrefix, "The prefix of the StatsD metrics, followed by the type and the target of each test.")
+	f.StringVar(&p.OTLPEndpoint, "otlp-endpoint", defaults.OTLPEndpoint, "If set, the OTLP/HTTP endpoint of an OpenTelemetry collector (e.g. 'http://localhost:4318') to export a trace of each test to, with spans for the DNS resolution and each attempt.")
+
+	// Kafka
+	f.StringVar(&p.NotifyKafka, "notify-kafka", defaults.NotifyKafka, "If set, the comma-separated Kafka brokers (e.g. 'kafka1:9092,kafka2:9092') each result is published to, keyed by its type and target, in addition to the results queue.")
+	f.StringVar(&p.KafkaTopic, "kafka-topic", defaults.KafkaTopic, "The Kafka topic results are published to.")
+	f.BoolVar(&p.KafkaTLS, "kafka-tls", defaults.KafkaTLS, "If true, connect to the Kafka brokers over TLS, verified with -ca-file if given.")
+	f.StringVar(&p.KafkaUsername, "kafka-username", defaults.KafkaUsername, "If set, the username of the SASL/PLAIN login to the Kafka brokers.")
+	f.StringVar(&p.KafkaPassword, "kafka-password", defaults.KafkaPassword, "The password of the SASL/PLAIN login to the Kafka brokers.")
+	f.UintVar(&p.KafkaBuffer, "kafka-buffer", defaults.KafkaBuffer, "The maximum number of results waiting to be published to Kafka, newer ones being dropped, so that Kafka never holds back the tests.")
+
 	// Protocols
 	f.BoolVar(&p.IPv4, "4", defaults.IPv4, "Enable IPv4 tests.")
 	f.BoolVar(&p.IPv6, "6", defaults.IPv6, "Enable IPv6 tests.")
+	f.BoolVar(&p.AllowPortScan, "allow-port-scan", defaults.AllowPortScan, "Allow port-scan tests, which connect to many ports of their targets and could be regarded as attacks.")
+	f.BoolVar(&p.AllowMock, "allow-mock", defaults.AllowMock, "Allow mock tests, which return made up results, e.g. to test the notifications of a deployment in CI.")
+	f.StringVar(&p.K8sAllowedNamespaces, "k8s-allowed-namespaces", defaults.K8sAllowedNamespaces, "If set, a comma-separated list of the only Kubernetes namespaces (e.g. 'default,monitoring') the k8s-svc tests may query, the tests of any other namespace failing without querying the API.")
+	f.StringVar(&p.LocalPortRange, "local-port-range", defaults.LocalPortRange, "If set, the range of the local ports (e.g. '20000-29999') the outbound connections of tests are made from, in turn, instead of the ephemeral ports, to avoid exhausting them under heavy load.")
+	f.BoolVar(&p.AllowHooks, "allow-hooks", defaults.AllowHooks, "Allow hooks, such as -pre-test-hook, which run arbitrary commands on the worker.")
+	f.StringVar(&p.PreTestHook, "pre-test-hook", defaults.PreTestHook, "A shell command run before each test (e.g. to refresh a token file), with its type, target, sanitized input and label in the OVERSEER_TEST_* environment variables. Requires -allow-hooks.")
+	f.BoolVar(&p.PreTestHookOnce, "pre-test-hook-once", defaults.PreTestHookOnce, "Run the pre-test hook once at startup, instead of before each test.")
+	f.BoolVar(&p.PreTestHookAbort, "pre-test-hook-abort", defaults.PreTestHookAbort, "If the pre-test hook fails, fail the test (or exit, with -pre-test-hook-once) instead of only logging the failure.")
+	f.DurationVar(&p.DNSCacheTTL, "dns-cache-ttl", defaults.DNSCacheTTL, "If > 0, cache the addresses of the targets of the tests, shared by all the jobs, for the TTL of their records, capped by this duration.")
+	f.IntVar(&p.DNSCacheSize, "dns-cache-size", defaults.DNSCacheSize, "The maximum number of targets whose addresses are cached, with -dns-cache-ttl, the least recently used being evicted first.")
+	f.StringVar(&p.CompareResolvers, "compare-resolvers", defaults.CompareResolvers, "A comma-separated list of DNS resolvers (e.g. '8.8.8.8,10.0.0.2:53'), which must all return the same A/AAAA records for the target of a test, otherwise the test fails.")
 
 	// Timeout
 	f.DurationVar(&p.Timeout, "timeout", defaults.Timeout, "The global timeout for all tests, in seconds.")
+	f.DurationVar(&p.JobDeadline, "job-deadline", defaults.JobDeadline, "If > 0, the maximum total duration of a job, across all of its resolved targets and retries. Once exceeded, the remaining attempts are skipped and the test fails.")
+
+	// TLS
+	f.StringVar(&p.CAFile, "ca-file", defaults.CAFile, "A PEM bundle of additional certificate authorities to trust in TLS-capable tests, e.g. for an internal PKI.")
 
 	// Retry
 	f.BoolVar(&p.Retry, "retry", defaults.Retry, "Should failing tests be retried a few times before raising a notification.")
-	f.UintVar(&p.RetryCount, "retry-count", defaults.RetryCount, "How many times to retry a test, before regarding it as a failure.")
+	f.UintVar(&p.RetryCount, "retry-count", defaults.RetryCount, "How many times to retry a failing test, after its first attempt, before regarding it as a failure.")
 	f.DurationVar(&p.RetryDelay, "retry-delay", defaults.RetryDelay, "The time to sleep between failing tests.")
+	f.BoolVar(&p.RetryBackoff, "retry-backoff", defaults.RetryBackoff, "If true, double the time to sleep between failing tests after each attempt, e.g. 5s, 10s, 20s...")
+	f.DurationVar(&p.RetryMaxDelay, "retry-max-delay", defaults.RetryMaxDelay, "If > 0, the maximum time to sleep between failing tests, with -retry-backoff.")
+	f.DurationVar(&p.RetryJitter, "retry-jitter", defaults.RetryJitter, "If > 0, add a random duration up to this value to each sleep between failing tests, so that workers don't retry in lockstep.")
 
 	f.DurationVar(&p.DedupDuration, "dedup", defaults.DedupDuration, "The maximum duration of a deduplication.")
 	f.DurationVar(&p.MinDuration, "min-duration", defaults.MinDuration, "The minimum duration of an error, for it to generate an alert.")
 	f.UintVar(&p.MinDurationCacheFactor, "min-duration-cache-factor", defaults.MinDurationCacheFactor,
 		"The lifetime factor for a min-duration error, for it to be reset (e.g. min-duration=2sec, min-duration-cache-factor=10 -> if an error is thrown after 20sec, it will be again considered like a first-time error).")
+	f.UintVar(&p.FailuresBeforeNotify, "failures-before-notify", defaults.FailuresBeforeNotify,
+		"The number of consecutive failed runs of a test (across separate scheduled runs) needed before a failure is notified. A passing run resets the count.")
 
 	// Redis
 	f.StringVar(&p.RedisHost, "redis-host", defaults.RedisHost, "Specify the address of the redis queue.")
 	f.IntVar(&p.RedisDB, "redis-db", defaults.RedisDB, "Specify the database-number for redis.")
 	f.StringVar(&p.RedisPassword, "redis-pass", defaults.RedisPassword, "Specify the password for the redis queue.")
+	f.StringVar(&p.RedisURL, "redis-url", defaults.RedisURL, "If set, a redis://[:password@]host[:port][/db] URL, or rediss:// for TLS, overriding -redis-host, -redis-db and -redis-pass.")
 	f.StringVar(&p.RedisSocket, "redis-socket", defaults.RedisSocket, "If set, will be used for the redis connections.")
 	f.DurationVar(&p.RedisDialTimeout, "redis-timeout", defaults.RedisDialTimeout, "Redis connection timeout.")
+	f.BoolVar(&p.RedisSentinel, "redis-sentinel", defaults.RedisSentinel, "If true, -redis-host is a comma-separated list of the Sentinel addresses monitoring the master named by -redis-master-name, which is followed across failovers.")
+	f.StringVar(&p.RedisMasterName, "redis-master-name", defaults.RedisMasterName, "The name of the master monitored by the sentinels, with -redis-sentinel.")
+	f.BoolVar(&p.RedisTLS, "redis-tls", defaults.RedisTLS, "If true, connect to redis over TLS, e.g. through a TLS-terminating proxy.")
+	f.StringVar(&p.RedisTLSCA, "redis-tls-ca", defaults.RedisTLSCA, "A PEM bundle of additional certificate authorities to verify redis with, with -redis-tls.")
+	f.StringVar(&p.RedisTLSCert, "redis-tls-cert", defaults.RedisTLSCert, "The PEM client certificate to present to redis, for mutual TLS, along with -redis-tls-key.")
+	f.StringVar(&p.RedisTLSKey, "redis-tls-key", defaults.RedisTLSKey, "The PEM key of the -redis-tls-cert client certificate.")
+	f.BoolVar(&p.RedisTLSSkipVerify, "redis-tls-skip-verify", defaults.RedisTLSSkipVerify, "If true, don't verify the certificate of redis, e.g. self-signed in development clusters.")
+	f.StringVar(&p.RedisFallbackHost, "redis-fallback-host", defaults.RedisFallbackHost, "If set, the address of a warm standby redis, where results are buffered while the primary redis is unreachable, and periodically moved back to it once it recovers.")
+	f.StringVar(&p.JobsQueue, "jobs-queue", defaults.JobsQueue, "The queue jobs are pulled from, e.g. to run several deployments against the same redis. It must match the -jobs-queue of the enqueue command.")
+	f.StringVar(&p.ResultsQueue, "results-queue", defaults.ResultsQueue, "The queue test results are published to (default '"+defaultResultQueue+"'). The placeholders {type}, {tag} and {severity} are replaced with the values of each result, e.g. 'overseer.results.{type}'.")
+	f.StringVar(&p.ResultQueueTemplate, "result-queue-template", defaults.ResultQueueTemplate, "Deprecated, use -results-queue, which takes precedence over it.")
 
 	// Tag
 	f.StringVar(&p.Tag, "tag", defaults.Tag, "Specify the tag to add to all test-results.")
@@ -246,8 +547,49 @@ func (p *workerCmd) SetFlags(f *flag.FlagSet) {
 	f.Var(utils.NewPercentageValue(defaults.PeriodTestThreshold, &p.PeriodTestThreshold), "period-test-threshold", "The percentage of failures need to trigger an alert in a period-test.")
 }
 
+// testOutcome contains the optional data gathered while executing a
+// test, which is included in its result.
+type testOutcome struct {
+	// Result details, e.g. the errors of a period-test
+	Details *string
+
+	// Values captured from the response of the target
+	Captures map[string]string
+
+	// Metadata about the test, from the protocol-tests providing it
+	Metadata map[string]interface{}
+
+	// How long the test took, including its retries
+	Duration time.Duration
+
+	// How many attempts the test took, and how long the final one took
+	Attempts    uint
+	LastAttempt time.Duration
+
+	// How the failure was classified, e.g. after testing the control-target
+	Classification string
+}
+
+// Classifications of a failed test
+const (
+	// The control-target passed, so the target is at fault
+	classificationFailed = "failed"
+
+	// The control-target failed too, so our network is at fault
+	classificationNetworkIssue = "network-issue"
+
+	// The job deadline was exceeded before the test could pass
+	classificationTimeout = "failed-timeout"
+
+	// The test was not run, as a test it depends on is failing
+	classificationSkippedDependency = "skipped-dependency"
+
+	// The test was not run, as its target is silenced
+	classificationSilenced = "silenced"
+)
+
 // notify is used to store the result of a test in our redis queue.
-func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultError error, details *string) error {
+func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultError error, outcome *testOutcome) error {
 
 	//
 	// If we don't have a redis-server then return immediately.
@@ -259,6 +601,28 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 		return nil
 	}
 
+	//
+	// Metrics are sent for every result, like the Graphite ones, even
+	// if it is not notified.
+	//
+	if p._statsd != nil {
+		var duration time.Duration
+		if outcome != nil {
+			duration = outcome.Duration
+		}
+		target := redactString(testDefinition.Target, p._redact)
+		p._statsd.emit(p.statsdLines(p._statsd.prefix, testDefinition.Type, target, duration, resultError != nil))
+	}
+
+	//
+	// Shadow tests are run to gauge their noise, without alerting.
+	//
+	if p.Shadow || testDefinition.Shadow {
+		p.verbose(fmt.Sprintf("Skipping notification (shadow mode) for test `%s` (%s), error: %v\n",
+			testDefinition.Input, testDefinition.Target, resultError))
+		return nil
+	}
+
 	//
 	// The message we'll publish will be a JSON hash
 	//
@@ -268,9 +632,26 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 		Time:       time.Now().Unix(),
 		Type:       testDefinition.Type,
 		Tag:        p.Tag,
-		Details:    details,
 		UniqueHash: uniqueHash,
 		TestLabel:  testDefinition.TestLabel,
+		Severity:   testDefinition.Severity,
+		Tags:       testDefinition.Tags,
+
+		Informational: testDefinition.Informational,
+		Worker:        p._hostname,
+	}
+
+	if testResult.Severity == "" {
+		testResult.Severity = test.DefaultSeverity
+	}
+
+	if outcome != nil {
+		testResult.Details = outcome.Details
+		testResult.Captures = outcome.Captures
+		testResult.Metadata = outcome.Metadata
+		testResult.Classification = outcome.Classification
+		testResult.Attempts = outcome.Attempts
+		testResult.DurationMs = int64(outcome.LastAttempt / time.Millisecond)
 	}
 
 	//
@@ -281,10 +662,57 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 	if resultError != nil {
 		errorString := resultError.Error()
 		testResult.Error = &errorString
+
+		//
+		// Failures outside of the notification hours of the test must
+		// not page anyone.
+		//
+		if testDefinition.NotifyHours != nil && !testDefinition.NotifyHours.Contains(p.now()) {
+			p.verbose(fmt.Sprintf("Notifying as informational (outside of %s) the failure of test `%s` (%s)\n",
+				testDefinition.NotifyHours, testDefinition.Input, testDefinition.Target))
+			testResult.Informational = true
+		}
+	}
+
+	// Mask any sensitive text, before the result is stored or sent anywhere
+	redactResult(testResult, p._redact)
+
+	// The success rate covers every run, whatever is notified
+	if p.SuccessRateWindow > 0 {
+		p.updateSuccessRate(testDefinition, testResult)
+	}
+
+	// Keep track of the latest status of each target, whatever is notified
+	if p.RecordStatus {
+		p.recordStatus(testResult)
+	}
+	if p.RecordMatrix {
+		p.recordMatrix(testResult)
+	}
+
+	// Trends are analysed on the raw results, before any smoothing
+	if p._analytics != nil {
+		p.publishAnalytics(testResult)
 	}
 
 	now := time.Now()
 
+	// If we require consecutive failures, avoid triggering a notification until enough runs have failed.
+	if p.FailuresBeforeNotify > 1 {
+		hash := testResult.Hash()
+
+		if testResult.Error != nil {
+			failures := p.incrConsecutiveFailures(hash)
+			if failures < int64(p.FailuresBeforeNotify) {
+				p.verbose(fmt.Sprintf("Skipping notification (consecutive failures %d/%d) for test `%s` (%s)\n",
+					failures, p.FailuresBeforeNotify, testDefinition.Input, testDefinition.Target))
+				return nil
+			}
+		} else {
+			p.clearConsecutiveFailures(hash)
+		}
+	}
+
 	// If test has a min duration rule, avoid triggering a notification if not needed, or clean the min duration cache if needed.
 	if testDefinition.MinDuration != nil {
 		minDurationSeconds := int64(*testDefinition.MinDuration / time.Second)
@@ -426,6 +854,14 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 
 	}
 
+	//
+	// With analytics enabled, passing results are only published to the
+	// analytics queue, leaving the results queue to the alerting.
+	//
+	if p._analytics != nil && !alertingResult(testResult) {
+		return nil
+	}
+
 	//
 	// Convert the test result to a JSON string we can notify.
 	//
@@ -435,10 +871,23 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 		return err
 	}
 
+	// Keep the payload to the fields the consumers expect
+	if p._resultFields != nil {
+		if j, err = filterResultFields(j, p._resultFields); err != nil {
+			fmt.Printf("Failed to filter the fields of the test-result: %s\n", err.Error())
+			return err
+		}
+	}
+
+	// Stream the result, without waiting for Kafka
+	if p._kafka != nil {
+		p._kafka.publish(statusField(testResult), j)
+	}
+
 	//
 	// Publish the message to the queue.
 	//
-	_, err = p._r.RPush("overseer.results", j).Result()
+	err = p.publishResult(p.resultQueue(testResult), j)
 	if err != nil {
 		fmt.Printf("Result addition failed: %s\n", err)
 		return err
@@ -447,6 +896,42 @@ func (p *workerCmd) notify(testDefinition test.Test, uniqueHash *string, resultE
 	return nil
 }
 
+func (p *workerCmd) getConsecutiveFailuresKey(hash string) string {
+	return fmt.Sprintf("overseer.consecutive-failures.%s", hash)
+}
+
+func (p *workerCmd) incrConsecutiveFailures(hash string) int64 {
+	if p._r == nil {
+		return 0
+	}
+
+	cacheKey := p.getConsecutiveFailuresKey(hash)
+	failures, err := p._r.Incr(cacheKey).Result()
+	if err != nil {
+		fmt.Printf("Failed to increment consecutive failures key: %s\n", err)
+		return 0
+	}
+
+	// Don't keep counting the failures of tests which are no longer run
+	if p.StatusTTL > 0 {
+		p._r.Expire(cacheKey, p.StatusTTL)
+	}
+
+	return failures
+}
+
+func (p *workerCmd) clearConsecutiveFailures(hash string) {
+	if p._r == nil {
+		return
+	}
+
+	cacheKey := p.getConsecutiveFailuresKey(hash)
+	_, err := p._r.Del(cacheKey).Result()
+	if err != nil {
+		fmt.Printf("Failed to clear consecutive failures key: %s\n", err)
+	}
+}
+
 func (p *workerCmd) getDeduplicationCacheKey(hash string) string {
 	return fmt.Sprintf("overseer.dedup-cache.%s", hash)
 }
@@ -686,13 +1171,156 @@ func (p *workerCmd) formatMetrics(tst test.Test, key string) string {
 	return prefix + tst.Type + "." + p.alphaNumeric(tst.Target) + "." + key
 }
 
+// notifyFunc is the signature of the function receiving the result of
+// each executed test, normally workerCmd.notify.
+type notifyFunc func(testDefinition test.Test, uniqueHash *string, resultError error, outcome *testOutcome) error
+
+// enabledAddresses returns the addresses of the families which are not
+// disabled.
+func (p *workerCmd) enabledAddresses(ips []net.IP) []string {
+	var addresses []string
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if p.IPv4 {
+				addresses = append(addresses, ip.String())
+			}
+		}
+		if ip.To16() != nil && ip.To4() == nil {
+			if p.IPv6 {
+				addresses = append(addresses, ip.String())
+			}
+		}
+	}
+	return addresses
+}
+
+// lookupIP resolves the given hostname to its IP addresses.
+func (p *workerCmd) lookupIP(host string) ([]net.IP, error) {
+	if p._lookupIP != nil {
+		return p._lookupIP(host)
+	}
+	if p._dnsCache != nil {
+		return p._dnsCache.lookup(host)
+	}
+	return net.LookupIP(host)
+}
+
+// now returns the current time.
+func (p *workerCmd) now() time.Time {
+	if p._now != nil {
+		return p._now()
+	}
+	return time.Now()
+}
+
+// sleep pauses for the given duration.
+func (p *workerCmd) sleep(d time.Duration) {
+	if p._sleep != nil {
+		p._sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+// workerContext returns the parent of the contexts of the tests, which is
+// cancelled by the second signal to abort them.
+func (p *workerCmd) workerContext() context.Context {
+	if p._ctx != nil {
+		return p._ctx
+	}
+	return context.Background()
+}
+
+// testContext returns the context of an attempt of a test, cancelled
+// once its timeout, or the longer duration of a long test, elapses, or
+// with its parent.
+func testContext(parent context.Context, handler protocols.ProtocolTest, tst test.Test, opts test.Options) (context.Context, context.CancelFunc) {
+	if opts.Timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	timeout := opts.Timeout
+	if long, ok := handler.(protocols.LongTest); ok && long.MaxDuration(tst, opts) > timeout {
+		timeout = long.MaxDuration(tst, opts)
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// runProtocolTest runs the test via the given handler, returning any
+// captured values, and metadata, if the handler supports them.
+func runProtocolTest(parent context.Context, handler protocols.ProtocolTest, tst test.Test, target string, opts test.Options) (map[string]string, map[string]interface{}, error) {
+	ctx, cancel := testContext(parent, handler, tst, opts)
+	defer cancel()
+
+	if _, ok := handler.(protocols.DetailedTest); !ok {
+		if capturer, ok := handler.(protocols.CaptureTest); ok {
+			captures, err := capturer.RunTestCapture(ctx, tst, target, opts)
+			return captures, nil, err
+		}
+	}
+
+	metadata, err := protocols.Detailed(handler).RunTestDetailed(ctx, tst, target, opts)
+	captures, _ := metadata[protocols.CapturesDetail].(map[string]string)
+	delete(metadata, protocols.CapturesDetail)
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+	return captures, metadata, err
+}
+
 // runTest is really the core of our application, as it is responsible
 // for receiving a test to execute, executing it, and then issuing
 // the notification with the result.
 func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) error {
+	if p.CoalesceResults {
+		return p.runTestCoalesced(workerIdx, tst, opts)
+	}
+	return p.executeTest(workerIdx, tst, opts, p.notify)
+}
+
+// executeSilently executes a test without notifying its result, and
+// returns an error if it failed against any of its targets.
+func (p *workerCmd) executeSilently(workerIdx uint, tst test.Test, opts test.Options) error {
+	lock := &sync.Mutex{}
+	var failure error
+
+	err := p.executeTest(workerIdx, tst, opts, func(_ test.Test, _ *string, resultError error, _ *testOutcome) error {
+		if resultError != nil {
+			lock.Lock()
+			failure = resultError
+			lock.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return failure
+}
+
+// executeTest executes a test against all of its targets, passing the
+// result for each of them to the given notification function.
+func (p *workerCmd) executeTest(workerIdx uint, tst test.Test, opts test.Options, notify notifyFunc) error {
 
 	workerPrefix := fmt.Sprintf("[W%d] ", workerIdx)
 
+	// Trace the test, and its results, if enabled
+	tracing := p.startTrace(tst)
+	defer tracing.finish()
+	notify = tracing.notifier(notify)
+
+	// The deadline of the whole job, across all of its targets and retries
+	var jobDeadline time.Time
+	if p.JobDeadline > 0 {
+		jobDeadline = time.Now().Add(p.JobDeadline)
+	}
+
+	// If the test has its own timeout, it overrides the worker one
+	if tst.Timeout != nil {
+		opts.Timeout = *tst.Timeout
+	}
+
 	// Create a map for metric-recording.
 	metricsLock := new(sync.Mutex)
 	metrics := map[string]string{}
@@ -725,6 +1353,61 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 	// Look for a suitable protocol handler
 	//
 	tmp := protocols.ProtocolHandler(testType)
+	if tmp == nil {
+		err := fmt.Errorf("unknown test type '%s'", testType)
+
+		job := tst.Input
+		tst.Input = tst.Sanitize()
+		if job == "" {
+			job = tst.Input
+		}
+		notify(tst, nil, err, nil)
+		p.deadLetterJob(job, err)
+
+		fmt.Printf(workerPrefix+"WARNING: %s\n", err.Error())
+		return err
+	}
+
+	//
+	// Don't run, nor alert about, the tests of silenced targets, e.g.
+	// during incidents or maintenances.
+	//
+	if err := p.silenced(tst); err != nil {
+		tst.Input = tst.Sanitize()
+		tst.Informational = true
+		notify(tst, nil, err, &testOutcome{Classification: classificationSilenced})
+
+		p.verbose(fmt.Sprintf(workerPrefix+"Skipping '%s' test against %s: %s\n", testType, testTarget, err.Error()))
+		return nil
+	}
+
+	//
+	// Don't run the test if a test it depends on is failing, to avoid
+	// a cascade of failures with the same cause.
+	//
+	if tst.DependsOn != nil {
+		if err := p.dependencyFailure(*tst.DependsOn); err != nil {
+			tst.Input = tst.Sanitize()
+			notify(tst, nil, err, &testOutcome{Classification: classificationSkippedDependency})
+
+			p.verbose(fmt.Sprintf(workerPrefix+"Skipping '%s' test against %s: %s\n", testType, testTarget, err.Error()))
+			return nil
+		}
+	}
+
+	//
+	// Run the setup steps of the test, if any.
+	//
+	if p.PreTestHook != "" && !p.PreTestHookOnce {
+		if err := p.runPreTestHook(&tst); err != nil {
+			fmt.Printf(workerPrefix+"WARNING: '%s' test against %s: %s\n", testType, testTarget, err.Error())
+			if p.PreTestHookAbort {
+				tst.Input = tst.Sanitize()
+				notify(tst, nil, err, nil)
+				return err
+			}
+		}
+	}
 
 	//
 	// Each test will be executed for each address-family, so we need to
@@ -747,11 +1430,26 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 			testTarget = u.Hostname()
 		}
 
+		//
+		// If we're checking the consistency of DNS, all the resolvers
+		// must agree on the addresses of the target.
+		//
+		if p.CompareResolvers != "" && net.ParseIP(testTarget) == nil {
+			if err := compareResolvers(testTarget, parseResolvers(p.CompareResolvers), p.IPv4, p.IPv6, p.Timeout); err != nil {
+				tst.Input = tst.Sanitize()
+				notify(tst, nil, err, nil)
+
+				fmt.Printf(workerPrefix+"WARNING: %s\n", err.Error())
+				return err
+			}
+		}
+
 		// Record the time before we lookup our targets IPs.
 		timeA := time.Now()
 
 		// Now resolve the target to IPv4 & IPv6 addresses.
-		ips, err := net.LookupIP(testTarget)
+		ips, err := p.lookupIP(testTarget)
+		tracing.resolved(testTarget, timeA, len(ips), err)
 		if err != nil {
 
 			//
@@ -764,7 +1462,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 			//
 			// Notify the world about our DNS-failure.
 			//
-			p.notify(tst, nil, fmt.Errorf("failed to resolve name %s", testTarget), nil)
+			notify(tst, nil, fmt.Errorf("failed to resolve name %s", testTarget), nil)
 
 			//
 			// Otherwise we're done.
@@ -789,18 +1487,7 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		//
 		// Save the results in our `targets` array, unless disabled.
 		//
-		for _, ip := range ips {
-			if ip.To4() != nil {
-				if p.IPv4 {
-					targets = append(targets, ip.String())
-				}
-			}
-			if ip.To16() != nil && ip.To4() == nil {
-				if p.IPv6 {
-					targets = append(targets, ip.String())
-				}
-			}
-		}
+		targets = p.enabledAddresses(ips)
 
 	} else {
 		// Directly pass the original target
@@ -810,10 +1497,35 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 	if tst.MaxTargetsCount > 0 && len(targets) > tst.MaxTargetsCount {
 		// By sorting we have a higher chance of targeting the same target
 		sort.Strings(targets)
+	}
+
+	// The preferred address-family is tested first, and kept first
+	targets = preferFamily(targets, tst.PreferFamily)
+
+	if tst.MaxTargetsCount > 0 && len(targets) > tst.MaxTargetsCount {
 		targets = targets[:tst.MaxTargetsCount]
 	}
 
-	testEndFn := func(startTime time.Time, target string, attempts uint, result error, details *string) {
+	// The failure of the test against any of its targets, for the tests
+	// depending on it
+	failureLock := new(sync.Mutex)
+	var failedTarget string
+	var failure error
+
+	var testEndFn testEndFunc = func(startTime time.Time, target string, attempts uint, result error, outcome *testOutcome) {
+		// The test was aborted, as the worker is exiting: its failure
+		// says nothing about the target
+		if p.workerContext().Err() != nil {
+			p.verbose(fmt.Sprintf(workerPrefix+"Test aborted against %s, not notifying its result\n", target))
+			return
+		}
+
+		if result != nil {
+			failureLock.Lock()
+			failedTarget, failure = target, result
+			failureLock.Unlock()
+		}
+
 		//
 		// Now the test is complete we can record the time it
 		// took to carry out, and the number of attempts it
@@ -850,184 +1562,296 @@ func (p *workerCmd) runTest(workerIdx uint, tst test.Test, opts test.Options) er
 		//
 		tstCopy.Input = tst.Sanitize()
 
+		if outcome == nil {
+			outcome = &testOutcome{}
+		}
+		outcome.Duration = duration
+		outcome.Attempts = attempts
+		if outcome.LastAttempt == 0 {
+			outcome.LastAttempt = duration
+		}
+
 		//
 		// Now we can trigger the notification with our updated
 		// copy of the test.
 		//
-		p.notify(tstCopy, tmp.GetUniqueHashForTest(tstCopy, opts), result, details)
+		notify(tstCopy, tmp.GetUniqueHashForTest(tstCopy, opts), result, outcome)
 	}
 
-	wg := &sync.WaitGroup{}
+	//
+	// If the test fails, its control-target is tested (once for all the
+	// targets) to tell whether the target is down, or our network is.
+	//
+	var controlOnce sync.Once
+	var classification string
+	classifyFailure := func() string {
+		controlOnce.Do(func() {
+			classification = p.testControlTarget(workerIdx, tst, opts)
+		})
+		return classification
+	}
 
 	//
-	// Now for each target, run the test.
+	// Run the test against a target, handing its result to the end
+	// function.
 	//
-	for _, target := range targets {
-		wg.Add(1)
-		go func() {
+	runTarget := func(target string, end testEndFunc) {
+
+		// Is this a period test?
+		if tst.PeriodTestDuration != nil {
+			periodTestDuration := *tst.PeriodTestDuration
+			periodTestSleep := tst.PeriodTestSleep
+			if periodTestSleep == 0 {
+				periodTestSleep = p.PeriodTestSleep
+			}
+			periodTestThreshold := p.PeriodTestThreshold
+			if tst.PeriodTestThreshold != nil {
+				periodTestThreshold = *tst.PeriodTestThreshold
+			}
 
-			// Is this a period test?
-			if tst.PeriodTestDuration != nil {
-				periodTestDuration := *tst.PeriodTestDuration
-				periodTestSleep := tst.PeriodTestSleep
-				if periodTestSleep == 0 {
-					periodTestSleep = p.PeriodTestSleep
-				}
-				periodTestThreshold := p.PeriodTestThreshold
-				if tst.PeriodTestThreshold != nil {
-					periodTestThreshold = *tst.PeriodTestThreshold
+			p.verbose(fmt.Sprintf(workerPrefix+"Running '%s' period-test (duration: %s, sleep: %s, threshold: %.0f%%) against %s (%s)\n", testType, periodTestDuration, periodTestSleep, periodTestThreshold, testTarget, target))
+
+			// Start time
+			timeStart := time.Now()
+			timeEnd := timeStart.Add(periodTestDuration)
+
+			var countSuccess uint = 0
+			var countFail uint = 0
+
+			iteration := 0
+			var errorStrings []string
+			for time.Now().Before(timeEnd) {
+				iteration++
+				iterationStartTime := time.Now()
+
+				// Copy opts
+				currentOpts := opts
+				currentOpts.PeriodTestIndex = iteration
+				currentOpts.PeriodTestStartTime = iterationStartTime.UnixNano() / int64(time.Millisecond)
+				ctx, cancel := testContext(p.workerContext(), tmp, tst, currentOpts)
+				err := expectedResult(tst, tmp.RunTest(ctx, tst, target, currentOpts))
+				cancel()
+
+				iterationDuration := time.Since(iterationStartTime)
+				iterationElapsedString := fmt.Sprintf("%.2fms", float64(iterationDuration)/float64(time.Millisecond))
+				if err != nil {
+					countFail++
+					p.verbose(fmt.Sprintf(workerPrefix+"Period-test (test %d failed, took %s): %s\n", iteration, iterationElapsedString, err.Error()))
+					errString := fmt.Sprintf("test %d failed, took %s: %s", iteration, iterationElapsedString, err.Error())
+					errorStrings = append(errorStrings, errString)
+				} else {
+					countSuccess++
+					p.verbose(fmt.Sprintf(workerPrefix+"Period-test (test %d success, took %s)\n", iteration, iterationElapsedString))
 				}
 
-				p.verbose(fmt.Sprintf(workerPrefix+"Running '%s' period-test (duration: %s, sleep: %s, threshold: %.0f%%) against %s (%s)\n", testType, periodTestDuration, periodTestSleep, periodTestThreshold, testTarget, target))
-
-				// Start time
-				timeStart := time.Now()
-				timeEnd := timeStart.Add(periodTestDuration)
-
-				var countSuccess uint = 0
-				var countFail uint = 0
-
-				iteration := 0
-				var errorStrings []string
-				for time.Now().Before(timeEnd) {
-					iteration++
-					iterationStartTime := time.Now()
-
-					// Copy opts
-					currentOpts := opts
-					currentOpts.PeriodTestIndex = iteration
-					currentOpts.PeriodTestStartTime = iterationStartTime.UnixNano() / int64(time.Millisecond)
-					err := tmp.RunTest(tst, target, currentOpts)
-
-					iterationDuration := time.Since(iterationStartTime)
-					iterationElapsedString := fmt.Sprintf("%.2fms", float64(iterationDuration)/float64(time.Millisecond))
-					if err != nil {
-						countFail++
-						p.verbose(fmt.Sprintf(workerPrefix+"Period-test (test %d failed, took %s): %s\n", iteration, iterationElapsedString, err.Error()))
-						errString := fmt.Sprintf("test %d failed, took %s: %s", iteration, iterationElapsedString, err.Error())
-						errorStrings = append(errorStrings, errString)
-					} else {
-						countSuccess++
-						p.verbose(fmt.Sprintf(workerPrefix+"Period-test (test %d success, took %s)\n", iteration, iterationElapsedString))
-					}
+				time.Sleep(periodTestSleep)
+			}
+
+			totalAttempts := countFail + countSuccess
 
-					time.Sleep(periodTestSleep)
+			errPercentage := float32(countFail) / float32(totalAttempts)
+			var result error
+			var failuresString *string
+			if len(errorStrings) > 0 {
+				var lines []string
+				for _, errorString := range errorStrings {
+					lines = append(lines, fmt.Sprintf("- %s", errorString))
 				}
+				output := fmt.Sprintf("Period-test errors:\n%s", strings.Join(lines, "\n"))
+				failuresString = &output
+			}
+			if errPercentage > periodTestThreshold {
+				result = fmt.Errorf("%d tests failed out of %d (%.2f%%)", countFail, totalAttempts, errPercentage*100)
+				p.verbose(fmt.Sprintf(workerPrefix+"Test failed: %s\n", result.Error()))
+			} else {
+				p.verbose(fmt.Sprintf(workerPrefix+"Test passed: %d tests failed out of %d (%.2f%%)\n", countFail, totalAttempts, errPercentage*100))
+			}
 
-				totalAttempts := countFail + countSuccess
+			end(timeStart, target, totalAttempts, result, &testOutcome{Details: failuresString})
+			return
+		}
 
-				errPercentage := float32(countFail) / float32(totalAttempts)
-				var result error
-				var failuresString *string
-				if len(errorStrings) > 0 {
-					var lines []string
-					for _, errorString := range errorStrings {
-						lines = append(lines, fmt.Sprintf("- %s", errorString))
-					}
-					output := fmt.Sprintf("Period-test errors:\n%s", strings.Join(lines, "\n"))
-					failuresString = &output
-				}
-				if errPercentage > periodTestThreshold {
-					result = fmt.Errorf("%d tests failed out of %d (%.2f%%)", countFail, totalAttempts, errPercentage*100)
-					p.verbose(fmt.Sprintf(workerPrefix+"Test failed: %s\n", result.Error()))
-				} else {
-					p.verbose(fmt.Sprintf(workerPrefix+"Test passed: %d tests failed out of %d (%.2f%%)\n", countFail, totalAttempts, errPercentage*100))
-				}
+		p.verbose(fmt.Sprintf(workerPrefix+"Running '%s' test against %s (%s)\n", testType, testTarget, target))
 
-				testEndFn(timeStart, target, totalAttempts, result, failuresString)
-				wg.Done()
-				return
-			}
+		//
+		// We'll repeat failing tests up to four times by default,
+		// for five attempts
+		//
+		var attempt uint = 0
+		var maxAttempts uint = p.RetryCount + 1
 
-			p.verbose(fmt.Sprintf(workerPrefix+"Running '%s' test against %s (%s)\n", testType, testTarget, target))
+		//
+		// The test can override the global retry settings, and
+		// defining its number of retries implies retrying.
+		//
+		retry := p.Retry
+		if tst.Retry != nil {
+			retry = *tst.Retry
+		}
 
-			//
-			// We'll repeat failing tests up to five times by default
-			//
-			var attempt uint = 0
-			var maxAttempts uint = p.RetryCount
+		//
+		// If retrying is disabled then don't retry.
+		//
+		if !retry {
+			maxAttempts = attempt + 1
+		}
+
+		if tst.MaxRetries != nil {
+			maxAttempts = *tst.MaxRetries + 1
+		}
+
+		//
+		// The result of the test.
+		//
+		var result error
+
+		//
+		// Any values captured from the response of the target.
+		//
+		var captures map[string]string
+		var metadata map[string]interface{}
+
+		//
+		// How long the final attempt took.
+		//
+		var lastAttempt time.Duration
+
+		//
+		// Record the start-time of the test.
+		//
+		timeA := time.Now()
+
+		//
+		// Start the count here for graphing execution attempts.
+		//
+		var c uint = 0
+
+		//
+		// Prepare to repeat the test.
+		//
+		// We only repeat tests that fail, if the test passes then
+		// it will only be executed once.
+		//
+		// This is designed to cope with transient failures, at a
+		// cost that flapping services might be missed.
+		//
+		deadlineExceeded := false
+		for attempt < maxAttempts {
 
 			//
-			// If retrying is disabled then don't retry.
+			// Never let an attempt run past the deadline of the job.
 			//
-			if !p.Retry {
-				maxAttempts = attempt + 1
+			attemptOpts := opts
+			if !jobDeadline.IsZero() {
+				remaining := time.Until(jobDeadline)
+				if remaining <= 0 {
+					deadlineExceeded = true
+					break
+				}
+				if remaining < attemptOpts.Timeout {
+					attemptOpts.Timeout = remaining
+				}
 			}
 
-			if tst.MaxRetries != nil {
-				maxAttempts = *tst.MaxRetries + 1
-			}
+			attempt++
+			c++
 
 			//
-			// The result of the test.
+			// Run the test
 			//
-			var result error
+			attemptStart := time.Now()
+			p._inflight.acquire()
+			captures, metadata, result = runProtocolTest(p.workerContext(), tmp, tst, target, attemptOpts)
+			p._inflight.release()
+			lastAttempt = time.Since(attemptStart)
+
+			if tst.ExpectFailure && result != nil {
+				p.verbose(fmt.Sprintf(workerPrefix+"[%d/%d] Test failed, as expected: %s\n", attempt, maxAttempts, result.Error()))
+			}
+			result = expectedResult(tst, result)
+			tracing.attempt(target, attempt, attemptStart, result)
 
 			//
-			// Record the start-time of the test.
+			// If the test passed then we're good.
 			//
-			timeA := time.Now()
+			if result == nil {
+				p.verbose(fmt.Sprintf(workerPrefix+"[%d/%d] - Test passed.\n", attempt, maxAttempts))
 
-			//
-			// Start the count here for graphing execution attempts.
-			//
-			var c uint = 0
+				// break out of loop
+				attempt = maxAttempts + 1
 
-			//
-			// Prepare to repeat the test.
-			//
-			// We only repeat tests that fail, if the test passes then
-			// it will only be executed once.
-			//
-			// This is designed to cope with transient failures, at a
-			// cost that flapping services might be missed.
-			//
-			for attempt < maxAttempts {
-				attempt++
-				c++
+			} else {
 
 				//
-				// Run the test
-				//
-				result = tmp.RunTest(tst, target, opts)
-
+				// The test failed.
 				//
-				// If the test passed then we're good.
+				// It will be repeated before a notifier
+				// is invoked.
 				//
-				if result == nil {
-					p.verbose(fmt.Sprintf(workerPrefix+"[%d/%d] - Test passed.\n", attempt, maxAttempts))
-
-					// break out of loop
-					attempt = maxAttempts + 1
-
-				} else {
+				p.verbose(fmt.Sprintf(workerPrefix+"[%d/%d] Test failed: %s\n", attempt, maxAttempts, result.Error()))
 
+				// Only wait between attempts: if this was the last
+				// one, notify its failure right away
+				if attempt < maxAttempts {
 					//
-					// The test failed.
+					// Sleep before retrying the failing test.
 					//
-					// It will be repeated before a notifier
-					// is invoked.
-					//
-					p.verbose(fmt.Sprintf(workerPrefix+"[%d/%d] Test failed: %s\n", attempt, maxAttempts, result.Error()))
-
-					// If there are no more retries, do not wait
-					if maxAttempts-attempt > 0 {
-						//
-						// Sleep before retrying the failing test.
-						//
-						p.verbose(fmt.Sprintf(workerPrefix+"Sleeping for %s before retrying\n", p.RetryDelay.String()))
+					delay := p._retryJitter.add(retryDelay(p.RetryDelay, p.RetryBackoff, p.RetryMaxDelay, attempt))
+					p.verbose(fmt.Sprintf(workerPrefix+"Sleeping for %s before retrying\n", delay.String()))
 
-						time.Sleep(p.RetryDelay)
+					if !jobDeadline.IsZero() && time.Until(jobDeadline) < delay {
+						delay = time.Until(jobDeadline)
 					}
+					p.sleep(delay)
 				}
 			}
+		}
+
+		outcome := &testOutcome{Captures: captures, Metadata: metadata, LastAttempt: lastAttempt}
+		if deadlineExceeded {
+			if c == 0 {
+				result = fmt.Errorf("job deadline of %s exceeded, test skipped", p.JobDeadline)
+			} else {
+				result = fmt.Errorf("job deadline of %s exceeded after %d attempts: %s", p.JobDeadline, c, result.Error())
+			}
+			p.verbose(fmt.Sprintf(workerPrefix+"Test failed: %s\n", result.Error()))
+			outcome.Classification = classificationTimeout
+		} else if result != nil && tst.ControlTarget != nil {
+			outcome.Classification = classifyFailure()
+		}
 
-			testEndFn(timeA, target, c, result, nil)
-			wg.Done()
-		}()
+		end(timeA, target, c, result, outcome)
 	}
 
-	wg.Wait()
+	if tst.AnyFamily {
+		p.runTargetsUntilPass(workerPrefix, targets, runTarget, testEndFn)
+	} else if len(tst.Consistency) > 0 {
+		p.runTargetsConsistently(workerPrefix, tst.Consistency, targets, runTarget, testEndFn)
+	} else if tst.MinHealthyIPs > 0 || tst.Threshold != nil {
+		minHealthy := tst.MinHealthyIPs
+		if tst.Threshold != nil {
+			minHealthy = tst.Threshold.Required(len(targets))
+		}
+		p.runTargetsMinHealthy(workerPrefix, tst.Target, minHealthy, targets, runTarget, testEndFn)
+	} else {
+		//
+		// Now for each target, run the test.
+		//
+		wg := &sync.WaitGroup{}
+		for _, target := range targets {
+			target := target
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runTarget(target, testEndFn)
+			}()
+		}
+		wg.Wait()
+	}
+
+	if p.workerContext().Err() == nil {
+		p.recordDependency(tst, failedTarget, failure)
+	}
 
 	//
 	// If we have a metric-host we can now submit each of the values
@@ -1066,11 +1890,75 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 		fmt.Printf("Number of parallel workers must be > 0")
 		return subcommands.ExitFailure
 	}
+	if p.ResultQueueTemplate != "" {
+		fmt.Printf("WARNING: -result-queue-template is deprecated, use -results-queue instead\n")
+	}
+	if err := p.validateQueues(); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if p.RecordMatrix && p.Tag == "" {
+		fmt.Printf("-record-matrix requires a -tag naming the region of the worker\n")
+		return subcommands.ExitFailure
+	}
+	if p.PreTestHook != "" && !p.AllowHooks {
+		fmt.Printf("-pre-test-hook runs arbitrary commands, and requires -allow-hooks\n")
+		return subcommands.ExitFailure
+	}
+	redact, err := compileRedactPatterns(p.RedactPatterns)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	p._redact = redact
+	if p.DNSCacheTTL > 0 {
+		if p.DNSCacheSize < 1 {
+			fmt.Printf("-dns-cache-size must be at least 1\n")
+			return subcommands.ExitFailure
+		}
+		p._dnsCache = newDNSCache(p.DNSCacheTTL, p.DNSCacheSize, lookupIPWithTTL(p.Timeout))
+	}
+	// Identify the worker in its results
+	p._hostname, _ = os.Hostname()
+
+	p._resultFields, err = parseResultFields(p.ResultFields)
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if p.RetryJitter > 0 {
+		p._retryJitter = newRetryJitter(p.RetryJitter, rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
+	if p.AnalyticsSampleRate > 0 {
+		p._analytics, err = newResultSampler(p.AnalyticsSampleRate, rand.New(rand.NewSource(time.Now().UnixNano())))
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	if err = p.applyRedisURL(f); err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+
+	redisTLS, err := p.redisTLSConfig()
+	if err != nil {
+		fmt.Printf("%s\n", err.Error())
+		return subcommands.ExitFailure
+	}
 
 	//
 	// Connect to the redis-host.
 	//
-	if p.RedisSocket != "" {
+	if p.RedisSentinel {
+		failoverOptions, errSentinel := p.redisFailoverOptions(redisTLS)
+		if errSentinel != nil {
+			fmt.Printf("%s\n", errSentinel.Error())
+			return subcommands.ExitFailure
+		}
+		p._r = redis.NewFailoverClient(failoverOptions)
+	} else if p.RedisSocket != "" {
 		p._r = redis.NewClient(&redis.Options{
 			Network:     "unix",
 			Addr:        p.RedisSocket,
@@ -1084,23 +1972,65 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 			Password:    p.RedisPassword,
 			DB:          p.RedisDB,
 			DialTimeout: p.RedisDialTimeout,
+			TLSConfig:   redisTLS,
 		})
 	}
 
 	//
-	// And run a ping, just to make sure it worked.
+	// And run a ping, just to make sure it worked, against the master
+	// resolved by the sentinels if any.
 	//
-	_, err := p._r.Ping().Result()
+	_, err = p._r.Ping().Result()
 	if err != nil {
 		fmt.Printf("Redis connection failed: %s\n", err.Error())
 		return subcommands.ExitFailure
 	}
 
+	//
+	// Connect to the fallback redis-host, if any. It is only needed
+	// when the primary one fails, so it doesn't have to be up now.
+	//
+	if p.RedisFallbackHost != "" {
+		p._fallback = redis.NewClient(&redis.Options{
+			Addr:        p.RedisFallbackHost,
+			Password:    p.RedisPassword,
+			DB:          p.RedisDB,
+			DialTimeout: p.RedisDialTimeout,
+			TLSConfig:   redisTLS,
+		})
+		go p.drainFallbackLoop()
+	}
+
+	// Remove the status of the targets which are no longer tested
+	if p.StatusTTL > 0 {
+		go p.reapStatusLoop()
+	}
+
 	//
 	// Setup our metrics-connection, if enabled
 	//
 	p.MetricsFromEnvironment()
 
+	if p.NotifyStatsd != "" {
+		p._statsd, err = newStatsdEmitter(p.NotifyStatsd, p.StatsdPrefix)
+		if err != nil {
+			fmt.Printf("Failed to setup StatsD metrics: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	if p.OTLPEndpoint != "" {
+		provider, err := newOTLPTracerProvider(p.OTLPEndpoint, p.Timeout)
+		if err != nil {
+			fmt.Printf("Failed to setup the OTLP exporter: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+		p._tracer = provider.Tracer(tracerName)
+
+		// Export the traces of the last tests before exiting
+		defer provider.Shutdown(context.Background())
+	}
+
 	//
 	// Setup the options passed to each test, by copying our
 	// global ones.
@@ -1108,22 +2038,96 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	var opts test.Options
 	opts.Verbose = p.Verbose
 	opts.Timeout = p.Timeout
+	opts.AllowPortScan = p.AllowPortScan
+	opts.AllowMock = p.AllowMock
+	for _, namespace := range strings.Split(p.K8sAllowedNamespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			opts.K8sAllowedNamespaces = append(opts.K8sAllowedNamespaces, namespace)
+		}
+	}
+	opts.State = &redisStateStore{r: p._r, ttl: p.StatusTTL}
+
+	if p.LocalPortRange != "" {
+		opts.LocalPorts, err = parseLocalPortRange(p.LocalPortRange)
+		if err != nil {
+			fmt.Printf("%s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	if p.CAFile != "" {
+		opts.RootCAs, err = utils.LoadCertPool(p.CAFile)
+		if err != nil {
+			fmt.Printf("Failed to load the certificate authorities: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+	}
+
+	if p.NotifyKafka != "" {
+		var tlsConfig *tls.Config
+		if p.KafkaTLS {
+			tlsConfig = &tls.Config{RootCAs: opts.RootCAs}
+		}
+		p._kafka, err = newKafkaSink(p.NotifyKafka, p.KafkaTopic, tlsConfig, p.KafkaUsername, p.KafkaPassword, p.KafkaBuffer, p.Timeout)
+		if err != nil {
+			fmt.Printf("Failed to setup Kafka: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+		go p._kafka.run()
+
+		// Publish the results of the running tests before exiting
+		defer p._kafka.close()
+	}
 
 	//
 	// Create a parser for our input
 	//
 	parse := parser.New()
 
+	// Shrink the pool of workers when the host is under load
+	if p.MaxLoadAvg > 0 {
+		p._loadLimiter = newLoadLimiter(p.MaxLoadAvg, p.Parallel)
+	}
+
+	// Bound the resources used by tests, however many targets they have
+	p._inflight = newInflightLimiter(p.MaxInflight)
+
+	// Run the setup steps shared by all the tests
+	if p.PreTestHook != "" && p.PreTestHookOnce {
+		if err = p.runPreTestHook(nil); err != nil {
+			fmt.Printf("WARNING: %s\n", err.Error())
+			if p.PreTestHookAbort {
+				return subcommands.ExitFailure
+			}
+		}
+	}
+
+	// Avoid a thundering herd when a whole fleet of workers restarts
+	if p.StartupJitter > 0 {
+		delay := jitterDelay(p.StartupJitter, rand.New(rand.NewSource(time.Now().UnixNano())))
+		p.verbose(fmt.Sprintf("Delaying startup by %s\n", delay))
+		time.Sleep(delay)
+	}
+
+	// Requeue the jobs we were running when we last died
+	recovered, err := p.recoverJobs()
+	if err != nil {
+		fmt.Printf("Failed to requeue the jobs of the processing queue: %s\n", err.Error())
+		return subcommands.ExitFailure
+	}
+	if recovered > 0 {
+		fmt.Printf("Requeued %d job(s) left in the processing queue\n", recovered)
+	}
+
+	if p.Once {
+		return p.runOnce(&opts, parse)
+	}
+
 	// We want a graceful shutdown, e.g. if a long-running test is active at the moment we need to wait for it to
-	// complete before brutally exiting!
-	shouldExit := sync.NewCond(&sync.Mutex{})
-	onSignalInterrupt(func() {
-		shouldExit.Broadcast()
-
-		// If there is a second interrupt, immediately exit
-		onSignalInterrupt(func() {
-			os.Exit(0)
-		})
+	// complete, and its result to be notified, before exiting!
+	done := make(chan struct{})
+	p.handleShutdownSignals(func() {
+		close(done)
 	})
 
 	wg := &sync.WaitGroup{}
@@ -1133,7 +2137,7 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			p.workerLoop(workerIdx, shouldExit, &opts, parse)
+			p.workerLoop(workerIdx, done, &opts, parse)
 		}()
 	}
 
@@ -1142,89 +2146,101 @@ func (p *workerCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}
 	return subcommands.ExitSuccess
 }
 
-func (p *workerCmd) workerLoop(workerIdx uint, shouldExit *sync.Cond, opts *test.Options, parse *parser.Parser) {
+// waitForLoad blocks while the load limiter does not allow the worker to
+// pull new jobs. It returns false if the worker should exit instead.
+func (p *workerCmd) waitForLoad(workerIdx uint, done <-chan struct{}) bool {
+	paused := false
+	for !p._loadLimiter.allows(workerIdx) {
+		if !paused {
+			p.verbose(fmt.Sprintf("[W%d] Pausing, host load average is above %.2f\n", workerIdx, p.MaxLoadAvg))
+			paused = true
+		}
+
+		select {
+		case <-done:
+			return false
+		case <-time.After(p._loadLimiter.checkInterval):
+		}
+	}
+
+	if paused {
+		p.verbose(fmt.Sprintf("[W%d] Resuming, host load average is back below %.2f\n", workerIdx, p.MaxLoadAvg))
+	}
+
+	return true
+}
+
+// stopping returns true once the worker has been asked to exit.
+func stopping(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// workerLoop claims jobs and runs them, one at a time, until done is
+// closed.
+//
+// Jobs are claimed with a short timeout, rather than blocking until there
+// is one, so that the worker notices it has to exit: the test it is
+// running, if any, is completed and its result notified first.
+func (p *workerCmd) workerLoop(workerIdx uint, done <-chan struct{}, opts *test.Options, parse *parser.Parser) {
 	fmt.Printf("worker %d started [tag=%s]\n", workerIdx, p.Tag)
 
-	exitLock := &sync.Mutex{}
-	exit := false
-
-	workerAvailableChan := make(chan bool)
-	testObjectChan := make(chan []string)
-
-	go func() {
-		shouldExit.L.Lock()
-		defer shouldExit.L.Unlock()
-		shouldExit.Wait()
-
-		exitLock.Lock()
-		defer exitLock.Unlock()
-		exit = true
-		close(testObjectChan)
-		close(workerAvailableChan)
-	}()
-
-	go func() {
-		for <-workerAvailableChan {
-			exitLock.Lock()
-			if exit {
-				exitLock.Unlock()
-				return
+	for !stopping(done) && p.waitForLoad(workerIdx, done) {
+		// Get a job.
+		testObject, err := p.claimJob()
+		if err != nil {
+			fmt.Printf("Failed to claim a job: %s\n", err.Error())
+			select {
+			case <-done:
+			case <-time.After(claimTimeout):
 			}
-			exitLock.Unlock()
-
-			// Get a job.
-			testObject, _ := p._r.BLPop(0, "overseer.jobs").Result()
-
-			exitLock.Lock()
-			if exit {
-				exitLock.Unlock()
-				if len(testObject) >= 1 {
-					// Requeue! Let's not lose the test
-					if _, err := p._r.RPush("overseer.jobs", testObject[1]).Result(); err != nil {
-						fmt.Printf("failed to requeue job `%s`: %v\n", testObject[1], err)
-					} else {
-						fmt.Printf("job requeued: %s\n", testObject[1])
-					}
-				} else {
-					fmt.Printf("Popped unsupported value: %v\n", testObject)
-				}
-				return
+			continue
+		}
+		if testObject == nil {
+			continue
+		}
+
+		if len(testObject) < 2 {
+			fmt.Printf("Popped unsupported value: %v\n", testObject)
+			continue
+		}
+
+		// We were asked to exit while claiming it, requeue! Let's not
+		// lose the test
+		if stopping(done) {
+			if err = p.releaseJob(testObject[1]); err != nil {
+				fmt.Printf("failed to requeue job `%s`: %v\n", testObject[1], err)
+			} else {
+				fmt.Printf("job requeued: %s\n", testObject[1])
 			}
-			exitLock.Unlock()
-			testObjectChan <- testObject
+			break
 		}
-	}()
 
-	// Wait for jobs
-	workerAvailableChan <- true
-	for testObject := range testObjectChan {
 		//
 		// Parse it
 		//
-		//   testObject[0] will be "overseer.jobs"
+		//   testObject[0] will be the jobs queue
 		//
 		//   testObject[1] will be the value removed from the list.
 		//
-		if len(testObject) >= 1 {
-			var job test.Test
-			job, err := parse.ParseLine(testObject[1], nil)
-
-			if err == nil {
-				p.runTest(workerIdx, job, *opts)
-			} else {
-				fmt.Printf("Error parsing job from queue: %s - %s\n", testObject[1], err.Error())
-			}
+		job, err := parse.ParseLine(testObject[1], nil)
+		if err == nil {
+			p.runTest(workerIdx, job, *opts)
 		} else {
-			fmt.Printf("Popped unsupported value: %v\n", testObject)
+			fmt.Printf("Error parsing job from queue: %s - %s\n", testObject[1], err.Error())
+			p.deadLetterJob(testObject[1], err)
 		}
 
-		exitLock.Lock()
-		if exit {
-			exitLock.Unlock()
+		// An aborted job is left in the processing queue, to be run
+		// again once the worker restarts
+		if p.workerContext().Err() != nil {
 			break
 		}
-		exitLock.Unlock()
-		workerAvailableChan <- true
+		p.completeJob(testObject[1])
 	}
 
 	fmt.Printf("Worker %d exiting\n", workerIdx)
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// newTestWorker returns a worker connected to an in-memory redis server,
+// with retries disabled.
+func newTestWorker(t *testing.T) (*workerCmd, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis server: %s", err)
+	}
+
+	p := &workerCmd{
+		Parallel: 1,
+		IPv4:     true,
+		IPv6:     true,
+		Timeout:  5 * time.Second,
+	}
+	p._r = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	p._signals = make(chan os.Signal, 2)
+
+	return p, server
+}
+
+// testResults returns all the results pushed by the worker.
+func testResults(t *testing.T, p *workerCmd) []string {
+	results, err := p._r.LRange("overseer.results", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("failed to read results: %s", err)
+	}
+	return results
+}
+
+// deref returns the value of an optional field of a result, for messages.
+func deref(value *string) string {
+	if value == nil {
+		return "<nil>"
+	}
+	return *value
+}
+
+func TestRunTestCaptures(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("running version 1.4.2"))
+	}))
+	defer web.Close()
+
+	tst, err := parser.New().ParseLine(web.URL+"/ must run http with pattern 'version (?P<version>[0-9.]+)' with capture version", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+
+	if err = p.runTest(0, tst, test.Options{Timeout: 5 * time.Second}); err != nil {
+		t.Fatalf("failed to run test: %s", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	result, err := test.ResultFromJSON([]byte(results[0]))
+	if err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	if result.Error != nil {
+		t.Fatalf("unexpected failure: %s", *result.Error)
+	}
+	if result.Captures["version"] != "1.4.2" {
+		t.Errorf("expected the captured version in the result, got %v", result.Captures)
+	}
+}
+
+func TestRunTestMetadata(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("running version 1.4.2"))
+	}))
+	defer web.Close()
+
+	tst, err := parser.New().ParseLine(web.URL+"/ must run http with pattern 'version (?P<version>[0-9.]+)' with capture version", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+
+	if err = p.runTest(0, tst, test.Options{Timeout: 5 * time.Second}); err != nil {
+		t.Fatalf("failed to run test: %s", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal([]byte(results[0]), &raw); err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	metadata, _ := raw["metadata"].(map[string]interface{})
+	if metadata["statusCode"] != float64(200) || metadata["bodySize"] != float64(21) {
+		t.Errorf("expected the metadata of the response in the result, got %v", raw["metadata"])
+	}
+	if _, ok := metadata["captures"]; ok {
+		t.Errorf("expected the captures to be notified apart, got %v", metadata)
+	}
+	if captures, _ := raw["captures"].(map[string]interface{}); captures["version"] != "1.4.2" {
+		t.Errorf("expected the captured version in the result, got %v", raw["captures"])
+	}
+}
+
+func TestNotifyInformational(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	failure := errors.New("connection refused")
+	p.notify(test.Test{Input: "example.com must run ssh with informational true", Target: "1.2.3.4", Type: "ssh", Informational: true}, nil, failure, nil)
+	p.notify(test.Test{Input: "example.com must run ftp", Target: "1.2.3.4", Type: "ftp"}, nil, failure, nil)
+
+	results := testResults(t, p)
+	if len(results) != 2 {
+		t.Fatalf("expected informational results to be notified too, got %d results", len(results))
+	}
+
+	for i, expected := range []bool{true, false} {
+		result, err := test.ResultFromJSON([]byte(results[i]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		if result.Informational != expected {
+			t.Errorf("expected informational %v, got %v", expected, result.Informational)
+		}
+		if result.Error == nil {
+			t.Errorf("expected the failure to be notified")
+		}
+	}
+}
+
+func TestNotifyHours(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	now := time.Date(2024, 5, 15, 20, 30, 0, 0, time.UTC)
+	p._now = func() time.Time { return now }
+
+	office, _ := test.ParseTimeWindow("09:00-18:00", time.UTC)
+	night, _ := test.ParseTimeWindow("22:00-06:00", time.UTC)
+	// 20:30 UTC is 09:30 in this timezone
+	remote, _ := test.ParseTimeWindow("09:00-18:00", time.FixedZone("UTC+13", 13*60*60))
+
+	failure := errors.New("connection refused")
+	tests := []struct {
+		window        *test.TimeWindow
+		err           error
+		informational bool
+	}{
+		{office, failure, true},
+		{night, failure, true},
+		{remote, failure, false},
+		{nil, failure, false},
+		// Passing results are left alone
+		{office, nil, false},
+	}
+
+	for _, tt := range tests {
+		p.notify(test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh", NotifyHours: tt.window}, nil, tt.err, nil)
+	}
+
+	// Within the overnight window, failures are notified as usual
+	now = time.Date(2024, 5, 15, 23, 0, 0, 0, time.UTC)
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh", NotifyHours: night}, nil, failure, nil)
+	tests = append(tests, struct {
+		window        *test.TimeWindow
+		err           error
+		informational bool
+	}{night, failure, false})
+
+	results := testResults(t, p)
+	if len(results) != len(tests) {
+		t.Fatalf("expected %d results, got %d", len(tests), len(results))
+	}
+	for i, tt := range tests {
+		result, err := test.ResultFromJSON([]byte(results[i]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		if result.Informational != tt.informational {
+			t.Errorf("result %d: expected informational %v, got %v", i, tt.informational, result.Informational)
+		}
+	}
+}
+
+func TestNotifySeverity(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh", Severity: "info"}, nil, nil, nil)
+	p.notify(test.Test{Input: "example.com must run ftp", Target: "1.2.3.4", Type: "ftp"}, nil, nil, nil)
+
+	results := testResults(t, p)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+
+	for i, expected := range []string{"info", test.DefaultSeverity} {
+		result, err := test.ResultFromJSON([]byte(results[i]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		if result.Severity != expected {
+			t.Errorf("expected severity %s, got %s", expected, result.Severity)
+		}
+	}
+}
+
+func TestRunTestTimeout(t *testing.T) {
+	var timeouts []time.Duration
+	name := registerFakeTest(&fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		timeouts = append(timeouts, opts.Timeout)
+		return nil
+	}})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	for _, line := range []string{
+		"reports.example.com must run " + name,
+		"reports.example.com must run " + name + " with timeout 30s",
+	} {
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, test.Options{Timeout: 10 * time.Second})
+	}
+
+	// The worker timeout, then the one of the test
+	if len(timeouts) != 2 || timeouts[0] != 10*time.Second || timeouts[1] != 30*time.Second {
+		t.Errorf("expected the test to override the timeout, got %v", timeouts)
+	}
+}
+
+// flaky returns a run function which fails slowly a number of times,
+// then passes quickly.
+func flaky(failures int) func(context.Context, string, test.Options) error {
+	runs := 0
+	return func(ctx context.Context, target string, opts test.Options) error {
+		runs++
+		if runs <= failures {
+			time.Sleep(100 * time.Millisecond)
+			return errors.New("flaky")
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+}
+
+func TestRunTestAttempts(t *testing.T) {
+	name := registerFakeTest(&fakeTest{run: flaky(2)})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.Retry = true
+	p.RetryCount = 5
+	p._sleep = func(time.Duration) {}
+	p._hostname = "worker-1"
+
+	tst, err := parser.New().ParseLine("flaky.example.com must run "+name, nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+	p.runTest(0, tst, test.Options{Timeout: 5 * time.Second})
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal([]byte(results[0]), &raw); err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	if raw["worker"] != "worker-1" || raw["attempts"] != float64(3) {
+		t.Errorf("expected the worker and the number of attempts in the result, got %v", raw)
+	}
+
+	// Only the final attempt is timed
+	if duration, _ := raw["duration_ms"].(float64); duration < 20 || duration >= 100 {
+		t.Errorf("expected the duration of the final attempt, got %v", raw["duration_ms"])
+	}
+
+	// The existing keys are kept
+	for _, key := range []string{"input", "target", "time", "type", "error"} {
+		if _, ok := raw[key]; !ok {
+			t.Errorf("expected the result to have %s, got %v", key, raw)
+		}
+	}
+}
+
+func TestRunTestRetryCount(t *testing.T) {
+	failing := &fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		return errors.New("failing")
+	}}
+	name := registerFakeTest(failing)
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p._sleep = func(time.Duration) {}
+
+	// Both give 3 attempts, even with retries disabled globally
+	for _, line := range []string{
+		"failing.example.com must run " + name + " with retry-count 2",
+		"failing.example.com must run " + name + " with retries 2",
+	} {
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+
+		failing.reset()
+		p.runTest(0, tst, test.Options{Timeout: 5 * time.Second})
+		if runs := len(failing.ran()); runs != 3 {
+			t.Errorf("expected 3 attempts for '%s', got %d", line, runs)
+		}
+	}
+}
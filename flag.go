@@ -0,0 +1,18 @@
+package main
+
+import "strings"
+
+// stringsFlag is a flag which can be repeated, collecting all of its values.
+type stringsFlag []string
+
+func (i *stringsFlag) String() string {
+	if i == nil {
+		return ""
+	}
+	return strings.Join(*i, ",")
+}
+
+func (i *stringsFlag) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
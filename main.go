@@ -24,6 +24,10 @@ func main() {
 	subcommands.Register(&versionCmd{}, "")
 	subcommands.Register(&workerCmd{}, "")
 	subcommands.Register(&k8sEventWatcherCmd{}, "")
+	subcommands.Register(&snapshotCmd{}, "")
+	subcommands.Register(&silenceCmd{}, "")
+	subcommands.Register(&statusCmd{}, "")
+	subcommands.Register(&statusPageCmd{}, "")
 
 	flag.Parse()
 	ctx := context.Background()
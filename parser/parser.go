@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"regexp"
@@ -99,6 +100,18 @@ func (s *Parser) ParseFile(filename string, cb ParsedTest) error {
 			reader := bytes.NewReader(outb.Bytes())
 			scanner = bufio.NewScanner(reader)
 		} else {
+			//
+			// Tests defined as YAML, or JSON, objects are parsed as
+			// a whole.
+			//
+			if isStructured(filename) {
+				data, errRead := ioutil.ReadFile(filename)
+				if errRead != nil {
+					return fmt.Errorf("error opening %s - %s", filename, errRead.Error())
+				}
+				return s.ParseStructured(data, cb)
+			}
+
 			//
 			// Otherwise just read it
 			//
@@ -331,10 +344,17 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 	//
 	// For each argument which was supplied..
 	//
+	// The notification hours are parsed once their timezone is known
+	notifyHours := ""
+	notifyTimezone := ""
+
 	for arg, val := range arguments {
 		switch arg {
 		// Is there a custom per-test override?
-		case "retries":
+		case "retries", "retry-count":
+			if result.MaxRetries != nil {
+				return result, fmt.Errorf("the arguments 'retries' and 'retry-count' cannot be combined in input '%s'", input)
+			}
 			maxRetries, err := strconv.ParseInt(val, 10, 0)
 			if err != nil {
 				return result, fmt.Errorf("non-numeric argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
@@ -345,7 +365,14 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 			maxRetriesUInt := uint(maxRetries)
 			result.MaxRetries = &maxRetriesUInt
 			continue
+		case "retry":
+			retry, err := strconv.ParseBool(val)
+			if err != nil {
+				return result, fmt.Errorf("non-boolean argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+			}
 
+			result.Retry = &retry
+			continue
 			// Do not re-trigger same errors for the specified amount of time, or until test succeeds again
 		case "dedup":
 			duration, err := time.ParseDuration(val)
@@ -393,7 +420,7 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 				return result, fmt.Errorf("non-duration argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
 			}
 
-			if duration < 0 {
+			if duration <= 0 {
 				return result, fmt.Errorf("duration argument '%s' for test-type '%s' in input '%s' must be > 0", arg, testType, input)
 			}
 
@@ -442,6 +469,99 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 			valCopy := val
 			result.TestLabel = &valCopy
 			continue
+		case "shadow":
+			shadow, err := strconv.ParseBool(val)
+			if err != nil {
+				return result, fmt.Errorf("non-boolean argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+			}
+
+			result.Shadow = shadow
+			continue
+		case "informational":
+			informational, err := strconv.ParseBool(val)
+			if err != nil {
+				return result, fmt.Errorf("non-boolean argument '%s' for test-type '%s' in input '%s'", arg, testType, input)
+			}
+
+			result.Informational = informational
+			continue
+		case "notify-hours":
+			notifyHours = val
+			continue
+		case "notify-timezone":
+			notifyTimezone = val
+			continue
+		case "control-target":
+			valCopy := val
+			result.ControlTarget = &valCopy
+			continue
+		case "ca":
+			valCopy := val
+			result.CAFile = &valCopy
+			continue
+		case "depends-on":
+			valCopy := val
+			result.DependsOn = &valCopy
+			continue
+		case "prefer":
+			if val != "ipv4" && val != "ipv6" {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be 'ipv4' or 'ipv6'", arg, testType, input)
+			}
+
+			result.PreferFamily = val
+			continue
+		case "family-mode":
+			if val != "all" && val != "any" {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be 'all' or 'any'", arg, testType, input)
+			}
+
+			result.AnyFamily = val == "any"
+			continue
+		case "consistent":
+			if !regexp.MustCompile(`^[a-zA-Z0-9_]+(,[a-zA-Z0-9_]+)*$`).MatchString(val) {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be a comma-separated list of the values to compare", arg, testType, input)
+			}
+
+			result.Consistency = strings.Split(val, ",")
+			continue
+		case "min-healthy-ips":
+			minHealthy, err := strconv.ParseInt(val, 10, 32)
+			if err != nil || minHealthy < 1 {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be a positive number", arg, testType, input)
+			}
+
+			result.MinHealthyIPs = int(minHealthy)
+			continue
+		case "threshold":
+			threshold, err := test.ParseThreshold(val)
+			if err != nil {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s': %s", arg, testType, input, err.Error())
+			}
+
+			result.Threshold = threshold
+			continue
+		case "expect-result":
+			if val != "pass" && val != "fail" {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be 'pass' or 'fail'", arg, testType, input)
+			}
+
+			result.ExpectFailure = val == "fail"
+			continue
+		case "severity":
+			if !test.IsValidSeverity(val) {
+				return result, fmt.Errorf("argument '%s' for test-type '%s' in input '%s' must be one of %v", arg, testType, input, test.Severities)
+			}
+
+			result.Severity = val
+			continue
+		case "tags":
+			result.Tags = nil
+			for _, tag := range strings.Split(val, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					result.Tags = append(result.Tags, tag)
+				}
+			}
+			continue
 		}
 
 		//
@@ -466,6 +586,63 @@ func (s *Parser) ParseLine(input string, cb ParsedTest) (test.Test, error) {
 		result.Arguments[arg] = val
 	}
 
+	//
+	// Failures outside of the notification hours are informational only.
+	//
+	if notifyHours != "" {
+		location := time.Local
+		if notifyTimezone != "" {
+			var err error
+			location, err = time.LoadLocation(notifyTimezone)
+			if err != nil {
+				return result, fmt.Errorf("unknown timezone '%s' for test-type '%s' in input '%s'", notifyTimezone, testType, input)
+			}
+		}
+
+		window, err := test.ParseTimeWindow(notifyHours, location)
+		if err != nil {
+			return result, fmt.Errorf("argument 'notify-hours' for test-type '%s' in input '%s': %s", testType, input, err.Error())
+		}
+		result.NotifyHours = window
+	} else if notifyTimezone != "" {
+		return result, fmt.Errorf("the argument 'notify-timezone' requires 'notify-hours' in input '%s'", input)
+	}
+
+	//
+	// Comparing the responses of all the addresses requires testing all
+	// of them.
+	//
+	if len(result.Consistency) > 0 && result.AnyFamily {
+		return result, fmt.Errorf("the argument 'consistent' cannot be combined with 'family-mode any' in input '%s'", input)
+	}
+
+	//
+	// Counting the healthy addresses requires testing all of them, and
+	// results in a single result, with nothing to compare.
+	//
+	if result.MinHealthyIPs > 0 && result.Threshold != nil {
+		return result, fmt.Errorf("the arguments 'min-healthy-ips' and 'threshold' cannot be combined in input '%s'", input)
+	}
+	if (result.MinHealthyIPs > 0 || result.Threshold != nil) && (result.AnyFamily || len(result.Consistency) > 0) {
+		return result, fmt.Errorf("the arguments 'min-healthy-ips' and 'threshold' cannot be combined with 'family-mode any' or 'consistent' in input '%s'", input)
+	}
+
+	//
+	// The retry overrides must not contradict each other.
+	//
+	if result.Retry != nil && !*result.Retry && result.MaxRetries != nil {
+		return result, fmt.Errorf("the argument 'retry false' cannot be combined with 'retries' or 'retry-count' in input '%s'", input)
+	}
+
+	//
+	// Let the handler validate the arguments as a whole, if it can.
+	//
+	if validator, ok := handler.(protocols.ArgumentsValidator); ok {
+		if err := validator.ValidateArguments(result.Arguments); err != nil {
+			return result, fmt.Errorf("invalid arguments for test-type '%s' in input '%s': %s", testType, input, err.Error())
+		}
+	}
+
 	//
 	// Invoke the user-supplied callback on this parsed test.
 	//
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cmaster11/overseer/test"
 )
@@ -536,6 +538,43 @@ func TestMaxRetries(t *testing.T) {
 	}
 }
 
+func TestRetryOverrides(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with retry false", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Retry == nil || *tst.Retry {
+		t.Errorf("Expected retries to be disabled")
+	}
+
+	tst, err = p.ParseLine("http://example.com/ must run http with retry-count 3", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.MaxRetries == nil || *tst.MaxRetries != 3 {
+		t.Errorf("Expected a retry-count of 3 to be 3 retries, like retries 3")
+	}
+	for _, arg := range []string{"retry", "retry-count"} {
+		if _, ok := tst.Arguments[arg]; ok {
+			t.Errorf("The %s argument should not be passed to the protocol-test", arg)
+		}
+	}
+
+	for _, input := range []string{
+		"http://example.com/ must run http with retry maybe",
+		"http://example.com/ must run http with retry-count -1",
+		"http://example.com/ must run http with retry-count many",
+		"http://example.com/ must run http with retry-count 3 with retries 2",
+		"http://example.com/ must run http with retry false with retry-count 3",
+	} {
+		if _, err = p.ParseLine(input, nil); err == nil {
+			t.Errorf("Expected an error parsing %s", input)
+		}
+	}
+}
+
 func TestMinDuration(t *testing.T) {
 	tests := []string{
 		"http://example.com/ must run http with min-duration 5m",
@@ -560,6 +599,29 @@ func TestMinDuration(t *testing.T) {
 	}
 }
 
+func TestTimeout(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/report must run http with timeout 30s", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error parsing the timeout - got %s!", err)
+	}
+	if tst.Timeout == nil || *tst.Timeout != 30*time.Second {
+		t.Errorf("Expected a timeout of 30s, got %v", tst.Timeout)
+	}
+
+	for _, input := range []string{
+		"http://example.com/ must run http with timeout 30",
+		"http://example.com/ must run http with timeout slow",
+		"http://example.com/ must run http with timeout 0s",
+		"http://example.com/ must run http with timeout -5s",
+	} {
+		if _, err = p.ParseLine(input, nil); err == nil {
+			t.Errorf("Expected an error parsing %s", input)
+		}
+	}
+}
+
 func TestTestLabel(t *testing.T) {
 	tests := []string{
 		"http://example.com/ must run http with min-duration 5m with test-label \"Hello 0\"",
@@ -587,6 +649,176 @@ func TestTestLabel(t *testing.T) {
 	}
 }
 
+func TestShadow(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with shadow true", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if !tst.Shadow {
+		t.Errorf("Expected the test to be a shadow one")
+	}
+	if _, ok := tst.Arguments["shadow"]; ok {
+		t.Errorf("The shadow argument should not be passed to the protocol-test")
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with shadow maybe", nil)
+	if err == nil {
+		t.Errorf("Expected an error for a non-boolean shadow argument")
+	}
+}
+
+func TestInformational(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with informational true", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if !tst.Informational {
+		t.Errorf("Expected the test to be an informational one")
+	}
+	if _, ok := tst.Arguments["informational"]; ok {
+		t.Errorf("The informational argument should not be passed to the protocol-test")
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with informational maybe", nil)
+	if err == nil {
+		t.Errorf("Expected an error for a non-boolean informational argument")
+	}
+}
+
+func TestNotifyHours(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with notify-hours 09:00-18:30 with notify-timezone UTC", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.NotifyHours == nil || tst.NotifyHours.String() != "09:00-18:30 UTC" {
+		t.Fatalf("Expected the notification hours to be parsed, got %v", tst.NotifyHours)
+	}
+	for _, arg := range []string{"notify-hours", "notify-timezone"} {
+		if _, ok := tst.Arguments[arg]; ok {
+			t.Errorf("The %s argument should not be passed to the protocol-test", arg)
+		}
+	}
+
+	// Without a timezone the local time of the worker is used
+	tst, err = p.ParseLine("http://example.com/ must run http with notify-hours 22:00-06:00", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.NotifyHours.Location != time.Local {
+		t.Errorf("Expected the local timezone, got %s", tst.NotifyHours.Location)
+	}
+
+	for _, input := range []string{
+		"http://example.com/ must run http with notify-hours 9-18",
+		"http://example.com/ must run http with notify-hours 09:00-25:00",
+		"http://example.com/ must run http with notify-hours 09:00-09:00",
+		"http://example.com/ must run http with notify-hours 09:00-18:00 with notify-timezone Nowhere/Atlantis",
+		"http://example.com/ must run http with notify-timezone UTC",
+	} {
+		if _, err = p.ParseLine(input, nil); err == nil {
+			t.Errorf("Expected an error for input '%s'", input)
+		}
+	}
+}
+
+func TestDependsOn(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with depends-on 'main database'", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.DependsOn == nil || *tst.DependsOn != "main database" {
+		t.Errorf("Invalid depends-on")
+	}
+	if _, ok := tst.Arguments["depends-on"]; ok {
+		t.Errorf("The depends-on argument should not be passed to the protocol-test")
+	}
+}
+
+func TestTags(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with tags 'team-a, eu-west,'", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if !reflect.DeepEqual(tst.Tags, []string{"team-a", "eu-west"}) {
+		t.Errorf("Invalid tags: %v", tst.Tags)
+	}
+	if _, ok := tst.Arguments["tags"]; ok {
+		t.Errorf("The tags argument should not be passed to the protocol-test")
+	}
+}
+
+func TestControlTarget(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with control-target https://www.google.com/", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.ControlTarget == nil || *tst.ControlTarget != "https://www.google.com/" {
+		t.Errorf("Invalid control-target")
+	}
+	if _, ok := tst.Arguments["control-target"]; ok {
+		t.Errorf("The control-target argument should not be passed to the protocol-test")
+	}
+}
+
+func TestCAFile(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("https://internal.example.com/ must run http with ca /etc/ssl/internal.pem", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.CAFile == nil || *tst.CAFile != "/etc/ssl/internal.pem" {
+		t.Errorf("Invalid ca")
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with severity warning", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Severity != "warning" {
+		t.Errorf("Invalid severity, got %s", tst.Severity)
+	}
+
+	tst, err = p.ParseLine("http://example.com/ must run http", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.Severity != "" {
+		t.Errorf("Expected no severity, got %s", tst.Severity)
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with severity panic", nil)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown severity")
+	}
+}
+
+// Test handlers can validate their arguments further.
+func TestArgumentsValidator(t *testing.T) {
+	p := New()
+
+	_, err := p.ParseLine("http://example.com/ must run http with json-schema /does/not/exist.json", nil)
+	if err == nil {
+		t.Errorf("Expected an error for a missing JSON schema")
+	}
+}
+
 func TestParseArguments(t *testing.T) {
 	input := "http://example.com/ must run http with min-duration 5m with test-label \"Hello 0\""
 
@@ -713,3 +945,255 @@ http://example.com/ must run http with username 'steve' with password 'ke'mp'
 		t.Errorf("We see no evidence of censorship")
 	}
 }
+
+func TestExpectResult(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with expect-result fail", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if !tst.ExpectFailure {
+		t.Errorf("Expected the test to be expected to fail")
+	}
+	if _, ok := tst.Arguments["expect-result"]; ok {
+		t.Errorf("The expect-result argument should not be passed to the protocol-test")
+	}
+
+	tst, err = p.ParseLine("http://example.com/ must run http with expect-result pass", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.ExpectFailure {
+		t.Errorf("Expected the test to be expected to pass")
+	}
+
+	_, err = p.ParseLine("http://example.com/ must run http with expect-result maybe", nil)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid expect-result argument")
+	}
+}
+
+func TestPreferFamily(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("example.com must run ssh with prefer ipv6 with family-mode any", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.PreferFamily != "ipv6" || !tst.AnyFamily {
+		t.Errorf("Expected IPv6 to be preferred, in any family-mode, got %q %v", tst.PreferFamily, tst.AnyFamily)
+	}
+	if len(tst.Arguments) != 0 {
+		t.Errorf("The family arguments should not be passed to the protocol-test, got %v", tst.Arguments)
+	}
+
+	for _, line := range []string{
+		"example.com must run ssh with prefer ipv5",
+		"example.com must run ssh with family-mode some",
+	} {
+		if _, err = p.ParseLine(line, nil); err == nil {
+			t.Errorf("Expected an error for '%s'", line)
+		}
+	}
+}
+
+func TestConsistent(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("http://example.com/ must run http with capture-header X-Version with consistent status,body,x_version", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if strings.Join(tst.Consistency, " ") != "status body x_version" {
+		t.Errorf("Expected the values to compare to be parsed, got %v", tst.Consistency)
+	}
+	if _, ok := tst.Arguments["consistent"]; ok {
+		t.Errorf("The consistency argument should not be passed to the protocol-test, got %v", tst.Arguments)
+	}
+
+	for _, line := range []string{
+		"http://example.com/ must run http with consistent 'status, body'",
+		"http://example.com/ must run http with consistent status with family-mode any",
+	} {
+		if _, err = p.ParseLine(line, nil); err == nil {
+			t.Errorf("Expected an error for '%s'", line)
+		}
+	}
+}
+
+func TestMinHealthyIPs(t *testing.T) {
+	p := New()
+
+	tst, err := p.ParseLine("example.com must run ssh with min-healthy-ips 3", nil)
+	if err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if tst.MinHealthyIPs != 3 {
+		t.Errorf("Expected the minimum of healthy addresses to be parsed, got %d", tst.MinHealthyIPs)
+	}
+	if _, ok := tst.Arguments["min-healthy-ips"]; ok {
+		t.Errorf("The minimum of healthy addresses should not be passed to the protocol-test, got %v", tst.Arguments)
+	}
+
+	for _, line := range []string{
+		"example.com must run ssh with min-healthy-ips 0",
+		"example.com must run ssh with min-healthy-ips three",
+		"example.com must run ssh with min-healthy-ips 2 with family-mode any",
+		"http://example.com/ must run http with min-healthy-ips 2 with consistent status",
+	} {
+		if _, err = p.ParseLine(line, nil); err == nil {
+			t.Errorf("Expected an error for '%s'", line)
+		}
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	p := New()
+
+	for _, tt := range []struct {
+		value    string
+		expected string
+		required int
+	}{
+		{"3", "3", 3},
+		{"80%", "80%", 4},
+		{"0.8", "80%", 4},
+		{"0.5", "50%", 3},
+		{"100%", "100%", 5},
+		{"1%", "1%", 1},
+	} {
+		tst, err := p.ParseLine("example.com must run ssh with threshold "+tt.value, nil)
+		if err != nil {
+			t.Fatalf("We did not expect an error for %s - got %s!", tt.value, err)
+		}
+		if tst.Threshold == nil || tst.Threshold.String() != tt.expected {
+			t.Errorf("Expected the threshold %s to be parsed as %s, got %v", tt.value, tt.expected, tst.Threshold)
+			continue
+		}
+		// Out of 5 targets
+		if required := tst.Threshold.Required(5); required != tt.required {
+			t.Errorf("Expected the threshold %s to require %d targets, got %d", tt.value, tt.required, required)
+		}
+		if _, ok := tst.Arguments["threshold"]; ok {
+			t.Errorf("The threshold should not be passed to the protocol-test, got %v", tst.Arguments)
+		}
+	}
+
+	for _, line := range []string{
+		"example.com must run ssh with threshold 0",
+		"example.com must run ssh with threshold 0%",
+		"example.com must run ssh with threshold 120%",
+		"example.com must run ssh with threshold 1.5",
+		"example.com must run ssh with threshold most",
+		"example.com must run ssh with threshold 2 with min-healthy-ips 2",
+		"example.com must run ssh with threshold 50% with family-mode any",
+	} {
+		if _, err := p.ParseLine(line, nil); err == nil {
+			t.Errorf("Expected an error for '%s'", line)
+		}
+	}
+}
+
+// Test reading tests defined in YAML, and in JSON
+func TestStructured(t *testing.T) {
+	p := New()
+
+	yamlTests := `
+- target: http://example.com/
+  type: http
+  arguments:
+    content: "it's fine"
+    status: 200
+    severity: warning
+- target: example.com
+  type: ssh
+  tags: [team-a, "eu west"]
+  arguments:
+    port: 2222
+`
+
+	var parsed []test.Test
+	collect := func(tst test.Test) error {
+		parsed = append(parsed, tst)
+		return nil
+	}
+
+	if err := p.ParseStructured([]byte(yamlTests), collect); err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("Expected 2 tests, got %d", len(parsed))
+	}
+	if parsed[0].Input != `http://example.com/ must run http with content "it's fine" with severity 'warning' with status '200'` {
+		t.Errorf("Unexpected input: %s", parsed[0].Input)
+	}
+	if parsed[0].Arguments["content"] != "it's fine" || parsed[0].Arguments["status"] != "200" || parsed[0].Severity != "warning" {
+		t.Errorf("Unexpected test: %v %s", parsed[0].Arguments, parsed[0].Severity)
+	}
+	if parsed[1].Target != "example.com" || parsed[1].Arguments["port"] != "2222" {
+		t.Errorf("Unexpected test: %s %v", parsed[1].Target, parsed[1].Arguments)
+	}
+	if parsed[1].Input != "example.com must run ssh with port '2222' with tags 'team-a,eu west'" {
+		t.Errorf("Unexpected input: %s", parsed[1].Input)
+	}
+	if !reflect.DeepEqual(parsed[1].Tags, []string{"team-a", "eu west"}) || len(parsed[0].Tags) != 0 {
+		t.Errorf("Unexpected tags: %v %v", parsed[0].Tags, parsed[1].Tags)
+	}
+
+	// JSON is parsed just the same
+	parsed = nil
+	jsonTests := `[{"target": "example.com", "type": "ssh", "arguments": {"port": "2222"}}]`
+	if err := p.ParseStructured([]byte(jsonTests), collect); err != nil {
+		t.Fatalf("We did not expect an error - got %s!", err)
+	}
+	if len(parsed) != 1 || parsed[0].Input != "example.com must run ssh with port '2222'" {
+		t.Errorf("Unexpected tests: %v", parsed)
+	}
+
+	// The tests are validated like lines
+	invalid := []struct {
+		input   string
+		failure string
+	}{
+		{`[{"target": "example.com", "type": "ssh", "arguments": {"port": "ssh"}}]`, "test 1: unsupported argument 'port'"},
+		{`[{"target": "example.com", "type": "nope"}]`, "test 1: unknown test-type 'nope'"},
+		{`[{"type": "ssh"}]`, "test 1: invalid target ''"},
+		{`[{"target": "example.com", "type": "ssh", "tags": ["a,b"]}]`, "test 1: invalid tag 'a,b'"},
+		{`[{"target": "example.com", "type": "ssh", "tags": ["a"], "arguments": {"tags": "b"}}]`, "given both as a field and as an argument"},
+		{"- {target: example.com, type: ssh, args: {port: 22}}", "failed to parse the tests"},
+	}
+	for _, tt := range invalid {
+		err := p.ParseStructured([]byte(tt.input), nil)
+		if err == nil || !strings.Contains(err.Error(), tt.failure) {
+			t.Errorf("Expected an error containing %q for %s, got %v", tt.failure, tt.input, err)
+		}
+	}
+}
+
+// Test that files are parsed as YAML, or JSON, by their extension
+func TestStructuredFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "structured")
+	if err != nil {
+		t.Fatalf("Error creating temporary-directory %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := dir + "/tests.yml"
+	err = ioutil.WriteFile(path, []byte("- {target: example.com, type: ssh}\n"), 0644)
+	if err != nil {
+		t.Fatalf("Error writing our test-case")
+	}
+
+	var inputs []string
+	err = New().ParseFile(path, func(tst test.Test) error {
+		inputs = append(inputs, tst.Input)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error parsing our valid file: %s", err)
+	}
+	if len(inputs) != 1 || inputs[0] != "example.com must run ssh" {
+		t.Errorf("Unexpected tests: %v", inputs)
+	}
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StructuredTest is a test defined as an object, in YAML or JSON, rather
+// than as a line of text.
+//
+// The arguments hold both the arguments of the protocol-test and the
+// options of the test itself, e.g. `severity` or `test-label`, under the
+// same names as in the lines.
+type StructuredTest struct {
+	Target    string            `json:"target" yaml:"target"`
+	Type      string            `json:"type" yaml:"type"`
+	Arguments map[string]string `json:"arguments" yaml:"arguments"`
+
+	// Tags of the test, given as the comma-separated `tags` option in the
+	// lines
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+// Line returns the line of text defining the test.
+func (st StructuredTest) Line() (string, error) {
+	if st.Target == "" || strings.ContainsAny(st.Target, " \t") {
+		return "", fmt.Errorf("invalid target '%s'", st.Target)
+	}
+	if st.Type == "" || strings.ContainsAny(st.Type, " \t") {
+		return "", fmt.Errorf("invalid type '%s' for target '%s'", st.Type, st.Target)
+	}
+
+	line := fmt.Sprintf("%s must run %s", st.Target, st.Type)
+
+	arguments := map[string]string{}
+	for k, v := range st.Arguments {
+		arguments[k] = v
+	}
+	if len(st.Tags) > 0 {
+		if _, ok := arguments["tags"]; ok {
+			return "", fmt.Errorf("the tags for target '%s' are given both as a field and as an argument", st.Target)
+		}
+		for _, tag := range st.Tags {
+			if strings.TrimSpace(tag) == "" || strings.Contains(tag, ",") {
+				return "", fmt.Errorf("invalid tag '%s' for target '%s'", tag, st.Target)
+			}
+		}
+		arguments["tags"] = strings.Join(st.Tags, ",")
+	}
+
+	// Arguments, sorted
+	var keys []string
+	for k := range arguments {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k == "" || strings.ContainsAny(k, " \t") {
+			return "", fmt.Errorf("invalid argument name '%s' for target '%s'", k, st.Target)
+		}
+
+		value := arguments[k]
+		switch {
+		case !strings.Contains(value, "'"):
+			line += fmt.Sprintf(" with %s '%s'", k, value)
+		case !strings.Contains(value, "\""):
+			line += fmt.Sprintf(" with %s \"%s\"", k, value)
+		default:
+			return "", fmt.Errorf("the argument '%s' for target '%s' cannot contain both single and double quotes", k, st.Target)
+		}
+	}
+
+	return line, nil
+}
+
+// ParseStructured processes a YAML, or JSON, array of test objects,
+// invoking the supplied callback for every test-case which has been
+// successfully parsed.
+//
+// The objects are converted to lines, which are parsed like the lines of
+// a configuration file, so they are validated in the same way, and their
+// input is the line.
+func (s *Parser) ParseStructured(data []byte, cb ParsedTest) error {
+	var tests []StructuredTest
+
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &tests)
+	} else {
+		err = yaml.UnmarshalStrict(data, &tests)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse the tests: %s", err.Error())
+	}
+
+	for i, st := range tests {
+		line, err := st.Line()
+		if err != nil {
+			return fmt.Errorf("test %d: %s", i+1, err.Error())
+		}
+		if _, err = s.ParseLine(line, cb); err != nil {
+			return fmt.Errorf("test %d: %s", i+1, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// isStructured returns true if the file holds structured tests, as told
+// by its extension.
+func isStructured(filename string) bool {
+	for _, extension := range []string{".yaml", ".yml", ".json"} {
+		if strings.HasSuffix(strings.ToLower(filename), extension) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+// AMQP Tester
+//
+// The AMQP tester connects to an AMQP 0-9-1 broker, e.g. RabbitMQ, logs in,
+// and opens a connection to a virtual host, and a channel, failing on any
+// error of the handshake or the login.
+//
+// This test is invoked via input like so:
+//
+//    amqp://mq.example.com must run amqp
+//    amqps://mq.example.com:5671/orders must run amqp with user 'monitor' with password 'secret'
+//
+// The virtual host is the path of the URL, "/" by default, unless given
+// via `vhost`. Without credentials the login is guest/guest. They must be
+// given as arguments, not in the URL, so that the password is censored in
+// the results.
+//
+// To also require a queue to exist in the virtual host use:
+//
+//    amqp://mq.example.com must run amqp with user 'monitor' with password 'secret' with queue 'orders'
+//
+// If you need to disable the validation of the certificates you can do so
+// via `with tls insecure`.
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPTest is our object.
+type AMQPTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *AMQPTest) Arguments() map[string]string {
+	known := map[string]string{
+		"vhost":    ".+",
+		"user":     ".+",
+		"password": ".+",
+		"queue":    ".+",
+		"tls":      "insecure",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *AMQPTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments ensures the credentials are given together.
+func (s *AMQPTest) ValidateArguments(args map[string]string) error {
+	if (args["user"] == "") != (args["password"] == "") {
+		return errors.New("the 'user' and 'password' must be given together")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *AMQPTest) Example() string {
+	str := `
+AMQP Tester
+-----------
+ The AMQP tester connects to an AMQP 0-9-1 broker, e.g. RabbitMQ, logs in,
+ and opens a connection to a virtual host, and a channel, failing on any
+ error of the handshake or the login.
+
+ This test is invoked via input like so:
+
+    amqp://mq.example.com must run amqp
+    amqps://mq.example.com:5671/orders must run amqp with user 'monitor' with password 'secret'
+
+ The virtual host is the path of the URL, "/" by default, unless given
+ via 'vhost'. Without credentials the login is guest/guest. They must be
+ given as arguments, not in the URL, so that the password is censored in
+ the results.
+
+ To also require a queue to exist in the virtual host use:
+
+    amqp://mq.example.com must run amqp with user 'monitor' with password 'secret' with queue 'orders'
+
+ If you need to disable the validation of the certificates you can do so
+ via 'with tls insecure'.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// The target is the resolved address of the host, while the URL, with the
+// virtual host as its path, is the target of the test itself:
+//
+//    tst.Target => "amqps://mq.example.com/orders"
+//
+//    target => "176.9.183.100"
+//
+func (s *AMQPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	u, err := url.Parse(tst.Target)
+	if err != nil {
+		return err
+	}
+
+	var port string
+	switch u.Scheme {
+	case "amqp":
+		port = "5672"
+	case "amqps":
+		port = "5671"
+	default:
+		return fmt.Errorf("the target must be an amqp:// or amqps:// URL, not '%s'", tst.Target)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	if u.User != nil {
+		return errors.New("the credentials must be given via 'user' and 'password', not in the URL")
+	}
+
+	vhost := "/"
+	if path := strings.TrimPrefix(u.Path, "/"); path != "" {
+		vhost = path
+	}
+	if tst.Arguments["vhost"] != "" {
+		vhost = tst.Arguments["vhost"]
+	}
+
+	user, password := "guest", "guest"
+	if tst.Arguments["user"] != "" {
+		user, password = tst.Arguments["user"], tst.Arguments["password"]
+	}
+
+	// The URL of the broker, at the resolved address
+	address := net.JoinHostPort(target, port)
+	broker := (&url.URL{Scheme: u.Scheme, Host: address, Path: "/" + vhost, RawPath: "/" + url.PathEscape(vhost)}).String()
+
+	var tlsConfig *tls.Config
+	if u.Scheme == "amqps" {
+		roots, errCA := rootCAs(tst, opts)
+		if errCA != nil {
+			return errCA
+		}
+		tlsConfig = &tls.Config{ServerName: u.Hostname(), RootCAs: roots}
+		if tst.Arguments["tls"] == "insecure" {
+			tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+	}
+
+	// The whole exchange must complete within the timeout, while the
+	// library only bounds the handshake, so the connection is closed once
+	// the timeout expires
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	config := amqp.Config{
+		Vhost:           vhost,
+		SASL:            []amqp.Authentication{&amqp.PlainAuth{Username: user, Password: password}},
+		TLSClientConfig: tlsConfig,
+		Locale:          "en_US",
+		Dial: func(network string, addr string) (net.Conn, error) {
+			conn, errDial := newDialer(opts).DialContext(ctx, network, addr)
+			if errDial != nil {
+				return nil, errDial
+			}
+			go func() {
+				<-ctx.Done()
+				conn.Close()
+			}()
+			deadline, _ := ctx.Deadline()
+			return conn, conn.SetDeadline(deadline)
+		},
+	}
+
+	connection, err := amqp.DialConfig(broker, config)
+	if err != nil {
+		switch err {
+		case amqp.ErrCredentials:
+			return fmt.Errorf("AMQP login as '%s' failed: %s", user, err.Error())
+		case amqp.ErrVhost:
+			return fmt.Errorf("the vhost '%s' is not accessible: %s", vhost, err.Error())
+		case amqp.ErrSASL:
+			return errors.New("the broker does not support the PLAIN login")
+		}
+		if _, ok := err.(*amqp.Error); ok {
+			return fmt.Errorf("failed to open an AMQP connection to %s: %s", broker, err.Error())
+		}
+		return fmt.Errorf("failed to connect to %s: %s", broker, err.Error())
+	}
+	defer connection.Close()
+
+	channel, err := connection.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open an AMQP channel to %s: %s", broker, err.Error())
+	}
+
+	if opts.Verbose {
+		fmt.Printf("AMQP connection opened to %s as '%s'\n", broker, user)
+	}
+
+	if queue := tst.Arguments["queue"]; queue != "" {
+		state, errDeclare := channel.QueueDeclarePassive(queue, false, false, false, false, nil)
+		if amqpErr, ok := errDeclare.(*amqp.Error); ok && amqpErr.Code == amqp.NotFound {
+			return fmt.Errorf("the queue '%s' does not exist in the vhost '%s'", queue, vhost)
+		}
+		if errDeclare != nil {
+			return fmt.Errorf("failed to check the queue '%s': %s", queue, errDeclare.Error())
+		}
+
+		if opts.Verbose {
+			fmt.Printf("The queue '%s' has %d messages, and %d consumers\n", queue, state.Messages, state.Consumers)
+		}
+	}
+
+	return connection.Close()
+}
+
+func (s *AMQPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("amqp", func() ProtocolTest {
+		return &AMQPTest{}
+	})
+}
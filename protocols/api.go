@@ -7,7 +7,9 @@
 package protocols
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/cmaster11/overseer/test"
 )
@@ -37,13 +39,87 @@ type ProtocolTest interface {
 	// Return a suitable error if the test fails, or nil to indicate
 	// it passed.
 	//
-	RunTest(tst test.Test, target string, opts test.Options) error
+	// The context is cancelled once the timeout of the test elapses,
+	// so long-running handlers should abort when it is done.
+	//
+	RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error
 
 	ShouldResolveHostname() bool
 
 	GetUniqueHashForTest(tst test.Test, opts test.Options) *string
 }
 
+// CaptureTest is an optional interface which can be implemented by
+// protocol-tests able to extract values from the response of the
+// target, e.g. via the `capture` argument of the HTTP tester.
+type CaptureTest interface {
+	//
+	// RunTestCapture behaves like RunTest, but also returns the
+	// captured values, keyed by name.
+	//
+	RunTestCapture(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]string, error)
+}
+
+// DetailedTest is an optional interface which can be implemented by
+// protocol-tests able to describe what they observed, e.g. the status code
+// and size of the response of the HTTP tester, to enrich their results.
+//
+// Protocol-tests also implementing CaptureTest return their captured
+// values in the metadata too, under CapturesDetail, so that the test is
+// only run once.
+type DetailedTest interface {
+	//
+	// RunTestDetailed behaves like RunTest, but also returns metadata
+	// about the test, keyed by name, whether it passed or not.
+	//
+	RunTestDetailed(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]interface{}, error)
+}
+
+// CapturesDetail is the key of the captured values, as a map[string]string,
+// in the metadata of a DetailedTest.
+const CapturesDetail = "captures"
+
+// runTestAdapter adapts the protocol-tests which don't describe what they
+// observed to DetailedTest.
+type runTestAdapter struct {
+	ProtocolTest
+}
+
+// RunTestDetailed runs the test, returning no metadata.
+func (a runTestAdapter) RunTestDetailed(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]interface{}, error) {
+	return nil, a.RunTest(ctx, tst, target, opts)
+}
+
+// Detailed returns the given protocol-test as a DetailedTest, adapting it
+// if needed.
+func Detailed(handler ProtocolTest) DetailedTest {
+	if detailed, ok := handler.(DetailedTest); ok {
+		return detailed
+	}
+	return runTestAdapter{handler}
+}
+
+// LongTest is an optional interface which can be implemented by
+// protocol-tests which may take longer than the timeout, e.g. waiting for
+// the delivery of a message, so that their context expires later.
+type LongTest interface {
+	//
+	// MaxDuration returns how long the test may take, at most.
+	//
+	MaxDuration(tst test.Test, opts test.Options) time.Duration
+}
+
+// ArgumentsValidator is an optional interface which can be implemented by
+// protocol-tests needing to validate their arguments further than their
+// regular expressions allow, e.g. by loading a referenced file.
+type ArgumentsValidator interface {
+	//
+	// ValidateArguments returns an error if the given arguments, already
+	// matched against their regular expressions, are not valid.
+	//
+	ValidateArguments(args map[string]string) error
+}
+
 // This is a map of known-tests.
 var handlers = struct {
 	m map[string]TestCtor
@@ -0,0 +1,438 @@
+// CoAP Tester
+//
+// The CoAP tester issues a GET request against a CoAP resource, the
+// protocol used by constrained (IoT) devices, and checks the response.
+//
+// This test is invoked via input like so:
+//
+//    coap://sensor.example.com/temperature must run coap
+//
+// By default the response code must be `2.05` (Content), but you can
+// change this via:
+//
+//    coap://sensor.example.com/temperature must run coap with code 2.03
+//
+// You can also ensure the response payload contains a substring:
+//
+//    coap://sensor.example.com/status must run coap with expect 'OK'
+//
+// Secure resources (coaps://) are reached via DTLS with a pre-shared key:
+//
+//    coaps://sensor.example.com/status must run coap with psk 'secret' with psk-identity 'overseer'
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/pion/dtls/v2"
+)
+
+// CoAP message types
+const (
+	coapTypeConfirmable     = 0
+	coapTypeNonConfirmable  = 1
+	coapTypeAcknowledgement = 2
+	coapTypeReset           = 3
+)
+
+// CoAP option numbers we send
+const (
+	coapOptionURIHost  = 3
+	coapOptionURIPort  = 7
+	coapOptionURIPath  = 11
+	coapOptionURIQuery = 15
+)
+
+// CoAPTest is our object.
+type CoAPTest struct {
+}
+
+// coapOption is a single option of a CoAP message.
+type coapOption struct {
+	Number uint16
+	Value  []byte
+}
+
+// coapMessage is a parsed CoAP message.
+type coapMessage struct {
+	Type      uint8
+	Code      uint8
+	MessageID uint16
+	Token     []byte
+	Options   []coapOption
+	Payload   []byte
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *CoAPTest) Arguments() map[string]string {
+	known := map[string]string{
+		"code":         `^[0-7]\.[0-9]{2}$`,
+		"expect":       ".+",
+		"psk":          ".+",
+		"psk-identity": ".+",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *CoAPTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *CoAPTest) Example() string {
+	str := `
+CoAP Tester
+-----------
+ The CoAP tester issues a GET request against a CoAP resource, the
+ protocol used by constrained (IoT) devices, and checks the response.
+
+ This test is invoked via input like so:
+
+    coap://sensor.example.com/temperature must run coap
+
+ By default the response code must be 2.05 (Content), but you can
+ change this via:
+
+    coap://sensor.example.com/temperature must run coap with code 2.03
+
+ You can also ensure the response payload contains a substring:
+
+    coap://sensor.example.com/status must run coap with expect 'OK'
+
+ Secure resources (coaps://) are reached via DTLS with a pre-shared key:
+
+    coaps://sensor.example.com/status must run coap with psk 'secret' with psk-identity 'overseer'
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we send a confirmable GET request, and wait for either a
+// piggybacked or a separate response.
+func (s *CoAPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	u, err := url.Parse(tst.Target)
+	if err != nil {
+		return err
+	}
+
+	port := "5683"
+	switch u.Scheme {
+	case "coap":
+	case "coaps":
+		port = "5684"
+		if tst.Arguments["psk"] == "" {
+			return errors.New("you must specify the psk when running a coaps test")
+		}
+	default:
+		return fmt.Errorf("unsupported CoAP scheme '%s'", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	expectedCode := "2.05"
+	if tst.Arguments["code"] != "" {
+		expectedCode = tst.Arguments["code"]
+	}
+
+	address := net.JoinHostPort(target, port)
+	until := deadline(ctx, opts.Timeout)
+
+	var conn net.Conn
+	if u.Scheme == "coaps" {
+		conn, err = s.dialDTLS(ctx, address, tst, until)
+	} else {
+		conn, err = newDialer(opts).DialContext(ctx, "udp", address)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(until); err != nil {
+		return err
+	}
+
+	//
+	// Build and send our request.
+	//
+	token := make([]byte, 4)
+	idBytes := make([]byte, 2)
+	if _, err = rand.Read(token); err != nil {
+		return err
+	}
+	if _, err = rand.Read(idBytes); err != nil {
+		return err
+	}
+	messageID := binary.BigEndian.Uint16(idBytes)
+
+	request := coapEncodeMessage(&coapMessage{
+		Type:      coapTypeConfirmable,
+		Code:      1, // GET
+		MessageID: messageID,
+		Token:     token,
+		Options:   coapRequestOptions(u),
+	})
+
+	if _, err = conn.Write(request); err != nil {
+		return err
+	}
+
+	response, err := s.readResponse(conn, messageID, token)
+	if err != nil {
+		return err
+	}
+
+	code := coapCodeString(response.Code)
+	if opts.Verbose {
+		fmt.Printf("CoAP response code %s, payload: %s\n", code, string(response.Payload))
+	}
+
+	if code != expectedCode {
+		return fmt.Errorf("response code was %s not %s", code, expectedCode)
+	}
+
+	if tst.Arguments["expect"] != "" && !strings.Contains(string(response.Payload), tst.Arguments["expect"]) {
+		return fmt.Errorf("payload didn't contain '%s'", tst.Arguments["expect"])
+	}
+
+	return nil
+}
+
+// dialDTLS opens a DTLS session, authenticated via a pre-shared key.
+func (s *CoAPTest) dialDTLS(ctx context.Context, address string, tst test.Test, deadline time.Time) (net.Conn, error) {
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := "overseer"
+	if tst.Arguments["psk-identity"] != "" {
+		identity = tst.Arguments["psk-identity"]
+	}
+
+	config := &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte(tst.Arguments["psk"]), nil
+		},
+		PSKIdentityHint: []byte(identity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	return dtls.DialWithContext(ctx, "udp", raddr, config)
+}
+
+// readResponse waits for the response matching our request, handling
+// the case of an empty acknowledgement followed by a separate response.
+func (s *CoAPTest) readResponse(conn net.Conn, messageID uint16, token []byte) (*coapMessage, error) {
+	buf := make([]byte, 2048)
+
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := coapParseMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case msg.Type == coapTypeReset && msg.MessageID == messageID:
+			return nil, errors.New("request was reset by the server")
+
+		case msg.Type == coapTypeAcknowledgement && msg.MessageID == messageID:
+			// An empty ACK means the real response will follow
+			if msg.Code == 0 {
+				continue
+			}
+			return msg, nil
+
+		case (msg.Type == coapTypeConfirmable || msg.Type == coapTypeNonConfirmable) && string(msg.Token) == string(token):
+			if msg.Type == coapTypeConfirmable {
+				ack := coapEncodeMessage(&coapMessage{Type: coapTypeAcknowledgement, MessageID: msg.MessageID})
+				if _, err = conn.Write(ack); err != nil {
+					return nil, err
+				}
+			}
+			return msg, nil
+		}
+	}
+}
+
+// coapRequestOptions builds the options identifying the requested resource.
+func coapRequestOptions(u *url.URL) []coapOption {
+	var options []coapOption
+
+	if net.ParseIP(u.Hostname()) == nil {
+		options = append(options, coapOption{Number: coapOptionURIHost, Value: []byte(u.Hostname())})
+	}
+
+	for _, segment := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		if segment != "" {
+			options = append(options, coapOption{Number: coapOptionURIPath, Value: []byte(segment)})
+		}
+	}
+
+	if u.RawQuery != "" {
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			options = append(options, coapOption{Number: coapOptionURIQuery, Value: []byte(param)})
+		}
+	}
+
+	return options
+}
+
+// coapCodeString formats a code the usual way, e.g. 69 => "2.05".
+func coapCodeString(code uint8) string {
+	return fmt.Sprintf("%d.%02d", code>>5, code&0x1f)
+}
+
+// coapEncodeMessage serializes a CoAP message, see RFC 7252 section 3.
+func coapEncodeMessage(msg *coapMessage) []byte {
+	out := []byte{
+		1<<6 | msg.Type<<4 | uint8(len(msg.Token)),
+		msg.Code,
+		byte(msg.MessageID >> 8),
+		byte(msg.MessageID),
+	}
+	out = append(out, msg.Token...)
+
+	// Options are delta-encoded, so must be sorted by number, which
+	// our callers guarantee.
+	var last uint16
+	for _, opt := range msg.Options {
+		delta, deltaExt := coapOptionNibble(int(opt.Number - last))
+		length, lengthExt := coapOptionNibble(len(opt.Value))
+		out = append(out, delta<<4|length)
+		out = append(out, deltaExt...)
+		out = append(out, lengthExt...)
+		out = append(out, opt.Value...)
+		last = opt.Number
+	}
+
+	if len(msg.Payload) > 0 {
+		out = append(out, 0xff)
+		out = append(out, msg.Payload...)
+	}
+
+	return out
+}
+
+// coapOptionNibble returns the 4-bit value and the extended bytes used to
+// encode an option delta or length.
+func coapOptionNibble(v int) (uint8, []byte) {
+	switch {
+	case v < 13:
+		return uint8(v), nil
+	case v < 269:
+		return 13, []byte{byte(v - 13)}
+	default:
+		return 14, []byte{byte((v - 269) >> 8), byte(v - 269)}
+	}
+}
+
+// coapParseMessage parses a serialized CoAP message.
+func coapParseMessage(data []byte) (*coapMessage, error) {
+	if len(data) < 4 {
+		return nil, errors.New("CoAP message too short")
+	}
+	if data[0]>>6 != 1 {
+		return nil, fmt.Errorf("unsupported CoAP version %d", data[0]>>6)
+	}
+
+	msg := &coapMessage{
+		Type:      (data[0] >> 4) & 0x3,
+		Code:      data[1],
+		MessageID: binary.BigEndian.Uint16(data[2:4]),
+	}
+
+	tokenLength := int(data[0] & 0xf)
+	if tokenLength > 8 || len(data) < 4+tokenLength {
+		return nil, errors.New("invalid CoAP token length")
+	}
+	msg.Token = data[4 : 4+tokenLength]
+	data = data[4+tokenLength:]
+
+	var number uint16
+	for len(data) > 0 {
+		if data[0] == 0xff {
+			msg.Payload = data[1:]
+			break
+		}
+
+		delta := int(data[0] >> 4)
+		length := int(data[0] & 0xf)
+		data = data[1:]
+
+		var err error
+		if delta, data, err = coapReadExtended(delta, data); err != nil {
+			return nil, err
+		}
+		if length, data, err = coapReadExtended(length, data); err != nil {
+			return nil, err
+		}
+		if len(data) < length {
+			return nil, errors.New("truncated CoAP option")
+		}
+
+		number += uint16(delta)
+		msg.Options = append(msg.Options, coapOption{Number: number, Value: data[:length]})
+		data = data[length:]
+	}
+
+	return msg, nil
+}
+
+// coapReadExtended decodes an extended option delta or length.
+func coapReadExtended(v int, data []byte) (int, []byte, error) {
+	switch v {
+	case 13:
+		if len(data) < 1 {
+			return 0, nil, errors.New("truncated CoAP option")
+		}
+		return int(data[0]) + 13, data[1:], nil
+	case 14:
+		if len(data) < 2 {
+			return 0, nil, errors.New("truncated CoAP option")
+		}
+		return int(binary.BigEndian.Uint16(data[:2])) + 269, data[2:], nil
+	case 15:
+		return 0, nil, errors.New("invalid CoAP option nibble")
+	}
+	return v, data, nil
+}
+
+func (s *CoAPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("coap", func() ProtocolTest {
+		return &CoAPTest{}
+	})
+}
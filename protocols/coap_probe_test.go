@@ -0,0 +1,169 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/pion/dtls/v2"
+)
+
+// startCoAPServer starts a stub CoAP server replying to the /status
+// resource, either piggybacked or with a separate response.
+func startCoAPServer(t *testing.T, separate bool) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+
+			req, err := coapParseMessage(buf[:n])
+			if err != nil || req.Type != coapTypeConfirmable {
+				continue
+			}
+
+			var path []string
+			for _, opt := range req.Options {
+				if opt.Number == coapOptionURIPath {
+					path = append(path, string(opt.Value))
+				}
+			}
+
+			code := uint8(2<<5 | 5) // 2.05
+			payload := []byte("status: OK")
+			if strings.Join(path, "/") != "status" {
+				code = 4<<5 | 4 // 4.04
+				payload = nil
+			}
+
+			if separate {
+				conn.WriteToUDP(coapEncodeMessage(&coapMessage{Type: coapTypeAcknowledgement, MessageID: req.MessageID}), addr)
+				conn.WriteToUDP(coapEncodeMessage(&coapMessage{Type: coapTypeNonConfirmable, Code: code, MessageID: req.MessageID + 1, Token: req.Token, Payload: payload}), addr)
+				continue
+			}
+
+			conn.WriteToUDP(coapEncodeMessage(&coapMessage{Type: coapTypeAcknowledgement, Code: code, MessageID: req.MessageID, Token: req.Token, Payload: payload}), addr)
+		}
+	}()
+
+	return conn
+}
+
+func TestCoAP(t *testing.T) {
+	for _, separate := range []bool{false, true} {
+		server := startCoAPServer(t, separate)
+		port := server.LocalAddr().(*net.UDPAddr).Port
+
+		run := func(path string, args map[string]string) error {
+			tst := test.Test{
+				Target:    "coap://127.0.0.1:" + strconv.Itoa(port) + path,
+				Type:      "coap",
+				Arguments: args,
+			}
+			return (&CoAPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 2 * time.Second})
+		}
+
+		if err := run("/status", map[string]string{"expect": "OK"}); err != nil {
+			t.Errorf("expected test to pass (separate=%v): %s", separate, err)
+		}
+		if err := run("/status", map[string]string{"expect": "FAIL"}); err == nil {
+			t.Errorf("expected payload mismatch (separate=%v)", separate)
+		}
+		if err := run("/missing", map[string]string{}); err == nil || !strings.Contains(err.Error(), "4.04") {
+			t.Errorf("expected 4.04 failure (separate=%v), got: %v", separate, err)
+		}
+		if err := run("/missing", map[string]string{"code": "4.04"}); err != nil {
+			t.Errorf("expected configured code to pass (separate=%v): %s", separate, err)
+		}
+
+		server.Close()
+	}
+}
+
+func TestCoAPEncoding(t *testing.T) {
+	msg := &coapMessage{
+		Type:      coapTypeConfirmable,
+		Code:      1,
+		MessageID: 1234,
+		Token:     []byte{1, 2},
+		Options: []coapOption{
+			{Number: coapOptionURIHost, Value: []byte("example.com")},
+			{Number: coapOptionURIPath, Value: []byte(strings.Repeat("a", 20))},
+			{Number: 300, Value: []byte("x")},
+		},
+		Payload: []byte("payload"),
+	}
+
+	parsed, err := coapParseMessage(coapEncodeMessage(msg))
+	if err != nil {
+		t.Fatalf("failed to parse encoded message: %s", err)
+	}
+
+	if parsed.MessageID != 1234 || parsed.Code != 1 || string(parsed.Payload) != "payload" || len(parsed.Options) != 3 {
+		t.Errorf("unexpected round-trip result: %+v", parsed)
+	}
+	if parsed.Options[2].Number != 300 || string(parsed.Options[1].Value) != strings.Repeat("a", 20) {
+		t.Errorf("unexpected options: %+v", parsed.Options)
+	}
+}
+
+func TestCoAPDTLS(t *testing.T) {
+	config := &dtls.Config{
+		PSK: func(hint []byte) ([]byte, error) {
+			return []byte("secret"), nil
+		},
+		PSKIdentityHint: []byte("server"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+
+	listener, err := dtls.Listen("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")}, config)
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+
+			buf := make([]byte, 2048)
+			n, errRead := conn.Read(buf)
+			if errRead == nil {
+				if req, errParse := coapParseMessage(buf[:n]); errParse == nil {
+					conn.Write(coapEncodeMessage(&coapMessage{Type: coapTypeAcknowledgement, Code: 2<<5 | 5, MessageID: req.MessageID, Token: req.Token, Payload: []byte("secure")}))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	port := listener.Addr().(*net.UDPAddr).Port
+	tst := test.Test{
+		Target:    "coaps://127.0.0.1:" + strconv.Itoa(port) + "/status",
+		Type:      "coap",
+		Arguments: map[string]string{"psk": "secret", "expect": "secure"},
+	}
+
+	if err := (&CoAPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second}); err != nil {
+		t.Errorf("expected DTLS test to pass: %s", err)
+	}
+
+	tst.Arguments = map[string]string{}
+	if err := (&CoAPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second}); err == nil {
+		t.Errorf("expected coaps test without psk to fail")
+	}
+}
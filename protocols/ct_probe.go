@@ -0,0 +1,287 @@
+// CT Tester
+//
+// The CT tester queries the certificate transparency logs, via the crt.sh
+// API, for the certificates recently issued for a domain, and fails if any
+// of them was issued by an unexpected certificate authority, catching rogue
+// or unexpected certificates.
+//
+// This test is invoked via input like so:
+//
+//    example.com must run ct with expected-issuer "Let's Encrypt"
+//
+// Multiple issuers can be separated by "|", and each one matches any issuer
+// name containing it, ignoring case:
+//
+//    example.com must run ct with expected-issuer "Let's Encrypt|O=DigiCert Inc"
+//
+// By default the certificates logged within the last 7 days are checked,
+// which can be changed with `window` (e.g. 48h, or 30d). To include all the
+// subdomains of the domain use:
+//
+//    with subdomains true
+//
+// Another crt.sh compatible API can be queried with `api`:
+//
+//    example.com must run ct with expected-issuer "Let's Encrypt" with api https://ct.example.com/
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// CTTest is our object.
+type CTTest struct {
+}
+
+// ctEntry is a certificate returned by the crt.sh API.
+type ctEntry struct {
+	ID             int64  `json:"id"`
+	IssuerName     string `json:"issuer_name"`
+	NameValue      string `json:"name_value"`
+	SerialNumber   string `json:"serial_number"`
+	EntryTimestamp string `json:"entry_timestamp"`
+	NotBefore      string `json:"not_before"`
+}
+
+// The maximum number of unexpected certificates listed in an error
+const ctMaxReported = 5
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *CTTest) Arguments() map[string]string {
+	known := map[string]string{
+		"expected-issuer": ".+",
+		"window":          `^[0-9]+(\.[0-9]+)?(h|d)$`,
+		"subdomains":      "^(true|false)$",
+		"api":             "^https?://.+$",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *CTTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *CTTest) Example() string {
+	str := `
+CT Tester
+---------
+ The CT tester queries the certificate transparency logs, via the crt.sh
+ API, for the certificates recently issued for a domain, and fails if any
+ of them was issued by an unexpected certificate authority, catching rogue
+ or unexpected certificates.
+
+ This test is invoked via input like so:
+
+    example.com must run ct with expected-issuer "Let's Encrypt"
+
+ Multiple issuers can be separated by "|", and each one matches any issuer
+ name containing it, ignoring case:
+
+    example.com must run ct with expected-issuer "Let's Encrypt|O=DigiCert Inc"
+
+ By default the certificates logged within the last 7 days are checked,
+ which can be changed with 'window' (e.g. 48h, or 30d). To include all the
+ subdomains of the domain use:
+
+    with subdomains true
+
+ Another crt.sh compatible API can be queried with 'api':
+
+    example.com must run ct with expected-issuer "Let's Encrypt" with api https://ct.example.com/
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we fetch the certificates logged for the domain, and check
+// the issuer of those logged within the window.
+func (s *CTTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	if tst.Arguments["expected-issuer"] == "" {
+		return errors.New("you must specify the expected-issuer when running a ct test")
+	}
+
+	var issuers []string
+	for _, issuer := range strings.Split(tst.Arguments["expected-issuer"], "|") {
+		if issuer = strings.TrimSpace(issuer); issuer != "" {
+			issuers = append(issuers, strings.ToLower(issuer))
+		}
+	}
+
+	window := 7 * 24 * time.Hour
+	if tst.Arguments["window"] != "" {
+		var err error
+		if window, err = ctParseWindow(tst.Arguments["window"]); err != nil {
+			return err
+		}
+	}
+
+	api := "https://crt.sh/"
+	if tst.Arguments["api"] != "" {
+		api = tst.Arguments["api"]
+	}
+
+	endpoint, err := url.Parse(api)
+	if err != nil {
+		return err
+	}
+
+	query := tst.Target
+	if tst.Arguments["subdomains"] == "true" {
+		query = "%." + query
+	}
+	endpoint.RawQuery = url.Values{"q": []string{query}, "output": []string{"json"}}.Encode()
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("CT API status code was %d not 200", resp.StatusCode)
+	}
+
+	var entries []ctEntry
+	if err = json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("failed to decode the CT API response: %s", err.Error())
+	}
+
+	//
+	// Certificates are logged both as pre-certificates and as final
+	// ones, so only consider each serial number once.
+	//
+	since := time.Now().Add(-window)
+	seen := map[string]bool{}
+	checked := 0
+	var unexpected []string
+
+	for _, entry := range entries {
+		logged, errTime := entry.loggedAt()
+		if errTime != nil {
+			return errTime
+		}
+		if logged.Before(since) {
+			continue
+		}
+
+		key := entry.IssuerName + "/" + entry.SerialNumber
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		checked++
+
+		if !ctExpectedIssuer(entry.IssuerName, issuers) {
+			names := strings.Join(strings.Fields(entry.NameValue), ",")
+			unexpected = append(unexpected, fmt.Sprintf("id %d for %s issued by '%s'", entry.ID, names, entry.IssuerName))
+		}
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Checked %d certificates logged since %s\n", checked, since.Format(time.RFC3339))
+	}
+
+	if len(unexpected) > 0 {
+		count := len(unexpected)
+		if count > ctMaxReported {
+			unexpected = append(unexpected[:ctMaxReported], "...")
+		}
+		return fmt.Errorf("%d certificates issued by unexpected issuers: %s", count, strings.Join(unexpected, "; "))
+	}
+
+	return nil
+}
+
+// loggedAt returns when the certificate was logged, falling back to its
+// validity start.
+func (entry ctEntry) loggedAt() (time.Time, error) {
+	value := entry.EntryTimestamp
+	if value == "" {
+		value = entry.NotBefore
+	}
+
+	// Fractional seconds are accepted even if missing in the layout
+	t, err := time.Parse("2006-01-02T15:04:05", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s' for certificate %d", value, entry.ID)
+	}
+	return t, nil
+}
+
+// ctExpectedIssuer returns true if the issuer name contains any of the
+// expected (lower-cased) issuers.
+func ctExpectedIssuer(issuerName string, issuers []string) bool {
+	issuerName = strings.ToLower(issuerName)
+	for _, issuer := range issuers {
+		if strings.Contains(issuerName, issuer) {
+			return true
+		}
+	}
+	return false
+}
+
+// ctParseWindow parses a window expressed in hours or days, e.g. 48h or 30d.
+func ctParseWindow(window string) (time.Duration, error) {
+	unit := time.Hour
+	if strings.HasSuffix(window, "d") {
+		unit = 24 * time.Hour
+	}
+
+	value, err := strconv.ParseFloat(window[:len(window)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(value * float64(unit)), nil
+}
+
+func (s *CTTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("ct", func() ProtocolTest {
+		return &CTTest{}
+	})
+}
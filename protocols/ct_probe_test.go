@@ -0,0 +1,88 @@
+package protocols
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startCTServer starts a stub crt.sh API, returning the given entries for
+// any query, and recording the last query.
+func startCTServer(t *testing.T, entries []ctEntry, query *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("output") != "json" {
+			http.Error(w, "html not supported", http.StatusBadRequest)
+			return
+		}
+		*query = r.URL.Query().Get("q")
+		json.NewEncoder(w).Encode(entries)
+	}))
+}
+
+func TestCT(t *testing.T) {
+	recent := time.Now().UTC().Add(-24 * time.Hour).Format("2006-01-02T15:04:05.000")
+	old := time.Now().UTC().Add(-30 * 24 * time.Hour).Format("2006-01-02T15:04:05")
+
+	entries := []ctEntry{
+		{ID: 1, IssuerName: "C=US, O=Let's Encrypt, CN=R3", NameValue: "example.com\nwww.example.com", SerialNumber: "01", EntryTimestamp: recent},
+		{ID: 2, IssuerName: "C=US, O=Let's Encrypt, CN=R3", NameValue: "example.com", SerialNumber: "01", EntryTimestamp: recent},
+		{ID: 3, IssuerName: "C=XX, O=Rogue CA", NameValue: "login.example.com", SerialNumber: "02", EntryTimestamp: old},
+	}
+
+	var query string
+	server := startCTServer(t, entries, &query)
+	defer server.Close()
+
+	run := func(args map[string]string) error {
+		args["api"] = server.URL + "/"
+		tst := test.Test{Target: "example.com", Type: "ct", Arguments: args}
+		return (&CTTest{}).RunTest(context.Background(), tst, "example.com", test.Options{Timeout: 5 * time.Second})
+	}
+
+	// The rogue certificate is outside of the default window
+	if err := run(map[string]string{"expected-issuer": "let's encrypt"}); err != nil {
+		t.Errorf("expected recent certificates from the expected issuer to pass: %s", err)
+	}
+	if query != "example.com" {
+		t.Errorf("expected the domain to be queried, got %q", query)
+	}
+
+	err := run(map[string]string{"expected-issuer": "Let's Encrypt", "window": "60d", "subdomains": "true"})
+	if err == nil || !strings.Contains(err.Error(), "1 certificates") || !strings.Contains(err.Error(), "Rogue CA") {
+		t.Errorf("expected the rogue certificate to be reported, got: %v", err)
+	}
+	if query != "%.example.com" {
+		t.Errorf("expected the subdomains to be queried, got %q", query)
+	}
+
+	if err = run(map[string]string{"expected-issuer": "Let's Encrypt|Rogue CA", "window": "60d"}); err != nil {
+		t.Errorf("expected multiple issuers to be allowed: %s", err)
+	}
+
+	if err = run(map[string]string{"expected-issuer": "DigiCert"}); err == nil {
+		t.Errorf("expected certificates from an unexpected issuer to fail")
+	}
+
+	if err = run(map[string]string{}); err == nil {
+		t.Errorf("expected a missing expected-issuer to fail")
+	}
+}
+
+func TestCTParseWindow(t *testing.T) {
+	for input, expected := range map[string]time.Duration{
+		"48h":  48 * time.Hour,
+		"30d":  30 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+	} {
+		window, err := ctParseWindow(input)
+		if err != nil || window != expected {
+			t.Errorf("expected %s to be %s, got %s (%v)", input, expected, window, err)
+		}
+	}
+}
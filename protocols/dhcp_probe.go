@@ -0,0 +1,321 @@
+// DHCP Tester
+//
+// The DHCP tester broadcasts a DHCPDISCOVER message on a network interface,
+// and succeeds if a DHCP server answers with an offer.
+//
+// This test is invoked via input like so:
+//
+//    255.255.255.255 must run dhcp with interface eth0
+//
+// The target is the address the discovery is sent to, usually the
+// broadcast one. You can also ensure the offered address is in a subnet:
+//
+//    255.255.255.255 must run dhcp with interface eth0 with subnet 10.0.0.0/24
+//
+// NOTE: The test needs to bind to the DHCP client port (68), so it must
+// be run with enough privileges, and no DHCP client must be using the port.
+// Binding to an interface is supported on Linux only.
+//
+
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// DHCP message types
+const (
+	dhcpDiscover = 1
+	dhcpOffer    = 2
+)
+
+// DHCP options we use
+const (
+	dhcpOptionSubnetMask  = 1
+	dhcpOptionRouter      = 3
+	dhcpOptionDNS         = 6
+	dhcpOptionMessageType = 53
+	dhcpOptionServerID    = 54
+	dhcpOptionParamList   = 55
+	dhcpOptionEnd         = 255
+)
+
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// DHCPTest is our object.
+type DHCPTest struct {
+}
+
+// dhcpOfferMessage contains the details of a received offer.
+type dhcpOfferMessage struct {
+	Address  net.IP
+	ServerID net.IP
+	Mask     net.IPMask
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *DHCPTest) Arguments() map[string]string {
+	known := map[string]string{
+		"interface":   `^[a-zA-Z0-9._-]+$`,
+		"subnet":      `^[0-9.]+/[0-9]+$`,
+		"port":        "^[0-9]+$",
+		"client-port": "^[0-9]+$",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *DHCPTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *DHCPTest) Example() string {
+	str := `
+DHCP Tester
+-----------
+ The DHCP tester broadcasts a DHCPDISCOVER message on a network interface,
+ and succeeds if a DHCP server answers with an offer.
+
+ This test is invoked via input like so:
+
+    255.255.255.255 must run dhcp with interface eth0
+
+ The target is the address the discovery is sent to, usually the
+ broadcast one. You can also ensure the offered address is in a subnet:
+
+    255.255.255.255 must run dhcp with interface eth0 with subnet 10.0.0.0/24
+
+ NOTE: The test needs to bind to the DHCP client port (68), so it must
+ be run with enough privileges, and no DHCP client must be using the port.
+ Binding to an interface is supported on Linux only.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we send a DHCPDISCOVER, and wait for a matching offer.
+func (s *DHCPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	serverPort := 67
+	if tst.Arguments["port"] != "" {
+		serverPort, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	clientPort := 68
+	if tst.Arguments["client-port"] != "" {
+		clientPort, err = strconv.Atoi(tst.Arguments["client-port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	var subnet *net.IPNet
+	if tst.Arguments["subnet"] != "" {
+		_, subnet, err = net.ParseCIDR(tst.Arguments["subnet"])
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// We identify ourselves with the hardware address of the interface,
+	// if any, otherwise with a random locally-administered one.
+	//
+	iface := tst.Arguments["interface"]
+	hwAddr := make(net.HardwareAddr, 6)
+	if iface != "" {
+		ifi, errIface := net.InterfaceByName(iface)
+		if errIface != nil {
+			return errIface
+		}
+		if len(ifi.HardwareAddr) == 6 {
+			copy(hwAddr, ifi.HardwareAddr)
+		}
+	}
+	if bytes.Equal(hwAddr, make(net.HardwareAddr, 6)) {
+		if _, err = rand.Read(hwAddr); err != nil {
+			return err
+		}
+		hwAddr[0] = (hwAddr[0] | 0x02) & 0xfe
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(target, strconv.Itoa(serverPort)))
+	if err != nil {
+		return err
+	}
+
+	//
+	// We have no address yet, so listen on all of them: the offer will
+	// likely be broadcast.
+	//
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var errControl error
+			err := c.Control(func(fd uintptr) {
+				errControl = dhcpSocketControl(fd, iface)
+			})
+			if err != nil {
+				return err
+			}
+			return errControl
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	pc, err := lc.ListenPacket(ctx, "udp4", ":"+strconv.Itoa(clientPort))
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	if err = pc.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return err
+	}
+
+	xid := make([]byte, 4)
+	if _, err = rand.Read(xid); err != nil {
+		return err
+	}
+
+	if _, err = pc.WriteTo(dhcpDiscoverMessage(xid, hwAddr), raddr); err != nil {
+		return err
+	}
+
+	//
+	// Wait for our offer, ignoring any other DHCP traffic.
+	//
+	buf := make([]byte, 1500)
+	for {
+		n, _, errRead := pc.ReadFrom(buf)
+		if errRead != nil {
+			if netErr, ok := errRead.(net.Error); ok && netErr.Timeout() {
+				return errors.New("no DHCP offer received")
+			}
+			return errRead
+		}
+
+		offer, errParse := dhcpParseOffer(buf[:n], xid)
+		if errParse != nil {
+			continue
+		}
+
+		if opts.Verbose {
+			fmt.Printf("DHCP server %s offered %s\n", offer.ServerID, offer.Address)
+		}
+
+		if subnet != nil && !subnet.Contains(offer.Address) {
+			return fmt.Errorf("offered address %s is not in subnet %s", offer.Address, subnet)
+		}
+
+		return nil
+	}
+}
+
+// dhcpDiscoverMessage builds a DHCPDISCOVER message, see RFC 2131.
+func dhcpDiscoverMessage(xid []byte, hwAddr net.HardwareAddr) []byte {
+	msg := make([]byte, 236)
+	msg[0] = 1 // BOOTREQUEST
+	msg[1] = 1 // Ethernet
+	msg[2] = 6 // Hardware address length
+	copy(msg[4:8], xid)
+
+	// Ask for the reply to be broadcast, as we have no address yet
+	binary.BigEndian.PutUint16(msg[10:12], 0x8000)
+	copy(msg[28:34], hwAddr)
+
+	msg = append(msg, dhcpMagicCookie...)
+	msg = append(msg, dhcpOptionMessageType, 1, dhcpDiscover)
+	msg = append(msg, dhcpOptionParamList, 3, dhcpOptionSubnetMask, dhcpOptionRouter, dhcpOptionDNS)
+	msg = append(msg, dhcpOptionEnd)
+
+	return msg
+}
+
+// dhcpParseOffer parses a DHCPOFFER message replying to the given
+// transaction.
+func dhcpParseOffer(msg []byte, xid []byte) (*dhcpOfferMessage, error) {
+	if len(msg) < 240 {
+		return nil, errors.New("DHCP message too short")
+	}
+	if msg[0] != 2 {
+		return nil, errors.New("not a DHCP reply")
+	}
+	if !bytes.Equal(msg[4:8], xid) {
+		return nil, errors.New("DHCP reply for another transaction")
+	}
+	if !bytes.Equal(msg[236:240], dhcpMagicCookie) {
+		return nil, errors.New("invalid DHCP magic cookie")
+	}
+
+	offer := &dhcpOfferMessage{Address: net.IP(msg[16:20])}
+	messageType := byte(0)
+
+	options := msg[240:]
+	for len(options) > 0 {
+		code := options[0]
+		if code == dhcpOptionEnd {
+			break
+		}
+		// Padding
+		if code == 0 {
+			options = options[1:]
+			continue
+		}
+		if len(options) < 2 || len(options) < 2+int(options[1]) {
+			return nil, errors.New("truncated DHCP option")
+		}
+		value := options[2 : 2+int(options[1])]
+		options = options[2+int(options[1]):]
+
+		switch code {
+		case dhcpOptionMessageType:
+			if len(value) == 1 {
+				messageType = value[0]
+			}
+		case dhcpOptionServerID:
+			offer.ServerID = net.IP(value)
+		case dhcpOptionSubnetMask:
+			offer.Mask = net.IPMask(value)
+		}
+	}
+
+	if messageType != dhcpOffer {
+		return nil, fmt.Errorf("unexpected DHCP message type %d", messageType)
+	}
+
+	return offer, nil
+}
+
+func (s *DHCPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("dhcp", func() ProtocolTest {
+		return &DHCPTest{}
+	})
+}
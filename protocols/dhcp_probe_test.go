@@ -0,0 +1,92 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startDHCPServer starts a stub DHCP server offering the given address.
+func startDHCPServer(t *testing.T, offered net.IP) *net.UDPConn {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < 240 || buf[0] != 1 {
+				continue
+			}
+
+			offer := make([]byte, 236)
+			offer[0] = 2
+			copy(offer[1:3], buf[1:3])
+			copy(offer[4:8], buf[4:8])
+			copy(offer[16:20], offered.To4())
+			copy(offer[28:34], buf[28:34])
+			offer = append(offer, dhcpMagicCookie...)
+			offer = append(offer, dhcpOptionMessageType, 1, dhcpOffer)
+			offer = append(offer, dhcpOptionServerID, 4, 127, 0, 0, 1)
+			offer = append(offer, dhcpOptionSubnetMask, 4, 255, 255, 255, 0)
+			offer = append(offer, dhcpOptionEnd)
+
+			conn.WriteToUDP(offer, addr)
+		}
+	}()
+
+	return conn
+}
+
+// freeUDPPort returns a currently unused UDP port.
+func freeUDPPort(t *testing.T) int {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestDHCP(t *testing.T) {
+	server := startDHCPServer(t, net.ParseIP("10.0.0.42"))
+	defer server.Close()
+
+	run := func(args map[string]string) error {
+		args["port"] = strconv.Itoa(server.LocalAddr().(*net.UDPAddr).Port)
+		args["client-port"] = strconv.Itoa(freeUDPPort(t))
+		tst := test.Test{Target: "127.0.0.1", Type: "dhcp", Arguments: args}
+		return (&DHCPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 2 * time.Second})
+	}
+
+	if err := run(map[string]string{}); err != nil {
+		t.Errorf("expected an offer: %s", err)
+	}
+	if err := run(map[string]string{"subnet": "10.0.0.0/24"}); err != nil {
+		t.Errorf("expected the offer to be in the subnet: %s", err)
+	}
+	if err := run(map[string]string{"subnet": "192.168.0.0/24"}); err == nil {
+		t.Errorf("expected an offer outside the subnet to fail")
+	}
+}
+
+func TestDHCPNoOffer(t *testing.T) {
+	// Nobody is listening on the server port
+	args := map[string]string{
+		"port":        strconv.Itoa(freeUDPPort(t)),
+		"client-port": strconv.Itoa(freeUDPPort(t)),
+	}
+	tst := test.Test{Target: "127.0.0.1", Type: "dhcp", Arguments: args}
+	if err := (&DHCPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 500 * time.Millisecond}); err == nil {
+		t.Errorf("expected a missing offer to fail")
+	}
+}
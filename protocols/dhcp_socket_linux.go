@@ -0,0 +1,18 @@
+package protocols
+
+import "syscall"
+
+// dhcpSocketControl allows the DHCP socket to broadcast, and binds it to
+// the given interface, if any.
+func dhcpSocketControl(fd uintptr, iface string) error {
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); err != nil {
+		return err
+	}
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return err
+	}
+	if iface != "" {
+		return syscall.BindToDevice(int(fd), iface)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package protocols
+
+import "errors"
+
+// dhcpSocketControl is only supported on Linux.
+func dhcpSocketControl(fd uintptr, iface string) error {
+	return errors.New("the dhcp tester is supported on Linux only")
+}
@@ -0,0 +1,126 @@
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// localPortAttempts is how many local ports of the range are tried, in
+// case they are in use, before giving up on a connection.
+const localPortAttempts = 10
+
+// localPortCursor hands out the ports of the local port range in turn,
+// across all the tests, so that the most recently used ports, which are
+// the most likely to still be in use, are reused last.
+var localPortCursor uint32
+
+// localDialer dials like a net.Dialer, but from the ports of the local port
+// range of the options, if any.
+type localDialer struct {
+	net.Dialer
+	ports *test.PortRange
+}
+
+// newDialer returns the dialer for the outbound connections of a test,
+// with the timeout of the options.
+func newDialer(opts test.Options) *localDialer {
+	return &localDialer{Dialer: net.Dialer{Timeout: opts.Timeout}, ports: opts.LocalPorts}
+}
+
+// Dial connects to the address on the named network.
+func (d *localDialer) Dial(network string, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network, using the
+// given context.
+//
+// With a local port range, the next port of the range is bound, with
+// SO_REUSEADDR where supported, so that ports lingering in TIME_WAIT can
+// be reused, and the following ones are tried if it is in use.
+func (d *localDialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if d.ports == nil {
+		return d.Dialer.DialContext(ctx, network, address)
+	}
+
+	attempts := localPortAttempts
+	if size := d.ports.Size(); size < attempts {
+		attempts = size
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		port := d.ports.Min + int(atomic.AddUint32(&localPortCursor, 1)%uint32(d.ports.Size()))
+
+		dialer := d.Dialer
+		dialer.Control = reuseAddressControl
+		switch network {
+		case "udp", "udp4", "udp6":
+			dialer.LocalAddr = &net.UDPAddr{Port: port}
+		default:
+			dialer.LocalAddr = &net.TCPAddr{Port: port}
+		}
+
+		var conn net.Conn
+		conn, err = dialer.DialContext(ctx, network, address)
+		if err == nil || !(errors.Is(err, syscall.EADDRINUSE) || errors.Is(err, syscall.EADDRNOTAVAIL)) {
+			return conn, err
+		}
+	}
+
+	return nil, fmt.Errorf("no free local port in %d-%d: %s", d.ports.Min, d.ports.Max, err.Error())
+}
+
+// DialTLS connects to the address on the named network, and performs the
+// TLS handshake, within the timeout.
+func (d *localDialer) DialTLS(network string, address string, config *tls.Config) (net.Conn, error) {
+	return d.DialTLSContext(context.Background(), network, address, config)
+}
+
+// DialTLSContext connects to the address on the named network, and
+// performs the TLS handshake, within the timeout, using the given context.
+//
+// As with tls.Dial, the server name defaults to the host of the address.
+func (d *localDialer) DialTLSContext(ctx context.Context, network string, address string, config *tls.Config) (net.Conn, error) {
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+
+	raw, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	raw.SetDeadline(deadline(ctx, d.Timeout))
+	conn := tls.Client(raw, config)
+	if err = conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	raw.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// deadline returns when the exchanges of a test must complete: once the
+// timeout elapses, or the context expires if sooner. It is zero, for no
+// deadline, if there is neither.
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var limit time.Time
+	if timeout > 0 {
+		limit = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (limit.IsZero() || ctxDeadline.Before(limit)) {
+		limit = ctxDeadline
+	}
+	return limit
+}
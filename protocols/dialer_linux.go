@@ -0,0 +1,16 @@
+package protocols
+
+import "syscall"
+
+// reuseAddressControl sets SO_REUSEADDR on the socket of an outbound
+// connection, so that a local port can be bound while still in TIME_WAIT.
+func reuseAddressControl(network string, address string, c syscall.RawConn) error {
+	var errSet error
+	err := c.Control(func(fd uintptr) {
+		errSet = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return errSet
+}
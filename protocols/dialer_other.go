@@ -0,0 +1,11 @@
+// +build !linux
+
+package protocols
+
+import "syscall"
+
+// reuseAddressControl leaves the socket unchanged, as SO_REUSEADDR has
+// other semantics outside of Linux.
+func reuseAddressControl(network string, address string, c syscall.RawConn) error {
+	return nil
+}
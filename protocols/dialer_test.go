@@ -0,0 +1,104 @@
+package protocols
+
+import (
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestDialerLocalPortRange(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// A range outside of the ephemeral ports
+	min := 20000 + rand.New(rand.NewSource(time.Now().UnixNano())).Intn(9000)
+	ports := &test.PortRange{Min: min, Max: min + 4}
+	opts := test.Options{Timeout: 5 * time.Second, LocalPorts: ports}
+
+	seen := map[int]bool{}
+	for i := 0; i < 10; i++ {
+		conn, err := newDialer(opts).Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("failed to connect: %s", err)
+		}
+		port := conn.LocalAddr().(*net.TCPAddr).Port
+		conn.Close()
+
+		if port < ports.Min || port > ports.Max {
+			t.Errorf("expected a local port in %d-%d, got %d", ports.Min, ports.Max, port)
+		}
+		seen[port] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("expected the ports of the range to be used in turn, got %v", seen)
+	}
+
+	// UDP sockets are bound in the range too
+	conn, err := newDialer(opts).Dial("udp", "127.0.0.1:9")
+	if err != nil {
+		t.Fatalf("failed to create the UDP socket: %s", err)
+	}
+	if port := conn.LocalAddr().(*net.UDPAddr).Port; port < ports.Min || port > ports.Max {
+		t.Errorf("expected a local UDP port in %d-%d, got %d", ports.Min, ports.Max, port)
+	}
+	conn.Close()
+}
+
+func TestDialerLocalPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// The first port of the range is taken by a listener
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer busy.Close()
+	min := busy.Addr().(*net.TCPAddr).Port
+	if min == 65535 {
+		t.Skip("no room for a range after the busy port")
+	}
+	opts := test.Options{Timeout: 5 * time.Second, LocalPorts: &test.PortRange{Min: min, Max: min + 1}}
+
+	conn, err := newDialer(opts).Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("expected the busy port to be skipped, got: %s", err)
+	}
+	if port := conn.LocalAddr().(*net.TCPAddr).Port; port != min+1 {
+		t.Errorf("expected the free port %d to be used, got %d", min+1, port)
+	}
+	conn.Close()
+
+	// Without any free port, the connection fails
+	opts.LocalPorts = &test.PortRange{Min: min, Max: min}
+	if _, err = newDialer(opts).Dial("tcp", listener.Addr().String()); err == nil {
+		t.Errorf("expected a range without free ports to fail")
+	}
+}
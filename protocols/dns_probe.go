@@ -14,6 +14,7 @@
 package protocols
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -35,7 +36,7 @@ var (
 
 // lookup will perform a DNS query, using the servername-specified.
 // It returns an array of maps of the response.
-func (s *DNSTest) lookup(server string, name string, ltype string, timeout time.Duration) ([]string, error) {
+func (s *DNSTest) lookup(ctx context.Context, server string, name string, ltype string, timeout time.Duration) ([]string, error) {
 
 	var results []string
 
@@ -49,7 +50,7 @@ func (s *DNSTest) lookup(server string, name string, ltype string, timeout time.
 	localc = &dns.Client{
 		ReadTimeout: timeout,
 	}
-	r, err := s.localQuery(server, dns.Fqdn(name), ltype)
+	r, err := s.localQuery(ctx, server, dns.Fqdn(name), ltype)
 	if err != nil || r == nil {
 		return nil, err
 	}
@@ -86,7 +87,7 @@ func (s *DNSTest) lookup(server string, name string, ltype string, timeout time.
 
 // Given a name & type to lookup perform the request against the named
 // DNS-server.
-func (s *DNSTest) localQuery(server string, qname string, lookupType string) (*dns.Msg, error) {
+func (s *DNSTest) localQuery(ctx context.Context, server string, qname string, lookupType string) (*dns.Msg, error) {
 
 	// Here we have a map of DNS type-names.
 	var StringToType = map[string]uint16{
@@ -118,7 +119,7 @@ func (s *DNSTest) localQuery(server string, qname string, lookupType string) (*d
 	//
 	// Run the lookup
 	//
-	r, _, err := localc.Exchange(localm, address)
+	r, _, err := localc.ExchangeContext(ctx, localm, address)
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +175,7 @@ DNS Tester
 // In this case we make a DNS-lookup against the named host, and compare
 // the result with what the user specified.
 // look for a response which appears to be an FTP-server.
-func (s *DNSTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *DNSTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 
 	if tst.Arguments["lookup"] == "" {
 		return errors.New("no value to lookup specified")
@@ -192,7 +193,7 @@ func (s *DNSTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Run the lookup
 	//
-	res, err := s.lookup(target, tst.Arguments["lookup"], tst.Arguments["type"], opts.Timeout)
+	res, err := s.lookup(ctx, target, tst.Arguments["lookup"], tst.Arguments["type"], opts.Timeout)
 	if err != nil {
 		return err
 	}
@@ -3,6 +3,7 @@
 package protocols
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -54,7 +55,7 @@ If fail-at is defined, fails only at the specified counter index, then resets co
 
 // RunTest is the part of our API which is invoked to actually execute a
 // test against the given target.
-func (s *DumbTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *DumbTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	durationMin := 0 * time.Second
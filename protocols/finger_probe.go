@@ -19,9 +19,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -76,7 +76,7 @@ Finger Tester
 //
 // In this case we make a TCP connection, defaulting to port 79, and
 // look for a non-empty response.
-func (s *FINGERTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *FINGERTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -104,7 +104,7 @@ func (s *FINGERTest) RunTest(tst test.Test, target string, opts test.Options) er
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -121,11 +121,19 @@ func (s *FINGERTest) RunTest(tst test.Test, target string, opts test.Options) er
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
+	//
+	// The whole exchange must complete within the timeout.
+	//
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
 	//
 	// Send the username
 	//
@@ -31,8 +31,10 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
@@ -104,7 +106,7 @@ FTP Tester
 //
 // In this case we make a TCP connection, defaulting to port 21, and
 // look for a response which appears to be an FTP-server.
-func (s *FTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *FTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	//
 	// Holder for any error we might encounter.
 	//
@@ -190,7 +192,16 @@ func (s *FTPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	// Make the connection.
 	//
 	var conn *ftp.ServerConn
-	conn, err = ftp.DialTimeout(address, opts.Timeout)
+	conn, err = ftp.Dial(address,
+		ftp.DialWithTimeout(opts.Timeout),
+		ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+			c, err := newDialer(opts).DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			c.SetDeadline(deadline(ctx, opts.Timeout))
+			return c, nil
+		}))
 	if err != nil {
 		return err
 	}
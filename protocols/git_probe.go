@@ -0,0 +1,335 @@
+// Git Tester
+//
+// The Git tester confirms that a repository is reachable on a git server,
+// by fetching its list of references, like `git ls-remote` does.
+//
+// Both the git protocol, and the smart HTTP(S) one are supported:
+//
+//    git://git.example.com/project.git must run git
+//    https://git.example.com/project.git must run git
+//
+// You can also ensure that a branch exists:
+//
+//    https://git.example.com/project.git must run git with branch main
+//
+// Private repositories served over HTTP(S) can be reached via basic
+// authentication:
+//
+//    https://git.example.com/private.git must run git with username 'bob' with password 'secret'
+//
+
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// GitTest is our object.
+type GitTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *GitTest) Arguments() map[string]string {
+	known := map[string]string{
+		"branch":   `^[^\s]+$`,
+		"username": ".*",
+		"password": ".*",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *GitTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *GitTest) Example() string {
+	str := `
+Git Tester
+----------
+ The Git tester confirms that a repository is reachable on a git server,
+ by fetching its list of references, like 'git ls-remote' does.
+
+ Both the git protocol, and the smart HTTP(S) one are supported:
+
+    git://git.example.com/project.git must run git
+    https://git.example.com/project.git must run git
+
+ You can also ensure that a branch exists:
+
+    https://git.example.com/project.git must run git with branch main
+
+ Private repositories served over HTTP(S) can be reached via basic
+ authentication:
+
+    https://git.example.com/private.git must run git with username 'bob' with password 'secret'
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we fetch the references advertised by the server, and
+// optionally look for the given branch.
+func (s *GitTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	u, err := url.Parse(tst.Target)
+	if err != nil {
+		return err
+	}
+
+	var refs map[string]string
+	switch u.Scheme {
+	case "git":
+		refs, err = s.gitRefs(ctx, u, target, opts)
+	case "http", "https":
+		refs, err = s.httpRefs(ctx, u, target, tst, opts)
+	default:
+		return fmt.Errorf("unsupported git scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Git repository advertised %d references\n", len(refs))
+	}
+
+	if tst.Arguments["branch"] != "" {
+		if _, ok := refs["refs/heads/"+tst.Arguments["branch"]]; !ok {
+			return fmt.Errorf("branch '%s' not found", tst.Arguments["branch"])
+		}
+	}
+
+	return nil
+}
+
+// gitRefs fetches the references via the git protocol.
+func (s *GitTest) gitRefs(ctx context.Context, u *url.URL, target string, opts test.Options) (map[string]string, error) {
+	port := "9418"
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	conn, err := newDialer(opts).DialContext(ctx, "tcp", net.JoinHostPort(target, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return nil, err
+	}
+
+	//
+	// Ask for the upload-pack service, which advertises the references
+	// straight away.
+	//
+	request := fmt.Sprintf("git-upload-pack %s\x00host=%s\x00", u.Path, u.Host)
+	if _, err = conn.Write([]byte(gitPktLine(request))); err != nil {
+		return nil, err
+	}
+
+	refs, err := gitReadRefs(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+
+	// Tell the server we don't want anything else
+	conn.Write([]byte("0000"))
+
+	return refs, nil
+}
+
+// httpRefs fetches the references via the smart HTTP protocol.
+func (s *GitTest) httpRefs(ctx context.Context, u *url.URL, target string, tst test.Test, opts test.Options) (map[string]string, error) {
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	address := net.JoinHostPort(target, port)
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	//
+	// Connect to the resolved address, whatever the host of the URL.
+	//
+	dialer := newDialer(opts)
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSClientConfig: &tls.Config{ServerName: u.Hostname(), RootCAs: roots},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	//
+	// Credentials are sent via headers, so they never show up in the
+	// errors we report.
+	//
+	endpoint := *u
+	endpoint.User = nil
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/info/refs"
+	endpoint.RawQuery = "service=git-upload-pack"
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+
+	if tst.Arguments["username"] != "" {
+		req.SetBasicAuth(tst.Arguments["username"], tst.Arguments["password"])
+	} else if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code was %d not 200", resp.StatusCode)
+	}
+
+	//
+	// Dumb servers return a plain list of references, we only support
+	// the smart ones.
+	//
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "application/x-git-upload-pack-advertisement" {
+		return nil, fmt.Errorf("unexpected content-type '%s', not a smart git server", contentType)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+
+	//
+	// The advertisement begins with the service announcement, followed
+	// by a flush-packet.
+	//
+	line, err := gitReadPktLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(line, "\n") != "# service=git-upload-pack" {
+		return nil, fmt.Errorf("unexpected service announcement '%s'", line)
+	}
+	if line, err = gitReadPktLine(reader); err != nil {
+		return nil, err
+	}
+	if line != "" {
+		return nil, errors.New("missing flush-packet after the service announcement")
+	}
+
+	return gitReadRefs(reader)
+}
+
+// gitReadRefs parses the advertised references, until a flush-packet.
+func gitReadRefs(reader *bufio.Reader) (map[string]string, error) {
+	refs := map[string]string{}
+
+	for {
+		line, err := gitReadPktLine(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		// Flush-packet, we're done
+		if line == "" {
+			break
+		}
+
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("git server error: %s", strings.TrimSpace(line[4:]))
+		}
+
+		// The first reference carries the capabilities after a NUL
+		if i := strings.IndexByte(line, 0); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("malformed reference line '%s'", line)
+		}
+
+		refs[fields[1]] = fields[0]
+	}
+
+	return refs, nil
+}
+
+// gitReadPktLine reads a single pkt-line, returning an empty string for
+// a flush-packet.
+func gitReadPktLine(reader io.Reader) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+
+	length, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid pkt-line length '%s'", string(header))
+	}
+	if length == 0 {
+		return "", nil
+	}
+	if length < 4 {
+		return "", fmt.Errorf("invalid pkt-line length %d", length)
+	}
+
+	data := make([]byte, length-4)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// gitPktLine encodes the given payload as a pkt-line.
+func gitPktLine(payload string) string {
+	return fmt.Sprintf("%04x%s", len(payload)+4, payload)
+}
+
+func (s *GitTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("git", func() ProtocolTest {
+		return &GitTest{}
+	})
+}
@@ -0,0 +1,103 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+var gitTestRefs = gitPktLine("1d3fcd5ced445d1abc402225c0b8a1299641f497 refs/heads/main\x00multi_ack\n") +
+	gitPktLine("1d3fcd5ced445d1abc402225c0b8a1299641f497 refs/heads/release-1\n") +
+	"0000"
+
+func TestGitHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("service") != "git-upload-pack" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/project.git/info/refs":
+		case "/private.git/info/refs":
+			if user, pass, ok := r.BasicAuth(); !ok || user != "bob" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-advertisement")
+		w.Write([]byte(gitPktLine("# service=git-upload-pack\n") + "0000" + gitTestRefs))
+	}))
+	defer server.Close()
+
+	run := func(path string, args map[string]string) error {
+		u, _ := url.Parse(server.URL)
+		tst := test.Test{Target: server.URL + path, Type: "git", Arguments: args}
+		return (&GitTest{}).RunTest(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+	}
+
+	if err := run("/project.git", map[string]string{}); err != nil {
+		t.Errorf("expected the repository to be reachable: %s", err)
+	}
+	if err := run("/project.git", map[string]string{"branch": "release-1"}); err != nil {
+		t.Errorf("expected the branch to be found: %s", err)
+	}
+	if err := run("/project.git", map[string]string{"branch": "develop"}); err == nil {
+		t.Errorf("expected a missing branch to fail")
+	}
+	if err := run("/missing.git", map[string]string{}); err == nil {
+		t.Errorf("expected a missing repository to fail")
+	}
+	if err := run("/private.git", map[string]string{}); err == nil {
+		t.Errorf("expected a private repository to fail without credentials")
+	}
+	if err := run("/private.git", map[string]string{"username": "bob", "password": "secret"}); err != nil {
+		t.Errorf("expected a private repository to be reachable with credentials: %s", err)
+	}
+}
+
+func TestGitProtocol(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+
+	requests := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		line, _ := gitReadPktLine(conn)
+		requests <- line
+		conn.Write([]byte(gitTestRefs))
+
+		// Wait for the closing flush-packet
+		gitReadPktLine(conn)
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	tst := test.Test{
+		Target:    "git://localhost:" + port + "/project.git",
+		Type:      "git",
+		Arguments: map[string]string{"branch": "main"},
+	}
+	if err = (&GitTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second}); err != nil {
+		t.Errorf("expected the repository to be reachable: %s", err)
+	}
+
+	if request := <-requests; request != "git-upload-pack /project.git\x00host=localhost:"+port+"\x00" {
+		t.Errorf("unexpected request %q", request)
+	}
+}
@@ -0,0 +1,52 @@
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/cmaster11/overseer/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// dialGRPC returns a connection to the gRPC server at the given address,
+// using TLS unless the config is nil.
+//
+// The connection is established lazily, by the first call, whose error
+// then reports any failure to connect.
+func dialGRPC(ctx context.Context, address string, tlsConfig *tls.Config, opts test.Options) (*grpc.ClientConn, error) {
+	dialer := newDialer(opts)
+
+	transport := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transport = credentials.NewTLS(tlsConfig)
+	}
+
+	return grpc.DialContext(ctx, address,
+		grpc.WithTransportCredentials(transport),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "tcp", addr)
+		}),
+		grpc.WithUserAgent("overseer/probe"),
+	)
+}
+
+// grpcTLSConfig returns the TLS configuration selected by the `tls`
+// argument of a gRPC tester: nil for cleartext, unless it is "on", or
+// "insecure" to not verify the certificate.
+func grpcTLSConfig(tst test.Test, opts test.Options) (*tls.Config, error) {
+	switch tst.Arguments["tls"] {
+	case "":
+		return nil, nil
+	case "insecure":
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{ServerName: tst.Target, RootCAs: roots}, nil
+}
@@ -0,0 +1,160 @@
+// gRPC Tester
+//
+// The gRPC tester calls the standard health service of a gRPC server,
+// grpc.health.v1.Health, and fails unless it answers that it is serving.
+//
+// This test is invoked via input like so:
+//
+//    api.example.com must run grpc [with port 50051]
+//
+// By default the overall health of the server is checked. To check the
+// health of one of its services use:
+//
+//    api.example.com must run grpc with service helloworld.Greeter
+//
+// The test fails as well if the server does not implement the health
+// service.
+//
+// TLS can be used with `with tls on`, or with `with tls insecure` to not
+// verify the certificate.
+//
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cmaster11/overseer/test"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCTest is our object.
+type GRPCTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *GRPCTest) Arguments() map[string]string {
+	known := map[string]string{
+		"service": `^[a-zA-Z0-9_.]+$`,
+		"port":    "^[0-9]+$",
+		"tls":     "^(on|insecure)$",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *GRPCTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *GRPCTest) Example() string {
+	str := `
+gRPC Tester
+-----------
+ The gRPC tester calls the standard health service of a gRPC server,
+ grpc.health.v1.Health, and fails unless it answers that it is serving.
+
+ This test is invoked via input like so:
+
+    api.example.com must run grpc [with port 50051]
+
+ By default the overall health of the server is checked. To check the
+ health of one of its services use:
+
+    api.example.com must run grpc with service helloworld.Greeter
+
+ The test fails as well if the server does not implement the health
+ service.
+
+ TLS can be used with 'with tls on', or with 'with tls insecure' to not
+ verify the certificate.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we call the Check method of the health service, for the
+// given service if any, and expect the SERVING status.
+func (s *GRPCTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	port := 50051
+	if tst.Arguments["port"] != "" {
+		if port, err = strconv.Atoi(tst.Arguments["port"]); err != nil {
+			return err
+		}
+	}
+
+	tlsConfig, err := grpcTLSConfig(tst, opts)
+	if err != nil {
+		return err
+	}
+
+	// The whole exchange must complete within the timeout
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	conn, err := dialGRPC(ctx, net.JoinHostPort(target, strconv.Itoa(port)), tlsConfig, opts)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	service := tst.Arguments["service"]
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.Unimplemented:
+		return errors.New("the server does not implement the gRPC health service")
+	case codes.NotFound:
+		return fmt.Errorf("the service '%s' is unknown to the gRPC health service", service)
+	default:
+		return fmt.Errorf("gRPC health check failed: %s", err.Error())
+	}
+
+	serving := healthStatusName(response.GetStatus())
+
+	if opts.Verbose {
+		fmt.Printf("gRPC health of %s: %s\n", tst.Target, serving)
+	}
+
+	if response.GetStatus() != grpc_health_v1.HealthCheckResponse_SERVING {
+		if service != "" {
+			return fmt.Errorf("the service '%s' is %s", service, serving)
+		}
+		return fmt.Errorf("the server is %s", serving)
+	}
+	return nil
+}
+
+// healthStatusName returns the name of a status of the health service.
+func healthStatusName(serving grpc_health_v1.HealthCheckResponse_ServingStatus) string {
+	if name, ok := grpc_health_v1.HealthCheckResponse_ServingStatus_name[int32(serving)]; ok {
+		return name
+	}
+	return fmt.Sprintf("in the unknown status %d", serving)
+}
+
+func (s *GRPCTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("grpc", func() ProtocolTest {
+		return &GRPCTest{}
+	})
+}
@@ -0,0 +1,92 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startGRPCServer starts a gRPC server, with the services registered by
+// register.
+func startGRPCServer(register func(server *grpc.Server), opts ...grpc.ServerOption) (string, string, func()) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	server := grpc.NewServer(opts...)
+	register(server)
+	go server.Serve(listener)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port, server.Stop
+}
+
+// healthServer registers a health service answering with the statuses of
+// the given services, "" being the whole server.
+func healthServer(statuses map[string]grpc_health_v1.HealthCheckResponse_ServingStatus) func(server *grpc.Server) {
+	return func(server *grpc.Server) {
+		service := health.NewServer()
+		for name, status := range statuses {
+			service.SetServingStatus(name, status)
+		}
+		grpc_health_v1.RegisterHealthServer(server, service)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	host, port, stop := startGRPCServer(healthServer(map[string]grpc_health_v1.HealthCheckResponse_ServingStatus{
+		"":                    grpc_health_v1.HealthCheckResponse_SERVING,
+		"helloworld.Greeter":  grpc_health_v1.HealthCheckResponse_SERVING,
+		"helloworld.Farewell": grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+		"helloworld.Pending":  grpc_health_v1.HealthCheckResponse_UNKNOWN,
+	}))
+	defer stop()
+	_, notServingPort, stop := startGRPCServer(healthServer(map[string]grpc_health_v1.HealthCheckResponse_ServingStatus{
+		"": grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+	}))
+	defer stop()
+	_, unimplementedPort, stop := startGRPCServer(func(server *grpc.Server) {})
+	defer stop()
+
+	tests := []struct {
+		port    string
+		service string
+		failure string
+	}{
+		{port, "", ""},
+		{port, "helloworld.Greeter", ""},
+		{port, "helloworld.Farewell", "the service 'helloworld.Farewell' is NOT_SERVING"},
+		{port, "helloworld.Pending", "the service 'helloworld.Pending' is UNKNOWN"},
+		{port, "helloworld.Missing", "the service 'helloworld.Missing' is unknown to the gRPC health service"},
+		{notServingPort, "", "the server is NOT_SERVING"},
+		{unimplementedPort, "", "the server does not implement the gRPC health service"},
+	}
+
+	for i, tt := range tests {
+		args := map[string]string{"port": tt.port}
+		if tt.service != "" {
+			args["service"] = tt.service
+		}
+		tst := test.Test{Target: host, Type: "grpc", Arguments: args}
+		err := (&GRPCTest{}).RunTest(context.Background(), tst, host, test.Options{Timeout: 5 * time.Second})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+	}
+
+	// Nothing listening
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	_, closedPort, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+	tst := test.Test{Target: host, Type: "grpc", Arguments: map[string]string{"port": closedPort}}
+	if err := (&GRPCTest{}).RunTest(context.Background(), tst, host, test.Options{Timeout: 5 * time.Second}); err == nil || !strings.Contains(err.Error(), "gRPC health check failed") {
+		t.Errorf("expected a closed port to fail, got: %v", err)
+	}
+}
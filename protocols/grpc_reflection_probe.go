@@ -0,0 +1,248 @@
+// gRPC Reflection Tester
+//
+// The gRPC reflection tester asks a gRPC server, via its server reflection
+// service, for the services it registered, and fails if the expected one
+// is not among them, to validate the wiring of a deployment beyond the
+// server being up.
+//
+// This test is invoked via input like so:
+//
+//    api.example.com must run grpc-reflection with service helloworld.Greeter [with port 50051]
+//
+// The test fails as well if the server does not enable reflection. Both
+// the v1 and the older v1alpha versions of the reflection service are
+// supported.
+//
+// TLS can be used with `with tls on`, on port 443 by default, or with
+// `with tls insecure` to not verify the certificate.
+//
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCReflectionTest is our object.
+type GRPCReflectionTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *GRPCReflectionTest) Arguments() map[string]string {
+	known := map[string]string{
+		"service": `^[a-zA-Z0-9_.]+$`,
+		"port":    "^[0-9]+$",
+		"tls":     "^(on|insecure)$",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *GRPCReflectionTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments ensures the expected service is given.
+func (s *GRPCReflectionTest) ValidateArguments(args map[string]string) error {
+	if args["service"] == "" {
+		return errors.New("the expected service must be given with 'service'")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *GRPCReflectionTest) Example() string {
+	str := `
+gRPC Reflection Tester
+----------------------
+ The gRPC reflection tester asks a gRPC server, via its server reflection
+ service, for the services it registered, and fails if the expected one
+ is not among them, to validate the wiring of a deployment beyond the
+ server being up.
+
+ This test is invoked via input like so:
+
+    api.example.com must run grpc-reflection with service helloworld.Greeter [with port 50051]
+
+ The test fails as well if the server does not enable reflection. Both
+ the v1 and the older v1alpha versions of the reflection service are
+ supported.
+
+ TLS can be used with 'with tls on', on port 443 by default, or with
+ 'with tls insecure' to not verify the certificate.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+func (s *GRPCReflectionTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestDetailed(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestDetailed behaves like RunTest, but also returns the services
+// registered by the server.
+//
+// In this case we list the services via the reflection service, falling
+// back to its v1alpha version if the server doesn't implement the v1 one.
+func (s *GRPCReflectionTest) RunTestDetailed(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]interface{}, error) {
+	var err error
+
+	port := 50051
+	if tst.Arguments["tls"] != "" {
+		port = 443
+	}
+	if tst.Arguments["port"] != "" {
+		if port, err = strconv.Atoi(tst.Arguments["port"]); err != nil {
+			return nil, err
+		}
+	}
+
+	tlsConfig, err := grpcTLSConfig(tst, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The whole exchange must complete within the timeout
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	conn, err := dialGRPC(ctx, net.JoinHostPort(target, strconv.Itoa(port)), tlsConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	services, err := s.listServices(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	details := map[string]interface{}{"services": services}
+
+	if opts.Verbose {
+		fmt.Printf("gRPC services of %s: %s\n", tst.Target, strings.Join(services, ", "))
+	}
+
+	for _, service := range services {
+		if service == tst.Arguments["service"] {
+			return details, nil
+		}
+	}
+	return details, fmt.Errorf("the service '%s' is not registered, the server has: %s", tst.Arguments["service"], strings.Join(services, ", "))
+}
+
+// listServices returns the sorted names of the services registered by the
+// server.
+func (s *GRPCReflectionTest) listServices(ctx context.Context, conn *grpc.ClientConn) ([]string, error) {
+	services, err := listServicesV1(ctx, conn)
+	if status.Code(err) == codes.Unimplemented {
+		services, err = listServicesV1Alpha(ctx, conn)
+	}
+	if status.Code(err) == codes.Unimplemented {
+		return nil, errors.New("server reflection is not enabled")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("server reflection failed: %s", err.Error())
+	}
+
+	sort.Strings(services)
+	return services, nil
+}
+
+// listServicesV1 lists the services via the v1 reflection service.
+func listServicesV1(ctx context.Context, conn *grpc.ClientConn) ([]string, error) {
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// On failure Send returns io.EOF, and Recv the status of the call
+	request := &grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{ListServices: "*"},
+	}
+	if err = stream.Send(request); err != nil && err != io.EOF {
+		return nil, err
+	}
+	stream.CloseSend()
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if failure := response.GetErrorResponse(); failure != nil {
+		return nil, errors.New(failure.GetErrorMessage())
+	}
+	if response.GetListServicesResponse() == nil {
+		return nil, errors.New("the services were not listed")
+	}
+
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	return services, nil
+}
+
+// listServicesV1Alpha lists the services via the v1alpha reflection
+// service, for the servers predating the v1 one.
+func listServicesV1Alpha(ctx context.Context, conn *grpc.ClientConn) ([]string, error) {
+	stream, err := grpc_reflection_v1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &grpc_reflection_v1alpha.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_ListServices{ListServices: "*"},
+	}
+	if err = stream.Send(request); err != nil && err != io.EOF {
+		return nil, err
+	}
+	stream.CloseSend()
+
+	response, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if failure := response.GetErrorResponse(); failure != nil {
+		return nil, errors.New(failure.GetErrorMessage())
+	}
+	if response.GetListServicesResponse() == nil {
+		return nil, errors.New("the services were not listed")
+	}
+
+	var services []string
+	for _, service := range response.GetListServicesResponse().GetService() {
+		services = append(services, service.GetName())
+	}
+	return services, nil
+}
+
+func (s *GRPCReflectionTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("grpc-reflection", func() ProtocolTest {
+		return &GRPCReflectionTest{}
+	})
+}
@@ -0,0 +1,112 @@
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// registerGreeter registers a service without methods, only to be listed
+// by the reflection service.
+func registerGreeter(server *grpc.Server) {
+	server.RegisterService(&grpc.ServiceDesc{ServiceName: "helloworld.Greeter", HandlerType: (*interface{})(nil)}, struct{}{})
+}
+
+// reflectionServerV1 registers the greeter, and the v1 reflection service.
+func reflectionServerV1(server *grpc.Server) {
+	registerGreeter(server)
+	grpc_reflection_v1.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{Services: server}))
+}
+
+// reflectionServerV1Alpha registers the greeter, and the v1alpha
+// reflection service.
+func reflectionServerV1Alpha(server *grpc.Server) {
+	registerGreeter(server)
+	grpc_reflection_v1alpha.RegisterServerReflectionServer(server, reflection.NewServer(reflection.ServerOptions{Services: server}))
+}
+
+func TestGRPCReflection(t *testing.T) {
+	host, v1Port, stop := startGRPCServer(reflectionServerV1)
+	defer stop()
+	_, alphaPort, stop := startGRPCServer(reflectionServerV1Alpha)
+	defer stop()
+	_, disabledPort, stop := startGRPCServer(registerGreeter)
+	defer stop()
+
+	tests := []struct {
+		port    string
+		service string
+		failure string
+	}{
+		{v1Port, "helloworld.Greeter", ""},
+		{alphaPort, "helloworld.Greeter", ""},
+		{v1Port, "helloworld.Farewell", "the service 'helloworld.Farewell' is not registered, the server has: grpc.reflection.v1.ServerReflection, helloworld.Greeter"},
+		{alphaPort, "helloworld.Farewell", "the server has: grpc.reflection.v1alpha.ServerReflection, helloworld.Greeter"},
+		{disabledPort, "helloworld.Greeter", "server reflection is not enabled"},
+	}
+
+	for i, tt := range tests {
+		args := map[string]string{"service": tt.service, "port": tt.port}
+		tst := test.Test{Target: host, Type: "grpc-reflection", Arguments: args}
+		details, err := (&GRPCReflectionTest{}).RunTestDetailed(context.Background(), tst, host, test.Options{Timeout: 5 * time.Second})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+		if tt.failure == "" && len(details["services"].([]string)) != 2 {
+			t.Errorf("test %d: expected the services in the details, got: %v", i, details)
+		}
+	}
+
+	// The timeout covers the whole exchange
+	_, slowPort, stop := startGRPCServer(func(server *grpc.Server) {}, grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+		time.Sleep(500 * time.Millisecond)
+		return nil
+	}))
+	defer stop()
+	tst := test.Test{Target: host, Type: "grpc-reflection", Arguments: map[string]string{"service": "helloworld.Greeter", "port": slowPort}}
+	if err := (&GRPCReflectionTest{}).RunTest(context.Background(), tst, host, test.Options{Timeout: 100 * time.Millisecond}); err == nil {
+		t.Errorf("expected a slow server to time out")
+	}
+}
+
+func TestGRPCReflectionTLS(t *testing.T) {
+	root, rootKey := issueCertificate(t, "Overseer Root", true, nil, nil)
+	leaf, leafKey := issueCertificate(t, "localhost", false, root, rootKey)
+	certificate := tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey, Leaf: leaf}
+
+	host, port, stop := startGRPCServer(reflectionServerV1, grpc.Creds(credentials.NewServerTLSFromCert(&certificate)))
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	run := func(mode string, opts test.Options) error {
+		args := map[string]string{"service": "helloworld.Greeter", "port": port, "tls": mode}
+		tst := test.Test{Target: host, Type: "grpc-reflection", Arguments: args}
+		opts.Timeout = 5 * time.Second
+		return (&GRPCReflectionTest{}).RunTest(context.Background(), tst, host, opts)
+	}
+
+	if err := run("on", test.Options{RootCAs: roots}); err != nil {
+		t.Errorf("expected a trusted server to pass, got: %s", err)
+	}
+	if err := run("on", test.Options{}); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected an untrusted server to fail, got: %v", err)
+	}
+	if err := run("insecure", test.Options{}); err != nil {
+		t.Errorf("expected an insecure test to pass, got: %s", err)
+	}
+}
@@ -0,0 +1,176 @@
+package protocols
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheStatusHeaders are the headers caching proxies and CDNs report the
+// cache status of a response with, e.g. "HIT" or "MISS".
+var cacheStatusHeaders = []string{"X-Cache", "X-Cache-Status", "CF-Cache-Status"}
+
+// observedCacheHeaders returns the cache headers of a response, keyed by
+// their lower-cased names, with dashes replaced by underscores, so that
+// they can be captured.
+func observedCacheHeaders(header http.Header) map[string]string {
+	observed := map[string]string{}
+	for _, name := range append([]string{"Age"}, cacheStatusHeaders...) {
+		if value := header.Get(name); value != "" {
+			observed[strings.ToLower(strings.Replace(name, "-", "_", -1))] = value
+		}
+	}
+	return observed
+}
+
+// checkCacheHit returns an error if the response was not served from the
+// cache.
+//
+// If a cache status header is present, it must contain the expected
+// status (ignoring case), otherwise the response must have an Age header,
+// which only caches add.
+func checkCacheHit(header http.Header, expected string) error {
+	observed := observedCacheHeaders(header)
+
+	found := false
+	for _, name := range cacheStatusHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		found = true
+		if strings.Contains(strings.ToLower(value), strings.ToLower(expected)) {
+			return nil
+		}
+	}
+
+	if !found && observed["age"] != "" {
+		return nil
+	}
+
+	if len(observed) == 0 {
+		return fmt.Errorf("response was not served from the cache, no cache headers found")
+	}
+
+	var headers []string
+	for name, value := range observed {
+		headers = append(headers, fmt.Sprintf("%s: %s", name, value))
+	}
+	sort.Strings(headers)
+	return fmt.Errorf("response was not served from the cache with status '%s', cache headers were %s", expected, strings.Join(headers, ", "))
+}
+
+// parseCacheControl returns the directives of a Cache-Control header, keyed
+// by their lower-cased names, with their values, if any.
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		parts := strings.SplitN(directive, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		directives[name] = ""
+		if len(parts) == 2 {
+			directives[name] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+		}
+	}
+	return directives
+}
+
+// parseCacheTTL parses a duration, which may also be given in days, e.g.
+// "7d".
+func parseCacheTTL(value string) (time.Duration, error) {
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// cacheLifetime returns how long a response can be cached for, from its
+// s-maxage or max-age directive, or else from its Expires header, and if
+// any of them was set.
+func cacheLifetime(header http.Header, directives map[string]string, now time.Time) (time.Duration, bool, error) {
+	for _, name := range []string{"s-maxage", "max-age"} {
+		value, ok := directives[name]
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0, true, fmt.Errorf("invalid %s directive '%s'", name, value)
+		}
+		return time.Duration(seconds) * time.Second, true, nil
+	}
+
+	if header.Get("Expires") == "" {
+		return 0, false, nil
+	}
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid Expires header '%s'", header.Get("Expires"))
+	}
+
+	// The lifetime is relative to the clock of the server, if known
+	if date, errDate := http.ParseTime(header.Get("Date")); errDate == nil {
+		now = date
+	}
+	return expires.Sub(now), true, nil
+}
+
+// checkCacheControl returns an error if the caching headers of a response
+// are missing or misconfigured.
+//
+// The Cache-Control header must contain each of the required directives,
+// given as a comma-separated list of names, or of name=value pairs to also
+// match their values. If minTTL is > 0, the response must be cacheable for
+// at least that long.
+func checkCacheControl(header http.Header, required string, minTTL time.Duration, now time.Time) error {
+	cacheControl := header.Get("Cache-Control")
+	directives := parseCacheControl(cacheControl)
+
+	if required != "" {
+		if cacheControl == "" {
+			return fmt.Errorf("no Cache-Control header")
+		}
+		for name, value := range parseCacheControl(required) {
+			found, ok := directives[name]
+			if !ok {
+				return fmt.Errorf("Cache-Control header '%s' doesn't contain '%s'", cacheControl, name)
+			}
+			if value != "" && found != value {
+				return fmt.Errorf("Cache-Control header '%s' has %s=%s, not %s", cacheControl, name, found, value)
+			}
+		}
+	}
+
+	// Even if not required, a broken Expires header is a misconfiguration
+	lifetime, found, err := cacheLifetime(header, directives, now)
+	if err != nil {
+		return err
+	}
+
+	if minTTL > 0 {
+		for _, name := range []string{"no-store", "no-cache", "private"} {
+			if _, ok := directives[name]; ok {
+				return fmt.Errorf("response is not cacheable, Cache-Control header was '%s'", cacheControl)
+			}
+		}
+		if !found {
+			return fmt.Errorf("response has no caching lifetime, neither max-age nor Expires were set")
+		}
+		if lifetime < minTTL {
+			return fmt.Errorf("response is cacheable for %s, not at least %s", lifetime, minTTL)
+		}
+	}
+
+	return nil
+}
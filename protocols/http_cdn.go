@@ -0,0 +1,59 @@
+package protocols
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// observedPOP returns the edge POP of a CDN which served a response, as
+// reported by the headers of the main providers, along with the header it
+// was found in.
+//
+// POPs are named after the nearest airport, e.g. "AMS", which is how they
+// are reported by:
+//
+//  - Cloudflare, at the end of CF-Ray, e.g. "7d5e8c4f0a1b2c3d-AMS".
+//  - Fastly, at the end of X-Served-By, whose last cache is the edge one,
+//    e.g. "cache-iad-kiad7000025-IAD, cache-ams21024-AMS".
+//  - CloudFront, at the start of X-Amz-Cf-Pop, e.g. "AMS50-C1".
+func observedPOP(header http.Header) (string, string) {
+	if value := header.Get("CF-Ray"); value != "" {
+		return strings.ToUpper(value[strings.LastIndex(value, "-")+1:]), "CF-Ray"
+	}
+
+	if value := header.Get("X-Served-By"); value != "" {
+		caches := strings.Split(value, ",")
+		edge := strings.TrimSpace(caches[len(caches)-1])
+		return strings.ToUpper(edge[strings.LastIndex(edge, "-")+1:]), "X-Served-By"
+	}
+
+	if value := header.Get("X-Amz-Cf-Pop"); value != "" {
+		code := value
+		for i, c := range value {
+			if c < 'A' || c > 'Z' {
+				code = value[:i]
+				break
+			}
+		}
+		return code, "X-Amz-Cf-Pop"
+	}
+
+	return "", ""
+}
+
+// checkPOP returns an error if the response was not served by one of the
+// expected POPs, given as a comma-separated list.
+func checkPOP(header http.Header, expected string) error {
+	pop, source := observedPOP(header)
+	if pop == "" {
+		return fmt.Errorf("no header tells the POP which served the response, expected one of %s", expected)
+	}
+
+	for _, allowed := range strings.Split(expected, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), pop) {
+			return nil
+		}
+	}
+	return fmt.Errorf("response was served by the POP '%s' (from %s: %s), not one of %s", pop, source, header.Get(source), expected)
+}
@@ -0,0 +1,69 @@
+package protocols
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// The modes in which a body can be compared with the content of a file
+const (
+	contentModeSubstring = "substring"
+	contentModeExact     = "exact"
+	contentModeSHA256    = "sha256"
+)
+
+var sha256Digest = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// loadContentFile returns the expected content stored in the given file.
+//
+// In sha256 mode the file contains the hex-encoded digest of the body,
+// optionally followed by a file name like `sha256sum` outputs.
+func loadContentFile(path string, mode string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != contentModeSHA256 {
+		return content, nil
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 || !sha256Digest.MatchString(fields[0]) {
+		return nil, fmt.Errorf("content file %s does not contain a SHA-256 digest", path)
+	}
+
+	return []byte(strings.ToLower(fields[0])), nil
+}
+
+// checkContentFile compares the body with the content of the given file,
+// in the given mode.
+func checkContentFile(path string, mode string, body []byte) error {
+	expected, err := loadContentFile(path, mode)
+	if err != nil {
+		return err
+	}
+
+	switch mode {
+	case contentModeExact:
+		if !bytes.Equal(body, expected) {
+			return fmt.Errorf("body (%d bytes) didn't match the content of %s (%d bytes)", len(body), path, len(expected))
+		}
+	case contentModeSHA256:
+		digest := sha256.Sum256(body)
+		if actual := hex.EncodeToString(digest[:]); actual != string(expected) {
+			return fmt.Errorf("body SHA-256 digest was %s not %s", actual, string(expected))
+		}
+	default:
+		if !bytes.Contains(body, expected) {
+			return fmt.Errorf("body didn't contain the content of %s", path)
+		}
+	}
+
+	return nil
+}
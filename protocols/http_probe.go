@@ -35,6 +35,12 @@
 //
 // https://steve.fi/ must run http with not-content 'Steve Kemp'
 //
+// For large expected bodies, the content can be read from a file instead,
+// and the body can be required to contain it (the default), to be exactly
+// it, or to have the SHA-256 digest it holds (like `sha256sum` outputs):
+//
+//   https://example.com/ must run http with content-file /etc/overseer/home.html with content-mode exact
+//
 // The 'content' setting looks for a literal match in the response-body,
 // if you're looking for something more flexible you can instead test that
 // the response-body matches a given regular-expression:
@@ -49,6 +55,26 @@
 // (The regular expression will be assumed to be multi-line, and
 // will also allow newlines to be matched with ".".)
 //
+// Named groups of the pattern can be captured, and their values will be
+// included in the test result under "captures", e.g. to track the deployed
+// version of a service:
+//
+//   https://example.com/version must run http with pattern 'v(?P<version>[0-9.]+)' with capture version
+//
+// To catch structural regressions of an API, the response body can be
+// validated against a JSON schema file:
+//
+//   https://example.com/api/status must run http with json-schema /etc/overseer/status.schema.json
+//
+// To test a backend serving multiple virtual hosts, you can override the
+// Host header sent, independently of the address connected to and of the
+// TLS server name, which both come from the URL:
+//
+//    https://backend1.example.com/ must run http with host-header www.example.com
+//
+// (The header is only sent with the first request, not when following
+// redirects.)
+//
 // If your URL requires the use of HTTP basic authentication this is
 // supported by adding a username and password parameter to your test,
 // for example:
@@ -89,6 +115,62 @@
 //    https://steve.fi/Security/XSS/Tutorial/filter.cgi must run http with method PUT with data "text=test%20me" with content "test me"
 //
 //
+// To confirm that the server compresses its responses, use:
+//
+//    https://example.com/ must run http with require-compression true
+//
+// Or to assert a specific encoding (e.g. gzip, br, deflate):
+//
+//    https://example.com/ must run http with content-encoding br
+//
+// To check that a caching proxy or CDN serves the page from its cache, two
+// requests are made, and the second one must have a cache status header
+// (X-Cache, X-Cache-Status or CF-Cache-Status) containing the given
+// status, or an Age header if there is none. The observed cache headers
+// are captured in the result:
+//
+//    https://www.example.com/ must run http with cache-status HIT
+//
+// To catch CDN routing anomalies, the response can be required to be
+// served by one of some edge POPs, as told by the CF-Ray, X-Served-By or
+// X-Amz-Cf-Pop headers. POPs are named after the nearest airport, and the
+// observed POP is captured in the result:
+//
+//    https://www.example.com/ must run http with expected-pop AMS,FRA
+//
+// To check the caching headers of static assets, the Cache-Control header
+// can be required to contain some directives, optionally with their
+// values, and the response can be required to be cacheable for at least
+// some time, via its max-age (or s-maxage) directive, or else its Expires
+// header. An invalid Expires header always fails these checks, and the
+// observed headers are captured in the result:
+//
+//    https://www.example.com/app.js must run http with cache-control public,immutable with cache-ttl 7d
+//
+// To catch large downloads slowed down to a trickle, the body can be
+// required to be transferred at a minimum rate, in bytes per second, with
+// an optional k, M or G multiplier. The rate is measured from the response
+// headers to the end of the body, which must be read within the timeout,
+// and is captured in the result, in bytes per second:
+//
+//    https://downloads.example.com/release.iso must run http with min-throughput 5M
+//
+// Servers often omit the intermediate certificates, which browsers fetch
+// by themselves, but most other clients don't. To fail unless the chain
+// sent by the server builds to a trusted root on its own use:
+//
+//    https://steve.fi/ must run http with chain-complete true
+//
+// Like with the SSL tester, the certificate can be pinned, via its SHA-256
+// fingerprint or the one of its public key, reported in the result:
+//
+//    https://steve.fi/ must run http with cert-pin sha256/x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4=
+//
+// Response headers, e.g. the version of the deployed application, can be
+// captured in the result, under their lowercase name with underscores:
+//
+//    https://www.example.com/ must run http with capture-header X-App-Version
+//
 // NOTE: This test deliberately does not follow redirections, to allow
 // enhanced testing.
 //
@@ -103,9 +185,14 @@ package protocols
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
@@ -129,13 +216,18 @@ type HTTPTest struct {
 func (s *HTTPTest) Arguments() map[string]string {
 	known := map[string]string{
 		"user-agent":          ".*",
+		"host-header":         `^[a-zA-Z0-9.\-\[\]:]+$`,
 		"content":             ".*",
 		"not-content":         ".*",
+		"content-file":        ".+",
+		"content-mode":        "^(substring|exact|sha256)$",
 		"data":                ".*",
 		"expiration":          "^(any|[0-9]+[hd]?)$",
 		"method":              "^(GET|HEAD|POST|PUT|PATCH|DELETE)$",
 		"password":            ".*",
 		"pattern":             ".*",
+		"capture":             `^[a-zA-Z0-9_]+(,[a-zA-Z0-9_]+)*$`,
+		"json-schema":         ".+",
 		"not-pattern":         ".*",
 		"status":              "^(any|[0-9]{3}(?:,[0-9]{3})*)$",
 		"tls":                 "insecure",
@@ -145,10 +237,48 @@ func (s *HTTPTest) Arguments() map[string]string {
 		"tls-timeout":         `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
 		"resp-header-timeout": `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
 		"follow-redirect":     `^true|false|(\d+)$`,
+		"require-compression": "^(true|false)$",
+		"content-encoding":    `^(gzip|br|deflate|zstd|compress)$`,
+		"cache-status":        `^[a-zA-Z_\-]+$`,
+		"expected-pop":        `^[a-zA-Z0-9]+(,[a-zA-Z0-9]+)*$`,
+		"cache-control":       `^[a-zA-Z\-]+(=[a-zA-Z0-9\-]+)?(,[a-zA-Z\-]+(=[a-zA-Z0-9\-]+)?)*$`,
+		"cache-ttl":           `^[0-9]+(s|m|h|d)$`,
+		"min-throughput":      `^[0-9]+(\.[0-9]+)?(k|M|G)?$`,
+		"chain-complete":      "^(true|false)$",
+		"cert-pin":            certPinPattern,
+		"capture-header":      `^[a-zA-Z0-9\-]+(,[a-zA-Z0-9\-]+)*$`,
 	}
 	return known
 }
 
+// ValidateArguments ensures any JSON schema, or content file, can be
+// loaded, so that broken files are reported when parsing the test.
+func (s *HTTPTest) ValidateArguments(args map[string]string) error {
+	if args["json-schema"] != "" {
+		if _, err := loadJSONSchema(args["json-schema"]); err != nil {
+			return err
+		}
+	}
+	if args["content-file"] != "" {
+		if _, err := loadContentFile(args["content-file"], args["content-mode"]); err != nil {
+			return err
+		}
+	} else if args["content-mode"] != "" {
+		return fmt.Errorf("content-mode requires a content-file")
+	}
+	if args["cache-ttl"] != "" {
+		if _, err := parseCacheTTL(args["cache-ttl"]); err != nil {
+			return err
+		}
+	}
+	if args["min-throughput"] != "" {
+		if _, err := parseThroughput(args["min-throughput"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
 func (s *HTTPTest) ShouldResolveHostname() bool {
 	return true
@@ -194,6 +324,12 @@ HTTP Tester
 
    https://steve.fi/ must run http with not-content 'Steve Kemp'
 
+ For large expected bodies, the content can be read from a file instead,
+ and the body can be required to contain it (the default), to be exactly
+ it, or to have the SHA-256 digest it holds (like 'sha256sum' outputs):
+
+   https://example.com/ must run http with content-file /etc/overseer/home.html with content-mode exact
+
  The 'content' setting looks for a literal match in the response-body,
  if you're looking for something more flexible you can instead test that
  the response-body matches a given regular-expression:
@@ -208,6 +344,26 @@ HTTP Tester
  (The regular expression will be assumed to be multi-line, and
  will also allow newlines to be matched with ".".)
 
+ Named groups of the pattern can be captured, and their values will be
+ included in the test result under "captures", e.g. to track the deployed
+ version of a service:
+
+   https://example.com/version must run http with pattern 'v(?P<version>[0-9.]+)' with capture version
+
+ To catch structural regressions of an API, the response body can be
+ validated against a JSON schema file:
+
+   https://example.com/api/status must run http with json-schema /etc/overseer/status.schema.json
+
+ To test a backend serving multiple virtual hosts, you can override the
+ Host header sent, independently of the address connected to and of the
+ TLS server name, which both come from the URL:
+
+    https://backend1.example.com/ must run http with host-header www.example.com
+
+ (The header is only sent with the first request, not when following
+ redirects.)
+
  If your URL requires the use of HTTP basic authentication this is
  supported by adding a username and password parameter to your test,
  for example:
@@ -247,6 +403,62 @@ HTTP Tester
 
     https://steve.fi/Security/XSS/Tutorial/filter.cgi must run http with method PUT with data "text=test%20me" with content "test me"
 
+ To confirm that the server compresses its responses, use:
+
+    https://example.com/ must run http with require-compression true
+
+ Or to assert a specific encoding (e.g. gzip, br, deflate):
+
+    https://example.com/ must run http with content-encoding br
+
+ To check that a caching proxy or CDN serves the page from its cache, two
+ requests are made, and the second one must have a cache status header
+ (X-Cache, X-Cache-Status or CF-Cache-Status) containing the given
+ status, or an Age header if there is none. The observed cache headers
+ are captured in the result:
+
+    https://www.example.com/ must run http with cache-status HIT
+
+ To catch CDN routing anomalies, the response can be required to be
+ served by one of some edge POPs, as told by the CF-Ray, X-Served-By or
+ X-Amz-Cf-Pop headers. POPs are named after the nearest airport, and the
+ observed POP is captured in the result:
+
+    https://www.example.com/ must run http with expected-pop AMS,FRA
+
+ To check the caching headers of static assets, the Cache-Control header
+ can be required to contain some directives, optionally with their
+ values, and the response can be required to be cacheable for at least
+ some time, via its max-age (or s-maxage) directive, or else its Expires
+ header. An invalid Expires header always fails these checks, and the
+ observed headers are captured in the result:
+
+    https://www.example.com/app.js must run http with cache-control public,immutable with cache-ttl 7d
+
+ To catch large downloads slowed down to a trickle, the body can be
+ required to be transferred at a minimum rate, in bytes per second, with
+ an optional k, M or G multiplier. The rate is measured from the response
+ headers to the end of the body, which must be read within the timeout,
+ and is captured in the result, in bytes per second:
+
+    https://downloads.example.com/release.iso must run http with min-throughput 5M
+
+ Servers often omit the intermediate certificates, which browsers fetch
+ by themselves, but most other clients don't. To fail unless the chain
+ sent by the server builds to a trusted root on its own use:
+
+    https://steve.fi/ must run http with chain-complete true
+
+ Like with the SSL tester, the certificate can be pinned, via its SHA-256
+ fingerprint or the one of its public key, reported in the result:
+
+    https://steve.fi/ must run http with cert-pin sha256/x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4=
+
+ Response headers, e.g. the version of the deployed application, can be
+ captured in the result, under their lowercase name with underscores:
+
+    https://www.example.com/ must run http with capture-header X-App-Version
+
  Do note that the HTTP-probe never follow redirections, to allow enhanced
  testing.
 
@@ -272,7 +484,35 @@ HTTP Tester
 //
 //    target => "176.9.183.100"
 //
-func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *HTTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestCapture(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestCapture runs the test, also returning the values of the named
+// groups of the pattern which were requested via the capture argument,
+// and the observed cache headers when checking a cache.
+func (s *HTTPTest) RunTestCapture(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]string, error) {
+	captures := map[string]string{}
+	err := s.run(ctx, tst, target, opts, captures, map[string]interface{}{})
+	return captures, err
+}
+
+// RunTestDetailed runs the test, also returning the status code, the
+// latency (up to the response headers) and the size of the body of the
+// response, along with the captured values.
+func (s *HTTPTest) RunTestDetailed(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]interface{}, error) {
+	captures := map[string]string{}
+	details := map[string]interface{}{}
+	err := s.run(ctx, tst, target, opts, captures, details)
+	if len(captures) > 0 {
+		details[CapturesDetail] = captures
+	}
+	return details, err
+}
+
+// run executes the test, filling the given captures and details maps.
+func (s *HTTPTest) run(ctx context.Context, tst test.Test, target string, opts test.Options, captures map[string]string, details map[string]interface{}) error {
 
 	//
 	// Determine the port to connect to, initially via the protocol
@@ -310,9 +550,11 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	target = strings.Replace(target, "__pt-time-ms__", strconv.FormatInt(opts.PeriodTestStartTime, 10), -1)
 
 	//
-	// Setup a dialer which will be dual-stack
+	// Setup a dialer which will be dual-stack, without a timeout of its
+	// own unless connect-timeout is given, as the request has one
 	//
-	dialer := &net.Dialer{}
+	dialer := newDialer(opts)
+	dialer.Timeout = 0
 
 	if connectTimeoutString := tst.Arguments["connect-timeout"]; connectTimeoutString != "" {
 		connectTimeout, errParse := time.ParseDuration(connectTimeoutString)
@@ -405,6 +647,36 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		tr.ResponseHeaderTimeout = headerTimeout
 	}
 
+	//
+	// Trust any custom certificate authority.
+	//
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+	if roots != nil {
+		tr.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+
+	//
+	// Check the chain sent by the server we test before the request,
+	// which would fail on an incomplete chain without saying why.
+	//
+	if u.Scheme == "https" && tst.Arguments["chain-complete"] == "true" {
+		if err = checkChainComplete(ctx, net.JoinHostPort(address, port), u.Hostname(), roots, opts); err != nil {
+			return err
+		}
+	}
+	if u.Scheme == "https" && tst.Arguments["cert-pin"] != "" {
+		fingerprint, errPin := checkCertPin(ctx, net.JoinHostPort(address, port), u.Hostname(), tst.Arguments["cert-pin"], opts)
+		if fingerprint != "" {
+			details["fingerprint"] = fingerprint
+		}
+		if errPin != nil {
+			return errPin
+		}
+	}
+
 	//
 	// If we're running insecurely then ignore SSL errors
 	//
@@ -466,14 +738,14 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	// If we have no data then make a GET request
 	//
 	if tst.Arguments["data"] == "" {
-		req, err = http.NewRequest(method, target, nil)
+		req, err = http.NewRequestWithContext(ctx, method, target, nil)
 	} else {
 
 		//
 		// Otherwise make a HTTP POST request, with
 		// the specified data.
 		//
-		req, err = http.NewRequest(method, target,
+		req, err = http.NewRequestWithContext(ctx, method, target,
 			bytes.NewBuffer([]byte(tst.Arguments["data"])))
 	}
 	if err != nil {
@@ -488,6 +760,13 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 			tst.Arguments["password"])
 	}
 
+	//
+	// Are we overriding the virtual host?
+	//
+	if tst.Arguments["host-header"] != "" {
+		req.Host = tst.Arguments["host-header"]
+	}
+
 	//
 	// Set a suitable user-agent
 	//
@@ -497,19 +776,91 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		req.Header.Set("User-Agent", "overseer/probe")
 	}
 
+	//
+	// If we're checking compression, we explicitly ask for it.  This
+	// also stops the transport from transparently decompressing the
+	// response, so that we can see the real encoding.
+	//
+	checkCompression := tst.Arguments["require-compression"] == "true" || tst.Arguments["content-encoding"] != ""
+	if checkCompression {
+		acceptEncoding := "gzip, deflate, br"
+		if tst.Arguments["content-encoding"] != "" {
+			acceptEncoding = tst.Arguments["content-encoding"]
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	//
+	// If we're checking a caching layer, a first request warms its
+	// cache, so that the actual one can be served from it.
+	//
+	if tst.Arguments["cache-status"] != "" {
+		warm := req.Clone(req.Context())
+		if tst.Arguments["data"] != "" {
+			warm.Body = ioutil.NopCloser(bytes.NewBuffer([]byte(tst.Arguments["data"])))
+		}
+
+		redirects := maxFollowRedirects
+		warmResponse, errWarm := netClient.Do(warm)
+		if errWarm != nil {
+			return fmt.Errorf("failed to warm the cache: %s", errWarm.Error())
+		}
+		io.Copy(ioutil.Discard, warmResponse.Body)
+		warmResponse.Body.Close()
+		maxFollowRedirects = redirects
+	}
+
 	//
 	// Perform the request
 	//
+	requestStart := time.Now()
 	response, err := netClient.Do(req)
 	if err != nil {
 		return err
 	}
+	details["statusCode"] = response.StatusCode
+	details["latencyMs"] = time.Since(requestStart).Milliseconds()
+
+	if tst.Arguments["capture-header"] != "" {
+		for _, name := range strings.Split(tst.Arguments["capture-header"], ",") {
+			if value := response.Header.Get(name); value != "" {
+				captures[strings.ToLower(strings.Replace(name, "-", "_", -1))] = value
+			}
+		}
+	}
 
 	//
 	// Get the body and status-code.
 	//
 	defer response.Body.Close()
+	readStart := time.Now()
 	body, err := ioutil.ReadAll(response.Body)
+	details["bodySize"] = len(body)
+	details["bodyHash"] = fmt.Sprintf("%x", sha256.Sum256(body))
+
+	//
+	// Was the body transferred fast enough?  A body which could not be
+	// read within the timeout is reported with the rate reached so far.
+	//
+	if tst.Arguments["min-throughput"] != "" {
+		minRate, errParse := parseThroughput(tst.Arguments["min-throughput"])
+		if errParse != nil {
+			return errParse
+		}
+
+		rate := transferRate(len(body), time.Since(readStart))
+		captures["throughput"] = strconv.FormatFloat(rate, 'f', 0, 64)
+		if opts.Verbose {
+			fmt.Printf("HTTP body of %d bytes transferred at %s\n", len(body), formatThroughput(rate))
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read the body, after %d bytes at %s: %s", len(body), formatThroughput(rate), err.Error())
+		}
+		if rate < minRate {
+			return fmt.Errorf("the body of %d bytes was transferred at %s, below the minimum of %s", len(body), formatThroughput(rate), formatThroughput(minRate))
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -567,6 +918,91 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 
 	}
 
+	//
+	// Was the response compressed as expected? Only checked once the
+	// status is, as error pages often aren't.
+	//
+	if checkCompression {
+		encoding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+
+		if opts.Verbose {
+			fmt.Printf("HTTP content-encoding: '%s'\n", encoding)
+		}
+
+		if tst.Arguments["content-encoding"] != "" && encoding != tst.Arguments["content-encoding"] {
+			return fmt.Errorf("response content-encoding was '%s' not '%s'", encoding, tst.Arguments["content-encoding"])
+		}
+		if encoding == "" || encoding == "identity" {
+			return fmt.Errorf("response was not compressed, its content-encoding was '%s'", encoding)
+		}
+
+		body, err = s.decodeBody(body, encoding, tst)
+		if err != nil {
+			return err
+		}
+	}
+
+	//
+	// Was the response served from the cache?
+	//
+	if tst.Arguments["cache-status"] != "" {
+		observed := observedCacheHeaders(response.Header)
+		if opts.Verbose {
+			fmt.Printf("HTTP cache headers: %v\n", observed)
+		}
+		for name, value := range observed {
+			captures[name] = value
+		}
+
+		if err = checkCacheHit(response.Header, tst.Arguments["cache-status"]); err != nil {
+			return err
+		}
+	}
+
+	//
+	// Was the response served by the expected edge of the CDN?
+	//
+	pop, _ := observedPOP(response.Header)
+	if pop != "" {
+		details["pop"] = pop
+	}
+	if tst.Arguments["expected-pop"] != "" {
+		if pop != "" {
+			captures["pop"] = pop
+			if opts.Verbose {
+				fmt.Printf("HTTP response served by the POP %s\n", pop)
+			}
+		}
+
+		if err = checkPOP(response.Header, tst.Arguments["expected-pop"]); err != nil {
+			return err
+		}
+	}
+
+	//
+	// Are the caching headers configured as expected?
+	//
+	if tst.Arguments["cache-control"] != "" || tst.Arguments["cache-ttl"] != "" {
+		for _, name := range []string{"Cache-Control", "Expires"} {
+			if value := response.Header.Get(name); value != "" {
+				captures[strings.ToLower(strings.Replace(name, "-", "_", -1))] = value
+			}
+		}
+		if opts.Verbose {
+			fmt.Printf("HTTP caching headers: Cache-Control '%s', Expires '%s'\n", response.Header.Get("Cache-Control"), response.Header.Get("Expires"))
+		}
+
+		var minTTL time.Duration
+		if tst.Arguments["cache-ttl"] != "" {
+			if minTTL, err = parseCacheTTL(tst.Arguments["cache-ttl"]); err != nil {
+				return err
+			}
+		}
+		if err = checkCacheControl(response.Header, tst.Arguments["cache-control"], minTTL, time.Now()); err != nil {
+			return err
+		}
+	}
+
 	//
 	// Is the user looking for a literal body-match?
 	//
@@ -576,6 +1012,15 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		}
 	}
 
+	//
+	// Is the user looking for the content of a file?
+	//
+	if tst.Arguments["content-file"] != "" {
+		if err = checkContentFile(tst.Arguments["content-file"], tst.Arguments["content-mode"], body); err != nil {
+			return err
+		}
+	}
+
 	//
 	// Is the user NOT looking for a literal body-match?
 	//
@@ -600,6 +1045,36 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		if len(match) < 1 {
 			return fmt.Errorf("body didn't match the regular expression '%s'", tst.Arguments["pattern"])
 		}
+
+		//
+		// Extract the requested groups from the first match.
+		//
+		if tst.Arguments["capture"] != "" {
+			for _, name := range strings.Split(tst.Arguments["capture"], ",") {
+				found := false
+				for index, group := range re.SubexpNames() {
+					if group == name {
+						captures[name] = match[0][index]
+						found = true
+						break
+					}
+				}
+				if !found {
+					return fmt.Errorf("the pattern has no group named '%s' to capture", name)
+				}
+			}
+		}
+	} else if tst.Arguments["capture"] != "" {
+		return fmt.Errorf("capturing values requires a pattern")
+	}
+
+	//
+	// Is the user expecting the body to match a JSON schema?
+	//
+	if tst.Arguments["json-schema"] != "" {
+		if err = validateJSONSchema(tst.Arguments["json-schema"], body); err != nil {
+			return err
+		}
 	}
 
 	//
@@ -684,7 +1159,7 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		//
 		// Check the expiration
 		//
-		hours, cn, errExpire := s.SSLExpiration(tst.Target, opts.Verbose)
+		hours, cn, errExpire := s.SSLExpiration(ctx, tst.Target, roots, opts)
 		if errExpire == nil {
 			// Is the age too short?
 			if int64(hours) < int64(period) {
@@ -701,9 +1176,41 @@ func (s *HTTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	return nil
 }
 
+// decodeBody decompresses a body we've explicitly asked to be compressed,
+// so that the content checks can run against it.
+func (s *HTTPTest) decodeBody(body []byte, encoding string, tst test.Test) ([]byte, error) {
+	var reader io.Reader
+	var err error
+
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		// We have no decoder for this encoding, which is only a
+		// problem if the user wants to check the content.
+		if tst.Arguments["content"] != "" || tst.Arguments["not-content"] != "" ||
+			tst.Arguments["pattern"] != "" || tst.Arguments["not-pattern"] != "" ||
+			tst.Arguments["json-schema"] != "" || tst.Arguments["content-file"] != "" {
+			return nil, fmt.Errorf("cannot check the content of a '%s' encoded response", encoding)
+		}
+		return body, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode '%s' response: %s", encoding, err.Error())
+	}
+
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode '%s' response: %s", encoding, err.Error())
+	}
+	return decoded, nil
+}
+
 // SSLExpiration returns the number of hours remaining for a given
-// SSL certificate chain.
-func (s *HTTPTest) SSLExpiration(host string, verbose bool) (int64, string, error) {
+// SSL certificate chain, verified against the given authorities.
+func (s *HTTPTest) SSLExpiration(ctx context.Context, host string, roots *x509.CertPool, opts test.Options) (int64, string, error) {
 
 	// Expiry time, in hours
 	var hours int64
@@ -735,24 +1242,24 @@ func (s *HTTPTest) SSLExpiration(host string, verbose bool) (int64, string, erro
 	//
 	// Show what we're doing.
 	//
-	if verbose {
+	if opts.Verbose {
 		fmt.Printf("SSLExpiration testing: %s\n", host)
 	}
 
-	conn, err := tls.Dial("tcp", host, nil)
+	conn, err := newDialer(opts).DialTLSContext(ctx, "tcp", host, &tls.Config{RootCAs: roots})
 	if err != nil {
 		return 0, "", err
 	}
 	defer conn.Close()
 
 	timeNow := time.Now()
-	for _, chain := range conn.ConnectionState().VerifiedChains {
+	for _, chain := range conn.(*tls.Conn).ConnectionState().VerifiedChains {
 		for _, cert := range chain {
 
 			// Get the expiration time, in hours.
 			expiresIn := int64(cert.NotAfter.Sub(timeNow).Hours())
 
-			if verbose {
+			if opts.Verbose {
 				fmt.Printf("SSLExpiration - certificate: %s expires in %d hours (%d days)\n", cert.Subject.CommonName, expiresIn, expiresIn/24)
 			}
 
@@ -0,0 +1,537 @@
+package protocols
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// runHTTPTest runs the HTTP tester against the given local server URL.
+func runHTTPTest(serverURL string, args map[string]string) error {
+	u, _ := url.Parse(serverURL)
+	if args == nil {
+		args = map[string]string{}
+	}
+	tst := test.Test{Target: serverURL, Type: "http", Arguments: args}
+	return (&HTTPTest{}).RunTest(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+}
+
+func TestHTTPCompression(t *testing.T) {
+	compress := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/identity" {
+			w.Header().Set("Content-Encoding", "identity")
+			w.Write([]byte("hello plain world"))
+			return
+		}
+		if compress && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			buf := &bytes.Buffer{}
+			gz := gzip.NewWriter(buf)
+			gz.Write([]byte("hello compressed world"))
+			gz.Close()
+
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(buf.Bytes())
+			return
+		}
+		w.Write([]byte("hello plain world"))
+	}))
+	defer server.Close()
+
+	if err := runHTTPTest(server.URL, map[string]string{"require-compression": "true", "content": "compressed"}); err != nil {
+		t.Errorf("expected compressed response to pass: %s", err)
+	}
+	if err := runHTTPTest(server.URL, map[string]string{"content-encoding": "gzip"}); err != nil {
+		t.Errorf("expected gzip response to pass: %s", err)
+	}
+	if err := runHTTPTest(server.URL, map[string]string{"content-encoding": "br"}); err == nil {
+		t.Errorf("expected brotli assertion to fail against a gzip-only server")
+	}
+
+	compress = false
+	err := runHTTPTest(server.URL, map[string]string{"require-compression": "true"})
+	if err == nil || !strings.Contains(err.Error(), "not compressed, its content-encoding was ''") {
+		t.Errorf("expected uncompressed response to fail, got: %v", err)
+	}
+	err = runHTTPTest(server.URL+"/identity", map[string]string{"require-compression": "true"})
+	if err == nil || !strings.Contains(err.Error(), "content-encoding was 'identity'") {
+		t.Errorf("expected the observed content-encoding in the failure, got: %v", err)
+	}
+
+	// The status is checked first, as error pages are often uncompressed
+	err = runHTTPTest(server.URL+"/error", map[string]string{"require-compression": "true"})
+	if err == nil || !strings.Contains(err.Error(), "status code was 500") {
+		t.Errorf("expected the status to fail first, got: %v", err)
+	}
+	if err := runHTTPTest(server.URL, map[string]string{"content": "plain"}); err != nil {
+		t.Errorf("expected plain response to pass without compression checks: %s", err)
+	}
+}
+
+func TestHTTPCapture(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app: overseer\nversion: 2.0.1\n"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(args map[string]string) (map[string]string, error) {
+		tst := test.Test{Target: server.URL, Type: "http", Arguments: args}
+		return (&HTTPTest{}).RunTestCapture(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+	}
+
+	captures, err := run(map[string]string{
+		"pattern": `app: (?P<app>\w+).*version: (?P<version>[0-9.]+)`,
+		"capture": "app,version",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if captures["app"] != "overseer" || captures["version"] != "2.0.1" {
+		t.Errorf("unexpected captures: %v", captures)
+	}
+
+	if _, err = run(map[string]string{"pattern": `version: (?P<version>[0-9.]+)`, "capture": "build"}); err == nil {
+		t.Errorf("expected capturing an unknown group to fail")
+	}
+	if _, err = run(map[string]string{"capture": "version"}); err == nil {
+		t.Errorf("expected capturing without a pattern to fail")
+	}
+}
+
+func TestHTTPDetailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("version: 2.0.1"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(path string, args map[string]string) (map[string]interface{}, error) {
+		tst := test.Test{Target: server.URL + path, Type: "http", Arguments: args}
+		return Detailed(&HTTPTest{}).RunTestDetailed(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+	}
+
+	details, err := run("/", map[string]string{"pattern": `version: (?P<version>[0-9.]+)`, "capture": "version"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if details["statusCode"] != 200 || details["bodySize"] != 14 {
+		t.Errorf("unexpected details: %v", details)
+	}
+	if latency, ok := details["latencyMs"].(int64); !ok || latency < 0 {
+		t.Errorf("expected the latency in the details, got %v", details)
+	}
+	if captures, _ := details[CapturesDetail].(map[string]string); captures["version"] != "2.0.1" {
+		t.Errorf("expected the captures in the details, got %v", details)
+	}
+
+	// Failing tests are described too
+	details, err = run("/missing", nil)
+	if err == nil {
+		t.Fatalf("expected the test to fail")
+	}
+	if details["statusCode"] != 404 {
+		t.Errorf("expected the status code of the failure in the details, got %v", details)
+	}
+	if _, ok := details[CapturesDetail]; ok {
+		t.Errorf("expected no captures in the details, got %v", details)
+	}
+}
+
+func TestDetailedAdapter(t *testing.T) {
+	// Protocol-tests which don't describe what they observed only fail
+	details, err := Detailed(&TCPTest{}).RunTestDetailed(context.Background(), test.Test{Target: "127.0.0.1", Type: "tcp", Arguments: map[string]string{"port": "1"}}, "127.0.0.1", test.Options{Timeout: time.Second})
+	if err == nil || details != nil {
+		t.Errorf("expected a failure without details, got %v (%v)", details, err)
+	}
+}
+
+func TestHTTPJSONSchema(t *testing.T) {
+	schema, err := ioutil.TempFile("", "overseer-schema")
+	if err != nil {
+		t.Fatalf("failed to create the schema: %s", err)
+	}
+	defer os.Remove(schema.Name())
+	schema.WriteString(`{
+  "type": "object",
+  "required": ["status", "version"],
+  "properties": {
+    "status": {"type": "string", "enum": ["ok", "degraded"]},
+    "version": {"type": "string"}
+  }
+}`)
+	schema.Close()
+
+	body := `{"status": "ok", "version": "1.2.3"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	if err = runHTTPTest(server.URL, map[string]string{"json-schema": schema.Name()}); err != nil {
+		t.Errorf("expected a conforming response to pass: %s", err)
+	}
+
+	body = `{"status": "broken"}`
+	err = runHTTPTest(server.URL, map[string]string{"json-schema": schema.Name()})
+	if err == nil {
+		t.Fatalf("expected a non-conforming response to fail")
+	}
+	for _, violation := range []string{"version", "status"} {
+		if !strings.Contains(err.Error(), violation) {
+			t.Errorf("expected the violation of '%s' to be listed, got: %s", violation, err)
+		}
+	}
+
+	if err = (&HTTPTest{}).ValidateArguments(map[string]string{"json-schema": schema.Name() + ".missing"}); err == nil {
+		t.Errorf("expected a missing schema to fail validation")
+	}
+}
+
+func TestHTTPContentFile(t *testing.T) {
+	body := "<html><body><h1>Welcome</h1><p>Hello, world</p></body></html>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "overseer-content")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+		return path
+	}
+
+	fragment := write("fragment.html", "<h1>Welcome</h1>")
+	exact := write("exact.html", body)
+	digest := sha256.Sum256([]byte(body))
+	hash := write("body.sha256", hex.EncodeToString(digest[:])+"  index.html\n")
+
+	for _, args := range []map[string]string{
+		{"content-file": fragment},
+		{"content-file": fragment, "content-mode": "substring"},
+		{"content-file": exact, "content-mode": "exact"},
+		{"content-file": hash, "content-mode": "sha256"},
+	} {
+		if err = runHTTPTest(server.URL, args); err != nil {
+			t.Errorf("expected %v to pass: %s", args, err)
+		}
+	}
+
+	body = "<html><body><h1>Maintenance</h1></body></html>"
+	for _, args := range []map[string]string{
+		{"content-file": fragment},
+		{"content-file": exact, "content-mode": "exact"},
+		{"content-file": hash, "content-mode": "sha256"},
+	} {
+		if err = runHTTPTest(server.URL, args); err == nil {
+			t.Errorf("expected %v to fail", args)
+		}
+	}
+
+	// A fragment of the body is not an exact match
+	body = "<html><body><h1>Welcome</h1><p>Hello, world</p></body></html>"
+	if err = runHTTPTest(server.URL, map[string]string{"content-file": fragment, "content-mode": "exact"}); err == nil {
+		t.Errorf("expected a partial match to fail in exact mode")
+	}
+
+	s := &HTTPTest{}
+	if err = s.ValidateArguments(map[string]string{"content-file": filepath.Join(dir, "missing.html")}); err == nil {
+		t.Errorf("expected a missing content file to fail validation")
+	}
+	if err = s.ValidateArguments(map[string]string{"content-file": fragment, "content-mode": "sha256"}); err == nil {
+		t.Errorf("expected a content file without a digest to fail validation in sha256 mode")
+	}
+	if err = s.ValidateArguments(map[string]string{"content-mode": "exact"}); err == nil {
+		t.Errorf("expected content-mode without a content-file to fail validation")
+	}
+}
+
+func TestHTTPHostHeader(t *testing.T) {
+	var serverName string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			serverName = r.TLS.ServerName
+		}
+		switch r.Host {
+		case "a.example.com":
+			w.Write([]byte("site A"))
+		case "b.example.com":
+			w.Write([]byte("site B"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if err := runHTTPTest(server.URL, map[string]string{"host-header": "b.example.com", "content": "site B"}); err != nil {
+		t.Errorf("expected the virtual host to be selected: %s", err)
+	}
+	if err := runHTTPTest(server.URL, map[string]string{"content": "site B"}); err == nil {
+		t.Errorf("expected the default virtual host not to be found")
+	}
+
+	// The TLS server name still comes from the URL
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	u, _ := url.Parse(tlsServer.URL)
+	tst := test.Test{
+		Target:    "https://backend.example.com:" + u.Port() + "/",
+		Type:      "http",
+		Arguments: map[string]string{"host-header": "a.example.com", "content": "site A", "tls": "insecure"},
+	}
+	if err := (&HTTPTest{}).RunTest(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second}); err != nil {
+		t.Errorf("expected the virtual host to be selected over TLS: %s", err)
+	}
+	if serverName != "backend.example.com" {
+		t.Errorf("expected the server name of the URL to be used, got %q", serverName)
+	}
+}
+
+func TestHTTPCacheStatus(t *testing.T) {
+	var hits int
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every page is cached after its first request
+		hits++
+		switch {
+		case header == "":
+		case hits == 1:
+			w.Header().Set(header, "MISS")
+		case header == "Age":
+			w.Header().Set(header, "12")
+		default:
+			w.Header().Set(header, "HIT from proxy")
+		}
+		w.Write([]byte("cached page"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(args map[string]string) (map[string]string, error) {
+		hits = 0
+		tst := test.Test{Target: server.URL, Type: "http", Arguments: args}
+		return (&HTTPTest{}).RunTestCapture(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+	}
+
+	for _, header = range []string{"X-Cache", "CF-Cache-Status", "X-Cache-Status", "Age"} {
+		captures, err := run(map[string]string{"cache-status": "hit"})
+		if err != nil {
+			t.Errorf("expected a cache hit via %s to pass: %s", header, err)
+		}
+		if hits != 2 {
+			t.Errorf("expected two requests, got %d", hits)
+		}
+		if len(captures) != 1 {
+			t.Errorf("expected the cache header to be captured, got %v", captures)
+		}
+	}
+
+	// The cache status must match
+	header = "CF-Cache-Status"
+	captures, err := run(map[string]string{"cache-status": "EXPIRED"})
+	if err == nil || !strings.Contains(err.Error(), "cf_cache_status: HIT from proxy") {
+		t.Errorf("expected a mismatching cache status to fail, got: %v", err)
+	}
+	if captures["cf_cache_status"] != "HIT from proxy" {
+		t.Errorf("expected the cache header to be captured on failure, got %v", captures)
+	}
+
+	// A response without cache headers was not served from a cache
+	header = ""
+	if _, err = run(map[string]string{"cache-status": "HIT"}); err == nil || !strings.Contains(err.Error(), "no cache headers") {
+		t.Errorf("expected a response without cache headers to fail, got: %v", err)
+	}
+
+	// Without a cache-status, a single request is made
+	if _, err = run(map[string]string{}); err != nil || hits != 1 {
+		t.Errorf("expected a single request, got %d (%v)", hits, err)
+	}
+}
+
+func TestHTTPCacheControl(t *testing.T) {
+	var headers map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		w.Write([]byte("asset"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(args map[string]string) (map[string]string, error) {
+		tst := test.Test{Target: server.URL, Type: "http", Arguments: args}
+		return (&HTTPTest{}).RunTestCapture(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+	}
+
+	tests := []struct {
+		headers map[string]string
+		args    map[string]string
+		failure string
+	}{
+		{map[string]string{"Cache-Control": "public, max-age=604800, immutable"}, map[string]string{"cache-control": "public,immutable", "cache-ttl": "7d"}, ""},
+		{map[string]string{"Cache-Control": "public, max-age=3600"}, map[string]string{"cache-control": "max-age=3600"}, ""},
+		{map[string]string{"Cache-Control": "public, max-age=60"}, map[string]string{"cache-control": "max-age=3600"}, "has max-age=60, not 3600"},
+		{map[string]string{"Cache-Control": "public, max-age=604800"}, map[string]string{"cache-control": "immutable"}, "doesn't contain 'immutable'"},
+		{map[string]string{}, map[string]string{"cache-control": "public"}, "no Cache-Control header"},
+		{map[string]string{"Cache-Control": "public, max-age=60"}, map[string]string{"cache-ttl": "1h"}, "cacheable for 1m0s, not at least 1h0m0s"},
+		{map[string]string{"Cache-Control": "private, max-age=3600"}, map[string]string{"cache-ttl": "1h"}, "not cacheable"},
+		{map[string]string{"Cache-Control": "no-store"}, map[string]string{"cache-ttl": "1h"}, "not cacheable"},
+		{map[string]string{}, map[string]string{"cache-ttl": "1h"}, "neither max-age nor Expires"},
+		// Without max-age, the Expires header is used
+		{map[string]string{"Expires": time.Now().Add(48 * time.Hour).UTC().Format(http.TimeFormat)}, map[string]string{"cache-ttl": "1d"}, ""},
+		{map[string]string{"Expires": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}, map[string]string{"cache-ttl": "1d"}, "not at least 24h0m0s"},
+		{map[string]string{"Cache-Control": "public", "Expires": "tomorrow"}, map[string]string{"cache-control": "public"}, "invalid Expires header 'tomorrow'"},
+	}
+
+	for i, tt := range tests {
+		headers = tt.headers
+		captures, err := run(tt.args)
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected the caching headers to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+		if captures["cache_control"] != tt.headers["Cache-Control"] || captures["expires"] != tt.headers["Expires"] {
+			t.Errorf("test %d: expected the caching headers to be captured, got %v", i, captures)
+		}
+	}
+}
+
+func TestHTTPMinThroughput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := bytes.Repeat([]byte("x"), 1000)
+		if r.URL.Path == "/fast" {
+			w.Write(bytes.Repeat(chunk, 1000))
+			return
+		}
+
+		// A trickle of about 50 kB/s
+		for i := 0; i < 10; i++ {
+			w.Write(chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(path string, minThroughput string, timeout time.Duration) (map[string]string, error) {
+		tst := test.Test{Target: server.URL + path, Type: "http", Arguments: map[string]string{"min-throughput": minThroughput}}
+		return (&HTTPTest{}).RunTestCapture(context.Background(), tst, u.Hostname(), test.Options{Timeout: timeout})
+	}
+
+	captures, err := run("/fast", "1M", 5*time.Second)
+	if err != nil {
+		t.Errorf("expected a fast body to pass, got: %s", err)
+	}
+	if captures["throughput"] == "" {
+		t.Errorf("expected the throughput to be captured, got %v", captures)
+	}
+
+	if _, err = run("/slow", "1k", 5*time.Second); err != nil {
+		t.Errorf("expected a slow body above the minimum to pass, got: %s", err)
+	}
+
+	captures, err = run("/slow", "1M", 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "the body of 10000 bytes was transferred at") || !strings.Contains(err.Error(), "below the minimum of 1.0 MB/s") {
+		t.Errorf("expected a slow body to fail, got: %v", err)
+	}
+	if rate, _ := strconv.ParseFloat(captures["throughput"], 64); rate <= 0 || rate >= 1e6 {
+		t.Errorf("expected the measured throughput to be captured, got %v", captures)
+	}
+
+	// The body must be read within the timeout
+	if _, err = run("/slow", "1k", 100*time.Millisecond); err == nil || !strings.Contains(err.Error(), "failed to read the body, after") {
+		t.Errorf("expected a body slower than the timeout to fail, got: %v", err)
+	}
+
+	if err = (&HTTPTest{}).ValidateArguments(map[string]string{"min-throughput": "1.5.2k"}); err == nil {
+		t.Errorf("expected an invalid throughput to be rejected")
+	}
+}
+
+func TestHTTPExpectedPOP(t *testing.T) {
+	var headers map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		w.Write([]byte("edge page"))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(expected string) (map[string]string, error) {
+		tst := test.Test{Target: server.URL, Type: "http", Arguments: map[string]string{"expected-pop": expected}}
+		return (&HTTPTest{}).RunTestCapture(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second})
+	}
+
+	tests := []struct {
+		headers map[string]string
+		pop     string
+	}{
+		{map[string]string{"CF-Ray": "7d5e8c4f0a1b2c3d-AMS"}, "AMS"},
+		{map[string]string{"X-Served-By": "cache-iad-kiad7000025-IAD, cache-fra19120-FRA"}, "FRA"},
+		{map[string]string{"X-Amz-Cf-Pop": "AMS50-C1"}, "AMS"},
+	}
+	for _, tt := range tests {
+		headers = tt.headers
+		captures, err := run("ams,FRA")
+		if err != nil {
+			t.Errorf("expected %v to pass: %s", tt.headers, err)
+		}
+		if captures["pop"] != tt.pop {
+			t.Errorf("expected the POP %s to be captured from %v, got %v", tt.pop, tt.headers, captures)
+		}
+	}
+
+	// The POP must be one of the expected ones
+	headers = map[string]string{"CF-Ray": "7d5e8c4f0a1b2c3d-SIN"}
+	captures, err := run("AMS,FRA")
+	if err == nil || !strings.Contains(err.Error(), "served by the POP 'SIN' (from CF-Ray: 7d5e8c4f0a1b2c3d-SIN), not one of AMS,FRA") {
+		t.Errorf("expected an unexpected POP to fail, got: %v", err)
+	}
+	if captures["pop"] != "SIN" {
+		t.Errorf("expected the POP to be captured on failure, got %v", captures)
+	}
+
+	headers = nil
+	if _, err = run("AMS"); err == nil || !strings.Contains(err.Error(), "no header tells the POP") {
+		t.Errorf("expected a response without POP headers to fail, got: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package protocols
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// jsonSchemaEntry is a compiled JSON schema, along with the modification
+// time of its file when it was loaded.
+type jsonSchemaEntry struct {
+	modTime time.Time
+	schema  *gojsonschema.Schema
+}
+
+// The compiled JSON schemas, by path, as they are shared by all the tests
+var jsonSchemas = struct {
+	m map[string]jsonSchemaEntry
+	sync.Mutex
+}{m: make(map[string]jsonSchemaEntry)}
+
+// loadJSONSchema returns the compiled JSON schema stored in the given
+// file, compiling it again only if the file has changed.
+func loadJSONSchema(path string) (*gojsonschema.Schema, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonSchemas.Lock()
+	defer jsonSchemas.Unlock()
+
+	if entry, ok := jsonSchemas.m[path]; ok && entry.modTime.Equal(info.ModTime()) {
+		return entry.schema, nil
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(path)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JSON schema %s: %s", path, err.Error())
+	}
+
+	jsonSchemas.m[path] = jsonSchemaEntry{modTime: info.ModTime(), schema: schema}
+	return schema, nil
+}
+
+// validateJSONSchema returns an error listing the violations of the
+// given schema by the body.
+func validateJSONSchema(path string, body []byte) error {
+	schema, err := loadJSONSchema(path)
+	if err != nil {
+		return err
+	}
+
+	result, err := schema.Validate(gojsonschema.NewBytesLoader(body))
+	if err != nil {
+		return fmt.Errorf("failed to validate the body against the JSON schema: %s", err.Error())
+	}
+
+	if !result.Valid() {
+		var violations []string
+		for _, violation := range result.Errors() {
+			violations = append(violations, violation.String())
+		}
+		return fmt.Errorf("body does not match the JSON schema: %s", strings.Join(violations, "; "))
+	}
+
+	return nil
+}
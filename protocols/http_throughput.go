@@ -0,0 +1,53 @@
+package protocols
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseThroughput parses a transfer rate in bytes per second, with an
+// optional k, M or G (decimal) multiplier, e.g. "500k".
+func parseThroughput(value string) (float64, error) {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(value, "k"):
+		multiplier = 1e3
+	case strings.HasSuffix(value, "M"):
+		multiplier = 1e6
+	case strings.HasSuffix(value, "G"):
+		multiplier = 1e9
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid throughput '%s': %s", value, err.Error())
+	}
+	return rate * multiplier, nil
+}
+
+// formatThroughput formats a transfer rate for humans, e.g. "1.5 MB/s".
+func formatThroughput(rate float64) string {
+	switch {
+	case rate >= 1e9:
+		return fmt.Sprintf("%.1f GB/s", rate/1e9)
+	case rate >= 1e6:
+		return fmt.Sprintf("%.1f MB/s", rate/1e6)
+	case rate >= 1e3:
+		return fmt.Sprintf("%.1f kB/s", rate/1e3)
+	}
+	return fmt.Sprintf("%.0f B/s", rate)
+}
+
+// transferRate returns the rate, in bytes per second, at which size bytes
+// were transferred in the given time.
+func transferRate(size int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		elapsed = time.Nanosecond
+	}
+	return float64(size) / elapsed.Seconds()
+}
@@ -12,6 +12,8 @@
 package protocols
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"strconv"
@@ -65,7 +67,7 @@ IMAP Tester
 // In this case we make a IMAP connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *IMAPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *IMAPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 
 	var err error
 
@@ -96,14 +98,10 @@ func (s *IMAPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 		address = fmt.Sprintf("[%s]:%d", target, port)
 	}
 
-	var dial = &net.Dialer{
-		Timeout: opts.Timeout,
-	}
-
 	//
 	// Connect.
 	//
-	con, err := client.DialWithDialer(dial, address)
+	con, err := dialIMAP(ctx, address, nil, opts)
 	if err != nil {
 		return err
 	}
@@ -128,6 +126,38 @@ func (s *IMAPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	return nil
 }
 
+// dialIMAP connects to the IMAP server at the given address, over TLS
+// unless the config is nil, and reads its greeting.
+//
+// The whole exchange must complete before the deadline of the context,
+// unless the Timeout of the client is set to bound each command instead.
+func dialIMAP(ctx context.Context, address string, tlsConfig *tls.Config, opts test.Options) (*client.Client, error) {
+	dialer := newDialer(opts)
+
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = dialer.DialTLSContext(ctx, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, err := client.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
 func (s *IMAPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
 	return nil
 }
@@ -15,14 +15,13 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
 	"github.com/cmaster11/overseer/test"
-	"github.com/emersion/go-imap/client"
 )
 
 // IMAPSTest is our object
@@ -74,7 +73,7 @@ IMAPS Tester
 // In this case we make a IMAP connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *IMAPSTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -112,13 +111,6 @@ func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) err
 		address = fmt.Sprintf("[%s]:%d", target, port)
 	}
 
-	//
-	// Setup a dialer so we can have a suitable timeout
-	//
-	var dial = &net.Dialer{
-		Timeout: opts.Timeout,
-	}
-
 	//
 	// Setup the default TLS config.
 	//
@@ -126,7 +118,11 @@ func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) err
 	// will verify upon, from our input-line.
 	//
 	data := strings.Fields(tst.Input)
-	tlsSetup := &tls.Config{ServerName: data[0]}
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+	tlsSetup := &tls.Config{ServerName: data[0], RootCAs: roots}
 
 	//
 	// Disable verification if we're being insecure.
@@ -140,7 +136,7 @@ func (s *IMAPSTest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// Connect.
 	//
-	con, err := client.DialWithDialerTLS(dial, address, tlsSetup)
+	con, err := dialIMAP(ctx, address, tlsSetup, opts)
 	if err != nil {
 		return err
 
@@ -0,0 +1,330 @@
+// Journey Tester
+//
+// The journey tester models a user journey, e.g. logging in and fetching
+// a page only visible to logged in users, as a sequence of HTTP requests,
+// and fails at the first failing step.
+//
+// This test is invoked via input like so:
+//
+//    https://www.example.com/ must run journey with steps '/etc/overseer/login.json'
+//
+// The steps are read from a JSON file, as a list of objects like so:
+//
+//    [
+//      {
+//        "name": "login",
+//        "method": "POST",
+//        "url": "/login",
+//        "headers": {"Content-Type": "application/x-www-form-urlencoded"},
+//        "body": "username=monitor&password=secret",
+//        "status": 200,
+//        "contains": "Welcome",
+//        "extract": {"token": "name=\"csrf\" value=\"([^\"]+)\""}
+//      },
+//      {
+//        "name": "account",
+//        "url": "/account?csrf={{token}}",
+//        "contains": "Balance"
+//      }
+//    ]
+//
+// Relative URLs are resolved against the target. Only the URL is needed:
+// the method defaults to GET, and the expected status code to 200, while
+// "contains" and "not-contains" are optional. The values extracted by the
+// regular expressions of a step, via their first group if any, replace
+// their {{name}} in the URL, headers and body of the next steps.
+//
+// Cookies are kept across the steps, and redirections are followed, like
+// a browser would. The timeout covers the whole journey.
+//
+// If you need to disable the validation of the certificates you can do so
+// via `with tls insecure`.
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// journeyStep is a step of a journey.
+type journeyStep struct {
+	Name        string            `json:"name"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	Status      int               `json:"status"`
+	Contains    string            `json:"contains"`
+	NotContains string            `json:"not-contains"`
+	Extract     map[string]string `json:"extract"`
+
+	extract map[string]*regexp.Regexp
+}
+
+// journeyVariable matches the {{name}} of the variables in the steps.
+var journeyVariable = regexp.MustCompile(`{{([a-zA-Z0-9_]+)}}`)
+
+// loadJourney loads, and validates, the steps of a journey.
+func loadJourney(path string) ([]*journeyStep, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []*journeyStep
+	if err = json.Unmarshal(content, &steps); err != nil {
+		return nil, fmt.Errorf("failed to parse the journey %s: %s", path, err.Error())
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("the journey %s has no steps", path)
+	}
+
+	for i, step := range steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step %d", i+1)
+		}
+		if step.URL == "" {
+			return nil, fmt.Errorf("the journey %s has no URL for %s", path, step.Name)
+		}
+		if step.Method == "" {
+			step.Method = http.MethodGet
+		}
+		if step.Status == 0 {
+			step.Status = http.StatusOK
+		}
+
+		step.extract = map[string]*regexp.Regexp{}
+		for name, pattern := range step.Extract {
+			re, errRe := regexp.Compile(pattern)
+			if errRe != nil {
+				return nil, fmt.Errorf("invalid pattern to extract %s in %s: %s", name, step.Name, errRe.Error())
+			}
+			step.extract[name] = re
+		}
+	}
+
+	return steps, nil
+}
+
+// JourneyTest is our object.
+type JourneyTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *JourneyTest) Arguments() map[string]string {
+	known := map[string]string{
+		"steps": ".+",
+		"tls":   "insecure",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *JourneyTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// ValidateArguments ensures the steps can be loaded, so that broken
+// journeys are reported when parsing the test.
+func (s *JourneyTest) ValidateArguments(args map[string]string) error {
+	if args["steps"] == "" {
+		return errors.New("the file of the steps must be given with 'steps'")
+	}
+	_, err := loadJourney(args["steps"])
+	return err
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *JourneyTest) Example() string {
+	str := `
+Journey Tester
+--------------
+ The journey tester models a user journey, e.g. logging in and fetching
+ a page only visible to logged in users, as a sequence of HTTP requests,
+ and fails at the first failing step.
+
+ This test is invoked via input like so:
+
+    https://www.example.com/ must run journey with steps '/etc/overseer/login.json'
+
+ The steps are read from a JSON file, as a list of objects like so:
+
+    [
+      {
+        "name": "login",
+        "method": "POST",
+        "url": "/login",
+        "headers": {"Content-Type": "application/x-www-form-urlencoded"},
+        "body": "username=monitor&password=secret",
+        "status": 200,
+        "contains": "Welcome",
+        "extract": {"token": "name=\"csrf\" value=\"([^\"]+)\""}
+      },
+      {
+        "name": "account",
+        "url": "/account?csrf={{token}}",
+        "contains": "Balance"
+      }
+    ]
+
+ Relative URLs are resolved against the target. Only the URL is needed:
+ the method defaults to GET, and the expected status code to 200, while
+ "contains" and "not-contains" are optional. The values extracted by the
+ regular expressions of a step, via their first group if any, replace
+ their {{name}} in the URL, headers and body of the next steps.
+
+ Cookies are kept across the steps, and redirections are followed, like
+ a browser would. The timeout covers the whole journey.
+
+ If you need to disable the validation of the certificates you can do so
+ via 'with tls insecure'.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we run the steps in order, stopping at the first failing
+// one.
+func (s *JourneyTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	steps, err := loadJourney(tst.Arguments["steps"])
+	if err != nil {
+		return err
+	}
+
+	base, err := url.Parse(tst.Target)
+	if err != nil {
+		return fmt.Errorf("the target must be the base URL of the journey: %s", err.Error())
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if tst.Arguments["tls"] == "insecure" {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Jar:       jar,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	// The timeout covers all the steps
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	variables := map[string]string{}
+	for i, step := range steps {
+		if err = s.runStep(ctx, client, base, step, variables, opts); err != nil {
+			return fmt.Errorf("step %d of %d (%s) failed: %s", i+1, len(steps), step.Name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// runStep runs a step, storing the values it extracts in the variables.
+func (s *JourneyTest) runStep(ctx context.Context, client *http.Client, base *url.URL, step *journeyStep, variables map[string]string, opts test.Options) error {
+	expand := func(value string) string {
+		return journeyVariable.ReplaceAllStringFunc(value, func(match string) string {
+			if value, ok := variables[match[2:len(match)-2]]; ok {
+				return value
+			}
+			return match
+		})
+	}
+
+	stepURL, err := base.Parse(expand(step.URL))
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if step.Body != "" {
+		body = strings.NewReader(expand(step.Body))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, step.Method, stepURL.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+	for name, value := range step.Headers {
+		req.Header.Set(name, expand(value))
+	}
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Journey step %s: %s %s returned %d\n", step.Name, step.Method, stepURL, response.StatusCode)
+	}
+
+	if response.StatusCode != step.Status {
+		return fmt.Errorf("status code was %d not %d", response.StatusCode, step.Status)
+	}
+	if step.Contains != "" && !strings.Contains(string(content), expand(step.Contains)) {
+		return fmt.Errorf("body didn't contain '%s'", step.Contains)
+	}
+	if step.NotContains != "" && strings.Contains(string(content), expand(step.NotContains)) {
+		return fmt.Errorf("body contained '%s'", step.NotContains)
+	}
+
+	for name, re := range step.extract {
+		match := re.FindStringSubmatch(string(content))
+		if match == nil {
+			return fmt.Errorf("nothing to extract %s from, via '%s'", name, re.String())
+		}
+		if len(match) > 1 {
+			variables[name] = match[1]
+		} else {
+			variables[name] = match[0]
+		}
+	}
+
+	return nil
+}
+
+func (s *JourneyTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("journey", func() ProtocolTest {
+		return &JourneyTest{}
+	})
+}
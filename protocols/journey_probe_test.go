@@ -0,0 +1,118 @@
+package protocols
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// writeJourney writes the steps of a journey to a temporary file.
+func writeJourney(t *testing.T, dir string, name string, steps string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(steps), 0644); err != nil {
+		t.Fatalf("failed to write the journey: %s", err)
+	}
+	return path
+}
+
+func TestJourney(t *testing.T) {
+	var delay int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+
+		switch r.URL.Path {
+		case "/login":
+			r.ParseForm()
+			if r.Method != http.MethodPost || r.PostForm.Get("username") != "monitor" || r.PostForm.Get("password") != "secret" {
+				http.Error(w, "invalid credentials", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3ss10n"})
+			w.Write([]byte(`Welcome! <input type="hidden" name="csrf" value="t0k3n">`))
+		case "/account":
+			cookie, err := r.Cookie("session")
+			if err != nil || cookie.Value != "s3ss10n" || r.URL.Query().Get("csrf") != "t0k3n" {
+				http.Error(w, "not logged in", http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("Balance: 42"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "journey")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	journey := func(password string, contains string) string {
+		return `[
+  {
+    "name": "login",
+    "method": "POST",
+    "url": "/login",
+    "headers": {"Content-Type": "application/x-www-form-urlencoded"},
+    "body": "username=monitor&password=` + password + `",
+    "contains": "Welcome",
+    "extract": {"token": "name=\"csrf\" value=\"([^\"]+)\""}
+  },
+  {
+    "name": "account",
+    "url": "/account?csrf={{token}}",
+    "contains": "` + contains + `"
+  }
+]`
+	}
+
+	run := func(steps string, timeout time.Duration) error {
+		path := writeJourney(t, dir, "journey.json", steps)
+		args := map[string]string{"steps": path}
+		if err := (&JourneyTest{}).ValidateArguments(args); err != nil {
+			return err
+		}
+		tst := test.Test{Target: server.URL + "/", Type: "journey", Arguments: args}
+		return (&JourneyTest{}).RunTest(context.Background(), tst, server.URL, test.Options{Timeout: timeout})
+	}
+
+	if err = run(journey("secret", "Balance: 42"), 5*time.Second); err != nil {
+		t.Errorf("expected the journey to pass, got: %s", err)
+	}
+
+	err = run(journey("wrong", "Balance: 42"), 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "step 1 of 2 (login) failed: status code was 403 not 200") {
+		t.Errorf("expected the login step to fail, got: %v", err)
+	}
+
+	err = run(journey("secret", "Balance: 100"), 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "step 2 of 2 (account) failed: body didn't contain 'Balance: 100'") {
+		t.Errorf("expected the account step to fail, got: %v", err)
+	}
+
+	// The timeout covers the whole journey, not each step
+	atomic.StoreInt64(&delay, int64(150*time.Millisecond))
+	err = run(journey("secret", "Balance: 42"), 250*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "step 2 of 2 (account) failed") {
+		t.Errorf("expected the journey to time out in its second step, got: %v", err)
+	}
+	atomic.StoreInt64(&delay, 0)
+
+	// Broken journeys are reported when parsing
+	if err = run(`[{"name": "login"}]`, 5*time.Second); err == nil || !strings.Contains(err.Error(), "no URL for login") {
+		t.Errorf("expected a step without URL to be rejected, got: %v", err)
+	}
+	if err = run(`[{"url": "/", "extract": {"token": "("}}]`, 5*time.Second); err == nil || !strings.Contains(err.Error(), "invalid pattern to extract token in step 1") {
+		t.Errorf("expected an invalid pattern to be rejected, got: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package protocols
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// k8sConfigSource is where the configuration of a clientset comes from:
+// the context of a kubeconfig, its current one if empty, or else the
+// in-cluster configuration if there is no kubeconfig.
+type k8sConfigSource struct {
+	kubeconfigPath string
+	context        string
+}
+
+// k8sClient is a clientset, along with the modification time of the
+// kubeconfig it was built from, if any.
+type k8sClient struct {
+	clientset kubernetes.Interface
+	modTime   time.Time
+}
+
+// k8sClients caches the clientsets across the tests, keyed by the source
+// of their configuration.
+var k8sClients = struct {
+	m map[k8sConfigSource]*k8sClient
+	sync.Mutex
+}{m: make(map[k8sConfigSource]*k8sClient)}
+
+// newK8sClientset builds the clientset of the given configuration source.
+var newK8sClientset = func(source k8sConfigSource) (kubernetes.Interface, error) {
+	var k8sConfig *rest.Config
+	var err error
+	if source.kubeconfigPath != "" {
+		k8sConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: source.kubeconfigPath},
+			&clientcmd.ConfigOverrides{CurrentContext: source.context},
+		).ClientConfig()
+	} else {
+		k8sConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The clientset is shared by all the tests, which are already paced
+	// by the worker, so it must not throttle them on its own
+	k8sConfig.QPS = -1
+
+	return kubernetes.NewForConfig(k8sConfig)
+}
+
+// k8sClientset returns the clientset of the given context of the kubeconfig
+// at the given path, reusing the one built by a previous test unless the
+// kubeconfig was modified since.
+//
+// Without a context, the current one is used, or else the in-cluster
+// configuration if there is no kubeconfig. With a context, the kubeconfig
+// defaults to the one of the user, i.e. ~/.kube/config.
+func k8sClientset(kubeconfigPath string, context string) (kubernetes.Interface, error) {
+	if kubeconfigPath == "" && context != "" {
+		kubeconfigPath = clientcmd.RecommendedHomeFile
+	}
+	source := k8sConfigSource{kubeconfigPath: kubeconfigPath, context: context}
+
+	var modTime time.Time
+	if kubeconfigPath != "" {
+		info, err := os.Stat(kubeconfigPath)
+		if err != nil {
+			return nil, err
+		}
+		modTime = info.ModTime()
+	}
+
+	k8sClients.Lock()
+	defer k8sClients.Unlock()
+
+	if client, ok := k8sClients.m[source]; ok && client.modTime.Equal(modTime) {
+		return client.clientset, nil
+	}
+
+	clientset, err := newK8sClientset(source)
+	if err != nil {
+		return nil, err
+	}
+	k8sClients.m[source] = &k8sClient{clientset: clientset, modTime: modTime}
+
+	return clientset, nil
+}
@@ -6,22 +6,32 @@
 //
 //    service-domain must run k8s-svc
 //
+// To monitor several clusters from one worker, the target can be prefixed
+// by the context of the kubeconfig to use, rather than its current one:
+//
+//    cluster-a:namespace-name/service-name must run k8s-svc
+//
+// The kubeconfig is read from $KUBE_CONFIG_PATH, or else ~/.kube/config,
+// while tests without a context and without $KUBE_CONFIG_PATH use the
+// in-cluster configuration.
+//
+// Workers started with `-k8s-allowed-namespaces` refuse to query the
+// services of any other namespace.
+//
 
 package protocols
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 
 	"github.com/cmaster11/overseer/test"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
+	v1 "k8s.io/api/core/v1"
 	// Import all auth methods k8s
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // K8SSvcTest is our object.
@@ -59,13 +69,32 @@ K8SSvc Tester
 
 	# Requires minimum 2 endpoints to be available for the test to succeed
 	service-name must run k8s-svc with min-endpoints 2
+
+ To monitor several clusters from one worker, the target can be prefixed
+ by the context of the kubeconfig to use, rather than its current one:
+
+    cluster-a:namespace-name/service-name must run k8s-svc
+
+ The kubeconfig is read from $KUBE_CONFIG_PATH, or else ~/.kube/config,
+ while tests without a context and without $KUBE_CONFIG_PATH use the
+ in-cluster configuration.
+
+ Workers started with '-k8s-allowed-namespaces' refuse to query the
+ services of any other namespace.
 `
 	return str
 }
 
 // RunTest is the part of our API which is invoked to actually execute a
 // test against the given target.
-func (s *K8SSvcTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *K8SSvcTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestDetailed(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestDetailed runs the test, also returning the number of available
+// endpoints of the service.
+func (s *K8SSvcTest) RunTestDetailed(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]interface{}, error) {
 	var err error
 
 	//
@@ -73,13 +102,14 @@ func (s *K8SSvcTest) RunTest(tst test.Test, target string, opts test.Options) er
 	//
 	minEndpoints := 1
 
-	parts := strings.Split(target, "/")
-	if len(parts) != 2 {
-		return fmt.Errorf("not a valid namespace-name/service-name target provided: %s", target)
+	kubeContext, namespace, serviceName, err := parseK8sSvcTarget(target)
+	if err != nil {
+		return nil, err
 	}
 
-	namespace := parts[0]
-	serviceName := parts[1]
+	if !k8sNamespaceAllowed(namespace, opts) {
+		return nil, fmt.Errorf("the namespace '%s' is not one of the namespaces allowed by the worker: %s", namespace, strings.Join(opts.K8sAllowedNamespaces, ", "))
+	}
 
 	//
 	// If the user specified a different port update to use it.
@@ -87,32 +117,27 @@ func (s *K8SSvcTest) RunTest(tst test.Test, target string, opts test.Options) er
 	if tst.Arguments["min-endpoints"] != "" {
 		minEndpoints, err = strconv.Atoi(tst.Arguments["min-endpoints"])
 		if err != nil {
-			return err
-		}
-	}
-
-	var k8sConfig *rest.Config
-	kubeconfigPath := os.Getenv("KUBE_CONFIG_PATH")
-	if kubeconfigPath != "" {
-		k8sConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-		if err != nil {
-			return err
-		}
-	} else {
-		k8sConfig, err = rest.InClusterConfig()
-		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	clientset, err := kubernetes.NewForConfig(k8sConfig)
+	clientset, err := k8sClientset(os.Getenv("KUBE_CONFIG_PATH"), kubeContext)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	endpoints, err := clientset.CoreV1().Endpoints(namespace).Get(serviceName, v1.GetOptions{})
+	// The typed client of this client-go can't be cancelled, unlike its
+	// underlying request
+	endpoints := &v1.Endpoints{}
+	err = clientset.CoreV1().RESTClient().Get().
+		Namespace(namespace).
+		Resource("endpoints").
+		Name(serviceName).
+		Context(ctx).
+		Do().
+		Into(endpoints)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Count the number of available endpoints
@@ -122,11 +147,53 @@ func (s *K8SSvcTest) RunTest(tst test.Test, target string, opts test.Options) er
 		endpointsCount += len(v.Addresses)
 	}
 
+	details := map[string]interface{}{
+		"endpoints":    endpointsCount,
+		"minEndpoints": minEndpoints,
+	}
+
 	if endpointsCount < minEndpoints {
-		return fmt.Errorf("number of available endpoints (%d) is lower than min defined (%d)", endpointsCount, minEndpoints)
+		return details, fmt.Errorf("number of available endpoints (%d) is lower than min defined (%d)", endpointsCount, minEndpoints)
 	}
 
-	return nil
+	return details, nil
+}
+
+// parseK8sSvcTarget splits a target like [context:]namespace/service.
+//
+// Contexts can contain colons and slashes, e.g. the ARNs of EKS clusters,
+// unlike namespaces and services, so the context ends at the last colon.
+func parseK8sSvcTarget(target string) (string, string, string, error) {
+	context := ""
+	service := target
+	if i := strings.LastIndex(target, ":"); i != -1 {
+		context = target[:i]
+		service = target[i+1:]
+		if context == "" {
+			return "", "", "", fmt.Errorf("empty context in target: %s", target)
+		}
+	}
+
+	parts := strings.Split(service, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("not a valid [context:]namespace-name/service-name target provided: %s", target)
+	}
+
+	return context, parts[0], parts[1], nil
+}
+
+// k8sNamespaceAllowed returns true if the k8s testers may query the given
+// namespace, i.e. if it is allowed by the worker, or if any is.
+func k8sNamespaceAllowed(namespace string, opts test.Options) bool {
+	if len(opts.K8sAllowedNamespaces) == 0 {
+		return true
+	}
+	for _, allowed := range opts.K8sAllowedNamespaces {
+		if allowed == namespace {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *K8SSvcTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
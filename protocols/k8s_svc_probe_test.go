@@ -0,0 +1,268 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"k8s.io/client-go/kubernetes"
+)
+
+// startK8sAPI starts a stub Kubernetes API serving the given number of
+// endpoints for the default/web service.
+func startK8sAPI(endpoints int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/endpoints/web" {
+			http.NotFound(w, r)
+			return
+		}
+
+		addresses := make([]string, endpoints)
+		for i := range addresses {
+			addresses[i] = fmt.Sprintf(`{"ip": "10.0.0.%d"}`, i+1)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"kind": "Endpoints", "apiVersion": "v1", "metadata": {"name": "web", "namespace": "default"},
+			"subsets": [{"addresses": [%s]}]}`, strings.Join(addresses, ", "))
+	}))
+}
+
+// writeKubeconfig writes a kubeconfig with a context for each of the given
+// API servers, the first one being the current one.
+func writeKubeconfig(t testing.TB, dir string, contexts []string, servers []*httptest.Server) string {
+	config := "apiVersion: v1\nkind: Config\ncurrent-context: " + contexts[0] + "\nusers:\n- name: stub\n  user:\n    token: secret\n"
+	config += "clusters:\n"
+	for i, server := range servers {
+		config += fmt.Sprintf("- name: %s\n  cluster:\n    server: %s\n", contexts[i], server.URL)
+	}
+	config += "contexts:\n"
+	for _, context := range contexts {
+		config += fmt.Sprintf("- name: %s\n  context:\n    cluster: %s\n    user: stub\n", context, context)
+	}
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(kubeconfig, []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write the kubeconfig: %s", err)
+	}
+	return kubeconfig
+}
+
+// countK8sClientsets counts the clientsets built from now on, until the
+// returned function is called.
+func countK8sClientsets() (*int32, func()) {
+	count := new(int32)
+	original := newK8sClientset
+	newK8sClientset = func(source k8sConfigSource) (kubernetes.Interface, error) {
+		atomic.AddInt32(count, 1)
+		return original(source)
+	}
+	return count, func() { newK8sClientset = original }
+}
+
+func TestK8SSvcAllowedNamespaces(t *testing.T) {
+	run := func(target string, allowed []string) error {
+		tst := test.Test{Target: target, Type: "k8s-svc", Arguments: map[string]string{}}
+		return (&K8SSvcTest{}).RunTest(context.Background(), tst, target, test.Options{Timeout: time.Second, K8sAllowedNamespaces: allowed})
+	}
+
+	// Refused before reaching out to any cluster
+	err := run("kube-system/kube-dns", []string{"default", "monitoring"})
+	if err == nil || !strings.Contains(err.Error(), "the namespace 'kube-system' is not one of the namespaces allowed by the worker: default, monitoring") {
+		t.Errorf("expected the namespace to be refused, got: %v", err)
+	}
+
+	// Allowed namespaces go on to query the cluster, which there is none
+	// of here
+	for _, allowed := range [][]string{{"default", "monitoring"}, nil} {
+		if err = run("monitoring/prometheus", allowed); err != nil && strings.Contains(err.Error(), "not one of the namespaces allowed") {
+			t.Errorf("expected the namespace to be allowed by %v, got: %s", allowed, err)
+		}
+	}
+}
+
+func TestK8SSvcClientsetCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8s")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := startK8sAPI(2)
+	defer server.Close()
+	kubeconfig := writeKubeconfig(t, dir, []string{"stub"}, []*httptest.Server{server})
+	os.Setenv("KUBE_CONFIG_PATH", kubeconfig)
+	defer os.Unsetenv("KUBE_CONFIG_PATH")
+
+	built, restore := countK8sClientsets()
+	defer restore()
+
+	run := func() {
+		tst := test.Test{Target: "default/web", Type: "k8s-svc", Arguments: map[string]string{"min-endpoints": "2"}}
+		details, errRun := (&K8SSvcTest{}).RunTestDetailed(context.Background(), tst, tst.Target, test.Options{Timeout: 5 * time.Second})
+		if errRun != nil {
+			t.Fatalf("expected the test to pass, got: %s", errRun)
+		}
+		if details["endpoints"] != 2 {
+			t.Errorf("expected 2 endpoints, got %v", details)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		run()
+	}
+	if n := atomic.LoadInt32(built); n != 1 {
+		t.Errorf("expected the clientset to be built once, got %d times", n)
+	}
+
+	// A modified kubeconfig is read again
+	later := time.Now().Add(time.Minute)
+	if err = os.Chtimes(kubeconfig, later, later); err != nil {
+		t.Fatalf("failed to touch the kubeconfig: %s", err)
+	}
+	run()
+	run()
+	if n := atomic.LoadInt32(built); n != 2 {
+		t.Errorf("expected the clientset to be rebuilt once after the kubeconfig changed, got %d builds", n)
+	}
+}
+
+func TestK8SSvcTarget(t *testing.T) {
+	tests := []struct {
+		target    string
+		context   string
+		namespace string
+		service   string
+	}{
+		{"default/web", "", "default", "web"},
+		{"cluster-a:default/web", "cluster-a", "default", "web"},
+		{"arn:aws:eks:eu-west-1:123456789012:cluster/prod:monitoring/prometheus", "arn:aws:eks:eu-west-1:123456789012:cluster/prod", "monitoring", "prometheus"},
+	}
+	for _, tt := range tests {
+		context, namespace, service, err := parseK8sSvcTarget(tt.target)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.target, err)
+			continue
+		}
+		if context != tt.context || namespace != tt.namespace || service != tt.service {
+			t.Errorf("%s: expected %q %q %q, got %q %q %q", tt.target, tt.context, tt.namespace, tt.service, context, namespace, service)
+		}
+	}
+
+	for _, target := range []string{"web", ":default/web", "cluster-a:web", "cluster-a:default/", "default/web/extra"} {
+		if _, _, _, err := parseK8sSvcTarget(target); err == nil {
+			t.Errorf("%s: expected an invalid target", target)
+		}
+	}
+}
+
+func TestK8SSvcContexts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8s")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each cluster has a different number of endpoints
+	clusterA := startK8sAPI(1)
+	defer clusterA.Close()
+	clusterB := startK8sAPI(3)
+	defer clusterB.Close()
+	kubeconfig := writeKubeconfig(t, dir, []string{"cluster-a", "cluster-b"}, []*httptest.Server{clusterA, clusterB})
+	os.Setenv("KUBE_CONFIG_PATH", kubeconfig)
+	defer os.Unsetenv("KUBE_CONFIG_PATH")
+
+	tests := []struct {
+		target    string
+		endpoints int
+	}{
+		{"default/web", 1},
+		{"cluster-a:default/web", 1},
+		{"cluster-b:default/web", 3},
+	}
+	for _, tt := range tests {
+		tst := test.Test{Target: tt.target, Type: "k8s-svc", Arguments: map[string]string{}}
+		details, errRun := (&K8SSvcTest{}).RunTestDetailed(context.Background(), tst, tt.target, test.Options{Timeout: 5 * time.Second})
+		if errRun != nil {
+			t.Errorf("%s: expected the test to pass, got: %s", tt.target, errRun)
+			continue
+		}
+		if details["endpoints"] != tt.endpoints {
+			t.Errorf("%s: expected %d endpoints, got %v", tt.target, tt.endpoints, details["endpoints"])
+		}
+	}
+
+	tst := test.Test{Target: "cluster-c:default/web", Type: "k8s-svc", Arguments: map[string]string{}}
+	if err = (&K8SSvcTest{}).RunTest(context.Background(), tst, tst.Target, test.Options{Timeout: 5 * time.Second}); err == nil || !strings.Contains(err.Error(), "cluster-c") {
+		t.Errorf("expected an unknown context to fail, got: %v", err)
+	}
+}
+
+func BenchmarkK8SSvc(b *testing.B) {
+	dir, err := ioutil.TempDir("", "k8s")
+	if err != nil {
+		b.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := startK8sAPI(2)
+	defer server.Close()
+	kubeconfig := writeKubeconfig(b, dir, []string{"stub"}, []*httptest.Server{server})
+	os.Setenv("KUBE_CONFIG_PATH", kubeconfig)
+	defer os.Unsetenv("KUBE_CONFIG_PATH")
+
+	built, restore := countK8sClientsets()
+	defer restore()
+
+	tst := test.Test{Target: "default/web", Type: "k8s-svc", Arguments: map[string]string{}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = (&K8SSvcTest{}).RunTest(context.Background(), tst, tst.Target, test.Options{Timeout: 5 * time.Second}); err != nil {
+			b.Fatalf("expected the test to pass, got: %s", err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt32(built)), "clientsets")
+}
+
+func TestK8SSvcCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8s")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An API server which hangs
+	release := make(chan bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	kubeconfig := writeKubeconfig(t, dir, []string{"slow"}, []*httptest.Server{server})
+	os.Setenv("KUBE_CONFIG_PATH", kubeconfig)
+	defer os.Unsetenv("KUBE_CONFIG_PATH")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	tst := test.Test{Target: "default/web", Type: "k8s-svc", Arguments: map[string]string{}}
+	if err = (&K8SSvcTest{}).RunTest(ctx, tst, tst.Target, test.Options{Timeout: time.Minute}); err == nil {
+		t.Errorf("expected the cancelled test to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the cancelled test to be aborted promptly, took %s", elapsed)
+	}
+}
@@ -0,0 +1,307 @@
+// Load Balancer Tester
+//
+// The load balancer tester queries the API of a cloud provider for the
+// health of the backends of a load balancer, and fails if fewer than the
+// specified number of them (default 1) are healthy.
+//
+// This test is invoked via input like so:
+//
+//    arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/web/73e2d6bc24d8a067 must run lb with min-healthy 2
+//
+// Only AWS is supported for now, where the target is the ARN of an ELB/ALB
+// target group. The region is taken from the ARN, unless `region` is given.
+//
+// The credentials are read from the usual AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables of the
+// worker, or can be given as arguments, which are never included in the
+// results:
+//
+//    with access-key 'AKIA..' with secret-key 'secret'
+//
+// Another API endpoint, e.g. a VPC endpoint, can be used with `endpoint`:
+//
+//    with endpoint https://vpce-0123.elasticloadbalancing.eu-west-1.vpce.amazonaws.com/
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// LBTest is our object.
+type LBTest struct {
+}
+
+// lbBackend is a backend of a load balancer, as reported by its provider.
+type lbBackend struct {
+	ID      string
+	Healthy bool
+
+	// Why the backend is unhealthy
+	Reason string
+}
+
+// lbProvider returns the backends of a load balancer, via the API of a
+// cloud provider.
+type lbProvider func(ctx context.Context, tst test.Test, opts test.Options) ([]lbBackend, error)
+
+// lbProviders contains the supported cloud providers.
+var lbProviders = map[string]lbProvider{
+	"aws": awsTargetGroupBackends,
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *LBTest) Arguments() map[string]string {
+	known := map[string]string{
+		"provider":      "^aws$",
+		"min-healthy":   "^[0-9]+$",
+		"region":        `^[a-z0-9\-]+$`,
+		"endpoint":      "^https?://.+$",
+		"access-key":    ".+",
+		"secret-key":    ".+",
+		"session-token": ".+",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *LBTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *LBTest) Example() string {
+	str := `
+Load Balancer Tester
+--------------------
+ The load balancer tester queries the API of a cloud provider for the
+ health of the backends of a load balancer, and fails if fewer than the
+ specified number of them (default 1) are healthy.
+
+ This test is invoked via input like so:
+
+    arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/web/73e2d6bc24d8a067 must run lb with min-healthy 2
+
+ Only AWS is supported for now, where the target is the ARN of an ELB/ALB
+ target group. The region is taken from the ARN, unless 'region' is given.
+
+ The credentials are read from the usual AWS_ACCESS_KEY_ID,
+ AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables of the
+ worker, or can be given as arguments, which are never included in the
+ results:
+
+    with access-key 'AKIA..' with secret-key 'secret'
+
+ Another API endpoint, e.g. a VPC endpoint, can be used with 'endpoint':
+
+    with endpoint https://vpce-0123.elasticloadbalancing.eu-west-1.vpce.amazonaws.com/
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we fetch the backends of the load balancer, and count the
+// healthy ones.
+func (s *LBTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	provider := "aws"
+	if tst.Arguments["provider"] != "" {
+		provider = tst.Arguments["provider"]
+	}
+
+	backends := lbProviders[provider]
+	if backends == nil {
+		return fmt.Errorf("unsupported load balancer provider '%s'", provider)
+	}
+
+	minHealthy := 1
+	if tst.Arguments["min-healthy"] != "" {
+		var err error
+		if minHealthy, err = strconv.Atoi(tst.Arguments["min-healthy"]); err != nil {
+			return err
+		}
+	}
+
+	found, err := backends(ctx, tst, opts)
+	if err != nil {
+		return err
+	}
+
+	healthy := 0
+	var unhealthy []string
+	for _, backend := range found {
+		if backend.Healthy {
+			healthy++
+			continue
+		}
+		unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", backend.ID, backend.Reason))
+	}
+
+	if opts.Verbose {
+		fmt.Printf("%d healthy backends out of %d\n", healthy, len(found))
+	}
+
+	if healthy < minHealthy {
+		msg := fmt.Sprintf("%d healthy backends out of %d, expected at least %d", healthy, len(found), minHealthy)
+		if len(unhealthy) > 0 {
+			msg += ", unhealthy: " + strings.Join(unhealthy, ", ")
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	return nil
+}
+
+// awsTargetHealthResponse is the response of the DescribeTargetHealth
+// action of the Elastic Load Balancing API.
+type awsTargetHealthResponse struct {
+	Descriptions []struct {
+		ID     string `xml:"Target>Id"`
+		Port   string `xml:"Target>Port"`
+		State  string `xml:"TargetHealth>State"`
+		Reason string `xml:"TargetHealth>Reason"`
+	} `xml:"DescribeTargetHealthResult>TargetHealthDescriptions>member"`
+}
+
+// awsErrorResponse is the error returned by the AWS query APIs.
+type awsErrorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+// awsTargetGroupBackends returns the targets of an ELB/ALB target group,
+// whose ARN is the target of the test.
+func awsTargetGroupBackends(ctx context.Context, tst test.Test, opts test.Options) ([]lbBackend, error) {
+
+	arn := tst.Target
+	fields := strings.Split(arn, ":")
+	if len(fields) < 6 || fields[0] != "arn" || !strings.HasPrefix(fields[5], "targetgroup/") {
+		return nil, fmt.Errorf("the target must be the ARN of a target group, got '%s'", arn)
+	}
+
+	region := fields[3]
+	if tst.Arguments["region"] != "" {
+		region = tst.Arguments["region"]
+	}
+
+	accessKey := tst.Arguments["access-key"]
+	secretKey := tst.Arguments["secret-key"]
+	sessionToken := tst.Arguments["session-token"]
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("no AWS credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or use access-key and secret-key")
+	}
+
+	endpoint := fmt.Sprintf("https://elasticloadbalancing.%s.amazonaws.com/", region)
+	if tst.Arguments["endpoint"] != "" {
+		endpoint = tst.Arguments["endpoint"]
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{
+		"Action":         []string{"DescribeTargetHealth"},
+		"Version":        []string{"2015-12-01"},
+		"TargetGroupArn": []string{arn},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signAWSRequestV4(req, accessKey, secretKey, region, "elasticloadbalancing", time.Now())
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var apiError awsErrorResponse
+		if xml.Unmarshal(body, &apiError) == nil && apiError.Code != "" {
+			return nil, fmt.Errorf("failed to describe the target health, %s: %s", apiError.Code, apiError.Message)
+		}
+		return nil, fmt.Errorf("failed to describe the target health, status code was %d", response.StatusCode)
+	}
+
+	var health awsTargetHealthResponse
+	if err = xml.Unmarshal(body, &health); err != nil {
+		return nil, fmt.Errorf("failed to decode the target health: %s", err.Error())
+	}
+
+	var backends []lbBackend
+	for _, description := range health.Descriptions {
+		id := description.ID
+		if description.Port != "" {
+			id += ":" + description.Port
+		}
+
+		reason := description.State
+		if description.Reason != "" {
+			reason += ", " + description.Reason
+		}
+
+		backends = append(backends, lbBackend{
+			ID:      id,
+			Healthy: description.State == "healthy",
+			Reason:  reason,
+		})
+	}
+
+	return backends, nil
+}
+
+func (s *LBTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("lb", func() ProtocolTest {
+		return &LBTest{}
+	})
+}
@@ -0,0 +1,109 @@
+package protocols
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+const lbTargetGroup = "arn:aws:elasticloadbalancing:eu-west-1:123456789012:targetgroup/web/73e2d6bc24d8a067"
+
+const lbTargetHealth = `<DescribeTargetHealthResponse xmlns="http://elasticloadbalancing.amazonaws.com/doc/2015-12-01/">
+  <DescribeTargetHealthResult>
+    <TargetHealthDescriptions>
+      <member>
+        <Target><Id>i-0f76fade</Id><Port>80</Port></Target>
+        <TargetHealth><State>healthy</State></TargetHealth>
+      </member>
+      <member>
+        <Target><Id>i-0f76fadf</Id><Port>80</Port></Target>
+        <TargetHealth><State>healthy</State></TargetHealth>
+      </member>
+      <member>
+        <Target><Id>i-0f76fae0</Id><Port>80</Port></Target>
+        <TargetHealth><State>unhealthy</State><Reason>Target.FailedHealthChecks</Reason></TargetHealth>
+      </member>
+    </TargetHealthDescriptions>
+  </DescribeTargetHealthResult>
+</DescribeTargetHealthResponse>`
+
+func TestLB(t *testing.T) {
+	var authorization, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		token = r.Header.Get("X-Amz-Security-Token")
+
+		if r.URL.Query().Get("Action") != "DescribeTargetHealth" || r.URL.Query().Get("TargetGroupArn") == "" {
+			http.Error(w, "unexpected action", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("TargetGroupArn") != lbTargetGroup {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`<ErrorResponse><Error><Code>TargetGroupNotFound</Code><Message>One or more target groups not found</Message></Error></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(lbTargetHealth))
+	}))
+	defer server.Close()
+
+	run := func(target string, args map[string]string) error {
+		args["endpoint"] = server.URL + "/"
+		tst := test.Test{Target: target, Type: "lb", Arguments: args}
+		return (&LBTest{}).RunTest(context.Background(), tst, target, test.Options{Timeout: 5 * time.Second})
+	}
+
+	credentials := func(args map[string]string) map[string]string {
+		args["access-key"] = "AKIDEXAMPLE"
+		args["secret-key"] = "secret"
+		return args
+	}
+
+	if err := run(lbTargetGroup, credentials(map[string]string{"min-healthy": "2"})); err != nil {
+		t.Errorf("expected 2 healthy backends to pass: %s", err)
+	}
+	if !strings.Contains(authorization, "Credential=AKIDEXAMPLE/") || !strings.Contains(authorization, "/eu-west-1/elasticloadbalancing/aws4_request") {
+		t.Errorf("expected a signed request for the region of the ARN, got %q", authorization)
+	}
+
+	err := run(lbTargetGroup, credentials(map[string]string{"min-healthy": "3"}))
+	if err == nil || !strings.Contains(err.Error(), "2 healthy backends out of 3") || !strings.Contains(err.Error(), "i-0f76fae0:80 (unhealthy, Target.FailedHealthChecks)") {
+		t.Errorf("expected too few healthy backends to fail, got: %v", err)
+	}
+
+	err = run(strings.Replace(lbTargetGroup, "web", "api", 1), credentials(map[string]string{}))
+	if err == nil || !strings.Contains(err.Error(), "TargetGroupNotFound") {
+		t.Errorf("expected the API error to be reported, got: %v", err)
+	}
+
+	if err = run("web.example.com", credentials(map[string]string{})); err == nil {
+		t.Errorf("expected a target which is not an ARN to fail")
+	}
+
+	// Credentials are read from the environment by default
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	if err = run(lbTargetGroup, map[string]string{}); err == nil || !strings.Contains(err.Error(), "no AWS credentials") {
+		t.Errorf("expected missing credentials to fail, got: %v", err)
+	}
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "ASIAEXAMPLE")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_SESSION_TOKEN", "session")
+	if err = run(lbTargetGroup, map[string]string{"region": "us-east-1"}); err != nil {
+		t.Errorf("expected credentials from the environment to be used: %s", err)
+	}
+	if !strings.Contains(authorization, "Credential=ASIAEXAMPLE/") || !strings.Contains(authorization, "/us-east-1/") || token != "session" {
+		t.Errorf("unexpected signing with temporary credentials: %q (token %q)", authorization, token)
+	}
+	if !strings.Contains(authorization, "x-amz-security-token") {
+		t.Errorf("expected the session token to be signed, got %q", authorization)
+	}
+}
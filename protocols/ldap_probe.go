@@ -0,0 +1,364 @@
+// LDAP Tester
+//
+// The LDAP tester connects to an LDAP server, and performs a simple bind,
+// failing if the server can't be reached, or refuses the bind.
+//
+// This test is invoked via input like so:
+//
+//    ldap.example.com must run ldap
+//
+// Without credentials the bind is anonymous, which confirms the server
+// responds. To check credentials too use:
+//
+//    ldap.example.com must run ldap with bind-dn 'cn=monitor,dc=example,dc=com' with bind-password 'secret'
+//
+// LDAPS, i.e. LDAP over TLS, is used via `with tls true`, on port 636 by
+// default instead of 389. The port can be changed too:
+//
+//    ldap.example.com must run ldap with tls true with port 1636
+//
+
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// The BER tags of the LDAP messages the tester exchanges.
+const (
+	berInteger      = 0x02
+	berOctetString  = 0x04
+	berEnumerated   = 0x0a
+	berSequence     = 0x30
+	ldapBindRequest = 0x60
+	ldapBindResult  = 0x61
+	ldapUnbind      = 0x42
+	ldapSimpleAuth  = 0x80
+)
+
+// ldapResultCodes are the names of the result codes a bind usually fails
+// with.
+var ldapResultCodes = map[int]string{
+	32: "no such object",
+	48: "inappropriate authentication",
+	49: "invalid credentials",
+	50: "insufficient access rights",
+	51: "busy",
+	52: "unavailable",
+	53: "unwilling to perform",
+}
+
+// LDAPTest is our object.
+type LDAPTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *LDAPTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":          "^[0-9]+$",
+		"tls":           "^(true|false)$",
+		"bind-dn":       ".+",
+		"bind-password": ".+",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *LDAPTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments ensures the credentials are given together, as a bind
+// with a DN but without password is an unauthenticated bind, which most
+// servers accept without checking anything.
+func (s *LDAPTest) ValidateArguments(args map[string]string) error {
+	if (args["bind-dn"] == "") != (args["bind-password"] == "") {
+		return errors.New("the 'bind-dn' and 'bind-password' must be given together")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *LDAPTest) Example() string {
+	str := `
+LDAP Tester
+-----------
+ The LDAP tester connects to an LDAP server, and performs a simple bind,
+ failing if the server can't be reached, or refuses the bind.
+
+ This test is invoked via input like so:
+
+    ldap.example.com must run ldap
+
+ Without credentials the bind is anonymous, which confirms the server
+ responds. To check credentials too use:
+
+    ldap.example.com must run ldap with bind-dn 'cn=monitor,dc=example,dc=com' with bind-password 'secret'
+
+ LDAPS, i.e. LDAP over TLS, is used via 'with tls true', on port 636 by
+ default instead of 389. The port can be changed too:
+
+    ldap.example.com must run ldap with tls true with port 1636
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we send a bind request, check its result, and unbind.
+func (s *LDAPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	useTLS := tst.Arguments["tls"] == "true"
+
+	port := 389
+	if useTLS {
+		port = 636
+	}
+	if tst.Arguments["port"] != "" {
+		port, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := newDialer(opts).DialContext(ctx, "tcp", net.JoinHostPort(target, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return err
+	}
+
+	if useTLS {
+		roots, errCA := rootCAs(tst, opts)
+		if errCA != nil {
+			return errCA
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: tst.Target, RootCAs: roots})
+		if err = tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+
+	dn := tst.Arguments["bind-dn"]
+	if _, err = conn.Write(ldapBindMessage(1, dn, tst.Arguments["bind-password"])); err != nil {
+		return err
+	}
+
+	code, diagnostic, err := readBindResult(bufio.NewReader(conn), 1)
+	if err != nil {
+		return fmt.Errorf("failed to read the LDAP bind response: %s", err.Error())
+	}
+
+	if opts.Verbose {
+		fmt.Printf("LDAP bind as '%s' returned %d\n", dn, code)
+	}
+
+	if code != 0 {
+		bind := "anonymous bind"
+		if dn != "" {
+			bind = fmt.Sprintf("bind as '%s'", dn)
+		}
+
+		reason := fmt.Sprintf("result code %d", code)
+		if name, ok := ldapResultCodes[code]; ok {
+			reason = fmt.Sprintf("%s (%d)", name, code)
+		}
+		if diagnostic != "" {
+			reason += ": " + diagnostic
+		}
+		return fmt.Errorf("LDAP %s failed: %s", bind, reason)
+	}
+
+	// Unbinding has no response, and its failure doesn't matter
+	conn.Write(berTLV(berSequence, append(berInt(2), ldapUnbind, 0)))
+
+	return nil
+}
+
+// ldapBindMessage returns a simple bind request, anonymous if the DN and
+// password are empty.
+func ldapBindMessage(id int, dn string, password string) []byte {
+	bind := berInt(3)
+	bind = append(bind, berTLV(berOctetString, []byte(dn))...)
+	bind = append(bind, berTLV(ldapSimpleAuth, []byte(password))...)
+
+	return berTLV(berSequence, append(berInt(id), berTLV(ldapBindRequest, bind)...))
+}
+
+// readBindResult reads the response to the bind request of the given id,
+// returning its result code and diagnostic message.
+func readBindResult(r *bufio.Reader, id int) (int, string, error) {
+	tag, message, err := readBER(r)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != berSequence {
+		return 0, "", fmt.Errorf("unexpected LDAP message tag 0x%02x", tag)
+	}
+
+	tag, value, message, err := parseBER(message)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != berInteger || berToInt(value) != id {
+		return 0, "", errors.New("the response does not match our request")
+	}
+
+	tag, result, _, err := parseBER(message)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != ldapBindResult {
+		return 0, "", fmt.Errorf("unexpected LDAP operation tag 0x%02x", tag)
+	}
+
+	tag, value, result, err = parseBER(result)
+	if err != nil {
+		return 0, "", err
+	}
+	if tag != berEnumerated {
+		return 0, "", errors.New("the response has no result code")
+	}
+	code := berToInt(value)
+
+	// The matched DN, then the diagnostic message
+	var diagnostic []byte
+	if _, _, result, err = parseBER(result); err == nil {
+		_, diagnostic, _, _ = parseBER(result)
+	}
+
+	return code, string(diagnostic), nil
+}
+
+// berTLV encodes a BER element with the given tag.
+func berTLV(tag byte, content []byte) []byte {
+	element := []byte{tag}
+	if len(content) < 0x80 {
+		element = append(element, byte(len(content)))
+	} else {
+		var length []byte
+		for n := len(content); n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		element = append(element, 0x80|byte(len(length)))
+		element = append(element, length...)
+	}
+	return append(element, content...)
+}
+
+// berInt encodes a small, non-negative, BER integer.
+func berInt(value int) []byte {
+	var content []byte
+	for ; value > 0x7f; value >>= 8 {
+		content = append([]byte{byte(value)}, content...)
+	}
+	return berTLV(berInteger, append([]byte{byte(value)}, content...))
+}
+
+// berToInt decodes the content of a small BER integer.
+func berToInt(content []byte) int {
+	value := 0
+	for _, b := range content {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// berLength decodes the length of a BER element from its first length
+// byte, and the following ones of the long form, if any.
+func berLength(first byte, long []byte) int {
+	if first&0x80 == 0 {
+		return int(first)
+	}
+	length := 0
+	for _, b := range long {
+		length = length<<8 | int(b)
+	}
+	return length
+}
+
+// berLongSize returns the number of bytes following the first length byte
+// of a BER element, servers using more of them than needed at times.
+func berLongSize(first byte) (int, error) {
+	if first&0x80 == 0 {
+		return 0, nil
+	}
+	size := int(first & 0x7f)
+	if size == 0 || size > 4 {
+		return 0, errors.New("unsupported BER length")
+	}
+	return size, nil
+}
+
+// readBER reads a BER element, with a definite length, from the reader.
+func readBER(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size, err := berLongSize(header[1])
+	if err != nil {
+		return 0, nil, err
+	}
+	long := make([]byte, size)
+	if _, err = io.ReadFull(r, long); err != nil {
+		return 0, nil, err
+	}
+
+	content := make([]byte, berLength(header[1], long))
+	if _, err = io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return header[0], content, nil
+}
+
+// parseBER parses the BER element at the start of the data, returning its
+// tag, its content, and the data following it.
+func parseBER(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("truncated LDAP message")
+	}
+	size, err := berLongSize(data[1])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if len(data) < 2+size {
+		return 0, nil, nil, errors.New("truncated LDAP message")
+	}
+
+	start := 2 + size
+	length := berLength(data[1], data[2:start])
+	if len(data)-start < length {
+		return 0, nil, nil, errors.New("truncated LDAP message")
+	}
+	return data[0], data[start : start+length], data[start+length:], nil
+}
+
+func (s *LDAPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("ldap", func() ProtocolTest {
+		return &LDAPTest{}
+	})
+}
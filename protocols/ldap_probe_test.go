@@ -0,0 +1,146 @@
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// berLongTLV encodes a BER element with a 4-byte length, like OpenLDAP.
+func berLongTLV(tag byte, content []byte) []byte {
+	n := len(content)
+	return append([]byte{tag, 0x84, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, content...)
+}
+
+// startLDAPServer starts a stub LDAP server, accepting the binds with the
+// given passwords of their DNs, "" being the anonymous bind.
+func startLDAPServer(listener net.Listener, passwords map[string]string) string {
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				_, message, err := readBER(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				_, id, message, _ := parseBER(message)
+				_, bind, _, _ := parseBER(message)
+				_, _, bind, _ = parseBER(bind)
+				_, dn, bind, _ := parseBER(bind)
+				_, password, _, _ := parseBER(bind)
+
+				code, diagnostic := 49, "invalid credentials"
+				if expected, ok := passwords[string(dn)]; ok && expected == string(password) {
+					code, diagnostic = 0, ""
+				}
+
+				result := berLongTLV(berEnumerated, []byte{byte(code)})
+				result = append(result, berLongTLV(berOctetString, nil)...)
+				result = append(result, berLongTLV(berOctetString, []byte(diagnostic))...)
+				conn.Write(berLongTLV(berSequence, append(berTLV(berInteger, id), berLongTLV(ldapBindResult, result)...)))
+			}(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+func TestLDAP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	port := startLDAPServer(listener, map[string]string{"": "", "cn=monitor,dc=example,dc=com": "secret"})
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := strconv.Itoa(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	tests := []struct {
+		port     string
+		dn       string
+		password string
+		failure  string
+	}{
+		{port, "", "", ""},
+		{port, "cn=monitor,dc=example,dc=com", "secret", ""},
+		{port, "cn=monitor,dc=example,dc=com", "wrong", "LDAP bind as 'cn=monitor,dc=example,dc=com' failed: invalid credentials (49)"},
+		{port, "cn=nobody,dc=example,dc=com", "secret", "invalid credentials (49)"},
+		{closedPort, "", "", "refused"},
+	}
+
+	for i, tt := range tests {
+		args := map[string]string{"port": tt.port}
+		if tt.dn != "" {
+			args["bind-dn"] = tt.dn
+			args["bind-password"] = tt.password
+		}
+		tst := test.Test{Target: "127.0.0.1", Type: "ldap", Arguments: args}
+		err := (&LDAPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+		if tt.password != "" && err != nil && strings.Contains(err.Error(), tt.password) {
+			t.Errorf("test %d: the password leaked into the failure: %s", i, err)
+		}
+		if tt.password != "" && strings.Contains(tst.Sanitize(), tt.password) {
+			t.Errorf("test %d: the password was not sanitized: %s", i, tst.Sanitize())
+		}
+	}
+}
+
+func TestLDAPS(t *testing.T) {
+	root, rootKey := issueCertificate(t, "Overseer Root", true, nil, nil)
+	leaf, leafKey := issueCertificate(t, "localhost", false, root, rootKey)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: leafKey}},
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	port := startLDAPServer(listener, map[string]string{"": ""})
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	tst := test.Test{Target: "127.0.0.1", Type: "ldap", Arguments: map[string]string{"tls": "true", "port": port}}
+	if err = (&LDAPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second, RootCAs: roots}); err != nil {
+		t.Errorf("expected a trusted LDAPS server to pass, got: %s", err)
+	}
+	if err = (&LDAPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second}); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected an untrusted LDAPS server to fail, got: %v", err)
+	}
+}
+
+func TestLDAPArguments(t *testing.T) {
+	if err := (&LDAPTest{}).ValidateArguments(map[string]string{"bind-dn": "cn=monitor"}); err == nil {
+		t.Errorf("expected a bind-dn without bind-password to be rejected")
+	}
+	if err := (&LDAPTest{}).ValidateArguments(map[string]string{"bind-dn": "cn=monitor", "bind-password": "secret"}); err != nil {
+		t.Errorf("expected the credentials to be accepted, got: %s", err)
+	}
+	if err := (&LDAPTest{}).ValidateArguments(map[string]string{}); err != nil {
+		t.Errorf("expected an anonymous bind to be accepted, got: %s", err)
+	}
+}
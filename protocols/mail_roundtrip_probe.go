@@ -0,0 +1,361 @@
+// Mail Round-Trip Tester
+//
+// The mail round-trip tester sends an email via SMTP, and then polls an IMAP
+// mailbox until it arrives, to verify that mail is delivered end-to-end.
+//
+// This test is invoked via input like so:
+//
+//    mx.example.com must run mail-roundtrip with to 'probe@example.com' with imap-username 'probe@example.com' with imap-password 'secret'
+//
+// The target is the SMTP server the email is sent to, on port 25 unless
+// `port` is given. If you supply a username & password a login will be
+// made, which requires STARTTLS, as for the smtp tester. The sender is
+// the recipient itself, unless `from` is given.
+//
+// The IMAP mailbox is read over TLS from the target itself, on port 993,
+// unless `imap-host` and `imap-port` are given. Plain IMAP can be used with
+// `with imap-tls off`, and certificates are not verified with
+// `with tls insecure`. The INBOX folder is searched, unless `mailbox` is
+// given.
+//
+// The email is matched via a unique token in its subject, and deleted once
+// found. It must arrive within a minute, which can be changed with
+// `delivery-deadline`:
+//
+//    with delivery-deadline 5m
+//
+// The passwords are never included in the results.
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/emersion/go-imap"
+)
+
+// mailRoundtripPollInterval is how often the mailbox is searched for the
+// email.
+var mailRoundtripPollInterval = 5 * time.Second
+
+// MailRoundtripTest is our object.
+type MailRoundtripTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *MailRoundtripTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":              "^[0-9]+$",
+		"from":              "^[^\\s<>]+@[^\\s<>]+$",
+		"to":                "^[^\\s<>]+@[^\\s<>]+$",
+		"username":          ".*",
+		"password":          ".*",
+		"tls":               "insecure",
+		"imap-host":         `^[a-zA-Z0-9.:\[\]\-]+$`,
+		"imap-port":         "^[0-9]+$",
+		"imap-username":     ".+",
+		"imap-password":     ".+",
+		"imap-tls":          "^(on|off)$",
+		"mailbox":           ".+",
+		"delivery-deadline": `^[0-9]+(\.[0-9]+)?(s|m|h)$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *MailRoundtripTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments checks that the recipient and the mailbox credentials
+// are given.
+func (s *MailRoundtripTest) ValidateArguments(args map[string]string) error {
+	if args["to"] == "" {
+		return errors.New("the recipient must be given with 'to'")
+	}
+	if args["imap-username"] == "" || args["imap-password"] == "" {
+		return errors.New("the mailbox credentials must be given with 'imap-username' and 'imap-password'")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *MailRoundtripTest) Example() string {
+	str := `
+Mail Round-Trip Tester
+----------------------
+ The mail round-trip tester sends an email via SMTP, and then polls an IMAP
+ mailbox until it arrives, to verify that mail is delivered end-to-end.
+
+ This test is invoked via input like so:
+
+    mx.example.com must run mail-roundtrip with to 'probe@example.com' with imap-username 'probe@example.com' with imap-password 'secret'
+
+ The target is the SMTP server the email is sent to, on port 25 unless
+ 'port' is given. If you supply a username & password a login will be
+ made, which requires STARTTLS, as for the smtp tester. The sender is
+ the recipient itself, unless 'from' is given.
+
+ The IMAP mailbox is read over TLS from the target itself, on port 993,
+ unless 'imap-host' and 'imap-port' are given. Plain IMAP can be used with
+ 'with imap-tls off', and certificates are not verified with
+ 'with tls insecure'. The INBOX folder is searched, unless 'mailbox' is
+ given.
+
+ The email is matched via a unique token in its subject, and deleted once
+ found. It must arrive within a minute, which can be changed with
+ 'delivery-deadline':
+
+    with delivery-deadline 5m
+
+ The passwords are never included in the results.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we send an email with a unique subject, and wait for it to
+// show up in the mailbox.
+func (s *MailRoundtripTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	deliveryDeadline, err := mailDeliveryDeadline(tst)
+	if err != nil {
+		return err
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if tst.Arguments["tls"] == "insecure" {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	subject := "overseer mail-roundtrip " + token
+
+	sent := time.Now()
+	if err = s.send(ctx, tst, target, subject, tlsConfig, opts); err != nil {
+		return fmt.Errorf("failed to send the email: %s", err.Error())
+	}
+
+	elapsed, err := s.await(ctx, tst, target, subject, tlsConfig, sent.Add(deliveryDeadline), opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("The email to %s was delivered in %s\n", tst.Arguments["to"], elapsed)
+	}
+
+	return nil
+}
+
+// send sends the email with the given subject via the SMTP server.
+func (s *MailRoundtripTest) send(ctx context.Context, tst test.Test, target string, subject string, tlsConfig *tls.Config, opts test.Options) error {
+	port := 25
+	if tst.Arguments["port"] != "" {
+		var err error
+		if port, err = strconv.Atoi(tst.Arguments["port"]); err != nil {
+			return err
+		}
+	}
+
+	conn, err := newDialer(opts).DialContext(ctx, "tcp", net.JoinHostPort(target, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(deadline(ctx, opts.Timeout))
+
+	c, err := smtp.NewClient(conn, tst.Target)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+	if err = c.Hello(hostname); err != nil {
+		return err
+	}
+
+	if tst.Arguments["username"] != "" && tst.Arguments["password"] != "" {
+		if hasStartTLS, _ := c.Extension("STARTTLS"); !hasStartTLS {
+			return errors.New("we cannot login without STARTTLS, and that was not advertised")
+		}
+
+		config := tlsConfig.Clone()
+		config.ServerName = tst.Target
+		if err = c.StartTLS(config); err != nil {
+			return err
+		}
+		if err = c.Auth(smtp.PlainAuth("", tst.Arguments["username"], tst.Arguments["password"], tst.Target)); err != nil {
+			return err
+		}
+	}
+
+	to := tst.Arguments["to"]
+	from := to
+	if tst.Arguments["from"] != "" {
+		from = tst.Arguments["from"]
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\nThis email was sent by overseer to test its delivery, and will be deleted.\r\n",
+		from, to, subject, time.Now().Format(time.RFC1123Z))
+	if err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// await polls the mailbox until the email with the given subject arrives,
+// or the deadline expires, then deletes the email.
+func (s *MailRoundtripTest) await(ctx context.Context, tst test.Test, target string, subject string, tlsConfig *tls.Config, deliveredBy time.Time, opts test.Options) (time.Duration, error) {
+	start := time.Now()
+
+	host := target
+	if tst.Arguments["imap-host"] != "" {
+		host = tst.Arguments["imap-host"]
+	}
+	port := 993
+	if tst.Arguments["imap-port"] != "" {
+		var err error
+		if port, err = strconv.Atoi(tst.Arguments["imap-port"]); err != nil {
+			return 0, err
+		}
+	}
+
+	var config *tls.Config
+	if tst.Arguments["imap-tls"] != "off" {
+		config = tlsConfig.Clone()
+		if config.ServerName == "" && !config.InsecureSkipVerify {
+			config.ServerName = tst.Target
+			if tst.Arguments["imap-host"] != "" {
+				config.ServerName = tst.Arguments["imap-host"]
+			}
+		}
+	}
+
+	c, err := dialIMAP(ctx, net.JoinHostPort(host, strconv.Itoa(port)), config, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to the mailbox: %s", err.Error())
+	}
+	defer c.Close()
+	c.Timeout = opts.Timeout
+
+	if err = c.Login(tst.Arguments["imap-username"], tst.Arguments["imap-password"]); err != nil {
+		return 0, fmt.Errorf("failed to login to the mailbox: %s", err.Error())
+	}
+	defer c.Logout()
+
+	mailbox := "INBOX"
+	if tst.Arguments["mailbox"] != "" {
+		mailbox = tst.Arguments["mailbox"]
+	}
+
+	criteria := &imap.SearchCriteria{Header: textproto.MIMEHeader{"Subject": []string{subject}}}
+	for {
+		// Selecting the mailbox again refreshes its messages
+		if _, err = c.Select(mailbox, false); err != nil {
+			return 0, fmt.Errorf("failed to select the mailbox %s: %s", mailbox, err.Error())
+		}
+
+		ids, err := c.Search(criteria)
+		if err != nil {
+			return 0, fmt.Errorf("failed to search the mailbox %s: %s", mailbox, err.Error())
+		}
+
+		if len(ids) > 0 {
+			elapsed := time.Since(start)
+
+			// Clean up, the email is no longer needed
+			seqSet := new(imap.SeqSet)
+			seqSet.AddNum(ids...)
+			if err = c.Store(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil); err != nil {
+				return 0, fmt.Errorf("failed to delete the email: %s", err.Error())
+			}
+			if err = c.Expunge(nil); err != nil {
+				return 0, fmt.Errorf("failed to delete the email: %s", err.Error())
+			}
+
+			return elapsed, nil
+		}
+
+		if time.Now().Add(mailRoundtripPollInterval).After(deliveredBy) {
+			return 0, fmt.Errorf("the email was not delivered to %s within %s", mailbox, deliveredBy.Sub(start).Round(time.Second))
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(mailRoundtripPollInterval):
+		}
+	}
+}
+
+// MaxDuration returns how long the test may take: the delivery deadline,
+// then the commands of the last poll of the mailbox, deleting the email,
+// and logging out, each within the timeout.
+func (s *MailRoundtripTest) MaxDuration(tst test.Test, opts test.Options) time.Duration {
+	deliveryDeadline, err := mailDeliveryDeadline(tst)
+	if err != nil {
+		return opts.Timeout
+	}
+	return deliveryDeadline + 5*opts.Timeout
+}
+
+// mailDeliveryDeadline returns how long the email has to be delivered.
+func mailDeliveryDeadline(tst test.Test) (time.Duration, error) {
+	if tst.Arguments["delivery-deadline"] == "" {
+		return time.Minute, nil
+	}
+	return time.ParseDuration(tst.Arguments["delivery-deadline"])
+}
+
+func (s *MailRoundtripTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("mail-roundtrip", func() ProtocolTest {
+		return &MailRoundtripTest{}
+	})
+}
@@ -0,0 +1,205 @@
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// stubMailbox holds the subjects of the emails delivered by the stub SMTP
+// server, and read by the stub IMAP server.
+type stubMailbox struct {
+	sync.Mutex
+	subjects []string
+
+	// If true, the stub SMTP server accepts emails but never delivers them
+	drop bool
+}
+
+// startStubSMTP starts a stub SMTP server delivering emails to the mailbox,
+// returning its port.
+func startStubSMTP(t *testing.T, mailbox *stubMailbox) (int, func()) {
+	return startStubServer(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "220 stub ESMTP\r\n")
+
+		subject := ""
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+
+			if inData {
+				if line == "." {
+					inData = false
+					mailbox.Lock()
+					if !mailbox.drop {
+						mailbox.subjects = append(mailbox.subjects, subject)
+					}
+					mailbox.Unlock()
+					fmt.Fprintf(conn, "250 queued\r\n")
+				} else if strings.HasPrefix(line, "Subject: ") {
+					subject = strings.TrimPrefix(line, "Subject: ")
+				}
+				continue
+			}
+
+			switch strings.ToUpper(strings.SplitN(line, " ", 2)[0]) {
+			case "DATA":
+				inData = true
+				fmt.Fprintf(conn, "354 go ahead\r\n")
+			case "QUIT":
+				fmt.Fprintf(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprintf(conn, "250 ok\r\n")
+			}
+		}
+	})
+}
+
+// startStubIMAP starts a stub IMAP server serving the mailbox, returning
+// its port.
+func startStubIMAP(t *testing.T, mailbox *stubMailbox) (int, func()) {
+	return startStubServer(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		fmt.Fprintf(conn, "* OK [CAPABILITY IMAP4rev1] stub ready\r\n")
+
+		deleted := map[int]bool{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 3)
+			if len(fields) < 2 {
+				return
+			}
+			tag, command := fields[0], strings.ToUpper(fields[1])
+
+			mailbox.Lock()
+			switch command {
+			case "LOGIN":
+				if !strings.Contains(fields[2], "secret") {
+					fmt.Fprintf(conn, "%s NO invalid credentials\r\n", tag)
+					break
+				}
+				fmt.Fprintf(conn, "%s OK logged in\r\n", tag)
+			case "SELECT":
+				fmt.Fprintf(conn, "* %d EXISTS\r\n%s OK [READ-WRITE] selected\r\n", len(mailbox.subjects), tag)
+			case "SEARCH":
+				var ids []string
+				for i, subject := range mailbox.subjects {
+					if strings.Contains(fields[2], subject) {
+						ids = append(ids, strconv.Itoa(i+1))
+					}
+				}
+				fmt.Fprintf(conn, "* SEARCH %s\r\n%s OK searched\r\n", strings.Join(ids, " "), tag)
+			case "STORE":
+				id, _ := strconv.Atoi(strings.Fields(fields[2])[0])
+				deleted[id] = true
+				fmt.Fprintf(conn, "%s OK stored\r\n", tag)
+			case "EXPUNGE":
+				var kept []string
+				for i, subject := range mailbox.subjects {
+					if !deleted[i+1] {
+						kept = append(kept, subject)
+					}
+				}
+				mailbox.subjects = kept
+				deleted = map[int]bool{}
+				fmt.Fprintf(conn, "%s OK expunged\r\n", tag)
+			case "LOGOUT":
+				fmt.Fprintf(conn, "* BYE\r\n%s OK logged out\r\n", tag)
+				mailbox.Unlock()
+				return
+			default:
+				fmt.Fprintf(conn, "%s OK\r\n", tag)
+			}
+			mailbox.Unlock()
+		}
+	})
+}
+
+// startStubServer accepts connections on a local port, serving each of
+// them with the handler.
+func startStubServer(t *testing.T, handle func(conn net.Conn)) (int, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, func() { listener.Close() }
+}
+
+func TestMailRoundtrip(t *testing.T) {
+	mailRoundtripPollInterval = 10 * time.Millisecond
+
+	mailbox := &stubMailbox{subjects: []string{"an unrelated email"}}
+	smtpPort, stopSMTP := startStubSMTP(t, mailbox)
+	defer stopSMTP()
+	imapPort, stopIMAP := startStubIMAP(t, mailbox)
+	defer stopIMAP()
+
+	run := func(password string) error {
+		tst := test.Test{Target: "127.0.0.1", Type: "mail-roundtrip", Arguments: map[string]string{
+			"port":              strconv.Itoa(smtpPort),
+			"to":                "probe@example.com",
+			"imap-port":         strconv.Itoa(imapPort),
+			"imap-username":     "probe@example.com",
+			"imap-password":     password,
+			"imap-tls":          "off",
+			"delivery-deadline": "200ms",
+		}}
+		if strings.Contains(tst.Sanitize(), password) {
+			t.Fatalf("the IMAP password was not sanitized: %s", tst.Sanitize())
+		}
+		return (&MailRoundtripTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second})
+	}
+
+	// The email is delivered, and then deleted
+	if err := run("secret"); err != nil {
+		t.Fatalf("expected the email to be delivered, got %s", err)
+	}
+	if len(mailbox.subjects) != 1 || mailbox.subjects[0] != "an unrelated email" {
+		t.Fatalf("expected only the test email to be deleted, got %v", mailbox.subjects)
+	}
+
+	// The email is lost
+	mailbox.drop = true
+	err := run("secret")
+	if err == nil || !strings.Contains(err.Error(), "not delivered") {
+		t.Fatalf("expected the delivery to fail, got %v", err)
+	}
+	mailbox.drop = false
+
+	// The mailbox cannot be read
+	err = run("wrong")
+	if err == nil || !strings.Contains(err.Error(), "failed to login") {
+		t.Fatalf("expected the login to fail, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Memcached Tester
+//
+// The memcached tester connects to a memcached server, and asks for its
+// version, failing unless the server answers.
+//
+// This test is invoked via input like so:
+//
+//    cache.example.com must run memcached [with port 11211]
+//
+// One of the statistics of the server can be required to be above a
+// threshold, 0 by default, e.g. to require clients to be connected:
+//
+//    cache.example.com must run memcached with stats curr_connections with gt 10
+//
+
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// MemcachedTest is our object.
+type MemcachedTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *MemcachedTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":  "^[0-9]+$",
+		"stats": "^[a-z0-9_:]+$",
+		"gt":    `^-?[0-9]+(\.[0-9]+)?$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *MemcachedTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *MemcachedTest) Example() string {
+	str := `
+Memcached Tester
+----------------
+ The memcached tester connects to a memcached server, and asks for its
+ version, failing unless the server answers.
+
+ This test is invoked via input like so:
+
+    cache.example.com must run memcached [with port 11211]
+
+ One of the statistics of the server can be required to be above a
+ threshold, 0 by default, e.g. to require clients to be connected:
+
+    cache.example.com must run memcached with stats curr_connections with gt 10
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we send the version command, and the stats one if a
+// statistic must be checked, over the text protocol.
+func (s *MemcachedTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	port := 11211
+	if tst.Arguments["port"] != "" {
+		port, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	threshold := 0.0
+	if tst.Arguments["gt"] != "" {
+		threshold, err = strconv.ParseFloat(tst.Arguments["gt"], 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := newDialer(opts).DialContext(ctx, "tcp", net.JoinHostPort(target, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(conn)
+
+	if _, err = conn.Write([]byte("version\r\n")); err != nil {
+		return err
+	}
+	line, err := readMemcachedLine(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "VERSION ") {
+		return fmt.Errorf("unexpected reply to the version command: '%s'", line)
+	}
+
+	if opts.Verbose {
+		fmt.Printf("memcached %s\n", strings.TrimPrefix(line, "VERSION "))
+	}
+
+	name := tst.Arguments["stats"]
+	if name == "" {
+		return nil
+	}
+
+	if _, err = conn.Write([]byte("stats\r\n")); err != nil {
+		return err
+	}
+	stats, err := readMemcachedStats(reader)
+	if err != nil {
+		return err
+	}
+
+	raw, ok := stats[name]
+	if !ok {
+		return fmt.Errorf("the server has no stat '%s'", name)
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("the stat '%s' is not numeric: '%s'", name, raw)
+	}
+	if value <= threshold {
+		return fmt.Errorf("the stat '%s' is %s, not above %s", name, raw, strconv.FormatFloat(threshold, 'f', -1, 64))
+	}
+	return nil
+}
+
+// readMemcachedLine reads a line of the text protocol, failing on the
+// errors of the server.
+func readMemcachedLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	if line == "ERROR" || strings.HasPrefix(line, "CLIENT_ERROR") || strings.HasPrefix(line, "SERVER_ERROR") {
+		return "", errors.New(line)
+	}
+	return line, nil
+}
+
+// readMemcachedStats reads the reply to the stats command.
+func readMemcachedStats(reader *bufio.Reader) (map[string]string, error) {
+	stats := map[string]string{}
+	for {
+		line, err := readMemcachedLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if line == "END" {
+			return stats, nil
+		}
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			return nil, fmt.Errorf("unexpected reply to the stats command: '%s'", line)
+		}
+		stats[fields[1]] = fields[2]
+	}
+}
+
+func (s *MemcachedTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("memcached", func() ProtocolTest {
+		return &MemcachedTest{}
+	})
+}
@@ -0,0 +1,90 @@
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startMemcachedServer starts a stub memcached server, answering the
+// commands with the given replies, and never answering the others.
+func startMemcachedServer(t *testing.T, replies map[string]string) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				for {
+					command, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if reply, ok := replies[strings.TrimSpace(command)]; ok {
+						conn.Write([]byte(reply))
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, func() { listener.Close() }
+}
+
+func TestMemcached(t *testing.T) {
+	port, stop := startMemcachedServer(t, map[string]string{
+		"version": "VERSION 1.6.21\r\n",
+		"stats":   "STAT pid 1\r\nSTAT version 1.6.21\r\nSTAT curr_connections 12\r\nSTAT evictions 0\r\nEND\r\n",
+	})
+	defer stop()
+	broken, stop := startMemcachedServer(t, map[string]string{"version": "ERROR\r\n"})
+	defer stop()
+	silent, stop := startMemcachedServer(t, map[string]string{})
+	defer stop()
+
+	tests := []struct {
+		port    string
+		args    map[string]string
+		timeout time.Duration
+		failure string
+	}{
+		{port, map[string]string{}, 5 * time.Second, ""},
+		{port, map[string]string{"stats": "curr_connections"}, 5 * time.Second, ""},
+		{port, map[string]string{"stats": "curr_connections", "gt": "10"}, 5 * time.Second, ""},
+		{port, map[string]string{"stats": "curr_connections", "gt": "12"}, 5 * time.Second, "the stat 'curr_connections' is 12, not above 12"},
+		{port, map[string]string{"stats": "evictions"}, 5 * time.Second, "the stat 'evictions' is 0, not above 0"},
+		{port, map[string]string{"stats": "version"}, 5 * time.Second, "the stat 'version' is not numeric: '1.6.21'"},
+		{port, map[string]string{"stats": "hits"}, 5 * time.Second, "the server has no stat 'hits'"},
+		{broken, map[string]string{}, 5 * time.Second, "ERROR"},
+		{silent, map[string]string{}, 200 * time.Millisecond, "timeout"},
+	}
+
+	for i, tt := range tests {
+		args := tt.args
+		args["port"] = tt.port
+		tst := test.Test{Target: "127.0.0.1", Type: "memcached", Arguments: args}
+		err := (&MemcachedTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: tt.timeout})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+	}
+}
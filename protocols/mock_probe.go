@@ -0,0 +1,163 @@
+// Mock Tester
+//
+// The mock tester doesn't test anything: it returns the configured result,
+// to exercise the notification, retry and metrics plumbing of overseer
+// deployments themselves, e.g. in end-to-end pipeline tests in CI.
+//
+// As its results are made up, the test only runs on workers started with
+// -allow-mock.
+//
+// This test is invoked via input like so:
+//
+//    anything.example.com must run mock with result fail with message 'disk full'
+//
+// The result is either `pass`, `fail`, or `timeout`, and is returned after
+// `delay`, if given, like a slow target would. A timeout lasts for the
+// delay, or the timeout of the test by default:
+//
+//    anything.example.com must run mock with result timeout with delay 2s
+//
+// Delays longer than the timeout of the test result in a timeout, whatever
+// the configured result.
+//
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// MockTest is our object.
+type MockTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *MockTest) Arguments() map[string]string {
+	known := map[string]string{
+		"result":  "^(pass|fail|timeout)$",
+		"delay":   `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
+		"message": ".+",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *MockTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// ValidateArguments ensures the result to return is given, and that the
+// delay is a duration.
+func (s *MockTest) ValidateArguments(args map[string]string) error {
+	if args["result"] == "" {
+		return errors.New("the result to return must be given with 'result'")
+	}
+	if args["delay"] != "" {
+		if _, err := time.ParseDuration(args["delay"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *MockTest) Example() string {
+	str := `
+Mock Tester
+-----------
+ The mock tester doesn't test anything: it returns the configured result,
+ to exercise the notification, retry and metrics plumbing of overseer
+ deployments themselves, e.g. in end-to-end pipeline tests in CI.
+
+ As its results are made up, the test only runs on workers started with
+ -allow-mock.
+
+ This test is invoked via input like so:
+
+    anything.example.com must run mock with result fail with message 'disk full'
+
+ The result is either 'pass', 'fail', or 'timeout', and is returned after
+ 'delay', if given, like a slow target would. A timeout lasts for the
+ delay, or the timeout of the test by default:
+
+    anything.example.com must run mock with result timeout with delay 2s
+
+ Delays longer than the timeout of the test result in a timeout, whatever
+ the configured result.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we wait for the delay, and return the configured result.
+func (s *MockTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	if !opts.AllowMock {
+		return errors.New("mock tests are not allowed, the worker must be started with -allow-mock")
+	}
+
+	var delay time.Duration
+	if tst.Arguments["delay"] != "" {
+		var err error
+		if delay, err = time.ParseDuration(tst.Arguments["delay"]); err != nil {
+			return err
+		}
+	} else if tst.Arguments["result"] == "timeout" {
+		delay = opts.Timeout
+	}
+
+	// The delay is cut short if the test is cancelled
+	wait := func(d time.Duration) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+
+	if opts.Timeout > 0 && delay > opts.Timeout {
+		wait(opts.Timeout)
+		return fmt.Errorf("mock timeout after %s", opts.Timeout)
+	}
+	if err := wait(delay); err != nil {
+		return fmt.Errorf("mock test cancelled: %s", err.Error())
+	}
+
+	switch tst.Arguments["result"] {
+	case "pass":
+		return nil
+	case "fail":
+		if tst.Arguments["message"] != "" {
+			return errors.New(tst.Arguments["message"])
+		}
+		return errors.New("mock failure")
+	case "timeout":
+		return fmt.Errorf("mock timeout after %s", delay)
+	}
+	return fmt.Errorf("unknown mock result '%s'", tst.Arguments["result"])
+}
+
+func (s *MockTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("mock", func() ProtocolTest {
+		return &MockTest{}
+	})
+}
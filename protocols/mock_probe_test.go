@@ -0,0 +1,77 @@
+package protocols
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestMock(t *testing.T) {
+	run := func(args map[string]string, opts test.Options) (time.Duration, error) {
+		if err := (&MockTest{}).ValidateArguments(args); err != nil {
+			return 0, err
+		}
+		tst := test.Test{Target: "mock.example.com", Type: "mock", Arguments: args}
+		start := time.Now()
+		err := (&MockTest{}).RunTest(context.Background(), tst, "mock.example.com", opts)
+		return time.Since(start), err
+	}
+	opts := test.Options{Timeout: time.Second, AllowMock: true}
+
+	tests := []struct {
+		args    map[string]string
+		failure string
+		min     time.Duration
+		max     time.Duration
+	}{
+		{map[string]string{"result": "pass"}, "", 0, 100 * time.Millisecond},
+		{map[string]string{"result": "pass", "delay": "150ms"}, "", 150 * time.Millisecond, 500 * time.Millisecond},
+		{map[string]string{"result": "fail"}, "mock failure", 0, 100 * time.Millisecond},
+		{map[string]string{"result": "fail", "message": "disk full", "delay": "100ms"}, "disk full", 100 * time.Millisecond, 500 * time.Millisecond},
+		{map[string]string{"result": "timeout", "delay": "200ms"}, "mock timeout after 200ms", 200 * time.Millisecond, 500 * time.Millisecond},
+		// Timeouts last for the timeout of the test by default
+		{map[string]string{"result": "timeout"}, "mock timeout after 1s", time.Second, 1500 * time.Millisecond},
+		// Which also cuts longer delays short
+		{map[string]string{"result": "pass", "delay": "1m"}, "mock timeout after 1s", time.Second, 1500 * time.Millisecond},
+	}
+
+	for i, tt := range tests {
+		elapsed, err := run(tt.args, opts)
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || err.Error() != tt.failure) {
+			t.Errorf("test %d: expected the failure %q, got: %v", i, tt.failure, err)
+		}
+		if elapsed < tt.min || elapsed > tt.max {
+			t.Errorf("test %d: expected to take between %s and %s, took %s", i, tt.min, tt.max, elapsed)
+		}
+	}
+
+	if _, err := run(map[string]string{}, opts); err == nil || !strings.Contains(err.Error(), "'result'") {
+		t.Errorf("expected a missing result to be rejected, got: %v", err)
+	}
+
+	// Mock tests must be allowed
+	if _, err := run(map[string]string{"result": "pass"}, test.Options{Timeout: time.Second}); err == nil || !strings.Contains(err.Error(), "-allow-mock") {
+		t.Errorf("expected the test to be refused, got: %v", err)
+	}
+}
+
+func TestMockCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	tst := test.Test{Target: "mock.example.com", Type: "mock", Arguments: map[string]string{"result": "pass", "delay": "10s"}}
+	err := (&MockTest{}).RunTest(ctx, tst, "mock.example.com", test.Options{Timeout: time.Minute, AllowMock: true})
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("expected the cancelled test to fail, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the cancelled test to be aborted promptly, took %s", elapsed)
+	}
+}
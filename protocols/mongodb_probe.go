@@ -0,0 +1,203 @@
+// MongoDB Tester
+//
+// The MongoDB tester connects to a MongoDB server, and runs the ping
+// command, failing if the server can't be reached, or the login fails.
+//
+// This test is invoked via input like so:
+//
+//    mongo.example.com must run mongodb [with port 27017]
+//
+// Credentials may be given, to authenticate via SCRAM against the admin
+// database, or the one given via `auth-database`:
+//
+//    mongo.example.com must run mongodb with user 'monitor' with password 'secret'
+//
+// To also require a database to exist use:
+//
+//    mongo.example.com must run mongodb with user 'monitor' with password 'secret' with database 'orders'
+//
+// which requires the user to be allowed to list the databases. TLS is used
+// via `with tls true`.
+//
+// The seed hosts of a replica set are resolved, and each of their
+// addresses tested.
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cmaster11/overseer/test"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// MongoDBTest is our object.
+type MongoDBTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *MongoDBTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":          "^[0-9]+$",
+		"user":          ".+",
+		"password":      ".+",
+		"auth-database": `^[^/\\. "$]+$`,
+		"database":      `^[^/\\. "$]+$`,
+		"tls":           "^(true|false)$",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *MongoDBTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments ensures the credentials are given together.
+func (s *MongoDBTest) ValidateArguments(args map[string]string) error {
+	if (args["user"] == "") != (args["password"] == "") {
+		return errors.New("the 'user' and 'password' must be given together")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *MongoDBTest) Example() string {
+	str := `
+MongoDB Tester
+--------------
+ The MongoDB tester connects to a MongoDB server, and runs the ping
+ command, failing if the server can't be reached, or the login fails.
+
+ This test is invoked via input like so:
+
+    mongo.example.com must run mongodb [with port 27017]
+
+ Credentials may be given, to authenticate via SCRAM against the admin
+ database, or the one given via 'auth-database':
+
+    mongo.example.com must run mongodb with user 'monitor' with password 'secret'
+
+ To also require a database to exist use:
+
+    mongo.example.com must run mongodb with user 'monitor' with password 'secret' with database 'orders'
+
+ which requires the user to be allowed to list the databases. TLS is used
+ via 'with tls true'.
+
+ The seed hosts of a replica set are resolved, and each of their
+ addresses tested.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we connect directly to the server, logging in if
+// credentials were given, ping it, and list its databases if one must
+// exist.
+func (s *MongoDBTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	port := 27017
+	if tst.Arguments["port"] != "" {
+		port, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	address := net.JoinHostPort(target, strconv.Itoa(port))
+	clientOptions := options.Client().
+		SetHosts([]string{address}).
+		SetDirect(true).
+		SetDialer(newDialer(opts)).
+		SetConnectTimeout(opts.Timeout).
+		SetServerSelectionTimeout(opts.Timeout).
+		SetTimeout(opts.Timeout).
+		SetMaxPoolSize(1).
+		SetRetryReads(false)
+
+	if tst.Arguments["tls"] == "true" {
+		roots, errCA := rootCAs(tst, opts)
+		if errCA != nil {
+			return errCA
+		}
+		clientOptions.SetTLSConfig(&tls.Config{ServerName: tst.Target, RootCAs: roots})
+	}
+
+	user := tst.Arguments["user"]
+	if user != "" {
+		authDatabase := "admin"
+		if tst.Arguments["auth-database"] != "" {
+			authDatabase = tst.Arguments["auth-database"]
+		}
+		clientOptions.SetAuth(options.Credential{
+			AuthSource: authDatabase,
+			Username:   user,
+			Password:   tst.Arguments["password"],
+		})
+	}
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB at %s: %s", address, err.Error())
+	}
+	defer client.Disconnect(context.Background())
+
+	// The login happens when the connection to ping the server is opened
+	if err = client.Ping(ctx, nil); err != nil {
+		var authErr *auth.Error
+		if errors.As(err, &authErr) {
+			return fmt.Errorf("MongoDB authentication as '%s' failed: %s", user, authErr.Error())
+		}
+		if errors.Is(err, topology.ErrServerSelectionTimeout) {
+			return fmt.Errorf("failed to connect to MongoDB at %s: %s", address, err.Error())
+		}
+		return fmt.Errorf("MongoDB ping failed: %s", err.Error())
+	}
+
+	if opts.Verbose {
+		fmt.Printf("MongoDB at %s answered the ping\n", address)
+	}
+
+	database := tst.Arguments["database"]
+	if database == "" {
+		return nil
+	}
+
+	names, err := client.ListDatabaseNames(ctx, bson.D{{Key: "name", Value: database}}, options.ListDatabases().SetNameOnly(true))
+	if err != nil {
+		return fmt.Errorf("failed to list the MongoDB databases: %s", err.Error())
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("the MongoDB database '%s' does not exist", database)
+	}
+	return nil
+}
+
+func (s *MongoDBTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("mongodb", func() ProtocolTest {
+		return &MongoDBTest{}
+	})
+}
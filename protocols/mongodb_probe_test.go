@@ -0,0 +1,201 @@
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/xdg-go/scram"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The opcodes of the messages exchanged with the driver.
+const (
+	mongoOpReply = 1
+	mongoOpQuery = 2004
+	mongoOpMsg   = 2013
+)
+
+// readMongoCommand reads a command sent by the driver, via OP_QUERY for
+// the handshake, or OP_MSG, returning its request id and opcode.
+func readMongoCommand(conn net.Conn) (bson.Raw, int32, int32, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, 0, 0, err
+	}
+	body := make([]byte, binary.LittleEndian.Uint32(header)-16)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return nil, 0, 0, err
+	}
+	requestID := int32(binary.LittleEndian.Uint32(header[4:]))
+	opCode := int32(binary.LittleEndian.Uint32(header[12:]))
+
+	if opCode == mongoOpQuery {
+		// The flags, the collection name, then the numbers to skip and return
+		body = body[4:]
+		body = body[strings.IndexByte(string(body), 0)+1+8:]
+	} else {
+		// The flags, then the kind of the section holding the command
+		body = body[5:]
+	}
+	return bson.Raw(body[:binary.LittleEndian.Uint32(body)]), requestID, opCode, nil
+}
+
+// writeMongoReply answers a command, with the reply matching its opcode.
+func writeMongoReply(conn net.Conn, requestID int32, opCode int32, reply bson.M) {
+	document, _ := bson.Marshal(reply)
+
+	var body []byte
+	if opCode == mongoOpQuery {
+		// The flags, the cursor, the starting position, and the documents count
+		body = make([]byte, 20)
+		binary.LittleEndian.PutUint32(body[16:], 1)
+		opCode = mongoOpReply
+	} else {
+		body = make([]byte, 5)
+	}
+	body = append(body, document...)
+
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header, uint32(16+len(body)))
+	binary.LittleEndian.PutUint32(header[8:], uint32(requestID))
+	binary.LittleEndian.PutUint32(header[12:], uint32(opCode))
+	conn.Write(append(header, body...))
+}
+
+// startMongoServer starts a stub MongoDB server with the given databases,
+// requiring a login as monitor/secret, via SCRAM-SHA-256, if auth is set.
+func startMongoServer(t *testing.T, auth bool, databases ...string) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	client, _ := scram.SHA256.NewClient("monitor", "secret", "")
+	credentials := client.GetStoredCredentials(scram.KeyFactors{Salt: "overseer-salt", Iters: 4096})
+	server, _ := scram.SHA256.NewServer(func(user string) (scram.StoredCredentials, error) {
+		return credentials, nil
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				authenticated := !auth
+				var conversation *scram.ServerConversation
+				for {
+					command, requestID, opCode, err := readMongoCommand(conn)
+					if err != nil {
+						return
+					}
+					reply := func(fields bson.M) {
+						writeMongoReply(conn, requestID, opCode, fields)
+					}
+
+					switch {
+					case command.Lookup("isMaster").Validate() == nil || command.Lookup("hello").Validate() == nil:
+						hello := bson.M{"ismaster": true, "minWireVersion": 0, "maxWireVersion": 17, "ok": 1}
+						if command.Lookup("saslSupportedMechs").Validate() == nil {
+							hello["saslSupportedMechs"] = bson.A{"SCRAM-SHA-256"}
+						}
+						reply(hello)
+
+					case command.Lookup("saslStart").Validate() == nil:
+						_, payload := command.Lookup("payload").Binary()
+						conversation = server.NewConversation()
+						serverFirst, err := conversation.Step(string(payload))
+						if err != nil {
+							reply(bson.M{"ok": 0, "code": 18, "codeName": "AuthenticationFailed", "errmsg": "Authentication failed."})
+							continue
+						}
+						reply(bson.M{"conversationId": 1, "done": false, "payload": primitive.Binary{Data: []byte(serverFirst)}, "ok": 1})
+
+					case command.Lookup("saslContinue").Validate() == nil:
+						_, payload := command.Lookup("payload").Binary()
+						serverFinal, err := conversation.Step(string(payload))
+						if err != nil || !conversation.Valid() {
+							reply(bson.M{"ok": 0, "code": 18, "codeName": "AuthenticationFailed", "errmsg": "Authentication failed."})
+							continue
+						}
+						authenticated = true
+						reply(bson.M{"conversationId": 1, "done": true, "payload": primitive.Binary{Data: []byte(serverFinal)}, "ok": 1})
+
+					case !authenticated:
+						reply(bson.M{"ok": 0, "code": 13, "codeName": "Unauthorized", "errmsg": "command requires authentication"})
+
+					case command.Lookup("ping").Validate() == nil:
+						reply(bson.M{"ok": 1})
+
+					case command.Lookup("listDatabases").Validate() == nil:
+						name := command.Lookup("filter", "name").StringValue()
+						matching := bson.A{}
+						for _, database := range databases {
+							if database == name {
+								matching = append(matching, bson.M{"name": database})
+							}
+						}
+						reply(bson.M{"databases": matching, "ok": 1})
+
+					default:
+						reply(bson.M{"ok": 0, "code": 59, "errmsg": "no such command"})
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, func() { listener.Close() }
+}
+
+func TestMongoDB(t *testing.T) {
+	open, stop := startMongoServer(t, false, "orders")
+	defer stop()
+	secured, stop := startMongoServer(t, true, "orders")
+	defer stop()
+
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := strconv.Itoa(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	tests := []struct {
+		args    map[string]string
+		timeout time.Duration
+		failure string
+	}{
+		{map[string]string{"port": open}, 5 * time.Second, ""},
+		{map[string]string{"port": open, "database": "orders"}, 5 * time.Second, ""},
+		{map[string]string{"port": open, "database": "invoices"}, 5 * time.Second, "the MongoDB database 'invoices' does not exist"},
+		{map[string]string{"port": secured, "user": "monitor", "password": "secret", "database": "orders"}, 5 * time.Second, ""},
+		{map[string]string{"port": secured, "user": "monitor", "password": "wrong"}, 5 * time.Second, "MongoDB authentication as 'monitor' failed"},
+		{map[string]string{"port": secured}, 5 * time.Second, "MongoDB ping failed: (Unauthorized) command requires authentication"},
+		{map[string]string{"port": closedPort}, time.Second, "failed to connect to MongoDB at 127.0.0.1:" + closedPort},
+	}
+
+	for i, tt := range tests {
+		tst := test.Test{Target: "127.0.0.1", Type: "mongodb", Arguments: tt.args}
+		err := (&MongoDBTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: tt.timeout})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+		if tt.args["password"] != "" && strings.Contains(tst.Sanitize(), tt.args["password"]) {
+			t.Errorf("test %d: the password was not sanitized: %s", i, tst.Sanitize())
+		}
+	}
+}
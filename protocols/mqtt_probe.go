@@ -0,0 +1,436 @@
+// MQTT Tester
+//
+// The MQTT tester connects to an MQTT broker and ensures that this
+// succeeds.  If you supply a username & password a login will be made,
+// and the test will fail if this login fails.
+//
+// This test is invoked via input like so:
+//
+//    broker.example.com must run mqtt [with port 1883] [with username 'steve' with password 'secret']
+//
+// TLS can be used with `with tls on`, on port 8883 by default, or with
+// `with tls insecure` to not verify the certificate.
+//
+// To catch stalled producers, the test can read the retained message of a
+// topic, which must exist, and fail if the timestamp it holds is older
+// than `max-age`:
+//
+//    broker.example.com must run mqtt with topic sensors/boiler/last with max-age 5m
+//
+// By default the whole message is the timestamp. For JSON messages, the
+// field holding the timestamp can be given, with dots to reach nested
+// fields:
+//
+//    with timestamp-field meta.time
+//
+// Timestamps can be RFC 3339 dates, or Unix times in seconds or in
+// milliseconds.
+//
+
+package protocols
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// MQTTTest is our object.
+type MQTTTest struct {
+}
+
+// The MQTT 3.1.1 control packet types used by the test.
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttDisconnect = 14
+)
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *MQTTTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":            "^[0-9]+$",
+		"username":        ".*",
+		"password":        ".*",
+		"tls":             "^(on|insecure)$",
+		"topic":           "^[^#+]+$",
+		"max-age":         `^[0-9]+(\.[0-9]+)?(ms|s|m|h)$`,
+		"timestamp-field": `^[a-zA-Z0-9_\-]+(\.[a-zA-Z0-9_\-]+)*$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *MQTTTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments checks that the message age is only checked when a
+// topic is given.
+func (s *MQTTTest) ValidateArguments(args map[string]string) error {
+	if (args["max-age"] != "" || args["timestamp-field"] != "") && args["topic"] == "" {
+		return errors.New("max-age and timestamp-field require a topic")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *MQTTTest) Example() string {
+	str := `
+MQTT Tester
+-----------
+ The MQTT tester connects to an MQTT broker and ensures that this
+ succeeds.  If you supply a username & password a login will be made,
+ and the test will fail if this login fails.
+
+ This test is invoked via input like so:
+
+    broker.example.com must run mqtt [with port 1883] [with username 'steve' with password 'secret']
+
+ TLS can be used with 'with tls on', on port 8883 by default, or with
+ 'with tls insecure' to not verify the certificate.
+
+ To catch stalled producers, the test can read the retained message of a
+ topic, which must exist, and fail if the timestamp it holds is older
+ than 'max-age':
+
+    broker.example.com must run mqtt with topic sensors/boiler/last with max-age 5m
+
+ By default the whole message is the timestamp. For JSON messages, the
+ field holding the timestamp can be given, with dots to reach nested
+ fields:
+
+    with timestamp-field meta.time
+
+ Timestamps can be RFC 3339 dates, or Unix times in seconds or in
+ milliseconds.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we connect to the broker, and optionally subscribe to the
+// topic, to receive its retained message.
+func (s *MQTTTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	port := 1883
+	if tst.Arguments["tls"] != "" {
+		port = 8883
+	}
+	if tst.Arguments["port"] != "" {
+		if port, err = strconv.Atoi(tst.Arguments["port"]); err != nil {
+			return err
+		}
+	}
+
+	var maxAge time.Duration
+	if tst.Arguments["max-age"] != "" {
+		if maxAge, err = time.ParseDuration(tst.Arguments["max-age"]); err != nil {
+			return err
+		}
+	}
+
+	address := net.JoinHostPort(target, strconv.Itoa(port))
+	dialer := newDialer(opts)
+
+	var conn net.Conn
+	if tst.Arguments["tls"] != "" {
+		roots, errCA := rootCAs(tst, opts)
+		if errCA != nil {
+			return errCA
+		}
+		config := &tls.Config{ServerName: tst.Target, RootCAs: roots}
+		if tst.Arguments["tls"] == "insecure" {
+			config = &tls.Config{InsecureSkipVerify: true}
+		}
+		conn, err = dialer.DialTLSContext(ctx, "tcp", address, config)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The whole exchange must complete within the timeout
+	conn.SetDeadline(deadline(ctx, opts.Timeout))
+	r := bufio.NewReader(conn)
+
+	if err = mqttWritePacket(conn, mqttConnect<<4, mqttConnectPacket(tst.Arguments["username"], tst.Arguments["password"])); err != nil {
+		return err
+	}
+	header, body, err := mqttReadPacket(r)
+	if err != nil {
+		return fmt.Errorf("failed to read the connection acknowledgement: %s", err.Error())
+	}
+	if header>>4 != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("unexpected response to the connection, packet type %d", header>>4)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("connection refused by the broker: %s", mqttConnackError(body[1]))
+	}
+
+	// Be polite, once done
+	defer mqttWritePacket(conn, mqttDisconnect<<4, nil)
+
+	topic := tst.Arguments["topic"]
+	if topic == "" {
+		return nil
+	}
+
+	payload, err := mqttRetainedMessage(conn, r, topic)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Retained message of %s: %s\n", topic, payload)
+	}
+
+	if maxAge == 0 {
+		return nil
+	}
+
+	timestamp, err := messageTimestamp(payload, tst.Arguments["timestamp-field"])
+	if err != nil {
+		return fmt.Errorf("failed to read the timestamp of the retained message of %s: %s", topic, err.Error())
+	}
+
+	age := time.Since(timestamp)
+	if age > maxAge {
+		return fmt.Errorf("the retained message of %s is %s old, more than %s", topic, age.Round(time.Second), maxAge)
+	}
+
+	return nil
+}
+
+// mqttRetainedMessage subscribes to the topic, and returns its retained
+// message.
+func mqttRetainedMessage(conn net.Conn, r *bufio.Reader, topic string) ([]byte, error) {
+	subscribe := &bytes.Buffer{}
+	binary.Write(subscribe, binary.BigEndian, uint16(1))
+	mqttWriteString(subscribe, topic)
+	subscribe.WriteByte(0)
+
+	if err := mqttWritePacket(conn, mqttSubscribe<<4|0x02, subscribe.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for {
+		header, body, err := mqttReadPacket(r)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return nil, fmt.Errorf("no retained message on topic %s", topic)
+			}
+			return nil, err
+		}
+
+		switch header >> 4 {
+		case mqttSuback:
+			if len(body) == 3 && body[2] == 0x80 {
+				return nil, fmt.Errorf("subscription to topic %s refused by the broker", topic)
+			}
+		case mqttPublish:
+			// Only the retained message is of interest, not new ones
+			if header&0x01 == 0 {
+				continue
+			}
+			if len(body) < 2 {
+				return nil, errors.New("malformed message")
+			}
+			topicLength := int(binary.BigEndian.Uint16(body))
+			offset := 2 + topicLength
+			// QoS > 0 messages have a packet identifier
+			if header&0x06 != 0 {
+				offset += 2
+			}
+			if offset > len(body) {
+				return nil, errors.New("malformed message")
+			}
+			return body[offset:], nil
+		}
+	}
+}
+
+// mqttConnectPacket returns the body of a CONNECT packet, with a clean
+// session and the given credentials, if any.
+func mqttConnectPacket(username string, password string) []byte {
+	body := &bytes.Buffer{}
+	mqttWriteString(body, "MQTT")
+	body.WriteByte(4)
+
+	flags := byte(0x02)
+	if username != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	body.WriteByte(flags)
+	binary.Write(body, binary.BigEndian, uint16(60))
+
+	mqttWriteString(body, fmt.Sprintf("overseer-%d", time.Now().UnixNano()%1000000))
+	if username != "" {
+		mqttWriteString(body, username)
+		if password != "" {
+			mqttWriteString(body, password)
+		}
+	}
+	return body.Bytes()
+}
+
+// mqttConnackError describes the return code of a refused connection.
+func mqttConnackError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad username or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
+
+// mqttWriteString writes a length-prefixed UTF-8 string.
+func mqttWriteString(w *bytes.Buffer, value string) {
+	binary.Write(w, binary.BigEndian, uint16(len(value)))
+	w.WriteString(value)
+}
+
+// mqttWritePacket writes a control packet, with the given first byte of
+// its fixed header.
+func mqttWritePacket(w io.Writer, header byte, body []byte) error {
+	packet := []byte{header}
+
+	// The remaining length is encoded 7 bits at a time
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(packet, body...))
+	return err
+}
+
+// mqttReadPacket reads a control packet, returning the first byte of its
+// fixed header, and its body.
+func mqttReadPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for multiplier := 1; ; multiplier *= 128 {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		if multiplier > 128*128*128 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// messageTimestamp returns the timestamp held by a message, either as its
+// whole content, or in the given field of a JSON message.
+func messageTimestamp(payload []byte, field string) (time.Time, error) {
+	var value interface{} = strings.TrimSpace(string(payload))
+
+	if field != "" {
+		var doc interface{}
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return time.Time{}, fmt.Errorf("message is not JSON: %s", err.Error())
+		}
+		for _, key := range strings.Split(field, ".") {
+			object, ok := doc.(map[string]interface{})
+			if !ok {
+				return time.Time{}, fmt.Errorf("no field '%s' in the message", field)
+			}
+			if doc, ok = object[key]; !ok {
+				return time.Time{}, fmt.Errorf("no field '%s' in the message", field)
+			}
+		}
+		value = doc
+	}
+
+	var unix float64
+	switch v := value.(type) {
+	case float64:
+		unix = v
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t, nil
+		}
+		var err error
+		if unix, err = strconv.ParseFloat(v, 64); err != nil {
+			return time.Time{}, fmt.Errorf("'%s' is neither an RFC 3339 date nor a Unix time", v)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("unsupported timestamp %v", value)
+	}
+
+	// Unix times in milliseconds are way past any date in seconds
+	if unix > 1e12 {
+		unix /= 1000
+	}
+	seconds, fraction := math.Modf(unix)
+	return time.Unix(int64(seconds), int64(fraction*1e9)), nil
+}
+
+func (s *MQTTTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("mqtt", func() ProtocolTest {
+		return &MQTTTest{}
+	})
+}
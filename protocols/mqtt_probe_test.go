@@ -0,0 +1,128 @@
+package protocols
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startStubBroker starts a stub MQTT broker, serving the retained messages
+// of the given topics, and only accepting the password "secret".
+func startStubBroker(t *testing.T, retained map[string]string) (int, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		for {
+			header, body, err := mqttReadPacket(r)
+			if err != nil {
+				return
+			}
+
+			switch header >> 4 {
+			case mqttConnect:
+				code := byte(0)
+				if bytes.Contains(body, []byte("steve")) && !bytes.Contains(body, []byte("secret")) {
+					code = 4
+				}
+				mqttWritePacket(conn, mqttConnack<<4, []byte{0, code})
+			case mqttSubscribe:
+				mqttWritePacket(conn, mqttSuback<<4, []byte{body[0], body[1], 0})
+
+				topic := string(body[4 : 4+binary.BigEndian.Uint16(body[2:])])
+				if message, ok := retained[topic]; ok {
+					publish := &bytes.Buffer{}
+					mqttWriteString(publish, topic)
+					publish.WriteString(message)
+					mqttWritePacket(conn, mqttPublish<<4|0x01, publish.Bytes())
+				}
+
+				// New messages are not retained
+				publish := &bytes.Buffer{}
+				mqttWriteString(publish, topic)
+				publish.WriteString("new")
+				mqttWritePacket(conn, mqttPublish<<4, publish.Bytes())
+			case mqttDisconnect:
+				return
+			}
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, func() { listener.Close() }
+}
+
+func TestMQTTMessageAge(t *testing.T) {
+	now := time.Now()
+	port, stop := startStubBroker(t, map[string]string{
+		"fresh/plain":   strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+		"fresh/millis":  strconv.FormatInt(now.Add(-time.Minute).UnixNano()/1e6, 10),
+		"fresh/json":    `{"meta": {"time": "` + now.Add(-time.Minute).Format(time.RFC3339) + `"}}`,
+		"stale/plain":   now.Add(-time.Hour).Format(time.RFC3339),
+		"stale/json":    `{"meta": {"time": ` + strconv.FormatInt(now.Add(-time.Hour).Unix(), 10) + `}}`,
+		"broken/plain":  "yesterday",
+		"broken/nested": `{"meta": "yesterday"}`,
+	})
+	defer stop()
+
+	run := func(args map[string]string, timeout time.Duration) error {
+		args["port"] = strconv.Itoa(port)
+		tst := test.Test{Target: "127.0.0.1", Type: "mqtt", Arguments: args}
+		return (&MQTTTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: timeout})
+	}
+
+	tests := []struct {
+		args    map[string]string
+		failure string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"username": "steve", "password": "secret"}, ""},
+		{map[string]string{"username": "steve", "password": "wrong"}, "bad username or password"},
+		{map[string]string{"topic": "fresh/plain", "max-age": "5m"}, ""},
+		{map[string]string{"topic": "fresh/millis", "max-age": "5m"}, ""},
+		{map[string]string{"topic": "fresh/json", "max-age": "5m", "timestamp-field": "meta.time"}, ""},
+		{map[string]string{"topic": "stale/plain", "max-age": "5m"}, "old, more than 5m0s"},
+		{map[string]string{"topic": "stale/json", "max-age": "5m", "timestamp-field": "meta.time"}, "more than 5m0s"},
+		{map[string]string{"topic": "stale/plain"}, ""},
+		{map[string]string{"topic": "broken/plain", "max-age": "5m"}, "neither an RFC 3339 date nor a Unix time"},
+		{map[string]string{"topic": "broken/nested", "max-age": "5m", "timestamp-field": "meta.time"}, "no field 'meta.time'"},
+	}
+
+	for i, tt := range tests {
+		err := run(tt.args, 5*time.Second)
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+	}
+
+	// A topic without a retained message stalls until the timeout
+	err := run(map[string]string{"topic": "missing", "max-age": "5m"}, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "no retained message on topic missing") {
+		t.Errorf("expected a missing retained message to fail, got: %v", err)
+	}
+}
@@ -12,6 +12,7 @@
 package protocols
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -64,7 +65,7 @@ MySQL Tester
 //
 // In this case we make a TCP connection to the host and attempt to login
 // with the specified username & password.
-func (s *MYSQLTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *MYSQLTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -145,7 +146,7 @@ func (s *MYSQLTest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// And test that the connection actually worked.
 	//
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	return err
 }
 
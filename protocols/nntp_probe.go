@@ -17,9 +17,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -71,7 +71,7 @@ NNTP Tester
 //
 // In this case we make a TCP connection, defaulting to port 119, and
 // look for a response which appears to be an NNTP-server.
-func (s *NNTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *NNTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -92,7 +92,7 @@ func (s *NNTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -109,11 +109,19 @@ func (s *NNTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
+	//
+	// The whole exchange must complete within the timeout.
+	//
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
 	//
 	// Read the banner.
 	//
@@ -0,0 +1,222 @@
+// NTP Tester
+//
+// The NTP tester queries an NTP server, and fails if the offset between
+// the server clock and the local one exceeds a threshold, catching time
+// drift on critical infrastructure.
+//
+// This test is invoked via input like so:
+//
+//    ntp.example.com must run ntp
+//
+// By default the test fails if the offset is larger than 5 seconds, but
+// you can change this via:
+//
+//    pool.ntp.org must run ntp with max-offset 2s
+//
+// The port can be changed too:
+//
+//    ntp.example.com must run ntp with port 1123
+//
+
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// Seconds between the NTP epoch (1900) and the unix one (1970)
+const ntpEpochOffset = 2208988800
+
+// NTPTest is our object.
+type NTPTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *NTPTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":       "^[0-9]+$",
+		"max-offset": `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *NTPTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *NTPTest) Example() string {
+	str := `
+NTP Tester
+----------
+ The NTP tester queries an NTP server, and fails if the offset between
+ the server clock and the local one exceeds a threshold, catching time
+ drift on critical infrastructure.
+
+ This test is invoked via input like so:
+
+    ntp.example.com must run ntp
+
+ By default the test fails if the offset is larger than 5 seconds, but
+ you can change this via:
+
+    pool.ntp.org must run ntp with max-offset 2s
+
+ The port can be changed too:
+
+    ntp.example.com must run ntp with port 1123
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we send a single SNTP client request, and compute the
+// clock offset from the timestamps of the reply.
+func (s *NTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	//
+	// The default port to connect to.
+	//
+	port := 123
+
+	//
+	// If the user specified a different port update to use it.
+	//
+	if tst.Arguments["port"] != "" {
+		port, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	maxOffset := 5 * time.Second
+	if tst.Arguments["max-offset"] != "" {
+		maxOffset, err = time.ParseDuration(tst.Arguments["max-offset"])
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := newDialer(opts).DialContext(ctx, "udp", net.JoinHostPort(target, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	//
+	// A dead server would never reply, so honour the timeout.
+	//
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return err
+	}
+
+	offset, stratum, err := ntpQuery(conn)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("NTP offset %s, stratum %d\n", offset, stratum)
+	}
+
+	if offset < 0 {
+		offset = -offset
+	}
+	if offset > maxOffset {
+		return fmt.Errorf("clock offset %s (stratum %d) exceeds the maximum offset %s", offset, stratum, maxOffset)
+	}
+
+	return nil
+}
+
+// ntpQuery sends a client request over the given connection, returning
+// the clock offset and the stratum of the server.
+func ntpQuery(conn net.Conn) (time.Duration, uint8, error) {
+	request := make([]byte, 48)
+
+	// LI = 0, version = 4, mode = 3 (client)
+	request[0] = 0<<6 | 4<<3 | 3
+
+	t1 := time.Now()
+	binary.BigEndian.PutUint64(request[40:], ntpTimestamp(t1))
+
+	if _, err := conn.Write(request); err != nil {
+		return 0, 0, err
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	if err != nil {
+		return 0, 0, err
+	}
+	t4 := time.Now()
+
+	if n < 48 {
+		return 0, 0, errors.New("NTP response too short")
+	}
+
+	leap := response[0] >> 6
+	mode := response[0] & 0x7
+	stratum := response[1]
+
+	if mode != 4 {
+		return 0, 0, fmt.Errorf("unexpected NTP response mode %d", mode)
+	}
+	if stratum == 0 {
+		return 0, 0, fmt.Errorf("NTP server sent a kiss-of-death: %s", string(response[12:16]))
+	}
+	if leap == 3 {
+		return 0, stratum, errors.New("NTP server clock is not synchronized")
+	}
+	if binary.BigEndian.Uint64(response[24:]) != ntpTimestamp(t1) {
+		return 0, stratum, errors.New("NTP response does not match our request")
+	}
+
+	t2 := ntpTime(binary.BigEndian.Uint64(response[32:]))
+	t3 := ntpTime(binary.BigEndian.Uint64(response[40:]))
+
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+
+	return offset, stratum, nil
+}
+
+// ntpTimestamp converts a time to the NTP 64-bit fixed-point format.
+func ntpTimestamp(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return seconds<<32 | fraction
+}
+
+// ntpTime converts an NTP 64-bit fixed-point timestamp to a time.
+func ntpTime(ts uint64) time.Time {
+	seconds := int64(ts>>32) - ntpEpochOffset
+	nanos := (ts & 0xffffffff) * uint64(time.Second) >> 32
+	return time.Unix(seconds, int64(nanos))
+}
+
+func (s *NTPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("ntp", func() ProtocolTest {
+		return &NTPTest{}
+	})
+}
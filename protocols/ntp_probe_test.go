@@ -0,0 +1,115 @@
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startNTPServer starts a stub NTP responder whose clock is off by the
+// given offset.
+func startNTPServer(t *testing.T, offset time.Duration, stratum uint8) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+
+			now := ntpTimestamp(time.Now().Add(offset))
+
+			response := make([]byte, 48)
+			response[0] = 0<<6 | 4<<3 | 4
+			response[1] = stratum
+			copy(response[24:32], buf[40:48])
+			binary.BigEndian.PutUint64(response[32:], now)
+			binary.BigEndian.PutUint64(response[40:], now)
+
+			conn.WriteToUDP(response, addr)
+		}
+	}()
+
+	return conn
+}
+
+func TestNTP(t *testing.T) {
+	run := func(server *net.UDPConn, args map[string]string) error {
+		args["port"] = strconv.Itoa(server.LocalAddr().(*net.UDPAddr).Port)
+		tst := test.Test{Target: "127.0.0.1", Type: "ntp", Arguments: args}
+		return (&NTPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 2 * time.Second})
+	}
+
+	inSync := startNTPServer(t, 0, 2)
+	defer inSync.Close()
+	if err := run(inSync, map[string]string{}); err != nil {
+		t.Errorf("expected in-sync server to pass: %s", err)
+	}
+
+	// The default maximum offset is 5 seconds
+	drifting := startNTPServer(t, -3*time.Second, 2)
+	defer drifting.Close()
+	if err := run(drifting, map[string]string{}); err != nil {
+		t.Errorf("expected drifting server to pass with the default max-offset: %s", err)
+	}
+	err := run(drifting, map[string]string{"max-offset": "2s"})
+	if err == nil || !strings.Contains(err.Error(), "stratum 2") {
+		t.Errorf("expected drifting server to fail, got: %v", err)
+	}
+
+	bogus := startNTPServer(t, 7*time.Second, 2)
+	defer bogus.Close()
+	if err = run(bogus, map[string]string{}); err == nil || !strings.Contains(err.Error(), "exceeds the maximum offset 5s") {
+		t.Errorf("expected a server off by more than the default max-offset to fail, got: %v", err)
+	}
+
+	kiss := startNTPServer(t, 0, 0)
+	defer kiss.Close()
+	if err = run(kiss, map[string]string{}); err == nil {
+		t.Errorf("expected kiss-of-death to fail")
+	}
+}
+
+func TestNTPTimeout(t *testing.T) {
+	// A server which never replies
+	dead, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer dead.Close()
+
+	args := map[string]string{"port": strconv.Itoa(dead.LocalAddr().(*net.UDPAddr).Port)}
+	tst := test.Test{Target: "127.0.0.1", Type: "ntp", Arguments: args}
+
+	start := time.Now()
+	err = (&NTPTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 200 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected a dead server to time out, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the test to give up after its timeout, took %s", elapsed)
+	}
+}
+
+func TestNTPTimestamp(t *testing.T) {
+	now := time.Now()
+	converted := ntpTime(ntpTimestamp(now))
+
+	if diff := converted.Sub(now); diff > time.Microsecond || diff < -time.Microsecond {
+		t.Errorf("timestamp round-trip lost precision: %s", diff)
+	}
+}
@@ -14,6 +14,7 @@ package protocols
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"net"
 	"os/exec"
@@ -32,9 +33,9 @@ func (s *PINGTest) ShouldResolveHostname() bool {
 }
 
 // RunCommand invokes an external binary and returns stdout/stderr/exit-code
-func (s *PINGTest) RunCommand(name string, args ...string) (stdout string, stderr string, exitCode int) {
+func (s *PINGTest) RunCommand(ctx context.Context, name string, args ...string) (stdout string, stderr string, exitCode int) {
 	var outbuf, errbuf bytes.Buffer
-	cmd := exec.Command(name, args...)
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Stdout = &outbuf
 	cmd.Stderr = &errbuf
 
@@ -63,16 +64,16 @@ func (s *PINGTest) RunCommand(name string, args ...string) (stdout string, stder
 
 // Ping4 runs a ping test against an IPv4 address, returning true
 // if the ping succeeded.
-func (s *PINGTest) Ping4(target string) bool {
+func (s *PINGTest) Ping4(ctx context.Context, target string) bool {
 
-	_, _, ret := s.RunCommand("ping4", "-c", "1", "-w", "4", "-W", "4", target)
+	_, _, ret := s.RunCommand(ctx, "ping4", "-c", "1", "-w", "4", "-W", "4", target)
 	return (ret == 0)
 }
 
 // Ping6 runs a ping test against an IPv6 address, returning true
 // if the ping succeeded.
-func (s *PINGTest) Ping6(target string) bool {
-	_, _, ret := s.RunCommand("ping6", "-c", "1", "-w", "4", "-W", "4", target)
+func (s *PINGTest) Ping6(ctx context.Context, target string) bool {
+	_, _, ret := s.RunCommand(ctx, "ping6", "-c", "1", "-w", "4", "-W", "4", target)
 	return (ret == 0)
 }
 
@@ -107,14 +108,14 @@ Ping Tester
 //
 // In this case we run a ping-command with the appropriate binary depending
 // on the address-family of the target host.
-func (s *PINGTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *PINGTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	ip := net.ParseIP(target)
 
 	//
 	// If the address is an IPv4 address.
 	//
 	if ip.To4() != nil {
-		if s.Ping4(target) {
+		if s.Ping4(ctx, target) {
 			return nil
 		}
 		return errors.New("failed to ping binary")
@@ -124,7 +125,7 @@ func (s *PINGTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	// If the address is an IPv6 address.
 	//
 	if ip.To16() != nil && ip.To4() == nil {
-		if s.Ping6(target) {
+		if s.Ping6(ctx, target) {
 			return nil
 		}
 		return errors.New("failed to ping target")
@@ -12,7 +12,10 @@
 package protocols
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
@@ -64,7 +67,7 @@ POP3 Tester
 // In this case we make a POP3 connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *POP3Test) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *POP3Test) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -97,7 +100,7 @@ func (s *POP3Test) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Connect
 	//
-	c, err := pop3.Dial(address, pop3.UseTimeout(opts.Timeout))
+	c, err := dialPOP3(ctx, address, nil, opts)
 	if err != nil {
 		return err
 	}
@@ -120,6 +123,37 @@ func (s *POP3Test) RunTest(tst test.Test, target string, opts test.Options) erro
 	return nil
 }
 
+// dialPOP3 connects to the POP3 server at the given address, over TLS
+// unless the config is nil, and reads its greeting.
+//
+// The whole exchange must complete before the deadline of the context.
+func dialPOP3(ctx context.Context, address string, tlsConfig *tls.Config, opts test.Options) (*pop3.Client, error) {
+	dialer := newDialer(opts)
+
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = dialer.DialTLSContext(ctx, "tcp", address, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, err := pop3.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
 func (s *POP3Test) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
 	return nil
 }
@@ -15,13 +15,13 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/cmaster11/overseer/test"
-	"github.com/simia-tech/go-pop3"
 )
 
 // POP3STest is our object
@@ -71,7 +71,7 @@ POP3S Tester
 // In this case we make a POP3 connection to the specified host, and if
 // a username + password were specified we then attempt to authenticate
 // to the remote host too.
-func (s *POP3STest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *POP3STest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -116,7 +116,11 @@ func (s *POP3STest) RunTest(tst test.Test, target string, opts test.Options) err
 	// will verify upon, from our input-line.
 	//
 	data := strings.Fields(tst.Input)
-	tlsSetup := &tls.Config{ServerName: data[0]}
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+	tlsSetup := &tls.Config{ServerName: data[0], RootCAs: roots}
 
 	//
 	// If we're being insecure then remove the verification
@@ -130,7 +134,7 @@ func (s *POP3STest) RunTest(tst test.Test, target string, opts test.Options) err
 	//
 	// Connect
 	//
-	c, err := pop3.Dial(address, pop3.UseTLS(tlsSetup), pop3.UseTimeout(opts.Timeout))
+	c, err := dialPOP3(ctx, address, tlsSetup, opts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,309 @@
+// Port-Scan Tester
+//
+// The port-scan tester checks that a host listens on exactly the expected
+// set of TCP ports, failing if any unexpected port is open, or any of the
+// expected ones is closed, to catch accidental exposures.
+//
+// As scanning could be regarded as an attack, the test only runs on
+// workers started with -allow-port-scan.
+//
+// This test is invoked via input like so:
+//
+//    example.com must run port-scan with expected-open 22,80,443
+//
+// By default the ports from 1 to 1024 are scanned, along with the expected
+// ones. Other ports, or ranges, can be scanned with `ports`:
+//
+//    example.com must run port-scan with expected-open 22,443 with ports 1-1024,3306,5432,6379,8000-9000
+//
+// The whole scan must complete within the test timeout. Up to 100 ports
+// are probed at once, which can be changed with `concurrency`, and each
+// probe waits up to 1s for a connection, which can be changed with
+// `port-timeout`.
+//
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// PortScanTest is our object.
+type PortScanTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *PortScanTest) Arguments() map[string]string {
+	known := map[string]string{
+		"expected-open": `^[0-9]+(,[0-9]+)*$`,
+		"ports":         `^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`,
+		"concurrency":   `^[0-9]+$`,
+		"port-timeout":  `^[0-9]+(\.[0-9]+)?(ms|s)$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *PortScanTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments checks the ports and the concurrency of the scan.
+func (s *PortScanTest) ValidateArguments(args map[string]string) error {
+	if args["expected-open"] != "" {
+		if _, err := parsePortRanges(args["expected-open"]); err != nil {
+			return err
+		}
+	}
+	if args["ports"] != "" {
+		if _, err := parsePortRanges(args["ports"]); err != nil {
+			return err
+		}
+	}
+	if args["concurrency"] != "" {
+		if concurrency, err := strconv.Atoi(args["concurrency"]); err != nil || concurrency < 1 {
+			return errors.New("concurrency must be >= 1")
+		}
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *PortScanTest) Example() string {
+	str := `
+Port-Scan Tester
+----------------
+ The port-scan tester checks that a host listens on exactly the expected
+ set of TCP ports, failing if any unexpected port is open, or any of the
+ expected ones is closed, to catch accidental exposures.
+
+ As scanning could be regarded as an attack, the test only runs on
+ workers started with -allow-port-scan.
+
+ This test is invoked via input like so:
+
+    example.com must run port-scan with expected-open 22,80,443
+
+ By default the ports from 1 to 1024 are scanned, along with the expected
+ ones. Other ports, or ranges, can be scanned with 'ports':
+
+    example.com must run port-scan with expected-open 22,443 with ports 1-1024,3306,5432,6379,8000-9000
+
+ The whole scan must complete within the test timeout. Up to 100 ports
+ are probed at once, which can be changed with 'concurrency', and each
+ probe waits up to 1s for a connection, which can be changed with
+ 'port-timeout'.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we try to connect to each of the ports, and compare the
+// open ones with the expected ones.
+func (s *PortScanTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	if !opts.AllowPortScan {
+		return errors.New("port-scan tests are not allowed, the worker must be started with -allow-port-scan")
+	}
+
+	expected := map[int]bool{}
+	if tst.Arguments["expected-open"] != "" {
+		ports, err := parsePortRanges(tst.Arguments["expected-open"])
+		if err != nil {
+			return err
+		}
+		for _, port := range ports {
+			expected[port] = true
+		}
+	}
+
+	spec := "1-1024"
+	if tst.Arguments["ports"] != "" {
+		spec = tst.Arguments["ports"]
+	}
+	scanned, err := parsePortRanges(spec)
+	if err != nil {
+		return err
+	}
+
+	// The expected ports are always scanned
+	seen := map[int]bool{}
+	for _, port := range scanned {
+		seen[port] = true
+	}
+	for port := range expected {
+		if !seen[port] {
+			scanned = append(scanned, port)
+		}
+	}
+
+	concurrency := 100
+	if tst.Arguments["concurrency"] != "" {
+		if concurrency, err = strconv.Atoi(tst.Arguments["concurrency"]); err != nil {
+			return err
+		}
+	}
+
+	portTimeout := time.Second
+	if tst.Arguments["port-timeout"] != "" {
+		if portTimeout, err = time.ParseDuration(tst.Arguments["port-timeout"]); err != nil {
+			return err
+		}
+	}
+
+	open, err := scanPorts(ctx, target, scanned, concurrency, portTimeout, deadline(ctx, opts.Timeout), opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Open ports of %s: %v\n", target, open)
+	}
+
+	var unexpected []string
+	for _, port := range open {
+		if !expected[port] {
+			unexpected = append(unexpected, strconv.Itoa(port))
+		}
+		delete(expected, port)
+	}
+
+	var closed []int
+	for port := range expected {
+		closed = append(closed, port)
+	}
+	sort.Ints(closed)
+
+	var problems []string
+	if len(unexpected) > 0 {
+		problems = append(problems, "unexpected open ports: "+strings.Join(unexpected, ", "))
+	}
+	if len(closed) > 0 {
+		var ports []string
+		for _, port := range closed {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		problems = append(problems, "expected ports not open: "+strings.Join(ports, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// scanPorts returns the sorted TCP ports of the target accepting
+// connections, probing up to concurrency ports at once.
+//
+// The scan fails if it cannot complete before the deadline, as its result
+// would be incomplete.
+func scanPorts(ctx context.Context, target string, ports []int, concurrency int, portTimeout time.Duration, scanDeadline time.Time, opts test.Options) ([]int, error) {
+	jobs := make(chan int)
+	lock := &sync.Mutex{}
+	var open []int
+	incomplete := false
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < concurrency && i < len(ports); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := range jobs {
+				timeout := time.Until(scanDeadline)
+				if timeout <= 0 {
+					lock.Lock()
+					incomplete = true
+					lock.Unlock()
+					continue
+				}
+				if timeout > portTimeout {
+					timeout = portTimeout
+				}
+
+				dialer := newDialer(opts)
+				dialer.Timeout = timeout
+				conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target, strconv.Itoa(port)))
+				if err != nil {
+					continue
+				}
+				conn.Close()
+
+				lock.Lock()
+				open = append(open, port)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, port := range ports {
+		jobs <- port
+	}
+	close(jobs)
+	wg.Wait()
+
+	// The ports the dials didn't reach, once cancelled, are not closed
+	if ctx.Err() == context.Canceled {
+		return nil, ctx.Err()
+	}
+	if incomplete {
+		return nil, fmt.Errorf("the scan of %d ports didn't complete within the timeout", len(ports))
+	}
+
+	sort.Ints(open)
+	return open, nil
+}
+
+// parsePortRanges parses a comma-separated list of ports and ranges, e.g.
+// "22,80,8000-8080", returning the listed ports.
+func parsePortRanges(spec string) ([]int, error) {
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		if first < 1 || last > 65535 || first > last {
+			return nil, fmt.Errorf("invalid port range '%s'", part)
+		}
+		for port := first; port <= last; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+func (s *PortScanTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("port-scan", func() ProtocolTest {
+		return &PortScanTest{}
+	})
+}
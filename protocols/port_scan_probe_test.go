@@ -0,0 +1,91 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestPortScan(t *testing.T) {
+	// Two open ports, and a closed one
+	var ports []string
+	for i := 0; i < 3; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %s", err)
+		}
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		ports = append(ports, port)
+
+		if i == 2 {
+			listener.Close()
+		} else {
+			defer listener.Close()
+		}
+	}
+	open1, open2, closed := ports[0], ports[1], ports[2]
+	scanned := strings.Join(ports, ",")
+
+	run := func(args map[string]string, allowed bool) error {
+		tst := test.Test{Target: "127.0.0.1", Type: "port-scan", Arguments: args}
+		return (&PortScanTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second, AllowPortScan: allowed})
+	}
+
+	if err := run(map[string]string{"expected-open": open1 + "," + open2, "ports": scanned}, true); err != nil {
+		t.Errorf("expected the open ports to match: %s", err)
+	}
+
+	// The expected ports are scanned even if not listed
+	if err := run(map[string]string{"expected-open": open1 + "," + open2, "ports": closed}, true); err != nil {
+		t.Errorf("expected the open ports to match: %s", err)
+	}
+
+	err := run(map[string]string{"expected-open": open1, "ports": scanned, "concurrency": "1"}, true)
+	if err == nil || err.Error() != "unexpected open ports: "+open2 {
+		t.Errorf("expected an unexpected open port to fail, got: %v", err)
+	}
+
+	err = run(map[string]string{"expected-open": open1 + "," + open2 + "," + closed, "ports": scanned}, true)
+	if err == nil || err.Error() != "expected ports not open: "+closed {
+		t.Errorf("expected a closed port to fail, got: %v", err)
+	}
+
+	err = run(map[string]string{"expected-open": closed, "ports": scanned}, true)
+	if err == nil || !strings.Contains(err.Error(), "unexpected open ports") || !strings.Contains(err.Error(), "expected ports not open: "+closed) {
+		t.Errorf("expected both differences to be reported, got: %v", err)
+	}
+
+	err = run(map[string]string{"expected-open": open1, "ports": scanned}, false)
+	if err == nil || !strings.Contains(err.Error(), "-allow-port-scan") {
+		t.Errorf("expected port scans to be disallowed by default, got: %v", err)
+	}
+}
+
+func TestParsePortRanges(t *testing.T) {
+	ports, err := parsePortRanges("22,80,8000-8003")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(ports) != 6 || ports[0] != 22 || ports[5] != 8003 {
+		t.Errorf("unexpected ports: %v", ports)
+	}
+
+	for _, spec := range []string{"0", "65536", "90-80", "1-70000"} {
+		if _, err = parsePortRanges(spec); err == nil {
+			t.Errorf("expected '%s' to be invalid", spec)
+		}
+	}
+
+	s := &PortScanTest{}
+	if err = s.ValidateArguments(map[string]string{"concurrency": "0"}); err == nil {
+		t.Errorf("expected a concurrency of 0 to be invalid")
+	}
+	if err = s.ValidateArguments(map[string]string{"expected-open": strconv.Itoa(22), "ports": "1-1024"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
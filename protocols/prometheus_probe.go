@@ -0,0 +1,300 @@
+// Prometheus Tester
+//
+// The Prometheus tester evaluates an expression via the query API of a
+// Prometheus server, and compares the result with a threshold, letting
+// you layer synthetic alerting on top of existing metrics.
+//
+// This test is invoked via input like so:
+//
+//    http://prometheus.example.com:9090 must run prometheus with query 'up{job="api"}' with eq 1
+//
+// The comparisons `gt`, `lt` and `eq` are supported, and can be combined,
+// e.g. to assert a value is within a range:
+//
+//    http://prometheus.example.com:9090 must run prometheus with query 'time() - last_backup_timestamp' with lt 86400
+//
+// Each returned series must satisfy all the comparisons, and the test fails
+// if the query returns no results. Without comparisons the test only checks
+// that the query returns some results.
+//
+// Basic authentication is supported, and TLS errors can be ignored:
+//
+//    https://prometheus.example.com must run prometheus with query 'up' with eq 1 with username 'bob' with password 'secret' with tls insecure
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// PrometheusTest is our object.
+type PrometheusTest struct {
+}
+
+// prometheusResponse is the subset of the query API response we use.
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	ErrorType string `json:"errorType"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// prometheusSample is a single value returned by a query.
+type prometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *PrometheusTest) Arguments() map[string]string {
+	known := map[string]string{
+		"query":    ".+",
+		"gt":       `^-?[0-9]+(\.[0-9]+)?$`,
+		"lt":       `^-?[0-9]+(\.[0-9]+)?$`,
+		"eq":       `^-?[0-9]+(\.[0-9]+)?$`,
+		"username": ".*",
+		"password": ".*",
+		"tls":      "insecure",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *PrometheusTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *PrometheusTest) Example() string {
+	str := `
+Prometheus Tester
+-----------------
+ The Prometheus tester evaluates an expression via the query API of a
+ Prometheus server, and compares the result with a threshold, letting
+ you layer synthetic alerting on top of existing metrics.
+
+ This test is invoked via input like so:
+
+    http://prometheus.example.com:9090 must run prometheus with query 'up{job="api"}' with eq 1
+
+ The comparisons 'gt', 'lt' and 'eq' are supported, and can be combined,
+ e.g. to assert a value is within a range:
+
+    http://prometheus.example.com:9090 must run prometheus with query 'time() - last_backup_timestamp' with lt 86400
+
+ Each returned series must satisfy all the comparisons, and the test fails
+ if the query returns no results. Without comparisons the test only checks
+ that the query returns some results.
+
+ Basic authentication is supported, and TLS errors can be ignored:
+
+    https://prometheus.example.com must run prometheus with query 'up' with eq 1 with username 'bob' with password 'secret' with tls insecure
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we run an instant query, and compare each returned value
+// with the thresholds.
+func (s *PrometheusTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	query := tst.Arguments["query"]
+	if query == "" {
+		return errors.New("you must specify the query when running a prometheus test")
+	}
+
+	endpoint, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return fmt.Errorf("the prometheus server must be an http or https URL, got '%s'", target)
+	}
+
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/api/v1/query"
+	endpoint.RawQuery = url.Values{
+		"query":   []string{query},
+		"timeout": []string{opts.Timeout.String()},
+	}.Encode()
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:            roots,
+				InsecureSkipVerify: tst.Arguments["tls"] == "insecure",
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+
+	if tst.Arguments["username"] != "" {
+		req.SetBasicAuth(tst.Arguments["username"], tst.Arguments["password"])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	//
+	// Errors in the query are reported with a 400/422 status, along with
+	// a JSON body describing them.
+	//
+	var response prometheusResponse
+	if err = json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("status code was %d, and the response could not be decoded: %s", resp.StatusCode, err)
+	}
+	if response.Status != "success" {
+		return fmt.Errorf("query failed (%s): %s", response.ErrorType, response.Error)
+	}
+
+	samples, err := prometheusSamples(response.Data.ResultType, response.Data.Result)
+	if err != nil {
+		return err
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Prometheus query returned %d samples\n", len(samples))
+	}
+
+	if len(samples) == 0 {
+		return fmt.Errorf("query '%s' returned no results", query)
+	}
+
+	//
+	// Every series must satisfy every comparison.
+	//
+	for _, sample := range samples {
+		value, errValue := sample.value()
+		if errValue != nil {
+			return errValue
+		}
+
+		for _, op := range []string{"gt", "lt", "eq"} {
+			if tst.Arguments[op] == "" {
+				continue
+			}
+
+			threshold, errParse := strconv.ParseFloat(tst.Arguments[op], 64)
+			if errParse != nil {
+				return errParse
+			}
+
+			if !prometheusCompare(op, value, threshold) {
+				return fmt.Errorf("query '%s' returned %s for %s, expected %s %s", query, strconv.FormatFloat(value, 'f', -1, 64), sample.labels(), op, tst.Arguments[op])
+			}
+		}
+	}
+
+	return nil
+}
+
+// prometheusSamples decodes the result of a query, which is either an
+// instant vector, or a scalar.
+func prometheusSamples(resultType string, result json.RawMessage) ([]prometheusSample, error) {
+	switch resultType {
+	case "vector":
+		var samples []prometheusSample
+		if err := json.Unmarshal(result, &samples); err != nil {
+			return nil, err
+		}
+		return samples, nil
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(result, &value); err != nil {
+			return nil, err
+		}
+		return []prometheusSample{{Value: value}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported result type '%s', the query must return a vector or a scalar", resultType)
+}
+
+// value returns the numeric value of the sample, sent as [time, "value"].
+func (sample prometheusSample) value() (float64, error) {
+	if len(sample.Value) != 2 {
+		return 0, errors.New("malformed sample in the query result")
+	}
+
+	str, ok := sample.Value[1].(string)
+	if !ok {
+		return 0, errors.New("malformed sample value in the query result")
+	}
+
+	return strconv.ParseFloat(str, 64)
+}
+
+// labels describes the series of the sample, e.g. `up{job="api"}`.
+func (sample prometheusSample) labels() string {
+	var keys []string
+	for k := range sample.Metric {
+		if k != "__name__" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, sample.Metric[k]))
+	}
+
+	return sample.Metric["__name__"] + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// prometheusCompare returns true if the value satisfies the comparison.
+func prometheusCompare(op string, value float64, threshold float64) bool {
+	switch op {
+	case "gt":
+		return value > threshold
+	case "lt":
+		return value < threshold
+	case "eq":
+		return value == threshold
+	}
+	return false
+}
+
+func (s *PrometheusTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("prometheus", func() ProtocolTest {
+		return &PrometheusTest{}
+	})
+}
@@ -0,0 +1,91 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startPrometheusServer starts a stub query API, answering each query
+// with the given result.
+func startPrometheusServer(t *testing.T, results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if user, pass, ok := r.BasicAuth(); ok && (user != "bob" || pass != "secret") {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"status":"error","errorType":"unauthorized","error":"bad credentials"}`)
+			return
+		}
+
+		result, ok := results[r.URL.Query().Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error"}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, result)
+	}))
+}
+
+func TestPrometheus(t *testing.T) {
+	server := startPrometheusServer(t, map[string]string{
+		`up{job="api"}`: `{"resultType":"vector","result":[
+			{"metric":{"__name__":"up","job":"api","instance":"a:80"},"value":[1600000000,"1"]},
+			{"metric":{"__name__":"up","job":"api","instance":"b:80"},"value":[1600000000,"0"]}
+		]}`,
+		`up{job="db"}`: `{"resultType":"vector","result":[{"metric":{"__name__":"up","job":"db"},"value":[1600000000,"1"]}]}`,
+		`absent`:       `{"resultType":"vector","result":[]}`,
+		`scalar(42)`:   `{"resultType":"scalar","result":[1600000000,"42"]}`,
+	})
+	defer server.Close()
+
+	run := func(args map[string]string) error {
+		tst := test.Test{Target: server.URL, Type: "prometheus", Arguments: args}
+		return (&PrometheusTest{}).RunTest(context.Background(), tst, server.URL, test.Options{Timeout: 5 * time.Second})
+	}
+
+	if err := run(map[string]string{"query": `up{job="db"}`, "eq": "1"}); err != nil {
+		t.Errorf("expected matching query to pass: %s", err)
+	}
+
+	err := run(map[string]string{"query": `up{job="api"}`, "eq": "1"})
+	if err == nil || !strings.Contains(err.Error(), `up{instance="b:80",job="api"}`) {
+		t.Errorf("expected the failing series to be reported, got: %v", err)
+	}
+
+	if err = run(map[string]string{"query": "scalar(42)", "gt": "40", "lt": "50"}); err != nil {
+		t.Errorf("expected scalar within range to pass: %s", err)
+	}
+	if err = run(map[string]string{"query": "scalar(42)", "lt": "10"}); err == nil {
+		t.Errorf("expected scalar above threshold to fail")
+	}
+
+	err = run(map[string]string{"query": "absent"})
+	if err == nil || !strings.Contains(err.Error(), "no results") {
+		t.Errorf("expected empty results to fail, got: %v", err)
+	}
+
+	err = run(map[string]string{"query": "invalid("})
+	if err == nil || !strings.Contains(err.Error(), "parse error") {
+		t.Errorf("expected query errors to be reported, got: %v", err)
+	}
+
+	if err = run(map[string]string{"query": `up{job="db"}`, "username": "bob", "password": "secret"}); err != nil {
+		t.Errorf("expected valid credentials to pass: %s", err)
+	}
+	err = run(map[string]string{"query": `up{job="db"}`, "username": "bob", "password": "wrong"})
+	if err == nil || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("expected invalid credentials to fail without leaking them, got: %v", err)
+	}
+}
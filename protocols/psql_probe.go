@@ -17,6 +17,7 @@
 package protocols
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -73,7 +74,7 @@ PSQL Tester
 //
 // In this case we make a TCP connection to the database host and attempt
 // to login with the specified username & password.
-func (s *PSQLTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *PSQLTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -126,7 +127,7 @@ func (s *PSQLTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// And test that the connection actually worked.
 	//
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	return err
 }
 
@@ -0,0 +1,207 @@
+// PTR Tester
+//
+// The PTR tester checks the reverse DNS records of an address, which mail
+// servers commonly require to match the name of the sending host.
+//
+// This test is invoked via input like so:
+//
+//    192.0.2.25 must run ptr with expect mail.example.com
+//
+// If the target is a hostname, each of its addresses is checked, and by
+// default the PTR records must point back to the hostname itself:
+//
+//    mail.example.com must run ptr
+//
+// Instead of a single name, the PTR records can be matched against a
+// regular expression:
+//
+//    192.0.2.25 must run ptr with pattern '^mx[0-9]+\.example\.com$'
+//
+// The system resolver is used unless a specific one is given:
+//
+//    192.0.2.25 must run ptr with expect mail.example.com with resolver 9.9.9.9
+//
+
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/miekg/dns"
+)
+
+// PTRTest is our object.
+type PTRTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *PTRTest) Arguments() map[string]string {
+	known := map[string]string{
+		"expect":   `^[a-zA-Z0-9.\-]+$`,
+		"pattern":  ".+",
+		"resolver": `^[a-zA-Z0-9.:\[\]\-]+$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *PTRTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// ValidateArguments checks that the pattern is a valid regular expression.
+func (s *PTRTest) ValidateArguments(args map[string]string) error {
+	if args["pattern"] != "" {
+		if _, err := regexp.Compile(args["pattern"]); err != nil {
+			return fmt.Errorf("invalid pattern: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *PTRTest) Example() string {
+	str := `
+PTR Tester
+----------
+ The PTR tester checks the reverse DNS records of an address, which mail
+ servers commonly require to match the name of the sending host.
+
+ This test is invoked via input like so:
+
+    192.0.2.25 must run ptr with expect mail.example.com
+
+ If the target is a hostname, each of its addresses is checked, and by
+ default the PTR records must point back to the hostname itself:
+
+    mail.example.com must run ptr
+
+ Instead of a single name, the PTR records can be matched against a
+ regular expression:
+
+    192.0.2.25 must run ptr with pattern '^mx[0-9]+\.example\.com$'
+
+ The system resolver is used unless a specific one is given:
+
+    192.0.2.25 must run ptr with expect mail.example.com with resolver 9.9.9.9
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we lookup the PTR records of the address, and compare them
+// with the expected name.
+func (s *PTRTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	expect := tst.Arguments["expect"]
+	if expect == "" && tst.Arguments["pattern"] == "" && net.ParseIP(tst.Target) == nil {
+		expect = tst.Target
+	}
+
+	var names []string
+	var err error
+	if tst.Arguments["resolver"] != "" {
+		resolver := tst.Arguments["resolver"]
+		if _, _, errPort := net.SplitHostPort(resolver); errPort != nil {
+			resolver = net.JoinHostPort(resolver, "53")
+		}
+		names, err = s.lookupVia(ctx, target, resolver, opts)
+	} else {
+		ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+		names, err = net.DefaultResolver.LookupAddr(ctx, target)
+	}
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return fmt.Errorf("no PTR record for %s", target)
+		}
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no PTR record for %s", target)
+	}
+
+	for i := range names {
+		names[i] = strings.ToLower(strings.TrimSuffix(names[i], "."))
+	}
+
+	if opts.Verbose {
+		fmt.Printf("PTR records of %s: %s\n", target, strings.Join(names, ", "))
+	}
+
+	if expect != "" {
+		expect = strings.ToLower(strings.TrimSuffix(expect, "."))
+		for _, name := range names {
+			if name == expect {
+				return nil
+			}
+		}
+		return fmt.Errorf("PTR records of %s were %s, not %s", target, strings.Join(names, ", "), expect)
+	}
+
+	if tst.Arguments["pattern"] != "" {
+		re, errRe := regexp.Compile(tst.Arguments["pattern"])
+		if errRe != nil {
+			return errRe
+		}
+		for _, name := range names {
+			if re.MatchString(name) {
+				return nil
+			}
+		}
+		return fmt.Errorf("PTR records of %s were %s, none matching '%s'", target, strings.Join(names, ", "), tst.Arguments["pattern"])
+	}
+
+	return nil
+}
+
+// lookupVia returns the PTR records of the address, as answered by the
+// given resolver.
+func (s *PTRTest) lookupVia(ctx context.Context, address string, resolver string, opts test.Options) ([]string, error) {
+	reverse, err := dns.ReverseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(reverse, dns.TypePTR)
+
+	client := &dns.Client{Timeout: opts.Timeout}
+	response, _, err := client.ExchangeContext(ctx, msg, resolver)
+	if err != nil {
+		return nil, err
+	}
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("PTR query for %s failed with %s", address, dns.RcodeToString[response.Rcode])
+	}
+
+	var names []string
+	for _, rr := range response.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			names = append(names, ptr.Ptr)
+		}
+	}
+	return names, nil
+}
+
+func (s *PTRTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("ptr", func() ProtocolTest {
+		return &PTRTest{}
+	})
+}
@@ -0,0 +1,104 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/miekg/dns"
+)
+
+// startPTRResolver starts a stub DNS resolver answering PTR queries from
+// the given records, keyed by address.
+func startPTRResolver(t *testing.T, records map[string][]string) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	reverse := map[string][]string{}
+	for address, names := range records {
+		name, _ := dns.ReverseAddr(address)
+		reverse[name] = names
+	}
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			names, ok := reverse[r.Question[0].Name]
+			if !ok {
+				m.Rcode = dns.RcodeNameError
+			}
+			for _, name := range names {
+				rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN PTR " + name)
+				m.Answer = append(m.Answer, rr)
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+
+	return conn.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func TestPTR(t *testing.T) {
+	resolver, stop := startPTRResolver(t, map[string][]string{
+		"192.0.2.25":   {"mail.example.com."},
+		"192.0.2.26":   {"mx2.example.com.", "Backup.Example.com."},
+		"2001:db8::25": {"mail.example.com."},
+	})
+	defer stop()
+
+	run := func(target string, address string, args map[string]string) error {
+		args["resolver"] = resolver
+		tst := test.Test{Target: target, Type: "ptr", Arguments: args}
+		return (&PTRTest{}).RunTest(context.Background(), tst, address, test.Options{Timeout: 5 * time.Second})
+	}
+
+	for _, c := range []struct {
+		target, address string
+		args            map[string]string
+	}{
+		{"192.0.2.25", "192.0.2.25", map[string]string{"expect": "mail.example.com"}},
+		{"192.0.2.26", "192.0.2.26", map[string]string{"expect": "backup.example.com."}},
+		{"192.0.2.26", "192.0.2.26", map[string]string{"pattern": `^mx[0-9]+\.example\.com$`}},
+		{"2001:db8::25", "2001:db8::25", map[string]string{"expect": "mail.example.com"}},
+		// A hostname must be pointed back to by default
+		{"mail.example.com", "192.0.2.25", map[string]string{}},
+		// An address only needs a PTR record by default
+		{"192.0.2.26", "192.0.2.26", map[string]string{}},
+	} {
+		if err := run(c.target, c.address, c.args); err != nil {
+			t.Errorf("expected %s (%s) with %v to pass: %s", c.target, c.address, c.args, err)
+		}
+	}
+
+	err := run("192.0.2.25", "192.0.2.25", map[string]string{"expect": "smtp.example.com"})
+	if err == nil || !strings.Contains(err.Error(), "were mail.example.com, not smtp.example.com") {
+		t.Errorf("expected a mismatch to fail, got: %v", err)
+	}
+
+	err = run("smtp.example.com", "192.0.2.26", map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "not smtp.example.com") {
+		t.Errorf("expected a hostname not pointed back to to fail, got: %v", err)
+	}
+
+	err = run("192.0.2.25", "192.0.2.25", map[string]string{"pattern": `^mx[0-9]+\.`})
+	if err == nil || !strings.Contains(err.Error(), "none matching") {
+		t.Errorf("expected a pattern mismatch to fail, got: %v", err)
+	}
+
+	err = run("192.0.2.99", "192.0.2.99", map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "no PTR record for 192.0.2.99") {
+		t.Errorf("expected a missing PTR record to fail, got: %v", err)
+	}
+
+	if err = (&PTRTest{}).ValidateArguments(map[string]string{"pattern": "("}); err == nil {
+		t.Errorf("expected an invalid pattern to fail validation")
+	}
+}
@@ -0,0 +1,294 @@
+// RabbitMQ Tester
+//
+// The RabbitMQ tester fetches the state of a queue via the management API
+// of a RabbitMQ server, and compares its depth and its consumers with
+// thresholds, to catch backlogs building up, or consumers going away.
+//
+// This test is invoked via input like so:
+//
+//    http://rabbit.example.com:15672 must run rabbitmq with queue orders with max-messages 1000 with min-consumers 1
+//
+// The thresholds `max-messages`, `max-unacknowledged` and `min-consumers`
+// are supported, and can be combined. The queue belongs to the default
+// virtual host "/", unless another one is given via `with vhost`. Without
+// thresholds the test only checks that the queue exists.
+//
+// The health of a node of the cluster can be checked too, or instead: the
+// node must be running, without memory nor disk alarms:
+//
+//    http://rabbit.example.com:15672 must run rabbitmq with node rabbit@rabbit-1
+//
+// Basic authentication is supported, and TLS errors can be ignored:
+//
+//    https://rabbit.example.com must run rabbitmq with queue orders with username 'monitor' with password 'secret' with tls insecure
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// rabbitmqQueue is the subset of the state of a queue we use.
+type rabbitmqQueue struct {
+	Messages               int64 `json:"messages"`
+	MessagesUnacknowledged int64 `json:"messages_unacknowledged"`
+	Consumers              int64 `json:"consumers"`
+}
+
+// rabbitmqNode is the subset of the state of a node we use.
+type rabbitmqNode struct {
+	Running       bool `json:"running"`
+	MemAlarm      bool `json:"mem_alarm"`
+	DiskFreeAlarm bool `json:"disk_free_alarm"`
+}
+
+// RabbitMQTest is our object.
+type RabbitMQTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *RabbitMQTest) Arguments() map[string]string {
+	known := map[string]string{
+		"queue":              ".+",
+		"vhost":              ".+",
+		"max-messages":       "^[0-9]+$",
+		"max-unacknowledged": "^[0-9]+$",
+		"min-consumers":      "^[0-9]+$",
+		"node":               ".+",
+		"username":           ".*",
+		"password":           ".*",
+		"tls":                "insecure",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *RabbitMQTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// ValidateArguments ensures there is something to check, and that the
+// thresholds apply to a queue.
+func (s *RabbitMQTest) ValidateArguments(args map[string]string) error {
+	if args["queue"] == "" && args["node"] == "" {
+		return errors.New("a queue, or a node, must be given with 'queue' or 'node'")
+	}
+	if args["queue"] == "" {
+		for _, threshold := range []string{"max-messages", "max-unacknowledged", "min-consumers"} {
+			if args[threshold] != "" {
+				return fmt.Errorf("%s requires a queue", threshold)
+			}
+		}
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *RabbitMQTest) Example() string {
+	str := `
+RabbitMQ Tester
+---------------
+ The RabbitMQ tester fetches the state of a queue via the management API
+ of a RabbitMQ server, and compares its depth and its consumers with
+ thresholds, to catch backlogs building up, or consumers going away.
+
+ This test is invoked via input like so:
+
+    http://rabbit.example.com:15672 must run rabbitmq with queue orders with max-messages 1000 with min-consumers 1
+
+ The thresholds 'max-messages', 'max-unacknowledged' and 'min-consumers'
+ are supported, and can be combined. The queue belongs to the default
+ virtual host "/", unless another one is given via 'with vhost'. Without
+ thresholds the test only checks that the queue exists.
+
+ The health of a node of the cluster can be checked too, or instead: the
+ node must be running, without memory nor disk alarms:
+
+    http://rabbit.example.com:15672 must run rabbitmq with node rabbit@rabbit-1
+
+ Basic authentication is supported, and TLS errors can be ignored:
+
+    https://rabbit.example.com must run rabbitmq with queue orders with username 'monitor' with password 'secret' with tls insecure
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+func (s *RabbitMQTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestDetailed(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestDetailed behaves like RunTest, but also returns the depth and the
+// consumers of the queue.
+//
+// In this case we fetch the state of the queue, and/or of the node, and
+// compare it with the thresholds.
+func (s *RabbitMQTest) RunTestDetailed(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]interface{}, error) {
+	if err := s.ValidateArguments(tst.Arguments); err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("the management API must be an http or https URL, got '%s'", target)
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:            roots,
+				InsecureSkipVerify: tst.Arguments["tls"] == "insecure",
+			},
+		},
+	}
+
+	// The timeout covers all the requests
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	details := map[string]interface{}{}
+
+	if queue := tst.Arguments["queue"]; queue != "" {
+		vhost := tst.Arguments["vhost"]
+		if vhost == "" {
+			vhost = "/"
+		}
+
+		var state rabbitmqQueue
+		path := "/api/queues/" + url.PathEscape(vhost) + "/" + url.PathEscape(queue)
+		if err = s.get(ctx, client, tst, base, path, &state); err != nil {
+			return nil, fmt.Errorf("failed to fetch the queue '%s' of the vhost '%s': %s", queue, vhost, err.Error())
+		}
+		details["messages"] = state.Messages
+		details["messagesUnacknowledged"] = state.MessagesUnacknowledged
+		details["consumers"] = state.Consumers
+
+		if opts.Verbose {
+			fmt.Printf("RabbitMQ queue %s: %d messages, %d unacknowledged, %d consumers\n", queue, state.Messages, state.MessagesUnacknowledged, state.Consumers)
+		}
+
+		if err = s.checkThreshold(tst, "max-messages", "messages", state.Messages); err != nil {
+			return details, err
+		}
+		if err = s.checkThreshold(tst, "max-unacknowledged", "unacknowledged messages", state.MessagesUnacknowledged); err != nil {
+			return details, err
+		}
+		if err = s.checkThreshold(tst, "min-consumers", "consumers", state.Consumers); err != nil {
+			return details, err
+		}
+	}
+
+	if node := tst.Arguments["node"]; node != "" {
+		var state rabbitmqNode
+		if err = s.get(ctx, client, tst, base, "/api/nodes/"+url.PathEscape(node), &state); err != nil {
+			return details, fmt.Errorf("failed to fetch the node '%s': %s", node, err.Error())
+		}
+
+		var problems []string
+		if !state.Running {
+			problems = append(problems, "not running")
+		}
+		if state.MemAlarm {
+			problems = append(problems, "memory alarm")
+		}
+		if state.DiskFreeAlarm {
+			problems = append(problems, "disk alarm")
+		}
+		if len(problems) > 0 {
+			return details, fmt.Errorf("the node '%s' is unhealthy: %s", node, strings.Join(problems, ", "))
+		}
+	}
+
+	return details, nil
+}
+
+// get fetches the given path of the management API, decoding the JSON
+// response into the value.
+func (s *RabbitMQTest) get(ctx context.Context, client *http.Client, tst test.Test, base *url.URL, path string, value interface{}) error {
+	endpoint, err := url.Parse(strings.TrimSuffix(base.String(), "/") + path)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+	if tst.Arguments["username"] != "" {
+		req.SetBasicAuth(tst.Arguments["username"], tst.Arguments["password"])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errors.New("not found")
+	case http.StatusUnauthorized:
+		return errors.New("authentication failed")
+	default:
+		return fmt.Errorf("status code was %d not 200", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(value)
+}
+
+// checkThreshold compares a value of the queue with its threshold, if
+// given.
+func (s *RabbitMQTest) checkThreshold(tst test.Test, name string, description string, value int64) error {
+	if tst.Arguments[name] == "" {
+		return nil
+	}
+	threshold, err := strconv.ParseInt(tst.Arguments[name], 10, 64)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(name, "max-") && value > threshold {
+		return fmt.Errorf("the queue '%s' has %d %s, more than %d", tst.Arguments["queue"], value, description, threshold)
+	}
+	if strings.HasPrefix(name, "min-") && value < threshold {
+		return fmt.Errorf("the queue '%s' has %d %s, fewer than %d", tst.Arguments["queue"], value, description, threshold)
+	}
+	return nil
+}
+
+func (s *RabbitMQTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("rabbitmq", func() ProtocolTest {
+		return &RabbitMQTest{}
+	})
+}
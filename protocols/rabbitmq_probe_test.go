@@ -0,0 +1,100 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startRabbitMQServer starts a stub management API, knowing the queue
+// "orders" of the default vhost, the queue "events" of the vhost "prod",
+// and two nodes.
+func startRabbitMQServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "monitor" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.EscapedPath() {
+		case "/api/queues/%2F/orders":
+			fmt.Fprint(w, `{"name":"orders","messages":1500,"messages_unacknowledged":20,"consumers":2}`)
+		case "/api/queues/prod/events":
+			fmt.Fprint(w, `{"name":"events","messages":0,"messages_unacknowledged":0,"consumers":0}`)
+		case "/api/nodes/rabbit@rabbit-1":
+			fmt.Fprint(w, `{"name":"rabbit@rabbit-1","running":true,"mem_alarm":false,"disk_free_alarm":false}`)
+		case "/api/nodes/rabbit@rabbit-2":
+			fmt.Fprint(w, `{"name":"rabbit@rabbit-2","running":true,"mem_alarm":true,"disk_free_alarm":true}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"Object Not Found","reason":"Not Found"}`)
+		}
+	}))
+}
+
+func TestRabbitMQ(t *testing.T) {
+	server := startRabbitMQServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		args    map[string]string
+		failure string
+	}{
+		{map[string]string{"queue": "orders"}, ""},
+		{map[string]string{"queue": "orders", "max-messages": "2000", "max-unacknowledged": "20", "min-consumers": "2"}, ""},
+		{map[string]string{"queue": "orders", "max-messages": "1000"}, "the queue 'orders' has 1500 messages, more than 1000"},
+		{map[string]string{"queue": "orders", "max-unacknowledged": "10"}, "has 20 unacknowledged messages, more than 10"},
+		{map[string]string{"queue": "orders", "min-consumers": "3"}, "has 2 consumers, fewer than 3"},
+		{map[string]string{"queue": "events", "vhost": "prod", "min-consumers": "1"}, "has 0 consumers, fewer than 1"},
+		{map[string]string{"queue": "events"}, "failed to fetch the queue 'events' of the vhost '/': not found"},
+		{map[string]string{"node": "rabbit@rabbit-1"}, ""},
+		{map[string]string{"queue": "orders", "node": "rabbit@rabbit-2"}, "the node 'rabbit@rabbit-2' is unhealthy: memory alarm, disk alarm"},
+		{map[string]string{"node": "rabbit@rabbit-1", "min-consumers": "1"}, "min-consumers requires a queue"},
+	}
+
+	for i, tt := range tests {
+		tt.args["username"] = "monitor"
+		tt.args["password"] = "secret"
+		tst := test.Test{Target: server.URL, Type: "rabbitmq", Arguments: tt.args}
+		err := (&RabbitMQTest{}).RunTest(context.Background(), tst, server.URL, test.Options{Timeout: 5 * time.Second})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+	}
+
+	// The password is never part of the input of the results
+	tst := test.Test{Target: server.URL, Type: "rabbitmq", Arguments: map[string]string{"queue": "orders", "username": "monitor", "password": "wrong"}}
+	if input := tst.Sanitize(); strings.Contains(input, "wrong") {
+		t.Errorf("expected the password to be censored, got: %s", input)
+	}
+	err := (&RabbitMQTest{}).RunTest(context.Background(), tst, server.URL, test.Options{Timeout: 5 * time.Second})
+	if err == nil || !strings.Contains(err.Error(), "authentication failed") || strings.Contains(err.Error(), "wrong") {
+		t.Errorf("expected the authentication to fail, got: %v", err)
+	}
+}
+
+func TestRabbitMQDetailed(t *testing.T) {
+	server := startRabbitMQServer(t)
+	defer server.Close()
+
+	args := map[string]string{"queue": "orders", "max-messages": "1000", "username": "monitor", "password": "secret"}
+	tst := test.Test{Target: server.URL, Type: "rabbitmq", Arguments: args}
+	details, err := (&RabbitMQTest{}).RunTestDetailed(context.Background(), tst, server.URL, test.Options{Timeout: 5 * time.Second})
+	if err == nil {
+		t.Errorf("expected the backlog to fail the test")
+	}
+
+	// The state of the queue is described even when the test fails
+	if details["messages"] != int64(1500) || details["messagesUnacknowledged"] != int64(20) || details["consumers"] != int64(2) {
+		t.Errorf("unexpected details: %v", details)
+	}
+}
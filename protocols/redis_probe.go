@@ -11,7 +11,9 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
 
@@ -59,7 +61,7 @@ Redis Tester
 //
 // In this case we make a Redis-test against the given target.
 //
-func (s *REDISTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *REDISTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 
 	//
 	// Predeclare our error
@@ -110,7 +112,16 @@ func (s *REDISTest) RunTest(tst test.Test, target string, opts test.Options) err
 		Addr:     address,
 		Password: password,
 		DB:       0, // use default DB
+		Dialer: func() (net.Conn, error) {
+			conn, err := newDialer(opts).DialContext(ctx, "tcp", address)
+			if err != nil {
+				return nil, err
+			}
+			conn.SetDeadline(deadline(ctx, opts.Timeout))
+			return conn, nil
+		},
 	})
+	defer client.Close()
 
 	//
 	// And run a ping
@@ -0,0 +1,314 @@
+// S3 Tester
+//
+// The S3 tester allows you to confirm that an S3-compatible object storage
+// (AWS S3, MinIO, Ceph, etc.) is reachable, and that a bucket can be listed.
+//
+// This test is invoked via input like so:
+//
+//    https://s3.eu-west-1.amazonaws.com must run s3 with bucket 'my-bucket'
+//
+// Instead of listing the bucket you can check that a specific object exists,
+// optionally asserting its size in bytes:
+//
+//    https://minio.example.com must run s3 with bucket 'backups' with object 'latest.tar.gz' with size 1024
+//
+// Requests are signed (AWS Signature Version 4) when credentials are given:
+//
+//    https://minio.example.com must run s3 with bucket 'backups' with access-key 'AKIA..' with secret-key 'secret'
+//
+// The signing region defaults to `us-east-1`, and can be changed with `region`.
+//
+// By default virtual-hosted style requests are made (`https://bucket.host/`),
+// to use path-style requests (`https://host/bucket/`), needed by most
+// self-hosted implementations, use:
+//
+//    with path-style true
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// S3Test is our object.
+type S3Test struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *S3Test) Arguments() map[string]string {
+	known := map[string]string{
+		"bucket":     `^[a-z0-9][a-z0-9.\-]+$`,
+		"object":     ".+",
+		"size":       "^[0-9]+$",
+		"access-key": ".+",
+		"secret-key": ".+",
+		"region":     `^[a-z0-9\-]+$`,
+		"path-style": "^(true|false)$",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *S3Test) ShouldResolveHostname() bool {
+	return false
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *S3Test) Example() string {
+	str := `
+S3 Tester
+---------
+ The S3 tester allows you to confirm that an S3-compatible object storage
+ (AWS S3, MinIO, Ceph, etc.) is reachable, and that a bucket can be listed.
+
+ This test is invoked via input like so:
+
+    https://s3.eu-west-1.amazonaws.com must run s3 with bucket 'my-bucket'
+
+ Instead of listing the bucket you can check that a specific object exists,
+ optionally asserting its size in bytes:
+
+    https://minio.example.com must run s3 with bucket 'backups' with object 'latest.tar.gz' with size 1024
+
+ Requests are signed (AWS Signature Version 4) when credentials are given:
+
+    https://minio.example.com must run s3 with bucket 'backups' with access-key 'AKIA..' with secret-key 'secret'
+
+ The signing region defaults to 'us-east-1', and can be changed with 'region'.
+
+ By default virtual-hosted style requests are made (https://bucket.host/),
+ to use path-style requests (https://host/bucket/), needed by most
+ self-hosted implementations, use:
+
+    with path-style true
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we either list the bucket (asking for a single key), or
+// issue a HEAD request against the requested object.
+func (s *S3Test) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+
+	bucket := tst.Arguments["bucket"]
+	if bucket == "" {
+		return fmt.Errorf("you must specify the bucket when running an S3 test")
+	}
+
+	endpoint, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return fmt.Errorf("the S3 endpoint must be an http or https URL, got '%s'", target)
+	}
+
+	region := "us-east-1"
+	if tst.Arguments["region"] != "" {
+		region = tst.Arguments["region"]
+	}
+
+	//
+	// Build the URL of the resource we're going to query.
+	//
+	u := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	resourcePath := "/"
+	if tst.Arguments["object"] != "" {
+		resourcePath += strings.TrimPrefix(tst.Arguments["object"], "/")
+	}
+
+	if tst.Arguments["path-style"] == "true" {
+		u.Path = "/" + bucket + resourcePath
+	} else {
+		u.Host = bucket + "." + endpoint.Host
+		u.Path = resourcePath
+	}
+
+	method := http.MethodHead
+	if tst.Arguments["object"] == "" {
+		method = http.MethodGet
+		u.RawQuery = "list-type=2&max-keys=1"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+
+	if tst.Arguments["access-key"] != "" {
+		signAWSRequestV4(req, tst.Arguments["access-key"], tst.Arguments["secret-key"], region, "s3", time.Now())
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		if tst.Arguments["object"] != "" {
+			return fmt.Errorf("object '%s' in bucket '%s' not available, status code was %d", tst.Arguments["object"], bucket, response.StatusCode)
+		}
+		return fmt.Errorf("failed to list bucket '%s', status code was %d", bucket, response.StatusCode)
+	}
+
+	//
+	// Are we expecting the object to have a specific size?
+	//
+	if tst.Arguments["size"] != "" && tst.Arguments["object"] != "" {
+		expected, errConv := strconv.ParseInt(tst.Arguments["size"], 10, 64)
+		if errConv != nil {
+			return errConv
+		}
+
+		if response.ContentLength != expected {
+			return fmt.Errorf("object '%s' has size %d, not %d", tst.Arguments["object"], response.ContentLength, expected)
+		}
+	}
+
+	return nil
+}
+
+// signAWSRequestV4 signs a body-less request following the AWS Signature
+// Version 4 process, see
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+//
+// The X-Amz-Security-Token header of temporary credentials, if any, must be
+// set before signing.
+func signAWSRequestV4(req *http.Request, accessKey string, secretKey string, region string, service string, now time.Time) {
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	// Hash of the empty payload
+	payloadHash := sha256Hex("")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	//
+	// The canonical query string has its keys sorted, and both keys
+	// and values URI-encoded.
+	//
+	query := req.URL.Query()
+	var queryKeys []string
+	for k := range query {
+		queryKeys = append(queryKeys, k)
+	}
+	sort.Strings(queryKeys)
+
+	var queryParts []string
+	for _, k := range queryKeys {
+		for _, v := range query[k] {
+			queryParts = append(queryParts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+
+	// Temporary credentials come with a session token, which is signed too
+	if token := req.Header.Get("X-Amz-Security-Token"); token != "" {
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += fmt.Sprintf("x-amz-security-token:%s\n", token)
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		strings.Join(queryParts, "&"),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// awsURIEncode encodes a string as expected by the AWS signing process,
+// which differs slightly from the url package behaviour.
+func awsURIEncode(in string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(in) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(in string) string {
+	sum := sha256.Sum256([]byte(in))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (s *S3Test) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("s3", func() ProtocolTest {
+		return &S3Test{}
+	})
+}
@@ -24,10 +24,10 @@
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"net"
 	"net/smtp"
 	"strconv"
 	"strings"
@@ -89,7 +89,7 @@ SMTP Tester
 //
 // In this case we make a TCP connection, defaulting to port 25, and
 // look for a response which appears to be an SMTP-server.
-func (s *SMTPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *SMTPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -110,7 +110,7 @@ func (s *SMTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -127,15 +127,29 @@ func (s *SMTPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
+	//
+	// The whole exchange must complete within the timeout.
+	//
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
 	// The default TLS configuration verifies the certificate
 	// matches the hostname of our target.
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		conn.Close()
+		return err
+	}
 	tlsconfig := &tls.Config{
 		ServerName: tst.Target,
+		RootCAs:    roots,
 	}
 
 	// However if the user is being insecure then we'll validate
@@ -0,0 +1,228 @@
+// SOA Tester
+//
+// The SOA tester fetches the SOA record of a DNS zone, to confirm that
+// changes to the zone were published, and propagated, by checking its
+// serial.
+//
+// This test is invoked via input like so:
+//
+//    example.com must run soa with min-serial 2024051501
+//
+// The serial must be at least the given one, as compared with the serial
+// number arithmetic of DNS, which handles the serial wrapping around.
+//
+// Instead, or as well, the serial can be required to increase between the
+// runs of the test, e.g. for zones updated more often than they are
+// tested, the last serial seen being kept by the worker:
+//
+//    example.com must run soa with changed true
+//
+// The first run of such a test only records the serial. The serial is
+// captured in the result in any case.
+//
+// The system resolver is used unless a specific one is given, e.g. one of
+// the authoritative servers of the zone:
+//
+//    example.com must run soa with min-serial 2024051501 with resolver ns1.example.com
+//
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/miekg/dns"
+)
+
+// SOATest is our object.
+type SOATest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *SOATest) Arguments() map[string]string {
+	known := map[string]string{
+		"min-serial": "^[0-9]+$",
+		"changed":    "^(true|false)$",
+		"resolver":   `^[a-zA-Z0-9.:\[\]\-]+$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *SOATest) ShouldResolveHostname() bool {
+	return false
+}
+
+// ValidateArguments checks that the minimum serial is a valid serial.
+func (s *SOATest) ValidateArguments(args map[string]string) error {
+	if args["min-serial"] != "" {
+		if _, err := strconv.ParseUint(args["min-serial"], 10, 32); err != nil {
+			return fmt.Errorf("invalid min-serial '%s': serials are 32-bit numbers", args["min-serial"])
+		}
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *SOATest) Example() string {
+	str := `
+SOA Tester
+----------
+ The SOA tester fetches the SOA record of a DNS zone, to confirm that
+ changes to the zone were published, and propagated, by checking its
+ serial.
+
+ This test is invoked via input like so:
+
+    example.com must run soa with min-serial 2024051501
+
+ The serial must be at least the given one, as compared with the serial
+ number arithmetic of DNS, which handles the serial wrapping around.
+
+ Instead, or as well, the serial can be required to increase between the
+ runs of the test, e.g. for zones updated more often than they are
+ tested, the last serial seen being kept by the worker:
+
+    example.com must run soa with changed true
+
+ The first run of such a test only records the serial. The serial is
+ captured in the result in any case.
+
+ The system resolver is used unless a specific one is given, e.g. one of
+ the authoritative servers of the zone:
+
+    example.com must run soa with min-serial 2024051501 with resolver ns1.example.com
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+func (s *SOATest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestCapture(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestCapture behaves like RunTest, but also returns the serial of the
+// zone.
+//
+// In this case we fetch the SOA record of the zone, and compare its serial
+// with the minimum one, and/or with the one seen by the previous run.
+func (s *SOATest) RunTestCapture(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]string, error) {
+	resolver := tst.Arguments["resolver"]
+	if resolver == "" {
+		config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the system resolver: %s", err.Error())
+		}
+		if len(config.Servers) == 0 {
+			return nil, errors.New("no system resolver is configured")
+		}
+		resolver = net.JoinHostPort(config.Servers[0], config.Port)
+	} else if _, _, errPort := net.SplitHostPort(resolver); errPort != nil {
+		resolver = net.JoinHostPort(resolver, "53")
+	}
+
+	zone := dns.Fqdn(tst.Target)
+	serial, err := s.lookupSerial(ctx, zone, resolver, opts)
+	if err != nil {
+		return nil, err
+	}
+	captures := map[string]string{"serial": strconv.FormatUint(uint64(serial), 10)}
+
+	if opts.Verbose {
+		fmt.Printf("SOA serial of %s: %d\n", zone, serial)
+	}
+
+	if tst.Arguments["min-serial"] != "" {
+		minSerial, errParse := strconv.ParseUint(tst.Arguments["min-serial"], 10, 32)
+		if errParse != nil {
+			return captures, errParse
+		}
+		if serialLess(serial, uint32(minSerial)) {
+			return captures, fmt.Errorf("the SOA serial of %s is %d, older than %d", zone, serial, minSerial)
+		}
+	}
+
+	if tst.Arguments["changed"] == "true" {
+		if opts.State == nil {
+			return captures, errors.New("tracking the changes of the SOA serial requires running the test via a worker")
+		}
+
+		key := "soa." + zone + "." + resolver
+		previous, errState := opts.State.Get(key)
+		if errState != nil {
+			return captures, fmt.Errorf("failed to fetch the previous SOA serial: %s", errState.Error())
+		}
+		if errState = opts.State.Set(key, captures["serial"]); errState != nil {
+			return captures, fmt.Errorf("failed to store the SOA serial: %s", errState.Error())
+		}
+
+		if previous != "" {
+			previousSerial, errParse := strconv.ParseUint(previous, 10, 32)
+			if errParse != nil {
+				return captures, fmt.Errorf("invalid previous SOA serial '%s'", previous)
+			}
+			if serial == uint32(previousSerial) {
+				return captures, fmt.Errorf("the SOA serial of %s is still %d, unchanged since the last run", zone, serial)
+			}
+			if serialLess(serial, uint32(previousSerial)) {
+				return captures, fmt.Errorf("the SOA serial of %s went back from %d to %d", zone, previousSerial, serial)
+			}
+		}
+	}
+
+	return captures, nil
+}
+
+// lookupSerial returns the serial of the SOA record of the zone, as
+// answered by the given resolver.
+func (s *SOATest) lookupSerial(ctx context.Context, zone string, resolver string, opts test.Options) (uint32, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(zone, dns.TypeSOA)
+
+	client := &dns.Client{Timeout: opts.Timeout}
+	response, _, err := client.ExchangeContext(ctx, msg, resolver)
+	if err != nil {
+		return 0, err
+	}
+	if response.Rcode == dns.RcodeNameError {
+		return 0, fmt.Errorf("no such zone %s", zone)
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return 0, fmt.Errorf("SOA query for %s failed with %s", zone, dns.RcodeToString[response.Rcode])
+	}
+
+	for _, rr := range response.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA record for %s", zone)
+}
+
+// serialLess returns whether the serial a is older than b, following the
+// serial number arithmetic of RFC 1982.
+func serialLess(a uint32, b uint32) bool {
+	return a != b && b-a < 1<<31
+}
+
+func (s *SOATest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("soa", func() ProtocolTest {
+		return &SOATest{}
+	})
+}
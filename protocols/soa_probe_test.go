@@ -0,0 +1,159 @@
+package protocols
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/miekg/dns"
+)
+
+// memoryStateStore is a StateStore keeping the values in memory.
+type memoryStateStore struct {
+	sync.Mutex
+	values map[string]string
+}
+
+func (m *memoryStateStore) Get(key string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.values[key], nil
+}
+
+func (m *memoryStateStore) Set(key string, value string) error {
+	m.Lock()
+	defer m.Unlock()
+	m.values[key] = value
+	return nil
+}
+
+// startSOAResolver starts a stub DNS resolver answering SOA queries for
+// the zones of the given serials, which can be changed while it runs.
+func startSOAResolver(t *testing.T, serials map[string]uint32, lock *sync.Mutex) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+
+			lock.Lock()
+			serial, ok := serials[r.Question[0].Name]
+			lock.Unlock()
+
+			if !ok {
+				m.Rcode = dns.RcodeNameError
+			} else {
+				m.Answer = append(m.Answer, &dns.SOA{
+					Hdr:     dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+					Ns:      "ns1." + r.Question[0].Name,
+					Mbox:    "hostmaster." + r.Question[0].Name,
+					Serial:  serial,
+					Refresh: 3600,
+					Retry:   600,
+					Expire:  86400,
+					Minttl:  60,
+				})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+
+	return conn.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func TestSOA(t *testing.T) {
+	lock := &sync.Mutex{}
+	serials := map[string]uint32{
+		"example.com.": 2024051501,
+		"wrapped.com.": 5,
+	}
+	resolver, stop := startSOAResolver(t, serials, lock)
+	defer stop()
+
+	state := &memoryStateStore{values: map[string]string{}}
+	run := func(zone string, args map[string]string) (map[string]string, error) {
+		args["resolver"] = resolver
+		tst := test.Test{Target: zone, Type: "soa", Arguments: args}
+		return (&SOATest{}).RunTestCapture(context.Background(), tst, zone, test.Options{Timeout: 5 * time.Second, State: state})
+	}
+
+	tests := []struct {
+		zone    string
+		args    map[string]string
+		failure string
+	}{
+		{"example.com", map[string]string{}, ""},
+		{"example.com", map[string]string{"min-serial": "2024051501"}, ""},
+		{"example.com", map[string]string{"min-serial": "2024051400"}, ""},
+		{"example.com", map[string]string{"min-serial": "2024051502"}, "is 2024051501, older than 2024051502"},
+		// The serial wrapped around, so it is newer
+		{"wrapped.com", map[string]string{"min-serial": "4294967000"}, ""},
+		{"missing.com", map[string]string{}, "no such zone missing.com."},
+	}
+
+	for i, tt := range tests {
+		captures, err := run(tt.zone, tt.args)
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+		if tt.failure == "" && captures["serial"] == "" {
+			t.Errorf("test %d: expected the serial to be captured", i)
+		}
+	}
+}
+
+func TestSOAChanged(t *testing.T) {
+	lock := &sync.Mutex{}
+	serials := map[string]uint32{"example.com.": 2024051501}
+	resolver, stop := startSOAResolver(t, serials, lock)
+	defer stop()
+
+	setSerial := func(serial uint32) {
+		lock.Lock()
+		serials["example.com."] = serial
+		lock.Unlock()
+	}
+
+	state := &memoryStateStore{values: map[string]string{}}
+	run := func(opts test.Options) error {
+		tst := test.Test{Target: "example.com", Type: "soa", Arguments: map[string]string{"resolver": resolver, "changed": "true"}}
+		opts.Timeout = 5 * time.Second
+		return (&SOATest{}).RunTest(context.Background(), tst, "example.com", opts)
+	}
+
+	// The first run only records the serial
+	if err := run(test.Options{State: state}); err != nil {
+		t.Errorf("expected the first run to pass, got: %s", err)
+	}
+
+	if err := run(test.Options{State: state}); err == nil || !strings.Contains(err.Error(), "still 2024051501, unchanged since the last run") {
+		t.Errorf("expected an unchanged serial to fail, got: %v", err)
+	}
+
+	setSerial(2024051502)
+	if err := run(test.Options{State: state}); err != nil {
+		t.Errorf("expected an increased serial to pass, got: %s", err)
+	}
+
+	setSerial(2024051500)
+	if err := run(test.Options{State: state}); err == nil || !strings.Contains(err.Error(), "went back from 2024051502 to 2024051500") {
+		t.Errorf("expected a decreased serial to fail, got: %v", err)
+	}
+
+	if err := run(test.Options{}); err == nil || !strings.Contains(err.Error(), "requires running the test via a worker") {
+		t.Errorf("expected tracking changes without a state store to fail, got: %v", err)
+	}
+}
@@ -7,14 +7,22 @@
 //
 //    host.example.com must run ssh [with port 22]
 //
+// If the host is only reachable through a jump host, e.g. a bastion, the
+// connection can be tunnelled through it, with its own credentials:
+//
+//    host.example.com must run ssh with jump-host 'bastion.example.com' with jump-username 'monitor' with jump-key '/etc/overseer/id_ed25519'
+//
+// The jump host accepts `jump-port`, `jump-password` and `jump-known-hosts`
+// too, and the timeout covers the whole tunnel.
+//
 
 package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -32,7 +40,7 @@ func (s *SSHTest) Arguments() map[string]string {
 	known := map[string]string{
 		"port": "^[0-9]+$",
 	}
-	return known
+	return withSSHJumpArguments(known)
 }
 
 // ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
@@ -51,6 +59,14 @@ SSH Tester
  This test is invoked via input like so:
 
     host.example.com must run ssh
+
+ If the host is only reachable through a jump host, e.g. a bastion, the
+ connection can be tunnelled through it, with its own credentials:
+
+    host.example.com must run ssh with jump-host 'bastion.example.com' with jump-username 'monitor' with jump-key '/etc/overseer/id_ed25519'
+
+ The jump host accepts 'jump-port', 'jump-password' and 'jump-known-hosts'
+ too, and the timeout covers the whole tunnel.
 `
 	return str
 }
@@ -60,7 +76,7 @@ SSH Tester
 //
 // In this case we make a TCP connection, defaulting to port 22, and
 // look for a response which appears to be an SSH-server.
-func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *SSHTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -78,11 +94,6 @@ func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error
 		}
 	}
 
-	//
-	// Set an explicit timeout
-	//
-	d := net.Dialer{Timeout: opts.Timeout}
-
 	//
 	// Default to connecting to an IPv4-address
 	//
@@ -96,12 +107,14 @@ func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error
 	}
 
 	//
-	// Make the TCP connection.
+	// Make the TCP connection, possibly through a jump host, with an
+	// explicit timeout.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := sshDial(ctx, tst, address, opts)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
 	//
 	// Read the banner.
@@ -110,7 +123,6 @@ func (s *SSHTest) RunTest(tst test.Test, target string, opts test.Options) error
 	if err != nil {
 		return err
 	}
-	conn.Close()
 
 	if !strings.Contains(banner, "SSH-") {
 		return errors.New("banner doesn't look like an SSH server")
@@ -0,0 +1,160 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshJumpArguments are the arguments of the SSH-based testers which
+// make them reach their target through a jump host, e.g. a bastion.
+var sshJumpArguments = map[string]string{
+	"jump-host":        `^[a-zA-Z0-9.:\[\]\-]+$`,
+	"jump-port":        "^[0-9]+$",
+	"jump-username":    ".+",
+	"jump-password":    ".*",
+	"jump-key":         ".+",
+	"jump-known-hosts": ".+",
+}
+
+// withSSHJumpArguments adds the jump host arguments to the arguments known
+// by a tester.
+func withSSHJumpArguments(known map[string]string) map[string]string {
+	for k, v := range sshJumpArguments {
+		known[k] = v
+	}
+	return known
+}
+
+// sshClientConfig returns the SSH configuration built from the arguments
+// starting with the given prefix, e.g. "jump-" for the jump host.
+func sshClientConfig(tst test.Test, prefix string, opts test.Options) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+
+	if key := tst.Arguments[prefix+"key"]; key != "" {
+		pem, err := ioutil.ReadFile(key)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %s", key, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if password := tst.Arguments[prefix+"password"]; password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+
+	//
+	// Without a known_hosts file there is nothing to verify the host
+	// key against.
+	//
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if knownHosts := tst.Arguments[prefix+"known-hosts"]; knownHosts != "" {
+		var err error
+		hostKeyCallback, err = knownhosts.New(knownHosts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            tst.Arguments[prefix+"username"],
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         opts.Timeout,
+	}, nil
+}
+
+// sshTunnelConn is a connection tunnelled through a jump host.
+//
+// Deadlines are applied to the connection to the jump host, as the
+// tunnel itself does not support them, and closing the tunnel also logs
+// out of the jump host.
+type sshTunnelConn struct {
+	net.Conn
+	jump   net.Conn
+	client *ssh.Client
+}
+
+func (c *sshTunnelConn) SetDeadline(t time.Time) error      { return c.jump.SetDeadline(t) }
+func (c *sshTunnelConn) SetReadDeadline(t time.Time) error  { return c.jump.SetReadDeadline(t) }
+func (c *sshTunnelConn) SetWriteDeadline(t time.Time) error { return c.jump.SetWriteDeadline(t) }
+
+func (c *sshTunnelConn) Close() error {
+	c.Conn.Close()
+	return c.client.Close()
+}
+
+// sshDial connects to the given address, directly or, if a `jump-host`
+// is given, through the jump host.
+//
+// The connection has a deadline of opts.Timeout, which covers the login
+// to the jump host, so that a hanging jump host can't block us, and the
+// dials are aborted if the context is cancelled.
+func sshDial(ctx context.Context, tst test.Test, address string, opts test.Options) (net.Conn, error) {
+	until := deadline(ctx, opts.Timeout)
+
+	if tst.Arguments["jump-host"] == "" {
+		conn, err := newDialer(opts).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		if err = conn.SetDeadline(until); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	if tst.Arguments["jump-username"] == "" {
+		return nil, errors.New("you must specify the jump-username when using a jump host")
+	}
+
+	port := 22
+	if tst.Arguments["jump-port"] != "" {
+		var err error
+		if port, err = strconv.Atoi(tst.Arguments["jump-port"]); err != nil {
+			return nil, err
+		}
+	}
+	jumpAddress := net.JoinHostPort(tst.Arguments["jump-host"], strconv.Itoa(port))
+
+	config, err := sshClientConfig(tst, "jump-", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	jump, err := newDialer(opts).DialContext(ctx, "tcp", jumpAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the jump host %s: %s", jumpAddress, err.Error())
+	}
+	if err = jump.SetDeadline(until); err != nil {
+		jump.Close()
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(jump, jumpAddress, config)
+	if err != nil {
+		jump.Close()
+		return nil, fmt.Errorf("failed to login to the jump host %s: %s", jumpAddress, err.Error())
+	}
+	client := ssh.NewClient(c, chans, reqs)
+
+	conn, err := client.Dial("tcp", address)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to reach %s through the jump host %s: %s", address, jumpAddress, err.Error())
+	}
+
+	return &sshTunnelConn{Conn: conn, jump: jump, client: client}, nil
+}
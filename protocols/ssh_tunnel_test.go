@@ -0,0 +1,206 @@
+package protocols
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"golang.org/x/crypto/ssh"
+)
+
+// startJumpServer starts a stub SSH jump host, accepting the given
+// password, which forwards the direct-tcpip channels to their destination.
+func startJumpServer(t *testing.T, password string) net.Listener {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "jumper" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+
+		for newChannel := range chans {
+			if newChannel.ChannelType() != "direct-tcpip" {
+				newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+				continue
+			}
+
+			var destination struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			if err = ssh.Unmarshal(newChannel.ExtraData(), &destination); err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+
+			upstream, err := net.Dial("tcp", net.JoinHostPort(destination.Host, strconv.Itoa(int(destination.Port))))
+			if err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, requests, err := newChannel.Accept()
+			if err != nil {
+				upstream.Close()
+				return
+			}
+			go ssh.DiscardRequests(requests)
+
+			go func() {
+				io.Copy(channel, upstream)
+				channel.Close()
+			}()
+			go func() {
+				io.Copy(upstream, channel)
+				upstream.Close()
+			}()
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+
+	return listener
+}
+
+func TestSSHJumpHost(t *testing.T) {
+	outputs := map[string]string{
+		"systemctl is-active -- nginx": "active\n",
+	}
+	server := startSSHServer(t, "secret", outputs, nil)
+	defer server.Close()
+	port := strconv.Itoa(server.Addr().(*net.TCPAddr).Port)
+
+	jump := startJumpServer(t, "jumpsecret")
+	defer jump.Close()
+	jumpPort := strconv.Itoa(jump.Addr().(*net.TCPAddr).Port)
+
+	jumpArgs := func(args map[string]string) map[string]string {
+		args["port"] = port
+		args["jump-host"] = "127.0.0.1"
+		args["jump-port"] = jumpPort
+		args["jump-username"] = "jumper"
+		if _, ok := args["jump-password"]; !ok {
+			args["jump-password"] = "jumpsecret"
+		}
+		return args
+	}
+	opts := test.Options{Timeout: 5 * time.Second}
+
+	// The systemd tester logs in to the target through the jump host
+	args := jumpArgs(map[string]string{"username": "monitor", "password": "secret", "unit": "nginx"})
+	tst := test.Test{Target: "127.0.0.1", Type: "systemd", Arguments: args}
+	if err := (&SystemdTest{}).RunTest(context.Background(), tst, "127.0.0.1", opts); err != nil {
+		t.Errorf("expected systemd through the jump host to pass: %s", err)
+	}
+
+	// The ssh tester reads the banner through the jump host
+	tst = test.Test{Target: "127.0.0.1", Type: "ssh", Arguments: jumpArgs(map[string]string{})}
+	if err := (&SSHTest{}).RunTest(context.Background(), tst, "127.0.0.1", opts); err != nil {
+		t.Errorf("expected ssh through the jump host to pass: %s", err)
+	}
+
+	// The jump host credentials are its own
+	tst = test.Test{Target: "127.0.0.1", Type: "ssh", Arguments: jumpArgs(map[string]string{"jump-password": "secret"})}
+	if err := (&SSHTest{}).RunTest(context.Background(), tst, "127.0.0.1", opts); err == nil || !strings.Contains(err.Error(), "failed to login to the jump host") {
+		t.Errorf("expected a wrong jump password to fail, got: %v", err)
+	}
+
+	// The target must be reachable from the jump host
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := strconv.Itoa(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+	args = jumpArgs(map[string]string{})
+	args["port"] = closedPort
+	tst = test.Test{Target: "127.0.0.1", Type: "ssh", Arguments: args}
+	if err := (&SSHTest{}).RunTest(context.Background(), tst, "127.0.0.1", opts); err == nil || !strings.Contains(err.Error(), "through the jump host") {
+		t.Errorf("expected an unreachable target to fail, got: %v", err)
+	}
+}
+
+func TestSSHJumpHostTimeout(t *testing.T) {
+	// A jump host which never answers
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	args := map[string]string{
+		"jump-host":     "127.0.0.1",
+		"jump-port":     strconv.Itoa(silent.Addr().(*net.TCPAddr).Port),
+		"jump-username": "jumper",
+		"jump-password": "jumpsecret",
+	}
+	tst := test.Test{Target: "127.0.0.1", Type: "ssh", Arguments: args}
+
+	start := time.Now()
+	if err := (&SSHTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 200 * time.Millisecond}); err == nil {
+		t.Errorf("expected a silent jump host to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the timeout to cover the jump host, took %s", elapsed)
+	}
+}
+
+func TestSSHJumpHostSanitized(t *testing.T) {
+	tst := test.Test{
+		Target:    "host.example.com",
+		Type:      "ssh",
+		Arguments: map[string]string{"jump-host": "bastion.example.com", "jump-username": "jumper", "jump-password": "jumpsecret"},
+	}
+
+	if sanitized := tst.Sanitize(); strings.Contains(sanitized, "jumpsecret") {
+		t.Errorf("expected the jump password to be censored: %s", sanitized)
+	}
+}
@@ -18,11 +18,29 @@
 //    # 12 hours (!)
 //    steve.fi must run ssl with expiration 12h
 //
+// Servers often omit the intermediate certificates, which browsers fetch
+// by themselves, but most other clients don't. To fail unless the chain
+// sent by the server builds to a trusted root on its own use:
+//
+//    steve.fi must run ssl with chain-complete true
+//
+// For high-security endpoints, the certificate can be pinned, to catch a
+// MITM or an unexpected rotation, via the SHA-256 fingerprint of the leaf
+// certificate, or the SHA-256 pin of its public key, which survives the
+// renewals reusing the key:
+//
+//    steve.fi must run ssl with cert-pin 5E:3B:...:9A
+//    steve.fi must run ssl with cert-pin sha256/x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4=
+//
+// The observed fingerprint is reported in the result.
+//
 
 package protocols
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"strconv"
 	"strings"
@@ -40,7 +58,9 @@ type SSLTest struct {
 // their values.
 func (s *SSLTest) Arguments() map[string]string {
 	known := map[string]string{
-		"expiration": "^([0-9]+[hd]?)$",
+		"expiration":     "^([0-9]+[hd]?)$",
+		"chain-complete": "^(true|false)$",
+		"cert-pin":       certPinPattern,
 	}
 	return known
 }
@@ -72,6 +92,22 @@ expiration period is assumed to be days:
 
    # 12 hours (!)
    steve.fi must run ssl with expiration 12h
+
+Servers often omit the intermediate certificates, which browsers fetch
+by themselves, but most other clients don't. To fail unless the chain
+sent by the server builds to a trusted root on its own use:
+
+   steve.fi must run ssl with chain-complete true
+
+For high-security endpoints, the certificate can be pinned, to catch a
+MITM or an unexpected rotation, via the SHA-256 fingerprint of the leaf
+certificate, or the SHA-256 pin of its public key, which survives the
+renewals reusing the key:
+
+   steve.fi must run ssl with cert-pin 5E:3B:...:9A
+   steve.fi must run ssl with cert-pin sha256/x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4=
+
+The observed fingerprint is reported in the result.
 `
 	return str
 }
@@ -90,7 +126,15 @@ expiration period is assumed to be days:
 //
 //    target => "176.9.183.100"
 //
-func (s *SSLTest) RunTest(tst test.Test, _ string, opts test.Options) error {
+func (s *SSLTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestDetailed(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestDetailed runs the test, also returning the expiration, the subject
+// and the issuer of the certificate of the chain which expires first, and
+// the fingerprint of the pinned certificate.
+func (s *SSLTest) RunTestDetailed(ctx context.Context, tst test.Test, _ string, opts test.Options) (map[string]interface{}, error) {
 
 	var err error
 	target := tst.Target
@@ -131,7 +175,7 @@ func (s *SSLTest) RunTest(tst test.Test, _ string, opts test.Options) error {
 		// Get the period.
 		period, err = strconv.Atoi(expire)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		//
@@ -143,30 +187,78 @@ func (s *SSLTest) RunTest(tst test.Test, _ string, opts test.Options) error {
 	//
 	// Check the expiration
 	//
-	hours, err := s.SSLExpiration(target, opts.Verbose)
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if tst.Arguments["chain-complete"] == "true" {
+		address := target
+		if !strings.Contains(address, ":") {
+			address += ":443"
+		}
+		if err = checkChainComplete(ctx, address, strings.Split(address, ":")[0], roots, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var fingerprint string
+	if tst.Arguments["cert-pin"] != "" {
+		address := target
+		if !strings.Contains(address, ":") {
+			address += ":443"
+		}
+		fingerprint, err = checkCertPin(ctx, address, strings.Split(address, ":")[0], tst.Arguments["cert-pin"], opts)
+		if err != nil {
+			if fingerprint != "" {
+				return map[string]interface{}{"fingerprint": fingerprint}, err
+			}
+			return nil, err
+		}
+	}
+
+	hours, cert, err := s.SSLExpiration(ctx, target, roots, opts)
 
 	if err == nil {
+		var details map[string]interface{}
+		if cert != nil {
+			details = map[string]interface{}{
+				"expiresInHours": hours,
+				"notAfter":       cert.NotAfter.UTC().Format(time.RFC3339),
+				"subject":        cert.Subject.CommonName,
+				"issuer":         cert.Issuer.CommonName,
+			}
+			if fingerprint != "" {
+				details["fingerprint"] = fingerprint
+			}
+		}
+
 		// Is the age too short?
 		if int64(hours) < int64(period) {
 
-			return fmt.Errorf("SSL certificate will expire in %d hours (%d days)", hours, int(hours/24))
+			return details, fmt.Errorf("SSL certificate will expire in %d hours (%d days)", hours, int(hours/24))
 		}
+		return details, nil
 	}
 
 	//
 	// If we reached here all is OK
 	//
-	return nil
+	return nil, nil
 }
 
 // SSLExpiration returns the number of hours remaining for a given
-// SSL certificate chain.
-func (s *SSLTest) SSLExpiration(host string, verbose bool) (int64, error) {
+// SSL certificate chain, verified against the given authorities, along
+// with the certificate of the chain which expires first.
+func (s *SSLTest) SSLExpiration(ctx context.Context, host string, roots *x509.CertPool, opts test.Options) (int64, *x509.Certificate, error) {
 
 	// Expiry time, in hours
 	var hours int64
 	hours = -1
 
+	// The certificate expiring first
+	var first *x509.Certificate
+
 	//
 	// If no port is specified default to :443
 	//
@@ -178,44 +270,46 @@ func (s *SSLTest) SSLExpiration(host string, verbose bool) (int64, error) {
 	//
 	// Show what we're doing.
 	//
-	if verbose {
+	if opts.Verbose {
 		fmt.Printf("SSLExpiration testing: %s\n", host)
 	}
 
-	cfg := &tls.Config{}
+	cfg := &tls.Config{RootCAs: roots}
 
-	conn, err := tls.Dial("tcp", host, cfg)
+	conn, err := newDialer(opts).DialTLSContext(ctx, "tcp", host, cfg)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 	defer conn.Close()
 
 	timeNow := time.Now()
-	for _, chain := range conn.ConnectionState().VerifiedChains {
+	for _, chain := range conn.(*tls.Conn).ConnectionState().VerifiedChains {
 		for _, cert := range chain {
 
 			// Get the expiration time, in hours.
 			expiresIn := int64(cert.NotAfter.Sub(timeNow).Hours())
 
-			if verbose {
+			if opts.Verbose {
 				fmt.Printf("SSLExpiration - certificate: %s expires in %d hours (%d days)\n", cert.Subject.CommonName, expiresIn, expiresIn/24)
 			}
 
 			// If we've not checked anything this is the benchmark
 			if hours == -1 {
 				hours = expiresIn
+				first = cert
 			} else {
 				// Otherwise replace our result if the
 				// certificate is going to expire more
 				// recently than the current "winner".
 				if expiresIn < hours {
 					hours = expiresIn
+					first = cert
 				}
 			}
 		}
 	}
 
-	return hours, nil
+	return hours, first, nil
 }
 
 func (s *SSLTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
@@ -0,0 +1,49 @@
+package protocols
+
+import (
+	"context"
+	"crypto/x509"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestSSLDetailed(t *testing.T) {
+	root, rootKey := issueCertificate(t, "Overseer Root", true, nil, nil)
+	leaf, leafKey := issueCertificate(t, "localhost", false, root, rootKey)
+
+	server := chainServer([]*x509.Certificate{leaf}, leafKey)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	u, _ := url.Parse(server.URL)
+	run := func(expiration string) (map[string]interface{}, error) {
+		tst := test.Test{Target: u.Host, Type: "ssl", Arguments: map[string]string{"expiration": expiration}}
+		return (&SSLTest{}).RunTestDetailed(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second, RootCAs: roots})
+	}
+
+	details, err := run("7d")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if details["subject"] != "localhost" || details["issuer"] != "Overseer Root" {
+		t.Errorf("unexpected details: %v", details)
+	}
+	if details["notAfter"] != leaf.NotAfter.UTC().Format(time.RFC3339) {
+		t.Errorf("expected the expiration of the leaf, got %v", details["notAfter"])
+	}
+
+	// The certificate expires in a year
+	details, err = run("400d")
+	if err == nil || !strings.Contains(err.Error(), "SSL certificate will expire") {
+		t.Fatalf("expected the expiration to be too soon, got: %v", err)
+	}
+	if hours, _ := details["expiresInHours"].(int64); hours < 364*24 || hours > 365*24 {
+		t.Errorf("expected the hours before the expiration in the details, got %v", details)
+	}
+}
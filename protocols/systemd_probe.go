@@ -0,0 +1,238 @@
+// Systemd Tester
+//
+// The systemd tester logs into a remote host via SSH, and uses `systemctl`
+// to confirm that a unit is active, giving service-level health beyond a
+// simple port check.
+//
+// This test is invoked via input like so:
+//
+//    host.example.com must run systemd with username 'monitor' with password 'secret' with unit 'nginx.service'
+//
+// Instead of a password, you can authenticate with a private key:
+//
+//    host.example.com must run systemd with username 'monitor' with key '/etc/overseer/id_ed25519' with unit 'nginx'
+//
+// You can also make the test fail if any unit on the host is in the failed
+// state, with or without a unit:
+//
+//    host.example.com must run systemd with username 'monitor' with key '/etc/overseer/id_ed25519' with failed-units true
+//
+// The host key of the server is verified if a known_hosts file is given:
+//
+//    with known-hosts '/etc/overseer/known_hosts'
+//
+// The port defaults to 22, and can be changed with `port`.
+//
+// If the host is only reachable through a jump host, e.g. a bastion, the
+// connection can be tunnelled through it, with its own credentials:
+//
+//    with jump-host 'bastion.example.com' with jump-username 'monitor' with jump-key '/etc/overseer/id_ed25519'
+//
+// The jump host accepts `jump-port`, `jump-password` and `jump-known-hosts`
+// too, and the timeout covers the whole tunnel.
+//
+
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+	"golang.org/x/crypto/ssh"
+)
+
+// SystemdTest is our object.
+type SystemdTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *SystemdTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":         "^[0-9]+$",
+		"username":     ".+",
+		"password":     ".*",
+		"key":          ".+",
+		"known-hosts":  ".+",
+		"unit":         `^[a-zA-Z0-9@._:\\-]+$`,
+		"failed-units": "^(true|false)$",
+	}
+	return withSSHJumpArguments(known)
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *SystemdTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *SystemdTest) Example() string {
+	str := `
+Systemd Tester
+--------------
+ The systemd tester logs into a remote host via SSH, and uses 'systemctl'
+ to confirm that a unit is active, giving service-level health beyond a
+ simple port check.
+
+ This test is invoked via input like so:
+
+    host.example.com must run systemd with username 'monitor' with password 'secret' with unit 'nginx.service'
+
+ Instead of a password, you can authenticate with a private key:
+
+    host.example.com must run systemd with username 'monitor' with key '/etc/overseer/id_ed25519' with unit 'nginx'
+
+ You can also make the test fail if any unit on the host is in the failed
+ state, with or without a unit:
+
+    host.example.com must run systemd with username 'monitor' with key '/etc/overseer/id_ed25519' with failed-units true
+
+ The host key of the server is verified if a known_hosts file is given:
+
+    with known-hosts '/etc/overseer/known_hosts'
+
+ The port defaults to 22, and can be changed with 'port'.
+
+ If the host is only reachable through a jump host, e.g. a bastion, the
+ connection can be tunnelled through it, with its own credentials:
+
+    with jump-host 'bastion.example.com' with jump-username 'monitor' with jump-key '/etc/overseer/id_ed25519'
+
+ The jump host accepts 'jump-port', 'jump-password' and 'jump-known-hosts'
+ too, and the timeout covers the whole tunnel.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we log in via SSH, and run `systemctl is-active` against
+// the unit, and/or list the failed units.
+func (s *SystemdTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	unit := tst.Arguments["unit"]
+	failedUnits := tst.Arguments["failed-units"] == "true"
+
+	if tst.Arguments["username"] == "" {
+		return errors.New("you must specify the username when running a systemd test")
+	}
+	if unit == "" && !failedUnits {
+		return errors.New("you must specify a unit, or failed-units, when running a systemd test")
+	}
+
+	port := 22
+	if tst.Arguments["port"] != "" {
+		port, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	config, err := sshClientConfig(tst, "", opts)
+	if err != nil {
+		return err
+	}
+
+	//
+	// The deadline of the connection covers the handshake and all the
+	// commands we run, so a hanging server, or command, can't block us.
+	//
+	address := net.JoinHostPort(target, strconv.Itoa(port))
+	conn, err := sshDial(ctx, tst, address, opts)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		return err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+	defer client.Close()
+
+	if unit != "" {
+		//
+		// `is-active` exits with a non-zero status for inactive units, so
+		// we rely on its output only.
+		//
+		output, errRun := systemdRun(client, "systemctl is-active -- "+unit)
+		if errRun != nil {
+			return errRun
+		}
+
+		state := strings.TrimSpace(output)
+		if opts.Verbose {
+			fmt.Printf("Unit %s is %s\n", unit, state)
+		}
+		if state != "active" {
+			return fmt.Errorf("unit %s is %s, not active", unit, state)
+		}
+	}
+
+	if failedUnits {
+		output, errRun := systemdRun(client, "systemctl list-units --state=failed --no-legend --plain")
+		if errRun != nil {
+			return errRun
+		}
+
+		var failed []string
+		for _, line := range strings.Split(output, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 0 {
+				failed = append(failed, fields[0])
+			}
+		}
+
+		if opts.Verbose {
+			fmt.Printf("Found %d failed units\n", len(failed))
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("%d units failed: %s", len(failed), strings.Join(failed, ", "))
+		}
+	}
+
+	return nil
+}
+
+// systemdRun runs a command in a new session, returning its output even
+// if the command exited with a non-zero status.
+func systemdRun(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+
+	err = session.Run(command)
+	if _, ok := err.(*ssh.ExitError); err != nil && !ok {
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
+
+func (s *SystemdTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("systemd", func() ProtocolTest {
+		return &SystemdTest{}
+	})
+}
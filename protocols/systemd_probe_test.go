@@ -0,0 +1,156 @@
+package protocols
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSSHServer starts a stub SSH server, accepting the given password,
+// which answers each command with the canned output, and exit status.
+func startSSHServer(t *testing.T, password string, outputs map[string]string, statuses map[string]uint32) net.Listener {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %s", err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("failed to create signer: %s", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "monitor" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config, outputs, statuses)
+		}
+	}()
+
+	return listener
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig, outputs map[string]string, statuses map[string]uint32) {
+	defer conn.Close()
+
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" || len(req.Payload) < 4 {
+					req.Reply(false, nil)
+					continue
+				}
+				command := string(req.Payload[4:])
+				req.Reply(true, nil)
+
+				channel.Write([]byte(outputs[command]))
+
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, statuses[command])
+				channel.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	outputs := map[string]string{
+		"systemctl is-active -- nginx":                            "active\n",
+		"systemctl is-active -- cron":                             "failed\n",
+		"systemctl list-units --state=failed --no-legend --plain": "cron.service loaded failed failed Regular background program processing daemon\n",
+	}
+	statuses := map[string]uint32{
+		"systemctl is-active -- cron": 3,
+	}
+
+	server := startSSHServer(t, "secret", outputs, statuses)
+	defer server.Close()
+	port := strconv.Itoa(server.Addr().(*net.TCPAddr).Port)
+
+	run := func(args map[string]string) error {
+		args["port"] = port
+		args["username"] = "monitor"
+		if _, ok := args["password"]; !ok {
+			args["password"] = "secret"
+		}
+		tst := test.Test{Target: "127.0.0.1", Type: "systemd", Arguments: args}
+		return (&SystemdTest{}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second})
+	}
+
+	if err := run(map[string]string{"unit": "nginx"}); err != nil {
+		t.Errorf("expected active unit to pass: %s", err)
+	}
+
+	err := run(map[string]string{"unit": "cron"})
+	if err == nil || !strings.Contains(err.Error(), "unit cron is failed") {
+		t.Errorf("expected failed unit to fail, got: %v", err)
+	}
+
+	err = run(map[string]string{"unit": "nginx", "failed-units": "true"})
+	if err == nil || !strings.Contains(err.Error(), "1 units failed: cron.service") {
+		t.Errorf("expected failed units to be reported, got: %v", err)
+	}
+
+	if err = run(map[string]string{"unit": "nginx", "password": "wrong"}); err == nil {
+		t.Errorf("expected a wrong password to fail")
+	}
+
+	if err = run(map[string]string{}); err == nil {
+		t.Errorf("expected a missing unit to fail")
+	}
+}
+
+func TestSystemdSanitized(t *testing.T) {
+	tst := test.Test{
+		Target:    "host.example.com",
+		Type:      "systemd",
+		Input:     "host.example.com must run systemd with username 'monitor' with password 'secret' with unit 'nginx'",
+		Arguments: map[string]string{"username": "monitor", "password": "secret", "unit": "nginx"},
+	}
+
+	if sanitized := tst.Sanitize(); strings.Contains(sanitized, "secret") {
+		t.Errorf("expected the password to be censored: %s", sanitized)
+	}
+}
@@ -0,0 +1,148 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// probeEscapes replaces the escapes which can be used in the probe sent
+// after the idle period, e.g. 'PING\r\n'.
+var probeEscapes = strings.NewReplacer(`\r`, "\r", `\n`, "\n", `\t`, "\t", `\\`, `\`)
+
+// idle connects to the target, holds the connection idle for the idle
+// duration, and checks it still answers the probe afterwards, returning
+// how long the connection survived.
+//
+// The timeout of the test covers the connection, and the answer to the
+// probe, on top of the idle duration.
+func (s *TCPTest) idle(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]string, error) {
+	if tst.Arguments["port"] == "" {
+		return nil, errors.New("you must specify the port when running a TCP test")
+	}
+	if tst.Arguments["probe"] == "" {
+		return nil, errors.New("idle requires a probe to send after the idle period")
+	}
+
+	idle, err := time.ParseDuration(tst.Arguments["idle"])
+	if err != nil {
+		return nil, err
+	}
+
+	var expect *regexp.Regexp
+	if tst.Arguments["expect"] != "" {
+		if expect, err = regexp.Compile("(?ms)" + tst.Arguments["expect"]); err != nil {
+			return nil, err
+		}
+	}
+
+	timeout := opts.Timeout
+	if tst.Timeout != nil {
+		timeout = *tst.Timeout
+	}
+	opts.Timeout = timeout
+
+	conn, err := newDialer(opts).DialContext(ctx, "tcp", net.JoinHostPort(target, tst.Arguments["port"]))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	//
+	// The deadlines are handled below, so the connection is closed to
+	// abort the test along with its context.
+	//
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	//
+	// Wait for the idle duration, reading to notice the connection being
+	// closed as soon as it is. Whatever the server sends meanwhile, e.g.
+	// keepalives of its own, is ignored.
+	//
+	start := time.Now()
+	captures := map[string]string{}
+	buf := make([]byte, 4096)
+
+	conn.SetReadDeadline(start.Add(idle))
+	for {
+		_, err = conn.Read(buf)
+		if err == nil {
+			continue
+		}
+		if errNet, ok := err.(net.Error); ok && errNet.Timeout() {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		survived := time.Since(start).Round(time.Millisecond)
+		captures["idle_survived"] = survived.String()
+		if err == io.EOF {
+			return captures, fmt.Errorf("the connection was closed after %s idle, before %s", survived, idle)
+		}
+		return captures, fmt.Errorf("the connection failed after %s idle, before %s: %s", survived, idle, err.Error())
+	}
+	captures["idle_survived"] = time.Since(start).Round(time.Millisecond).String()
+
+	if opts.Verbose {
+		fmt.Printf("TCP connection to %s survived %s idle, sending the probe\n", target, captures["idle_survived"])
+	}
+
+	//
+	// Connections silently dropped, e.g. by a middlebox, are only noticed
+	// when used.
+	//
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write([]byte(probeEscapes.Replace(tst.Arguments["probe"]))); err != nil {
+		return captures, fmt.Errorf("failed to send the probe after %s idle: %s", idle, err.Error())
+	}
+
+	var answer []byte
+	for {
+		n, errRead := conn.Read(buf)
+		answer = append(answer, buf[:n]...)
+		if expect == nil && len(answer) > 0 {
+			return captures, nil
+		}
+		if expect != nil && expect.Match(answer) {
+			return captures, nil
+		}
+		if errRead != nil {
+			if len(answer) > 0 {
+				return captures, fmt.Errorf("the answer '%s' to the probe after %s idle didn't match the regular expression '%s'", strconv.Quote(string(answer)), idle, tst.Arguments["expect"])
+			}
+			return captures, fmt.Errorf("no answer to the probe after %s idle: %s", idle, errRead.Error())
+		}
+	}
+}
+
+// MaxDuration lets the idle mode hold its connection for the idle
+// duration, on top of the timeout of the connection and of the probe.
+func (s *TCPTest) MaxDuration(tst test.Test, opts test.Options) time.Duration {
+	idle, err := time.ParseDuration(tst.Arguments["idle"])
+	if err != nil {
+		return opts.Timeout
+	}
+	if tst.Timeout != nil {
+		opts.Timeout = *tst.Timeout
+	}
+	return idle + 2*opts.Timeout
+}
@@ -0,0 +1,107 @@
+package protocols
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// startIdleServer starts a stub server answering "PING" lines with "PONG",
+// which closes the connections idle for longer than the given timeout.
+func startIdleServer(t *testing.T, idleTimeout time.Duration) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					conn.SetReadDeadline(time.Now().Add(idleTimeout))
+					line, errRead := reader.ReadString('\n')
+					if errRead != nil {
+						return
+					}
+					if strings.TrimSpace(line) == "PING" {
+						conn.Write([]byte("+PONG\r\n"))
+					} else {
+						conn.Write([]byte("-ERR unknown command\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port, func() { listener.Close() }
+}
+
+func TestTCPIdle(t *testing.T) {
+	port, stop := startIdleServer(t, 300*time.Millisecond)
+	defer stop()
+
+	run := func(args map[string]string) (map[string]string, error) {
+		args["port"] = port
+		if err := (&TCPTest{}).ValidateArguments(args); err != nil {
+			return nil, err
+		}
+		tst := test.Test{Target: "127.0.0.1", Type: "tcp", Arguments: args}
+		return (&TCPTest{}).RunTestCapture(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 100 * time.Millisecond})
+	}
+
+	// Idle for less than the server allows, but longer than the timeout
+	// of the test, which only covers the connection and the probe
+	captures, err := run(map[string]string{"idle": "200ms", "probe": `PING\r\n`, "expect": `^\+PONG`})
+	if err != nil {
+		t.Errorf("expected the connection to survive, got: %s", err)
+	}
+	if survived, _ := time.ParseDuration(captures["idle_survived"]); survived < 200*time.Millisecond {
+		t.Errorf("expected the idle duration to be reported, got %v", captures)
+	}
+
+	// Any answer will do without expect
+	if _, err = run(map[string]string{"idle": "100ms", "probe": `QUIT\n`}); err != nil {
+		t.Errorf("expected any answer to pass, got: %s", err)
+	}
+
+	if _, err = run(map[string]string{"idle": "100ms", "probe": `QUIT\n`, "expect": `^\+PONG`}); err == nil || !strings.Contains(err.Error(), `the answer '"-ERR unknown command\r\n"' to the probe after 100ms idle didn't match`) {
+		t.Errorf("expected an unexpected answer to fail, got: %v", err)
+	}
+
+	// Idle for longer than the server allows
+	start := time.Now()
+	captures, err = run(map[string]string{"idle": "2s", "probe": `PING\r\n`})
+	if err == nil || !strings.Contains(err.Error(), "the connection was closed after") || !strings.Contains(err.Error(), "idle, before 2s") {
+		t.Errorf("expected the connection to be closed while idle, got: %v", err)
+	}
+	survived, _ := time.ParseDuration(captures["idle_survived"])
+	if survived < 250*time.Millisecond || survived > time.Second {
+		t.Errorf("expected the connection to survive about 300ms, got %v", captures)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the closed connection to be noticed at once, took %s", elapsed)
+	}
+
+	// The options are validated together
+	for _, args := range []map[string]string{
+		{"idle": "1s"},
+		{"probe": "PING"},
+		{"idle": "1s", "probe": "PING", "samples": "3"},
+	} {
+		if err = (&TCPTest{}).ValidateArguments(args); err == nil {
+			t.Errorf("expected %v to be rejected", args)
+		}
+	}
+}
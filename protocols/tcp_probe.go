@@ -16,23 +16,62 @@
 //
 //    host.example.com must run tcp with port 655 with banner '0 \S+ 17'
 //
+// To monitor the quality of the network, you can instead open a number of
+// connections in a row, and fail if their connect times vary too much,
+// either via their standard deviation, or their jitter (the mean difference
+// between consecutive connect times):
+//
+//    host.example.com must run tcp with port 443 with samples 10 with max-stddev 20ms with max-jitter 10ms
+//
+// All the samples must complete within the timeout of the test.
+//
+// For dual-stack targets, you can race IPv4 and IPv6 connections like
+// clients implementing "happy eyeballs" (RFC 8305) do, giving IPv6 a head
+// start of 250ms, which can be changed with `attempt-delay`:
+//
+//    host.example.com must run tcp with port 443 with happy-eyeballs true with max-targets 1
+//
+// The test passes if any family connects, and the winning family, along
+// with the connect time of each family, are reported in the captures of
+// the result. The race involves the addresses of the hostname, so run it
+// against a single target with `max-targets 1`.
+//
+// For long-lived connections, you can check they survive being idle, e.g.
+// through firewalls or NATs with aggressive timeouts: the connection is
+// held idle for the given duration, after which the probe is sent, and
+// an answer, optionally matching a regular expression, is expected:
+//
+//    host.example.com must run tcp with port 6379 with idle 10m with probe 'PING\r\n' with expect '^\+PONG'
+//
+// The idle duration comes on top of the timeout of the test, which covers
+// the connection and the answer to the probe. How long the connection
+// survived is reported in the captures of the result.
+//
 
 package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cmaster11/overseer/test"
 )
 
 // TCPTest is our object
 type TCPTest struct {
+	// Opens a connection, replaceable for testing
+	dial func(network, address string, timeout time.Duration) (net.Conn, error)
+
+	// Resolves hostnames, replaceable for testing
+	lookupIP func(host string) ([]net.IP, error)
 }
 
 // Arguments returns the names of arguments which this protocol-test
@@ -40,12 +79,61 @@ type TCPTest struct {
 // their values.
 func (s *TCPTest) Arguments() map[string]string {
 	known := map[string]string{
-		"port":   "^[0-9]+$",
-		"banner": ".*",
+		"port":       "^[0-9]+$",
+		"banner":     ".*",
+		"samples":    "^[0-9]+$",
+		"max-stddev": `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
+		"max-jitter": `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
+
+		"happy-eyeballs": "^(true|false)$",
+		"attempt-delay":  `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
+
+		"idle":   `^[+]?([0-9]*(\.[0-9]*)?[a-z]+)+$`,
+		"probe":  ".+",
+		"expect": ".*",
 	}
 	return known
 }
 
+// ValidateArguments ensures the latency thresholds are only used along
+// with samples, and that the sampling, happy-eyeballs and idle modes are
+// not combined with other checks.
+func (s *TCPTest) ValidateArguments(args map[string]string) error {
+	if args["idle"] != "" {
+		if args["probe"] == "" {
+			return errors.New("idle requires a probe to send after the idle period")
+		}
+		if args["samples"] != "" || args["banner"] != "" || args["happy-eyeballs"] == "true" {
+			return errors.New("idle can't be used along with samples, banner or happy-eyeballs")
+		}
+	} else if args["probe"] != "" || args["expect"] != "" {
+		return errors.New("probe and expect require idle")
+	}
+
+	if args["happy-eyeballs"] == "true" {
+		if args["samples"] != "" || args["banner"] != "" {
+			return errors.New("happy-eyeballs can't be used along with samples or banner")
+		}
+	} else if args["attempt-delay"] != "" {
+		return errors.New("attempt-delay requires happy-eyeballs")
+	}
+
+	if args["samples"] == "" {
+		if args["max-stddev"] != "" || args["max-jitter"] != "" {
+			return errors.New("max-stddev and max-jitter require samples")
+		}
+		return nil
+	}
+
+	if samples, err := strconv.Atoi(args["samples"]); err != nil || samples < 2 {
+		return errors.New("samples must be at least 2")
+	}
+	if args["banner"] != "" {
+		return errors.New("banner can't be used along with samples")
+	}
+	return nil
+}
+
 // ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
 func (s *TCPTest) ShouldResolveHostname() bool {
 	return true
@@ -71,6 +159,37 @@ TCP Tester
  banner the remote host sends on connection:
 
     host.example.com must run tcp with port 655 with banner '0 \S+ 17'
+
+ To monitor the quality of the network, you can instead open a number of
+ connections in a row, and fail if their connect times vary too much,
+ either via their standard deviation, or their jitter (the mean difference
+ between consecutive connect times):
+
+    host.example.com must run tcp with port 443 with samples 10 with max-stddev 20ms with max-jitter 10ms
+
+ All the samples must complete within the timeout of the test.
+
+ For dual-stack targets, you can race IPv4 and IPv6 connections like
+ clients implementing "happy eyeballs" (RFC 8305) do, giving IPv6 a head
+ start of 250ms, which can be changed with 'attempt-delay':
+
+    host.example.com must run tcp with port 443 with happy-eyeballs true with max-targets 1
+
+ The test passes if any family connects, and the winning family, along
+ with the connect time of each family, are reported in the captures of
+ the result. The race involves the addresses of the hostname, so run it
+ against a single target with 'max-targets 1'.
+
+ For long-lived connections, you can check they survive being idle, e.g.
+ through firewalls or NATs with aggressive timeouts: the connection is
+ held idle for the given duration, after which the probe is sent, and
+ an answer, optionally matching a regular expression, is expected:
+
+    host.example.com must run tcp with port 6379 with idle 10m with probe 'PING\r\n' with expect '^\+PONG'
+
+ The idle duration comes on top of the timeout of the test, which covers
+ the connection and the answer to the probe. How long the connection
+ survived is reported in the captures of the result.
 `
 	return str
 }
@@ -80,7 +199,27 @@ TCP Tester
 //
 // In this case we make a TCP connection to the specified port, and assume
 // that everything is OK if that succeeded.
-func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *TCPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	_, err := s.RunTestCapture(ctx, tst, target, opts)
+	return err
+}
+
+// RunTestCapture behaves like RunTest, but also returns the outcome of the
+// race in happy-eyeballs mode, or how long the connection survived in idle
+// mode.
+func (s *TCPTest) RunTestCapture(ctx context.Context, tst test.Test, target string, opts test.Options) (map[string]string, error) {
+	if tst.Arguments["happy-eyeballs"] == "true" {
+		return s.happyEyeballs(ctx, tst, opts)
+	}
+	if tst.Arguments["idle"] != "" {
+		return s.idle(ctx, tst, target, opts)
+	}
+	return nil, s.run(ctx, tst, target, opts)
+}
+
+// run connects to the target, and optionally checks its banner, or the
+// distribution of its connect times.
+func (s *TCPTest) run(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -108,7 +247,7 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -122,10 +261,14 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 		address = fmt.Sprintf("[%s]:%d", target, port)
 	}
 
+	if tst.Arguments["samples"] != "" {
+		return s.sampleLatency(ctx, tst, address, opts)
+	}
+
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
@@ -162,6 +305,223 @@ func (s *TCPTest) RunTest(tst test.Test, target string, opts test.Options) error
 	return nil
 }
 
+// sampleLatency opens the requested number of connections, and checks
+// the distribution of their connect times.
+func (s *TCPTest) sampleLatency(ctx context.Context, tst test.Test, address string, opts test.Options) error {
+	samples, err := strconv.Atoi(tst.Arguments["samples"])
+	if err != nil {
+		return err
+	}
+
+	var maxStddev, maxJitter time.Duration
+	if tst.Arguments["max-stddev"] != "" {
+		if maxStddev, err = time.ParseDuration(tst.Arguments["max-stddev"]); err != nil {
+			return err
+		}
+	}
+	if tst.Arguments["max-jitter"] != "" {
+		if maxJitter, err = time.ParseDuration(tst.Arguments["max-jitter"]); err != nil {
+			return err
+		}
+	}
+
+	dial := s.dialer(ctx, opts)
+
+	//
+	// The timeout is the budget of all the samples, not of each one.
+	//
+	deadline := time.Now().Add(opts.Timeout)
+
+	var durations []time.Duration
+	for i := 0; i < samples; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timeout exceeded after %d of %d samples", i, samples)
+		}
+
+		start := time.Now()
+		conn, errDial := dial("tcp", address, remaining)
+		if errDial != nil {
+			return fmt.Errorf("sample %d of %d failed: %s", i+1, samples, errDial)
+		}
+		durations = append(durations, time.Since(start))
+		conn.Close()
+	}
+
+	mean, stddev, jitter := latencyStats(durations)
+
+	if opts.Verbose {
+		fmt.Printf("Connect time over %d samples: mean %s, stddev %s, jitter %s\n", samples, mean, stddev, jitter)
+	}
+
+	if maxStddev > 0 && stddev > maxStddev {
+		return fmt.Errorf("connect time stddev %s exceeds %s (mean %s over %d samples)", stddev, maxStddev, mean, samples)
+	}
+	if maxJitter > 0 && jitter > maxJitter {
+		return fmt.Errorf("connect time jitter %s exceeds %s (mean %s, stddev %s over %d samples)", jitter, maxJitter, mean, stddev, samples)
+	}
+
+	return nil
+}
+
+// dialer returns the function opening the connections of the samples and
+// of the happy-eyeballs race, which are aborted along with the context.
+func (s *TCPTest) dialer(ctx context.Context, opts test.Options) func(network, address string, timeout time.Duration) (net.Conn, error) {
+	if s.dial != nil {
+		return s.dial
+	}
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return newDialer(opts).DialContext(ctx, network, address)
+	}
+}
+
+// latencyStats returns the mean, the standard deviation, and the jitter
+// (mean absolute difference between consecutive values) of the durations.
+func latencyStats(durations []time.Duration) (time.Duration, time.Duration, time.Duration) {
+	if len(durations) == 0 {
+		return 0, 0, 0
+	}
+
+	var sum float64
+	for _, d := range durations {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(durations))
+
+	var variance, jitter float64
+	for i, d := range durations {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+		if i > 0 {
+			jitter += math.Abs(float64(d - durations[i-1]))
+		}
+	}
+	variance /= float64(len(durations))
+	if len(durations) > 1 {
+		jitter /= float64(len(durations) - 1)
+	}
+
+	return time.Duration(mean), time.Duration(math.Sqrt(variance)), time.Duration(jitter)
+}
+
+// happyEyeballsAttempt is the outcome of the connection of a family.
+type happyEyeballsAttempt struct {
+	family   string
+	duration time.Duration
+	err      error
+}
+
+// happyEyeballs races a connection to the first IPv6 address of the target
+// with one to its first IPv4 address, started after the attempt delay, or
+// as soon as the IPv6 one fails.
+func (s *TCPTest) happyEyeballs(ctx context.Context, tst test.Test, opts test.Options) (map[string]string, error) {
+	if tst.Arguments["port"] == "" {
+		return nil, errors.New("you must specify the port when running a TCP test")
+	}
+
+	attemptDelay := 250 * time.Millisecond
+	if tst.Arguments["attempt-delay"] != "" {
+		var err error
+		if attemptDelay, err = time.ParseDuration(tst.Arguments["attempt-delay"]); err != nil {
+			return nil, err
+		}
+	}
+
+	lookupIP := s.lookupIP
+	if lookupIP == nil {
+		lookupIP = net.LookupIP
+	}
+	dial := s.dialer(ctx, opts)
+
+	ips, err := lookupIP(tst.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	var ipv4, ipv6 net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = ip
+			}
+		} else if ipv6 == nil {
+			ipv6 = ip
+		}
+	}
+	if ipv4 == nil || ipv6 == nil {
+		return nil, fmt.Errorf("happy-eyeballs requires a dual-stack target, %s has IPv4 %v and IPv6 %v", tst.Target, ipv4 != nil, ipv6 != nil)
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	attempts := make(chan happyEyeballsAttempt, 2)
+	ipv6Failed := make(chan struct{})
+
+	connect := func(family string, ip net.IP) happyEyeballsAttempt {
+		start := time.Now()
+		conn, errDial := dial("tcp", net.JoinHostPort(ip.String(), tst.Arguments["port"]), time.Until(deadline))
+		if errDial == nil {
+			conn.Close()
+		}
+		return happyEyeballsAttempt{family: family, duration: time.Since(start), err: errDial}
+	}
+
+	go func() {
+		attempt := connect("ipv6", ipv6)
+		if attempt.err != nil {
+			close(ipv6Failed)
+		}
+		attempts <- attempt
+	}()
+	go func() {
+		select {
+		case <-time.After(attemptDelay):
+		case <-ipv6Failed:
+		case <-ctx.Done():
+		}
+		attempts <- connect("ipv4", ipv4)
+	}()
+
+	//
+	// The winner is the first family to connect, but we wait for the
+	// other one too, to compare their connect times.
+	//
+	results := map[string]happyEyeballsAttempt{}
+	winner := ""
+	for i := 0; i < 2; i++ {
+		attempt := <-attempts
+		results[attempt.family] = attempt
+		if winner == "" && attempt.err == nil {
+			winner = attempt.family
+		}
+	}
+
+	if winner == "" {
+		return nil, fmt.Errorf("both families failed to connect, ipv6: %s, ipv4: %s", results["ipv6"].err, results["ipv4"].err)
+	}
+
+	captures := map[string]string{"winner": winner}
+	for _, family := range []string{"ipv6", "ipv4"} {
+		if results[family].err != nil {
+			captures[family+"_connect"] = "failed"
+		} else {
+			captures[family+"_connect"] = results[family].duration.Round(time.Microsecond).String()
+		}
+	}
+	if results["ipv4"].err == nil && results["ipv6"].err == nil {
+		captures["connect_delta"] = (results["ipv4"].duration - results["ipv6"].duration).Round(time.Microsecond).String()
+	}
+
+	if opts.Verbose {
+		fmt.Printf("Happy eyeballs winner %s, ipv6 connect %s, ipv4 connect %s\n", winner, captures["ipv6_connect"], captures["ipv4_connect"])
+	}
+
+	return captures, nil
+}
+
 func (s *TCPTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
 	return nil
 }
@@ -0,0 +1,193 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// delayedDial returns a dial function whose connections take the given
+// durations, in turn, to be established.
+func delayedDial(delays ...time.Duration) func(network, address string, timeout time.Duration) (net.Conn, error) {
+	i := 0
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		delay := delays[i%len(delays)]
+		i++
+		if delay > timeout {
+			time.Sleep(timeout)
+			return nil, &net.OpError{Op: "dial", Net: network, Err: errTimeout{}}
+		}
+		time.Sleep(delay)
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+}
+
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
+
+func TestTCPLatencySamples(t *testing.T) {
+	run := func(dial func(string, string, time.Duration) (net.Conn, error), timeout time.Duration, args map[string]string) error {
+		args["port"] = "443"
+		tst := test.Test{Target: "127.0.0.1", Type: "tcp", Arguments: args}
+		return (&TCPTest{dial: dial}).RunTest(context.Background(), tst, "127.0.0.1", test.Options{Timeout: timeout})
+	}
+
+	stable := delayedDial(20 * time.Millisecond)
+	if err := run(stable, 5*time.Second, map[string]string{"samples": "5", "max-stddev": "15ms", "max-jitter": "15ms"}); err != nil {
+		t.Errorf("expected stable latencies to pass: %s", err)
+	}
+
+	unstable := delayedDial(5*time.Millisecond, 100*time.Millisecond)
+	err := run(unstable, 5*time.Second, map[string]string{"samples": "6", "max-jitter": "30ms"})
+	if err == nil || !strings.Contains(err.Error(), "jitter") {
+		t.Errorf("expected unstable latencies to exceed the jitter, got: %v", err)
+	}
+	err = run(unstable, 5*time.Second, map[string]string{"samples": "6", "max-stddev": "30ms"})
+	if err == nil || !strings.Contains(err.Error(), "stddev") {
+		t.Errorf("expected unstable latencies to exceed the stddev, got: %v", err)
+	}
+
+	// The timeout bounds all the samples, not each one of them
+	slow := delayedDial(100 * time.Millisecond)
+	start := time.Now()
+	if err = run(slow, 250*time.Millisecond, map[string]string{"samples": "10"}); err == nil {
+		t.Errorf("expected the samples to exceed the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the samples to be bounded by the timeout, took %s", elapsed)
+	}
+}
+
+func TestLatencyStats(t *testing.T) {
+	mean, stddev, jitter := latencyStats([]time.Duration{10 * time.Millisecond, 30 * time.Millisecond, 10 * time.Millisecond, 30 * time.Millisecond})
+
+	if mean != 20*time.Millisecond {
+		t.Errorf("unexpected mean %s", mean)
+	}
+	if stddev != 10*time.Millisecond {
+		t.Errorf("unexpected stddev %s", stddev)
+	}
+	if jitter != 20*time.Millisecond {
+		t.Errorf("unexpected jitter %s", jitter)
+	}
+}
+
+func TestTCPValidateArguments(t *testing.T) {
+	s := &TCPTest{}
+
+	if err := s.ValidateArguments(map[string]string{"port": "443", "samples": "5", "max-jitter": "10ms"}); err != nil {
+		t.Errorf("expected valid arguments, got %s", err)
+	}
+	if err := s.ValidateArguments(map[string]string{"port": "443", "max-jitter": "10ms"}); err == nil {
+		t.Errorf("expected max-jitter without samples to be rejected")
+	}
+	if err := s.ValidateArguments(map[string]string{"port": "443", "samples": "1"}); err == nil {
+		t.Errorf("expected a single sample to be rejected")
+	}
+	if err := s.ValidateArguments(map[string]string{"port": "443", "samples": "5", "banner": "SSH"}); err == nil {
+		t.Errorf("expected banner with samples to be rejected")
+	}
+}
+
+// dualStack returns a resolver answering with an IPv4 and an IPv6 address.
+func dualStack(host string) ([]net.IP, error) {
+	return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}, nil
+}
+
+func TestTCPHappyEyeballs(t *testing.T) {
+	listener4, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener4.Close()
+	port := strconv.Itoa(listener4.Addr().(*net.TCPAddr).Port)
+
+	listener6, err := net.Listen("tcp6", net.JoinHostPort("::1", port))
+	if err != nil {
+		t.Skipf("IPv6 is not available: %s", err)
+	}
+	defer listener6.Close()
+
+	tst := test.Test{Target: "dual.example.com", Type: "tcp", Arguments: map[string]string{"port": port, "happy-eyeballs": "true"}}
+	captures, err := (&TCPTest{lookupIP: dualStack}).RunTestCapture(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("expected the race to succeed: %s", err)
+	}
+
+	// With a head start on a local server, IPv6 must win
+	if captures["winner"] != "ipv6" {
+		t.Errorf("expected ipv6 to win, got %v", captures)
+	}
+	if captures["ipv4_connect"] == "" || captures["ipv4_connect"] == "failed" || captures["connect_delta"] == "" {
+		t.Errorf("expected both connect times to be reported, got %v", captures)
+	}
+}
+
+func TestTCPHappyEyeballsRace(t *testing.T) {
+	// IPv6 is slower than the head start, plus the IPv4 connect time
+	dial := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		if strings.HasPrefix(address, "[") {
+			time.Sleep(300 * time.Millisecond)
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	run := func(dial func(string, string, time.Duration) (net.Conn, error), args map[string]string) (map[string]string, error) {
+		args["port"] = "443"
+		args["happy-eyeballs"] = "true"
+		tst := test.Test{Target: "dual.example.com", Type: "tcp", Arguments: args}
+		return (&TCPTest{dial: dial, lookupIP: dualStack}).RunTestCapture(context.Background(), tst, "127.0.0.1", test.Options{Timeout: 5 * time.Second})
+	}
+
+	captures, err := run(dial, map[string]string{"attempt-delay": "50ms"})
+	if err != nil {
+		t.Fatalf("expected the race to succeed: %s", err)
+	}
+	if captures["winner"] != "ipv4" {
+		t.Errorf("expected ipv4 to win, got %v", captures)
+	}
+	if !strings.HasPrefix(captures["connect_delta"], "-") {
+		t.Errorf("expected ipv4 to connect faster, got %v", captures)
+	}
+
+	// A failing IPv6 connection doesn't wait for the attempt delay
+	failing6 := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		if strings.HasPrefix(address, "[") {
+			return nil, errors.New("network unreachable")
+		}
+		return dial(network, address, timeout)
+	}
+	start := time.Now()
+	captures, err = run(failing6, map[string]string{"attempt-delay": "2s"})
+	if err != nil {
+		t.Fatalf("expected ipv4 to connect: %s", err)
+	}
+	if captures["winner"] != "ipv4" || captures["ipv6_connect"] != "failed" {
+		t.Errorf("expected ipv4 to win over a failed ipv6, got %v", captures)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected ipv4 to start as soon as ipv6 failed, took %s", elapsed)
+	}
+
+	// A single-stack target can't race
+	_, err = (&TCPTest{lookupIP: func(string) ([]net.IP, error) { return []net.IP{net.ParseIP("127.0.0.1")}, nil }}).RunTestCapture(context.Background(), 
+		test.Test{Target: "v4.example.com", Arguments: map[string]string{"port": "443", "happy-eyeballs": "true"}}, "127.0.0.1", test.Options{Timeout: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "dual-stack") {
+		t.Errorf("expected a single-stack target to fail, got %v", err)
+	}
+}
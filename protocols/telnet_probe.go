@@ -10,8 +10,8 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -56,7 +56,7 @@ Telnet Tester
 //
 // In this case we make a TCP connection to the specified port, and assume
 // that everything is OK if that succeeded.
-func (s *TELNETTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *TELNETTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -77,7 +77,7 @@ func (s *TELNETTest) RunTest(tst test.Test, target string, opts test.Options) er
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -94,7 +94,7 @@ func (s *TELNETTest) RunTest(tst test.Test, target string, opts test.Options) er
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,18 @@
+package protocols
+
+import (
+	"crypto/x509"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/cmaster11/overseer/utils"
+)
+
+// rootCAs returns the certificate authorities a TLS-capable tester should
+// trust: the ones of the test `ca` argument if present, otherwise the
+// worker-wide ones. A nil pool means the system ones.
+func rootCAs(tst test.Test, opts test.Options) (*x509.CertPool, error) {
+	if tst.CAFile != nil {
+		return utils.LoadCertPool(*tst.CAFile)
+	}
+	return opts.RootCAs, nil
+}
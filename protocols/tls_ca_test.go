@@ -0,0 +1,64 @@
+package protocols
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/cmaster11/overseer/utils"
+)
+
+func TestCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The stub server certificate is signed by its own authority
+	bundle, err := ioutil.TempFile("", "overseer-ca")
+	if err != nil {
+		t.Fatalf("failed to create the bundle: %s", err)
+	}
+	defer os.Remove(bundle.Name())
+	pem.Encode(bundle, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	bundle.Close()
+
+	u, _ := url.Parse(server.URL)
+	run := func(caFile *string, opts test.Options) error {
+		opts.Timeout = 5 * time.Second
+		tst := test.Test{
+			Target:    server.URL,
+			Type:      "http",
+			Arguments: map[string]string{"expiration": "any"},
+			CAFile:    caFile,
+		}
+		return (&HTTPTest{}).RunTest(context.Background(), tst, u.Hostname(), opts)
+	}
+
+	if err = run(nil, test.Options{}); err == nil {
+		t.Errorf("expected the verification to fail without the bundle")
+	}
+
+	caFile := bundle.Name()
+	if err = run(&caFile, test.Options{}); err != nil {
+		t.Errorf("expected the per-test bundle to be trusted: %s", err)
+	}
+
+	roots, err := utils.LoadCertPool(bundle.Name())
+	if err != nil {
+		t.Fatalf("failed to load the bundle: %s", err)
+	}
+	if err = run(nil, test.Options{RootCAs: roots}); err != nil {
+		t.Errorf("expected the worker bundle to be trusted: %s", err)
+	}
+
+	missing := bundle.Name() + ".missing"
+	if err = run(&missing, test.Options{}); err == nil {
+		t.Errorf("expected a missing bundle to fail")
+	}
+}
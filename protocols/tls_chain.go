@@ -0,0 +1,79 @@
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// checkChainComplete connects to the address, asking for the certificate of
+// the given server name, and checks that the chain of certificates sent by
+// the server builds to a trusted root on its own.
+//
+// Browsers fetch the missing intermediates via the AIA extension of the
+// certificates, which hides incomplete chains, but most other clients
+// don't, and fail.
+func checkChainComplete(ctx context.Context, address string, serverName string, roots *x509.CertPool, opts test.Options) error {
+	var err error
+	if roots == nil {
+		roots, err = x509.SystemCertPool()
+		if err != nil {
+			return fmt.Errorf("failed to load the system authorities: %s", err.Error())
+		}
+	}
+
+	// We verify the chain ourselves, with only what the server sent.
+	conn, err := newDialer(opts).DialTLSContext(ctx, "tcp", address, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("the server sent no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(x509.UnknownAuthorityError); !ok {
+		return fmt.Errorf("failed to verify the certificate chain: %s", err.Error())
+	}
+
+	last := lastChainLink(certs)
+	if bytes.Equal(last.RawIssuer, last.RawSubject) {
+		return fmt.Errorf("the certificate chain ends with '%s', which is not a trusted authority", last.Subject.CommonName)
+	}
+	return fmt.Errorf("incomplete certificate chain: the server did not send the issuer '%s' of '%s'", last.Issuer.CommonName, last.Subject.CommonName)
+}
+
+// lastChainLink follows the chain sent by the server, from its leaf, up to
+// the first certificate whose issuer was not sent.
+func lastChainLink(certs []*x509.Certificate) *x509.Certificate {
+	cert := certs[0]
+	for i := 1; i < len(certs); i++ {
+		var issuer *x509.Certificate
+		for _, candidate := range certs[1:] {
+			if candidate != cert && bytes.Equal(candidate.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(candidate) == nil {
+				issuer = candidate
+				break
+			}
+		}
+		if issuer == nil {
+			break
+		}
+		cert = issuer
+	}
+	return cert
+}
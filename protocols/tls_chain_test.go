@@ -0,0 +1,144 @@
+package protocols
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// issueCertificate creates a certificate for the given name, signed by the
+// given parent, or self-signed if there is none.
+func issueCertificate(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+	}
+	if !ca {
+		template.DNSNames = []string{name}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create the certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse the certificate: %s", err)
+	}
+	return cert, key
+}
+
+// chainServer starts a TLS server sending the given chain.
+func chainServer(chain []*x509.Certificate, key *ecdsa.PrivateKey) *httptest.Server {
+	certificate := tls.Certificate{PrivateKey: key, Leaf: chain[0]}
+	for _, cert := range chain {
+		certificate.Certificate = append(certificate.Certificate, cert.Raw)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	server.StartTLS()
+	return server
+}
+
+func TestChainComplete(t *testing.T) {
+	root, rootKey := issueCertificate(t, "Overseer Root", true, nil, nil)
+	intermediate, intermediateKey := issueCertificate(t, "Overseer Intermediate", true, root, rootKey)
+	leaf, leafKey := issueCertificate(t, "localhost", false, intermediate, intermediateKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	opts := test.Options{Timeout: 5 * time.Second, RootCAs: roots}
+
+	complete := chainServer([]*x509.Certificate{leaf, intermediate}, leafKey)
+	defer complete.Close()
+	incomplete := chainServer([]*x509.Certificate{leaf}, leafKey)
+	defer incomplete.Close()
+
+	runSSL := func(server *httptest.Server, opts test.Options) error {
+		u, _ := url.Parse(server.URL)
+		tst := test.Test{Target: u.Host, Type: "ssl", Arguments: map[string]string{"chain-complete": "true"}}
+		return (&SSLTest{}).RunTest(context.Background(), tst, u.Hostname(), opts)
+	}
+	runHTTP := func(server *httptest.Server) error {
+		u, _ := url.Parse(server.URL)
+		tst := test.Test{Target: server.URL, Type: "http", Arguments: map[string]string{"chain-complete": "true", "expiration": "any"}}
+		return (&HTTPTest{}).RunTest(context.Background(), tst, u.Hostname(), opts)
+	}
+
+	if err := runSSL(complete, opts); err != nil {
+		t.Errorf("expected the complete chain to pass, got: %s", err)
+	}
+	if err := runHTTP(complete); err != nil {
+		t.Errorf("expected the complete chain to pass over HTTP, got: %s", err)
+	}
+
+	missing := "the server did not send the issuer 'Overseer Intermediate' of 'localhost'"
+	if err := runSSL(incomplete, opts); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("expected the missing intermediate to be reported, got: %v", err)
+	}
+	if err := runHTTP(incomplete); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("expected the missing intermediate to be reported over HTTP, got: %v", err)
+	}
+
+	// A complete chain still needs a trusted root
+	if err := runSSL(complete, test.Options{Timeout: 5 * time.Second, RootCAs: x509.NewCertPool()}); err == nil || !strings.Contains(err.Error(), "the server did not send the issuer 'Overseer Root' of 'Overseer Intermediate'") {
+		t.Errorf("expected the untrusted root to be reported, got: %v", err)
+	}
+}
+
+func TestChainCompleteTimeout(t *testing.T) {
+	// A server which never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	err = checkChainComplete(context.Background(), listener.Addr().String(), "localhost", x509.NewCertPool(), test.Options{Timeout: 200 * time.Millisecond})
+	if err == nil {
+		t.Errorf("expected the handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the timeout to be honored, took %s", elapsed)
+	}
+}
@@ -0,0 +1,104 @@
+package protocols
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestCertPin(t *testing.T) {
+	root, rootKey := issueCertificate(t, "Overseer Root", true, nil, nil)
+	leaf, leafKey := issueCertificate(t, "localhost", false, root, rootKey)
+	// An unexpected certificate for the same name, e.g. of a MITM
+	other, _ := issueCertificate(t, "localhost", false, root, rootKey)
+
+	server := chainServer([]*x509.Certificate{leaf}, leafKey)
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	opts := test.Options{Timeout: 5 * time.Second, RootCAs: roots}
+
+	u, _ := url.Parse(server.URL)
+	runSSL := func(pin string) (map[string]interface{}, error) {
+		tst := test.Test{Target: u.Host, Type: "ssl", Arguments: map[string]string{"cert-pin": pin}}
+		return (&SSLTest{}).RunTestDetailed(context.Background(), tst, u.Hostname(), opts)
+	}
+	runHTTP := func(pin string) (map[string]interface{}, error) {
+		tst := test.Test{Target: server.URL, Type: "http", Arguments: map[string]string{"cert-pin": pin}}
+		return (&HTTPTest{}).RunTestDetailed(context.Background(), tst, u.Hostname(), opts)
+	}
+
+	fingerprint := certFingerprint(leaf)
+	for _, pin := range []string{
+		fingerprint,
+		strings.ToLower(strings.Replace(fingerprint, ":", "", -1)),
+		publicKeyPin(leaf),
+	} {
+		if !regexp.MustCompile(certPinPattern).MatchString(pin) {
+			t.Errorf("expected %s to be a valid pin", pin)
+		}
+
+		details, err := runSSL(pin)
+		if err != nil {
+			t.Errorf("expected the pin %s to match, got: %s", pin, err)
+		}
+		if details["fingerprint"] != fingerprint {
+			t.Errorf("expected the observed fingerprint in the details, got %v", details)
+		}
+
+		if details, err = runHTTP(pin); err != nil || details["fingerprint"] != fingerprint {
+			t.Errorf("expected the pin %s to match over HTTP, got: %v (%v)", pin, err, details)
+		}
+	}
+
+	details, err := runSSL(certFingerprint(other))
+	if err == nil || !strings.Contains(err.Error(), "the certificate fingerprint "+fingerprint+" doesn't match the pinned") {
+		t.Errorf("expected another certificate to be reported, got: %v", err)
+	}
+	if details["fingerprint"] != fingerprint {
+		t.Errorf("expected the observed fingerprint in the details of the failure, got %v", details)
+	}
+
+	details, err = runHTTP(publicKeyPin(other))
+	if err == nil || !strings.Contains(err.Error(), "pinned as "+publicKeyPin(leaf)+", doesn't match the pin") {
+		t.Errorf("expected another public key to be reported over HTTP, got: %v", err)
+	}
+	if details["fingerprint"] != fingerprint {
+		t.Errorf("expected the observed fingerprint in the details of the failure, got %v", details)
+	}
+}
+
+func TestCertPinTimeout(t *testing.T) {
+	// A server which never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = checkCertPin(context.Background(), listener.Addr().String(), "localhost", "sha256/x4QzPSC810K5/cMjb05Qm4k3Bw5zBn4lTdO/nEW/Td4=", test.Options{Timeout: 200 * time.Millisecond})
+	if err == nil {
+		t.Errorf("expected the handshake to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the timeout to be honored, took %s", elapsed)
+	}
+}
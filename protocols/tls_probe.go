@@ -0,0 +1,180 @@
+// TLS Tester
+//
+// The TLS tester connects to a remote server, performs a TLS handshake,
+// and fails if the certificate it sends is invalid, or expires soon.
+//
+// This test is invoked via input like so:
+//
+//    www.example.com must run tls
+//
+// By default the server is reached on port 443, and the test fails if the
+// certificate expires within the next 14 days. Both can be changed, the
+// window being given as a duration, e.g. 336h:
+//
+//    www.example.com must run tls with port 8443 with expires-within 720h
+//
+// Virtual hosts sharing an address are told apart via the server name of
+// the handshake (SNI), which is the target by default. To check another
+// name use:
+//
+//    10.0.0.1 must run tls with host www.example.com
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// TLSTest is our object.
+type TLSTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *TLSTest) Arguments() map[string]string {
+	known := map[string]string{
+		"port":           "^[0-9]+$",
+		"expires-within": `^([0-9]+(\.[0-9]+)?(ns|us|ms|s|m|h))+$`,
+		"host":           `^[a-zA-Z0-9.\-]+$`,
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *TLSTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *TLSTest) Example() string {
+	str := `
+TLS Tester
+----------
+ The TLS tester connects to a remote server, performs a TLS handshake,
+ and fails if the certificate it sends is invalid, or expires soon.
+
+ This test is invoked via input like so:
+
+    www.example.com must run tls with expires-within 720h
+
+ By default the server is reached on port 443, and the test fails if the
+ certificate expires within the next 14 days. Both can be changed, the
+ window being given as a duration, e.g. 336h:
+
+    www.example.com must run tls with port 8443 with expires-within 720h
+
+ Virtual hosts sharing an address are told apart via the server name of
+ the handshake (SNI), which is the target by default. To check another
+ name use:
+
+    10.0.0.1 must run tls with host www.example.com
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we perform a TLS handshake, then check the expiration of
+// the leaf certificate, and its validity for the server name.
+func (s *TLSTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	var err error
+
+	port := 443
+	if tst.Arguments["port"] != "" {
+		port, err = strconv.Atoi(tst.Arguments["port"])
+		if err != nil {
+			return err
+		}
+	}
+
+	window := 14 * 24 * time.Hour
+	if tst.Arguments["expires-within"] != "" {
+		window, err = time.ParseDuration(tst.Arguments["expires-within"])
+		if err != nil {
+			return err
+		}
+	}
+
+	serverName := tst.Target
+	if tst.Arguments["host"] != "" {
+		serverName = tst.Arguments["host"]
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(target, strconv.Itoa(port))
+	raw, err := newDialer(opts).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer raw.Close()
+	if err = raw.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return err
+	}
+
+	//
+	// We verify the certificate ourselves, after the handshake, so that
+	// an expired certificate is reported as such.
+	//
+	conn := tls.Client(raw, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err = conn.Handshake(); err != nil {
+		return err
+	}
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("the server sent no certificate")
+	}
+	leaf := certs[0]
+
+	if opts.Verbose {
+		fmt.Printf("TLS certificate of %s: %s, expires %s\n", address, leaf.Subject.CommonName, leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+
+	remaining := time.Until(leaf.NotAfter)
+	if remaining <= 0 {
+		return fmt.Errorf("the certificate of %s expired on %s", serverName, leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	if remaining < window {
+		return fmt.Errorf("the certificate of %s expires in %d hours (%d days), within %s", serverName, int64(remaining.Hours()), int64(remaining.Hours()/24), window)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates})
+	if err != nil {
+		return fmt.Errorf("failed to verify the certificate of %s: %s", serverName, err.Error())
+	}
+
+	return nil
+}
+
+func (s *TLSTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("tls", func() ProtocolTest {
+		return &TLSTest{}
+	})
+}
@@ -0,0 +1,122 @@
+package protocols
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// expiringServer starts a TLS server sending a self-signed certificate for
+// 127.0.0.1, which expires at the given time.
+func expiringServer(t *testing.T, notAfter time.Time) *httptest.Server {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate the key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create the certificate: %s", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	server.StartTLS()
+	return server
+}
+
+// runTLS runs the tls test against the server, trusting its certificate.
+func runTLS(server *httptest.Server, args map[string]string) error {
+	u, _ := url.Parse(server.URL)
+	args["port"] = u.Port()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	tst := test.Test{Target: u.Hostname(), Type: "tls", Arguments: args}
+	return (&TLSTest{}).RunTest(context.Background(), tst, u.Hostname(), test.Options{Timeout: 5 * time.Second, RootCAs: roots})
+}
+
+func TestTLS(t *testing.T) {
+	// The certificate of httptest expires far in the future
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if err := runTLS(server, map[string]string{}); err != nil {
+		t.Errorf("expected a far-future certificate to pass, got: %s", err)
+	}
+	if err := runTLS(server, map[string]string{"expires-within": "720h"}); err != nil {
+		t.Errorf("expected a far-future certificate to pass, got: %s", err)
+	}
+
+	// The certificate is for example.com, so it can be checked via SNI
+	if err := runTLS(server, map[string]string{"host": "example.com"}); err != nil {
+		t.Errorf("expected the certificate to be valid for example.com, got: %s", err)
+	}
+	err := runTLS(server, map[string]string{"host": "www.example.org"})
+	if err == nil || !strings.Contains(err.Error(), "failed to verify the certificate of www.example.org") {
+		t.Errorf("expected the certificate to be invalid for www.example.org, got: %v", err)
+	}
+}
+
+func TestTLSExpiration(t *testing.T) {
+	expired := expiringServer(t, time.Now().Add(-time.Hour))
+	defer expired.Close()
+
+	err := runTLS(expired, map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "the certificate of 127.0.0.1 expired on") {
+		t.Errorf("expected an expired certificate to fail, got: %v", err)
+	}
+
+	soon := expiringServer(t, time.Now().Add(10*24*time.Hour))
+	defer soon.Close()
+
+	err = runTLS(soon, map[string]string{})
+	if err == nil || !strings.Contains(err.Error(), "expires in 239 hours (9 days), within 336h0m0s") {
+		t.Errorf("expected a certificate expiring within the default window to fail, got: %v", err)
+	}
+	if err = runTLS(soon, map[string]string{"expires-within": "168h"}); err != nil {
+		t.Errorf("expected a certificate expiring after the window to pass, got: %s", err)
+	}
+}
+
+func TestTLSArguments(t *testing.T) {
+	window := regexp.MustCompile((&TLSTest{}).Arguments()["expires-within"])
+
+	for _, valid := range []string{"336h", "30m", "1h30m", "1.5h"} {
+		if !window.MatchString(valid) {
+			t.Errorf("expected %q to be a valid window", valid)
+		}
+	}
+	for _, invalid := range []string{"14d", "336", "h"} {
+		if window.MatchString(invalid) {
+			t.Errorf("expected %q to be an invalid window", invalid)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package protocols
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// randomToken returns a random token, e.g. to recognize a message sent by a
+// test once it is delivered.
+func randomToken() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -12,9 +12,9 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -60,7 +60,7 @@ VNC Tester
 //
 // In this case we make a TCP connection, defaulting to port 5900, and
 // look for a response which appears to be an VNC-server.
-func (s *VNCTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *VNCTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -81,7 +81,7 @@ func (s *VNCTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -98,11 +98,19 @@ func (s *VNCTest) RunTest(tst test.Test, target string, opts test.Options) error
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
+	//
+	// The whole exchange must complete within the timeout.
+	//
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
 	//
 	// Read the banner.
 	//
@@ -0,0 +1,257 @@
+// Webhook Echo Tester
+//
+// The webhook-echo tester checks that a webhook receiver is alive, and
+// that the pipeline behind it processes what it receives, by posting a
+// unique token to the receiver, and then polling a verification URL until
+// it reports the token as processed.
+//
+// This test is invoked via input like so:
+//
+//    https://hooks.example.com/incoming must run webhook-echo with verify-url 'https://api.example.com/events?token={token}'
+//
+// By default the JSON object {"token": "<token>", "source": "overseer"} is
+// posted, but another body can be given, with {token} being replaced by
+// the token, along with its content type:
+//
+//    with body 'event=ping&id={token}' with content-type application/x-www-form-urlencoded
+//
+// The verification URL, where {token} is replaced too, must answer with a
+// 2xx status code and a body containing the token. It must do so within a
+// minute, which can be changed with `delivery-deadline`:
+//
+//    with delivery-deadline 5m
+//
+// If you need to disable the validation of the certificates of both URLs
+// you can do so via `with tls insecure`.
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// webhookEchoPollInterval is how often the verification URL is polled.
+var webhookEchoPollInterval = 2 * time.Second
+
+// WebhookEchoTest is our object.
+type WebhookEchoTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *WebhookEchoTest) Arguments() map[string]string {
+	known := map[string]string{
+		"verify-url":        "^https?://.+$",
+		"body":              ".+",
+		"content-type":      `^[a-zA-Z0-9.+\-]+/[a-zA-Z0-9.+\-]+$`,
+		"delivery-deadline": `^[0-9]+(\.[0-9]+)?(s|m|h)$`,
+		"tls":               "insecure",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *WebhookEchoTest) ShouldResolveHostname() bool {
+	return false
+}
+
+// ValidateArguments checks that the target is a URL, and that the
+// verification URL is given.
+func (s *WebhookEchoTest) ValidateArguments(args map[string]string) error {
+	if args["verify-url"] == "" {
+		return errors.New("the URL verifying the delivery must be given with 'verify-url'")
+	}
+	return nil
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *WebhookEchoTest) Example() string {
+	str := `
+Webhook Echo Tester
+-------------------
+ The webhook-echo tester checks that a webhook receiver is alive, and
+ that the pipeline behind it processes what it receives, by posting a
+ unique token to the receiver, and then polling a verification URL until
+ it reports the token as processed.
+
+ This test is invoked via input like so:
+
+    https://hooks.example.com/incoming must run webhook-echo with verify-url 'https://api.example.com/events?token={token}'
+
+ By default the JSON object {"token": "<token>", "source": "overseer"} is
+ posted, but another body can be given, with {token} being replaced by
+ the token, along with its content type:
+
+    with body 'event=ping&id={token}' with content-type application/x-www-form-urlencoded
+
+ The verification URL, where {token} is replaced too, must answer with a
+ 2xx status code and a body containing the token. It must do so within a
+ minute, which can be changed with 'delivery-deadline':
+
+    with delivery-deadline 5m
+
+ If you need to disable the validation of the certificates of both URLs
+ you can do so via 'with tls insecure'.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// In this case we post the token to the webhook receiver, and wait for
+// the verification URL to report it.
+func (s *WebhookEchoTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	if !strings.HasPrefix(tst.Target, "http://") && !strings.HasPrefix(tst.Target, "https://") {
+		return fmt.Errorf("the target must be the URL of the webhook receiver, got '%s'", tst.Target)
+	}
+
+	deliveryDeadline, err := webhookDeliveryDeadline(tst)
+	if err != nil {
+		return err
+	}
+
+	roots, err := rootCAs(tst, opts)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if tst.Arguments["tls"] == "insecure" {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	body := `{"token": "{token}", "source": "overseer"}`
+	if tst.Arguments["body"] != "" {
+		body = tst.Arguments["body"]
+	}
+	contentType := "application/json"
+	if tst.Arguments["content-type"] != "" {
+		contentType = tst.Arguments["content-type"]
+	}
+
+	sent := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tst.Target, strings.NewReader(strings.Replace(body, "{token}", token, -1)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "overseer/probe")
+
+	response, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to the webhook receiver: %s", err.Error())
+	}
+	ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the webhook receiver answered with status code %d", response.StatusCode)
+	}
+
+	verifyURL := strings.Replace(tst.Arguments["verify-url"], "{token}", token, -1)
+	for {
+		processed, errVerify := s.verify(ctx, client, verifyURL, token)
+		if errVerify != nil {
+			return errVerify
+		}
+		if processed {
+			if opts.Verbose {
+				fmt.Printf("The webhook was processed in %s\n", time.Since(sent))
+			}
+			return nil
+		}
+
+		if time.Since(sent)+webhookEchoPollInterval > deliveryDeadline {
+			return fmt.Errorf("the webhook was not processed within %s", deliveryDeadline)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(webhookEchoPollInterval):
+		}
+	}
+}
+
+// MaxDuration returns how long the test may take: the delivery deadline,
+// and the timeout of the last verification.
+func (s *WebhookEchoTest) MaxDuration(tst test.Test, opts test.Options) time.Duration {
+	deliveryDeadline, err := webhookDeliveryDeadline(tst)
+	if err != nil {
+		return opts.Timeout
+	}
+	return deliveryDeadline + opts.Timeout
+}
+
+// webhookDeliveryDeadline returns how long the pipeline has to process
+// the webhook.
+func webhookDeliveryDeadline(tst test.Test) (time.Duration, error) {
+	if tst.Arguments["delivery-deadline"] == "" {
+		return time.Minute, nil
+	}
+	return time.ParseDuration(tst.Arguments["delivery-deadline"])
+}
+
+// verify returns whether the verification URL reports the token as
+// processed.
+//
+// Errors from the verification URL are failures, as they would hide the
+// processing, but 4xx status codes, e.g. 404 until the token is processed,
+// are not.
+func (s *WebhookEchoTest) verify(ctx context.Context, client *http.Client, verifyURL string, token string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, verifyURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "overseer/probe")
+
+	response, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to query the verification URL: %s", err.Error())
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 500 {
+		return false, fmt.Errorf("the verification URL answered with status code %d", response.StatusCode)
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return false, nil
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(string(body), token), nil
+}
+
+func (s *WebhookEchoTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("webhook-echo", func() ProtocolTest {
+		return &WebhookEchoTest{}
+	})
+}
@@ -0,0 +1,91 @@
+package protocols
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestWebhookEcho(t *testing.T) {
+	webhookEchoPollInterval = 10 * time.Millisecond
+
+	lock := &sync.Mutex{}
+	processed := map[string]bool{}
+	var receiverStatus int
+	var drop bool
+
+	// The receiver processes the token asynchronously
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if receiverStatus != 0 {
+			w.WriteHeader(receiverStatus)
+			return
+		}
+
+		var payload struct{ Token string }
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			json.NewDecoder(r.Body).Decode(&payload)
+		} else {
+			body, _ := ioutil.ReadAll(r.Body)
+			payload.Token = strings.TrimPrefix(string(body), "id=")
+		}
+
+		if !drop {
+			go func() {
+				time.Sleep(30 * time.Millisecond)
+				lock.Lock()
+				processed[payload.Token] = true
+				lock.Unlock()
+			}()
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer receiver.Close()
+
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		lock.Lock()
+		defer lock.Unlock()
+		if !processed[token] {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"events": ["` + token + `"]}`))
+	}))
+	defer verifier.Close()
+
+	run := func(args map[string]string) error {
+		args["verify-url"] = verifier.URL + "/events?token={token}"
+		args["delivery-deadline"] = "500ms"
+		tst := test.Test{Target: receiver.URL, Type: "webhook-echo", Arguments: args}
+		return (&WebhookEchoTest{}).RunTest(context.Background(), tst, receiver.URL, test.Options{Timeout: 5 * time.Second})
+	}
+
+	// The token is processed
+	if err := run(map[string]string{}); err != nil {
+		t.Errorf("expected the webhook to be processed, got: %s", err)
+	}
+	if err := run(map[string]string{"body": "id={token}", "content-type": "application/x-www-form-urlencoded"}); err != nil {
+		t.Errorf("expected the form webhook to be processed, got: %s", err)
+	}
+
+	// The token is received, but never processed
+	drop = true
+	if err := run(map[string]string{}); err == nil || !strings.Contains(err.Error(), "not processed within 500ms") {
+		t.Errorf("expected the webhook not to be processed, got: %v", err)
+	}
+	drop = false
+
+	// The receiver is failing
+	receiverStatus = http.StatusBadGateway
+	if err := run(map[string]string{}); err == nil || !strings.Contains(err.Error(), "status code 502") {
+		t.Errorf("expected the receiver failure to be reported, got: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+// WebSocket Tester
+//
+// The WebSocket tester connects to a WebSocket server, and succeeds if it
+// completes the upgrade handshake, i.e. answers with the status code 101
+// (Switching Protocols).
+//
+// This test is invoked via input like so:
+//
+//    ws://chat.example.com/socket must run ws
+//    wss://chat.example.com/socket must run ws
+//
+// To also push a message once connected, and require a substring in the
+// reply, use:
+//
+//    wss://chat.example.com/socket must run ws with send '{"type":"ping"}' with expect 'pong'
+//
+// Without `send`, `expect` is looked for in the first message pushed by
+// the server. A subprotocol can be requested, via the header
+// Sec-WebSocket-Protocol, like so:
+//
+//    wss://chat.example.com/socket must run ws with subprotocol chat.v1
+//
+// If you need to disable the validation of the certificates you can do so
+// via `with tls insecure`.
+//
+
+package protocols
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+	"golang.org/x/net/websocket"
+)
+
+// WSTest is our object.
+type WSTest struct {
+}
+
+// Arguments returns the names of arguments which this protocol-test
+// understands, along with corresponding regular-expressions to validate
+// their values.
+func (s *WSTest) Arguments() map[string]string {
+	known := map[string]string{
+		"send":        ".+",
+		"expect":      ".+",
+		"subprotocol": `^[!#$%&'*+\-.^_|~0-9a-zA-Z]+$`,
+		"tls":         "insecure",
+	}
+	return known
+}
+
+// ShouldResolveHostname returns if this protocol requires the hostname resolution of the first test argument
+func (s *WSTest) ShouldResolveHostname() bool {
+	return true
+}
+
+// Example returns sample usage-instructions for self-documentation purposes.
+func (s *WSTest) Example() string {
+	str := `
+WebSocket Tester
+----------------
+ The WebSocket tester connects to a WebSocket server, and succeeds if it
+ completes the upgrade handshake, i.e. answers with the status code 101
+ (Switching Protocols).
+
+ This test is invoked via input like so:
+
+    ws://chat.example.com/socket must run ws
+    wss://chat.example.com/socket must run ws
+
+ To also push a message once connected, and require a substring in the
+ reply, use:
+
+    wss://chat.example.com/socket must run ws with send '{"type":"ping"}' with expect 'pong'
+
+ Without 'send', 'expect' is looked for in the first message pushed by
+ the server. A subprotocol can be requested, via the header
+ Sec-WebSocket-Protocol, like so:
+
+    wss://chat.example.com/socket must run ws with subprotocol chat.v1
+
+ If you need to disable the validation of the certificates you can do so
+ via 'with tls insecure'.
+`
+	return str
+}
+
+// RunTest is the part of our API which is invoked to actually execute a
+// test against the given target.
+//
+// The target is the resolved address of the host, while the URL, with its
+// path, is the target of the test itself:
+//
+//    tst.Target => "wss://chat.example.com/socket"
+//
+//    target => "176.9.183.100"
+//
+func (s *WSTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	u, err := url.Parse(tst.Target)
+	if err != nil {
+		return err
+	}
+
+	var port string
+	switch u.Scheme {
+	case "ws":
+		port = "80"
+	case "wss":
+		port = "443"
+	default:
+		return fmt.Errorf("the target must be a ws:// or wss:// URL, not '%s'", tst.Target)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+
+	address := net.JoinHostPort(target, port)
+	conn, err := newDialer(opts).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		return err
+	}
+
+	origin := "http://" + u.Host
+	if u.Scheme == "wss" {
+		origin = "https://" + u.Host
+
+		roots, errCA := rootCAs(tst, opts)
+		if errCA != nil {
+			return errCA
+		}
+		tlsConfig := &tls.Config{ServerName: u.Hostname(), RootCAs: roots}
+		if tst.Arguments["tls"] == "insecure" {
+			tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err = tlsConn.Handshake(); err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+
+	config, err := websocket.NewConfig(tst.Target, origin)
+	if err != nil {
+		return err
+	}
+	if tst.Arguments["subprotocol"] != "" {
+		config.Protocol = []string{tst.Arguments["subprotocol"]}
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err == websocket.ErrBadStatus {
+		return fmt.Errorf("the server did not answer the upgrade of %s with 101 Switching Protocols", tst.Target)
+	}
+	if err != nil {
+		return fmt.Errorf("the WebSocket handshake failed: %s", err.Error())
+	}
+	defer ws.Close()
+
+	if opts.Verbose {
+		fmt.Printf("WebSocket connected to %s\n", tst.Target)
+	}
+
+	if tst.Arguments["send"] != "" {
+		if err = websocket.Message.Send(ws, tst.Arguments["send"]); err != nil {
+			return fmt.Errorf("failed to send the message: %s", err.Error())
+		}
+	}
+
+	if tst.Arguments["expect"] != "" {
+		var reply string
+		if err = websocket.Message.Receive(ws, &reply); err != nil {
+			return fmt.Errorf("failed to receive a message: %s", err.Error())
+		}
+		if !strings.Contains(reply, tst.Arguments["expect"]) {
+			return fmt.Errorf("the message '%s' didn't contain '%s'", reply, tst.Arguments["expect"])
+		}
+	}
+
+	return nil
+}
+
+func (s *WSTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+//
+// Register our protocol-tester.
+//
+func init() {
+	Register("ws", func() ProtocolTest {
+		return &WSTest{}
+	})
+}
@@ -0,0 +1,103 @@
+package protocols
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"golang.org/x/net/websocket"
+)
+
+// wsHandler returns a stub WebSocket server, echoing the messages sent to
+// /echo, and requiring the chat subprotocol on /chat.
+func wsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/echo", websocket.Handler(func(ws *websocket.Conn) {
+		var message string
+		for websocket.Message.Receive(ws, &message) == nil {
+			websocket.Message.Send(ws, "echo: "+message)
+		}
+	}))
+	mux.Handle("/chat", websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			for _, protocol := range config.Protocol {
+				if protocol == "chat" {
+					config.Protocol = []string{protocol}
+					return nil
+				}
+			}
+			return errors.New("the chat subprotocol is required")
+		},
+		Handler: func(ws *websocket.Conn) {
+			websocket.Message.Send(ws, "welcome")
+		},
+	})
+	return mux
+}
+
+// runWS runs the ws test against the given URL of the server.
+func runWS(server *httptest.Server, scheme string, path string, args map[string]string, opts test.Options) error {
+	u, _ := url.Parse(server.URL)
+	tst := test.Test{Target: scheme + "://" + u.Host + path, Type: "ws", Arguments: args}
+	opts.Timeout = 5 * time.Second
+	return (&WSTest{}).RunTest(context.Background(), tst, u.Hostname(), opts)
+}
+
+func TestWS(t *testing.T) {
+	server := httptest.NewServer(wsHandler())
+	defer server.Close()
+
+	tests := []struct {
+		path    string
+		args    map[string]string
+		failure string
+	}{
+		{"/echo", map[string]string{}, ""},
+		{"/echo", map[string]string{"send": "ping", "expect": "echo: ping"}, ""},
+		{"/echo", map[string]string{"send": "ping", "expect": "pong"}, "the message 'echo: ping' didn't contain 'pong'"},
+		{"/chat", map[string]string{"subprotocol": "chat", "expect": "welcome"}, ""},
+		{"/chat", map[string]string{}, "did not answer the upgrade of ws://"},
+		{"/missing", map[string]string{}, "did not answer the upgrade of ws://"},
+	}
+
+	for i, tt := range tests {
+		err := runWS(server, "ws", tt.path, tt.args, test.Options{})
+		if tt.failure == "" && err != nil {
+			t.Errorf("test %d: expected to pass, got: %s", i, err)
+		}
+		if tt.failure != "" && (err == nil || !strings.Contains(err.Error(), tt.failure)) {
+			t.Errorf("test %d: expected a failure containing %q, got: %v", i, tt.failure, err)
+		}
+	}
+
+	if err := runWS(server, "http", "/echo", map[string]string{}, test.Options{}); err == nil || !strings.Contains(err.Error(), "must be a ws:// or wss:// URL") {
+		t.Errorf("expected an http:// target to be rejected, got: %v", err)
+	}
+}
+
+func TestWSS(t *testing.T) {
+	server := httptest.NewTLSServer(wsHandler())
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	args := map[string]string{"send": "ping", "expect": "echo: ping"}
+	if err := runWS(server, "wss", "/echo", args, test.Options{RootCAs: roots}); err != nil {
+		t.Errorf("expected a trusted server to pass, got: %s", err)
+	}
+	if err := runWS(server, "wss", "/echo", args, test.Options{}); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected an untrusted server to fail, got: %v", err)
+	}
+	args["tls"] = "insecure"
+	if err := runWS(server, "wss", "/echo", args, test.Options{}); err != nil {
+		t.Errorf("expected an insecure test to pass, got: %s", err)
+	}
+}
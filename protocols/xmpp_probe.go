@@ -12,8 +12,8 @@ package protocols
 
 import (
 	"bufio"
+	"context"
 	"fmt"
-	"net"
 	"strconv"
 	"strings"
 
@@ -59,7 +59,7 @@ XMPP Tester
 //
 // In this case we make a TCP connection, defaulting to port 5222, and
 // look for a response which appears to be an XMPP-server.
-func (s *XMPPTest) RunTest(tst test.Test, target string, opts test.Options) error {
+func (s *XMPPTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
 	var err error
 
 	//
@@ -80,7 +80,7 @@ func (s *XMPPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Set an explicit timeout
 	//
-	d := net.Dialer{Timeout: opts.Timeout}
+	d := newDialer(opts)
 
 	//
 	// Default to connecting to an IPv4-address
@@ -97,11 +97,19 @@ func (s *XMPPTest) RunTest(tst test.Test, target string, opts test.Options) erro
 	//
 	// Make the TCP connection.
 	//
-	conn, err := d.Dial("tcp", address)
+	conn, err := d.DialContext(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
+	//
+	// The whole exchange must complete within the timeout.
+	//
+	if err = conn.SetDeadline(deadline(ctx, opts.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
 	//
 	// Send a (bogus) greeting
 	//
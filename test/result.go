@@ -22,6 +22,17 @@ type Result struct {
 	// Result details
 	Details *string `json:"details"`
 
+	// Values captured from the response of the target, if requested
+	Captures map[string]string `json:"captures,omitempty"`
+
+	// Metadata about the test, e.g. the status code of an HTTP response,
+	// from the protocol-tests able to describe what they observed
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// If set, classifies the failure, e.g. "network-issue" if the
+	// control-target of the test failed too
+	Classification string `json:"classification,omitempty"`
+
 	// If true, this alert is a duplicate of an ongoing alert
 	IsDedup bool `json:"isDedup"`
 
@@ -36,6 +47,29 @@ type Result struct {
 
 	// If not nil, describes result with a custom label
 	TestLabel *string `json:"testLabel"`
+
+	// If not nil, the percentage of the latest SuccessRateRuns runs of the
+	// test which passed
+	SuccessRate     *float64 `json:"successRate,omitempty"`
+	SuccessRateRuns int      `json:"successRateRuns,omitempty"`
+
+	// The severity of a failure of the test, e.g. critical, warning or info
+	Severity string `json:"severity"`
+
+	// The tags of the test, if any
+	Tags []string `json:"tags,omitempty"`
+
+	// If true, this result is collected for trend data only, and alerting
+	// consumers should ignore it
+	Informational bool `json:"informational"`
+
+	// The hostname of the worker which ran the test
+	Worker string `json:"worker"`
+
+	// The number of attempts made, including the retries, and how long
+	// the final one took
+	Attempts   uint  `json:"attempts"`
+	DurationMs int64 `json:"duration_ms"`
 }
 
 // Hash generates a unique identifier for the original test (e.g. to deduplicate same results)
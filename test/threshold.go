@@ -0,0 +1,65 @@
+package test
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Threshold is the minimum number, or fraction, of the targets of a test
+// which must pass for the test to pass, e.g. "3", "80%" or "0.8".
+type Threshold struct {
+	// The number of targets, if > 0
+	Count int
+
+	// Otherwise, the fraction of the targets, in (0, 1]
+	Fraction float64
+}
+
+// ParseThreshold parses a threshold, either a number of targets, or a
+// fraction of them, as a percentage or a decimal.
+func ParseThreshold(value string) (*Threshold, error) {
+	if strings.HasSuffix(value, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percentage <= 0 || percentage > 100 {
+			return nil, fmt.Errorf("invalid threshold '%s', percentages must be in (0, 100]", value)
+		}
+		return &Threshold{Fraction: percentage / 100}, nil
+	}
+
+	if count, err := strconv.Atoi(value); err == nil {
+		if count < 1 {
+			return nil, fmt.Errorf("invalid threshold '%s', counts must be at least 1", value)
+		}
+		return &Threshold{Count: count}, nil
+	}
+
+	fraction, err := strconv.ParseFloat(value, 64)
+	if err != nil || fraction <= 0 || fraction > 1 {
+		return nil, fmt.Errorf("invalid threshold '%s', must be a count, a percentage, or a fraction in (0, 1]", value)
+	}
+	return &Threshold{Fraction: fraction}, nil
+}
+
+// Required returns how many of the given number of targets must pass, at
+// least one.
+func (t *Threshold) Required(targets int) int {
+	required := t.Count
+	if required == 0 {
+		// Don't let rounding errors require an extra target
+		required = int(math.Ceil(t.Fraction*float64(targets) - 1e-9))
+	}
+	if required < 1 {
+		required = 1
+	}
+	return required
+}
+
+// String returns the threshold as a count, or a percentage.
+func (t *Threshold) String() string {
+	if t.Count > 0 {
+		return strconv.Itoa(t.Count)
+	}
+	return strconv.FormatFloat(t.Fraction*100, 'f', -1, 64) + "%"
+}
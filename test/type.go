@@ -18,6 +18,7 @@
 package test
 
 import (
+	"crypto/x509"
 	"fmt"
 	"sort"
 	"time"
@@ -40,9 +41,13 @@ type Test struct {
 	// In the example above this would be `1.2.3.4 must run ftp`.
 	Input string
 
-	// MaxRetries overrides the global overseer setting for max test retries
+	// MaxRetries overrides the global overseer setting for max test retries,
+	// set by either `retries N`, or `retry-count N+1`
 	MaxRetries *uint
 
+	// If not nil, overrides the global overseer setting enabling retries
+	Retry *bool
+
 	// If not nil, triggers an error for the test only if it fails repeatedly at least for the amount of time defined by this minimum duration
 	MinDuration *time.Duration
 
@@ -78,6 +83,92 @@ type Test struct {
 
 	// It not nil, describes the test with a custom tag/label
 	TestLabel *string
+
+	// If true, the test is executed but its results are never notified
+	Shadow bool
+
+	// If true, the results of the test are notified for trend data only,
+	// and must never trigger alerts
+	Informational bool
+
+	// If not nil, the failures of the test outside of this window are
+	// notified as informational results only
+	NotifyHours *TimeWindow
+
+	// If not nil, a known-good target which is tested when the test fails,
+	// to tell a failing target apart from a broken network
+	ControlTarget *string
+
+	// If not nil, the path of a PEM bundle of certificate authorities
+	// trusted by TLS-capable testers
+	CAFile *string
+
+	// The severity of a failure of this test, one of Severities
+	Severity string
+
+	// Free-form tags of the test, e.g. the team owning it, carried in its
+	// results
+	Tags []string
+
+	// If not nil, the test-label (or the type and target) of another test
+	// which must not be failing for this test to run
+	DependsOn *string
+
+	// If set, "ipv4" or "ipv6", the addresses of this family are tested
+	// first
+	PreferFamily string
+
+	// If true, the test passes as soon as it passes against one of the
+	// addresses of its target, tried in order
+	AnyFamily bool
+
+	// If set, the responses of all the addresses of the target must agree
+	// on these values, e.g. "status", "body", or the name of a capture,
+	// and the addresses diverging from the others fail
+	Consistency []string
+
+	// If > 0, the test is run against all the addresses of its target,
+	// and passes, with a single result, if it passes against at least
+	// this many of them
+	MinHealthyIPs int
+
+	// If not nil, like MinHealthyIPs, with the number of addresses which
+	// must pass given as a count, or a fraction of the addresses
+	Threshold *Threshold
+
+	// If true, the test is expected to fail, e.g. for negative testing,
+	// so it passes when the protocol-test fails, and the other way round
+	ExpectFailure bool
+}
+
+// DefaultSeverity is the severity of tests which do not define one.
+const DefaultSeverity = "critical"
+
+// Severities contains the allowed severities of a test, from the most to
+// the least important.
+var Severities = []string{"critical", "warning", "info"}
+
+// IsValidSeverity returns true if the given severity is an allowed one.
+func IsValidSeverity(severity string) bool {
+	for _, s := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// SensitiveArguments contains the names of the arguments whose values
+// must never be leaked into results, e.g. passwords or secret keys.
+var SensitiveArguments = map[string]bool{
+	"password":      true,
+	"access-key":    true,
+	"secret-key":    true,
+	"session-token": true,
+	"psk":           true,
+	"imap-password": true,
+	"jump-password": true,
+	"bind-password": true,
 }
 
 // Sanitize returns a copy of the input string, but with any password
@@ -98,9 +189,9 @@ func (obj *Test) Sanitize() string {
 	for _, k := range keys {
 		tmp := ""
 
-		// Censor passwords
-		if k == "password" {
-			tmp = " with password 'CENSORED'"
+		// Censor passwords, and any other secret
+		if SensitiveArguments[k] {
+			tmp = fmt.Sprintf(" with %s 'CENSORED'", k)
 		} else {
 
 			// Otherwise leave alone.
@@ -112,6 +203,27 @@ func (obj *Test) Sanitize() string {
 	return res
 }
 
+// StateStore keeps small values across the runs of tests, e.g. to compare
+// a value with the one seen by the previous run.
+type StateStore interface {
+	// Get returns the value stored under the key, or "" if there is none.
+	Get(key string) (string, error)
+
+	// Set stores the value under the key.
+	Set(key string, value string) error
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// Size returns the number of ports in the range.
+func (r *PortRange) Size() int {
+	return r.Max - r.Min + 1
+}
+
 // Options are options which are passed to every test-handler.
 //
 // The options might change the way the test operates.
@@ -122,6 +234,28 @@ type Options struct {
 	// Should the protocol-tests run verbosely?
 	Verbose bool
 
+	// Certificate authorities trusted by TLS-capable testers, if nil
+	// the system ones are used
+	RootCAs *x509.CertPool
+
+	// Should intrusive tests, like port scans, be allowed?
+	AllowPortScan bool
+
+	// Should mock tests, returning made up results, be allowed?
+	AllowMock bool
+
+	// If not empty, the only Kubernetes namespaces the k8s testers may
+	// query
+	K8sAllowedNamespaces []string
+
+	// If not nil, the range of the local ports outbound connections are
+	// made from
+	LocalPorts *PortRange
+
+	// Keeps values across the runs of tests, if nil there is none, e.g.
+	// when tests are not run by a worker
+	State StateStore
+
 	// If this is a period test, we may want to replace vars in the target address
 	PeriodTestIndex     int
 	PeriodTestStartTime int64
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var timeWindowRegex = regexp.MustCompile(`^([01]?[0-9]|2[0-3]):([0-5][0-9])-([01]?[0-9]|2[0-4]):([0-5][0-9])$`)
+
+// TimeWindow is a daily window of time, e.g. business hours, in a given
+// location.
+type TimeWindow struct {
+	// The start and end of the window, since midnight. A window ending
+	// before it starts spans midnight.
+	Start time.Duration
+	End   time.Duration
+
+	Location *time.Location
+}
+
+// ParseTimeWindow parses a window such as 09:00-18:00, in the given
+// location.
+func ParseTimeWindow(value string, location *time.Location) (*TimeWindow, error) {
+	matches := timeWindowRegex.FindStringSubmatch(value)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("invalid time window '%s', must be e.g. 09:00-18:00", value)
+	}
+
+	clock := func(hours string, minutes string) time.Duration {
+		h, _ := strconv.Atoi(hours)
+		m, _ := strconv.Atoi(minutes)
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute
+	}
+
+	window := &TimeWindow{
+		Start:    clock(matches[1], matches[2]),
+		End:      clock(matches[3], matches[4]),
+		Location: location,
+	}
+	if window.End > 24*time.Hour {
+		return nil, fmt.Errorf("invalid time window '%s', it must end by 24:00", value)
+	}
+	if window.Start == window.End {
+		return nil, fmt.Errorf("invalid time window '%s', it must not be empty", value)
+	}
+	return window, nil
+}
+
+// Contains returns true if the given time is within the window.
+func (w *TimeWindow) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+
+	if w.Start < w.End {
+		return sinceMidnight >= w.Start && sinceMidnight < w.End
+	}
+	return sinceMidnight >= w.Start || sinceMidnight < w.End
+}
+
+// String returns the window as parsed.
+func (w *TimeWindow) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return clock(w.Start) + "-" + clock(w.End) + " " + w.Location.String()
+}
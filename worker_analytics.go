@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// The default queue sampled results are published to for analytics
+const defaultAnalyticsQueue = "overseer.analytics"
+
+// resultSampler picks the fraction of the results published to the
+// analytics queue.
+type resultSampler struct {
+	rate float64
+
+	// rand.Rand is not safe for concurrent use
+	lock sync.Mutex
+	rnd  *rand.Rand
+}
+
+// newResultSampler returns a sampler picking the given fraction, between
+// 0 and 1, of the results.
+func newResultSampler(rate float64, rnd *rand.Rand) (*resultSampler, error) {
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("the analytics sample rate must be between 0 and 1, got %g", rate)
+	}
+	return &resultSampler{rate: rate, rnd: rnd}, nil
+}
+
+// sample returns true if the next result must be sampled.
+func (s *resultSampler) sample() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rnd.Float64() < s.rate
+}
+
+// publishAnalytics publishes the result to the analytics queue, if it is
+// sampled, keeping the same fields as in the results queue.
+func (p *workerCmd) publishAnalytics(result *test.Result) {
+	if !p._analytics.sample() {
+		return
+	}
+
+	j, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Failed to encode test-result to JSON: %s\n", err.Error())
+		return
+	}
+
+	if p._resultFields != nil {
+		if j, err = filterResultFields(j, p._resultFields); err != nil {
+			fmt.Printf("Failed to filter the fields of the test-result: %s\n", err.Error())
+			return
+		}
+	}
+
+	if err = p.publishResult(p.AnalyticsQueue, j); err != nil {
+		fmt.Printf("Analytics result addition failed: %s\n", err)
+	}
+}
+
+// alertingResult returns true if the result must be published to the
+// results queue, consumed by the alerting, when analytics are enabled:
+// failures, and the recoveries which clear them.
+func alertingResult(result *test.Result) bool {
+	return result.Error != nil || result.Recovered
+}
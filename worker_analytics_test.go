@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestAnalyticsSampling(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	var err error
+	p.AnalyticsQueue = "overseer.trends"
+	p._analytics, err = newResultSampler(0.25, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatalf("failed to create the sampler: %s", err)
+	}
+
+	const runs = 2000
+	for i := 0; i < runs; i++ {
+		var resultError error
+		if i%2 == 0 {
+			resultError = errors.New("connection refused")
+		}
+		tst := test.Test{Target: "192.0.2.1", Type: "ssh", Input: "192.0.2.1 must run ssh"}
+		if err = p.notify(tst, nil, resultError, nil); err != nil {
+			t.Fatalf("failed to notify: %s", err)
+		}
+	}
+
+	// Only the failures reach the alerting
+	results := testResults(t, p)
+	if len(results) != runs/2 {
+		t.Errorf("expected %d results, got %d", runs/2, len(results))
+	}
+	for _, payload := range results {
+		result, _ := test.ResultFromJSON([]byte(payload))
+		if result.Error == nil {
+			t.Fatalf("expected only failures in the results queue, got %s", payload)
+		}
+	}
+
+	// While a fraction of all the results is sampled for analytics
+	sampled, err := p._r.LRange("overseer.trends", 0, -1).Result()
+	if err != nil {
+		t.Fatalf("failed to read the analytics queue: %s", err)
+	}
+	if len(sampled) < runs/4-100 || len(sampled) > runs/4+100 {
+		t.Errorf("expected about %d sampled results, got %d", runs/4, len(sampled))
+	}
+
+	passed := 0
+	for _, payload := range sampled {
+		result, _ := test.ResultFromJSON([]byte(payload))
+		if result.Error == nil {
+			passed++
+		}
+	}
+	if passed == 0 || passed == len(sampled) {
+		t.Errorf("expected both passing and failing results to be sampled, got %d passing out of %d", passed, len(sampled))
+	}
+}
+
+func TestAnalyticsRecovery(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.AnalyticsQueue = defaultAnalyticsQueue
+	p._analytics, _ = newResultSampler(0, rand.New(rand.NewSource(1)))
+
+	// Recoveries still reach the alerting, to clear the failures
+	if !alertingResult(&test.Result{Recovered: true}) {
+		t.Errorf("expected recoveries to be published to the results queue")
+	}
+
+	tst := test.Test{Target: "192.0.2.1", Type: "ssh", Input: "192.0.2.1 must run ssh"}
+	p.notify(tst, nil, nil, nil)
+	if results := testResults(t, p); len(results) != 0 {
+		t.Errorf("expected passing results not to be published to the results queue, got %d", len(results))
+	}
+	if sampled, _ := p._r.LLen(defaultAnalyticsQueue).Result(); sampled != 0 {
+		t.Errorf("expected no result to be sampled, got %d", sampled)
+	}
+
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := newResultSampler(rate, nil); err == nil {
+			t.Errorf("expected a sample rate of %g to be invalid", rate)
+		}
+	}
+}
+
+func TestAnalyticsResultFields(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	var err error
+	p.AnalyticsQueue = defaultAnalyticsQueue
+	p._analytics, _ = newResultSampler(1, rand.New(rand.NewSource(1)))
+	if p._resultFields, err = parseResultFields("target,error"); err != nil {
+		t.Fatalf("failed to parse the result fields: %s", err)
+	}
+
+	tst := test.Test{Target: "192.0.2.1", Type: "ssh", Input: "192.0.2.1 must run ssh"}
+	p.notify(tst, nil, errors.New("connection refused"), nil)
+
+	// The sampled results are filtered like the alerting ones
+	for _, queue := range []string{defaultAnalyticsQueue, "overseer.results"} {
+		payloads, _ := p._r.LRange(queue, 0, -1).Result()
+		if len(payloads) != 1 {
+			t.Fatalf("expected a result in %s, got %d", queue, len(payloads))
+		}
+		var fields map[string]interface{}
+		if err = json.Unmarshal([]byte(payloads[0]), &fields); err != nil {
+			t.Fatalf("failed to decode the result: %s", err)
+		}
+		if len(fields) != 2 || fields["target"] != "192.0.2.1" || fields["error"] != "connection refused" {
+			t.Errorf("expected only the listed fields in %s, got %v", queue, fields)
+		}
+	}
+}
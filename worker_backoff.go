@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// retryDelay returns how long to wait before retrying a test, after its
+// given attempt (starting at 1) failed.
+//
+// Without backoff this is always the delay, uncapped. With backoff it doubles after
+// each attempt, up to max if it is > 0.
+func retryDelay(delay time.Duration, backoff bool, max time.Duration, attempt uint) time.Duration {
+	if !backoff {
+		return delay
+	}
+
+	for i := uint(1); i < attempt; i++ {
+		// Stop before exceeding the cap, or overflowing: doubling 1<<62
+		// already gives a negative duration
+		if (max > 0 && delay >= max) || delay >= (1<<62) {
+			break
+		}
+		delay *= 2
+	}
+
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// retryJitter spreads in time the retries of the workers, which would
+// otherwise retry in lockstep the tests failing at once, e.g. when a
+// shared backend briefly fails.
+type retryJitter struct {
+	max time.Duration
+
+	// rand.Rand is not safe for concurrent use
+	lock sync.Mutex
+	rnd  *rand.Rand
+}
+
+// newRetryJitter returns a jitter of up to max, excluded.
+func newRetryJitter(max time.Duration, rnd *rand.Rand) *retryJitter {
+	return &retryJitter{max: max, rnd: rnd}
+}
+
+// add returns the delay plus a random duration in [0, max). A nil jitter
+// returns the delay unchanged.
+func (j *retryJitter) add(delay time.Duration) time.Duration {
+	if j == nil || j.max <= 0 {
+		return delay
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return delay + time.Duration(j.rnd.Int63n(int64(j.max)))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	for _, c := range []struct {
+		backoff  bool
+		max      time.Duration
+		attempt  uint
+		expected time.Duration
+	}{
+		// Without backoff the delay is flat
+		{false, 0, 1, 5 * time.Second},
+		{false, 0, 4, 5 * time.Second},
+		{false, 2 * time.Second, 4, 5 * time.Second},
+		// With backoff it doubles after each attempt
+		{true, 0, 1, 5 * time.Second},
+		{true, 0, 2, 10 * time.Second},
+		{true, 0, 3, 20 * time.Second},
+		{true, 0, 4, 40 * time.Second},
+		// Up to the cap
+		{true, 30 * time.Second, 3, 20 * time.Second},
+		{true, 30 * time.Second, 4, 30 * time.Second},
+		{true, 30 * time.Second, 100, 30 * time.Second},
+		{true, 2 * time.Second, 1, 2 * time.Second},
+	} {
+		if delay := retryDelay(5*time.Second, c.backoff, c.max, c.attempt); delay != c.expected {
+			t.Errorf("attempt %d with backoff %v and max %s: expected %s, got %s", c.attempt, c.backoff, c.max, c.expected, delay)
+		}
+	}
+
+	// Many attempts without a cap don't overflow
+	if delay := retryDelay(5*time.Second, true, 0, 1000); delay <= 0 {
+		t.Errorf("expected a positive delay, got %s", delay)
+	}
+	if delay := retryDelay(1<<62, true, 0, 2); delay != 1<<62 {
+		t.Errorf("expected a delay at the overflow boundary not to be doubled, got %s", delay)
+	}
+}
+
+func TestRetryJitter(t *testing.T) {
+	var disabled *retryJitter
+	if delay := disabled.add(5 * time.Second); delay != 5*time.Second {
+		t.Errorf("expected no jitter when disabled, got %s", delay)
+	}
+
+	max := time.Second
+	jitter := newRetryJitter(max, rand.New(rand.NewSource(1)))
+	var total time.Duration
+	for i := 0; i < 1000; i++ {
+		// Composed with the backed off delay
+		delay := jitter.add(retryDelay(5*time.Second, true, 0, 2))
+		if delay < 10*time.Second || delay >= 10*time.Second+max {
+			t.Fatalf("delay %s out of bounds [10s, 11s)", delay)
+		}
+		total += delay - 10*time.Second
+	}
+
+	// The jitter should be spread, not e.g. always zero
+	if average := total / 1000; average < max/4 || average > max*3/4 {
+		t.Errorf("unexpected average jitter %s", average)
+	}
+
+	// The same seed gives the same jitter
+	a := newRetryJitter(max, rand.New(rand.NewSource(42)))
+	b := newRetryJitter(max, rand.New(rand.NewSource(42)))
+	for i := 0; i < 10; i++ {
+		if x, y := a.add(0), b.add(0); x != y {
+			t.Errorf("expected the same jitter with the same seed, got %s and %s", x, y)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// targetResult is the result of a test against one of its targets.
+type targetResult struct {
+	test       test.Test
+	uniqueHash *string
+	err        error
+	outcome    *testOutcome
+}
+
+// runTestCoalesced executes a test against all of its targets, but emits
+// a single notification summarizing the results of all the targets,
+// instead of one for each of them.
+func (p *workerCmd) runTestCoalesced(workerIdx uint, tst test.Test, opts test.Options) error {
+	lock := &sync.Mutex{}
+	var results []targetResult
+
+	err := p.executeTest(workerIdx, tst, opts, func(testDefinition test.Test, uniqueHash *string, resultError error, outcome *testOutcome) error {
+		lock.Lock()
+		defer lock.Unlock()
+		results = append(results, targetResult{testDefinition, uniqueHash, resultError, outcome})
+		return nil
+	})
+
+	switch len(results) {
+	case 0:
+		return err
+	case 1:
+		// Nothing to coalesce
+		result := results[0]
+		p.notify(result.test, result.uniqueHash, result.err, result.outcome)
+		return err
+	}
+
+	coalesced := tst
+	coalesced.Input = tst.Sanitize()
+
+	outcome, resultError := coalesceResults(results)
+	p.notify(coalesced, nil, resultError, outcome)
+
+	return err
+}
+
+// coalesceResults summarizes the results of a test against its targets,
+// returning an error listing the failed targets, if any.
+//
+// The targets are tested in parallel, so their results are sorted by
+// address, to summarize them in the same order on every run.
+func coalesceResults(results []targetResult) (*testOutcome, error) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return lessTarget(results[i].test.Target, results[j].test.Target)
+	})
+
+	var failures []string
+	var lines []string
+	classifications := map[string]bool{}
+
+	for _, result := range results {
+		if result.err == nil {
+			lines = append(lines, fmt.Sprintf("- %s: passed", result.test.Target))
+			continue
+		}
+
+		failures = append(failures, fmt.Sprintf("%s: %s", result.test.Target, result.err.Error()))
+		lines = append(lines, fmt.Sprintf("- %s: failed, %s", result.test.Target, result.err.Error()))
+		if result.outcome != nil {
+			classifications[result.outcome.Classification] = true
+		}
+	}
+
+	details := fmt.Sprintf("%d targets passed, %d failed:\n%s", len(results)-len(failures), len(failures), strings.Join(lines, "\n"))
+	outcome := &testOutcome{Details: &details}
+
+	// The targets are tested in parallel, so the test took as long as the slowest one
+	for _, result := range results {
+		if result.outcome == nil {
+			continue
+		}
+		if result.outcome.Duration > outcome.Duration {
+			outcome.Duration = result.outcome.Duration
+		}
+		if result.outcome.Attempts > outcome.Attempts {
+			outcome.Attempts = result.outcome.Attempts
+		}
+		if result.outcome.LastAttempt > outcome.LastAttempt {
+			outcome.LastAttempt = result.outcome.LastAttempt
+		}
+	}
+
+	if len(failures) == 0 {
+		return outcome, nil
+	}
+
+	// Keep the classification only if all the failures agree on it
+	if len(classifications) == 1 {
+		for classification := range classifications {
+			outcome.Classification = classification
+		}
+	}
+
+	return outcome, fmt.Errorf("%d/%d targets failed: %s", len(failures), len(results), strings.Join(failures, "; "))
+}
+
+// lessTarget orders the targets by address, numerically for the IPs, so
+// that 10.0.0.2 comes before 10.0.0.10.
+func lessTarget(a string, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA != nil && ipB != nil {
+		return bytes.Compare(ipA.To16(), ipB.To16()) < 0
+	}
+	return a < b
+}
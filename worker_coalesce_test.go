@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestCoalesceResults(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	// Only the first of the addresses accepts connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3")}, nil
+	}
+	p.CoalesceResults = true
+
+	tst, err := parser.New().ParseLine("multi.example.com must run tcp with port "+strconv.Itoa(port), nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+
+	if err = p.runTest(0, tst, test.Options{Timeout: 2 * time.Second}); err != nil {
+		t.Fatalf("failed to run test: %s", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected a single coalesced result, got %d", len(results))
+	}
+
+	result, err := test.ResultFromJSON([]byte(results[0]))
+	if err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	if result.Target != "multi.example.com" {
+		t.Errorf("expected the coalesced result to target the hostname, got %s", result.Target)
+	}
+	if result.Error == nil || !strings.HasPrefix(*result.Error, "2/3 targets failed: 127.0.0.2: ") {
+		t.Fatalf("expected a summary of the failed targets, got %v", deref(result.Error))
+	}
+	if strings.Contains(*result.Error, "127.0.0.1") {
+		t.Errorf("expected the passing target not to be listed as failed: %s", *result.Error)
+	}
+	if result.Details == nil || !strings.HasPrefix(*result.Details, "1 targets passed, 2 failed") {
+		t.Errorf("expected the details to count the results, got %v", deref(result.Details))
+	}
+}
+
+func TestCoalesceResultsPassing(t *testing.T) {
+	results := []targetResult{
+		{test: test.Test{Target: "10.0.0.1"}},
+		{test: test.Test{Target: "10.0.0.2"}},
+	}
+
+	outcome, err := coalesceResults(results)
+	if err != nil {
+		t.Errorf("expected passing targets to coalesce into a success, got %s", err)
+	}
+	if outcome.Details == nil || !strings.Contains(*outcome.Details, "- 10.0.0.2: passed") {
+		t.Errorf("expected the details to list the targets, got %v", deref(outcome.Details))
+	}
+}
+
+func TestCoalesceResultsOrder(t *testing.T) {
+	failure := errors.New("connection refused")
+	results := []targetResult{
+		{test: test.Test{Target: "10.0.0.10"}, err: failure},
+		{test: test.Test{Target: "10.0.0.2"}, err: failure},
+		{test: test.Test{Target: "10.0.0.1"}},
+	}
+
+	outcome, err := coalesceResults(results)
+	if err == nil || err.Error() != "2/3 targets failed: 10.0.0.2: connection refused; 10.0.0.10: connection refused" {
+		t.Errorf("expected the failures sorted by address, got %v", err)
+	}
+	if outcome.Details == nil || !strings.HasSuffix(*outcome.Details, ":\n- 10.0.0.1: passed\n- 10.0.0.2: failed, connection refused\n- 10.0.0.10: failed, connection refused") {
+		t.Errorf("expected the details sorted by address, got %v", deref(outcome.Details))
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// targetEnd is the result of a test against one of its targets, as handed
+// to a testEndFunc.
+type targetEnd struct {
+	startTime time.Time
+	target    string
+	attempts  uint
+	result    error
+	outcome   *testOutcome
+}
+
+// consistencyValue returns the value of the outcome to compare: "status"
+// and "body" are the status code and the body digest of HTTP responses,
+// any other name is the one of a capture.
+func consistencyValue(outcome *testOutcome, name string) (string, bool) {
+	if outcome == nil {
+		return "", false
+	}
+
+	var value interface{}
+	var ok bool
+	switch name {
+	case "status":
+		value, ok = outcome.Metadata["statusCode"]
+	case "body":
+		value, ok = outcome.Metadata["bodyHash"]
+	default:
+		value, ok = outcome.Captures[name]
+	}
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// runTargetsConsistently runs a test against all of its targets, like
+// usual, but then fails the targets which passed with responses diverging
+// from the ones of the other targets, e.g. a single bad backend behind a
+// load balancer.
+func (p *workerCmd) runTargetsConsistently(workerPrefix string, values []string, targets []string, runTarget func(target string, end testEndFunc), end testEndFunc) {
+	lock := &sync.Mutex{}
+	var ends []*targetEnd
+
+	wg := &sync.WaitGroup{}
+	for _, target := range targets {
+		target := target
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runTarget(target, func(startTime time.Time, target string, attempts uint, result error, outcome *testOutcome) {
+				lock.Lock()
+				defer lock.Unlock()
+				ends = append(ends, &targetEnd{startTime, target, attempts, result, outcome})
+			})
+		}()
+	}
+	wg.Wait()
+
+	for _, divergence := range compareTargets(values, ends) {
+		p.verbose(fmt.Sprintf(workerPrefix+"Test failed: %s\n", divergence.result.Error()))
+	}
+
+	for _, e := range ends {
+		end(e.startTime, e.target, e.attempts, e.result, e.outcome)
+	}
+}
+
+// compareTargets fails the passing results whose values differ from the
+// ones of the majority of the passing results, returning them.
+//
+// Without a majority, e.g. with two targets disagreeing, all the diverging
+// results fail, as there is no telling which one is right.
+func compareTargets(values []string, ends []*targetEnd) []*targetEnd {
+	var passed []*targetEnd
+	for _, e := range ends {
+		if e.result == nil {
+			passed = append(passed, e)
+		}
+	}
+	if len(passed) < 2 {
+		return nil
+	}
+
+	var diverged []*targetEnd
+	for _, e := range passed {
+		var problems []string
+
+		for _, name := range values {
+			value, ok := consistencyValue(e.outcome, name)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("no %s to compare", name))
+				continue
+			}
+
+			counts := map[string]int{}
+			for _, other := range passed {
+				if otherValue, otherOk := consistencyValue(other.outcome, name); otherOk {
+					counts[otherValue]++
+				}
+			}
+			majority, found := majorityValue(counts)
+			if found && value == majority {
+				continue
+			}
+
+			if found {
+				problems = append(problems, fmt.Sprintf("%s '%s' instead of '%s'", name, value, majority))
+			} else {
+				problems = append(problems, fmt.Sprintf("%s '%s', with no majority among %s", name, value, describeCounts(counts)))
+			}
+		}
+
+		if len(problems) > 0 {
+			e.result = fmt.Errorf("the response of %s diverged from the other %d addresses: %s", e.target, len(passed)-1, strings.Join(problems, ", "))
+			diverged = append(diverged, e)
+		}
+	}
+	return diverged
+}
+
+// majorityValue returns the most common value, unless several values are
+// equally common.
+func majorityValue(counts map[string]int) (string, bool) {
+	best := ""
+	bestCount := 0
+	tie := false
+	for value, count := range counts {
+		switch {
+		case count > bestCount:
+			best, bestCount, tie = value, count, false
+		case count == bestCount:
+			tie = true
+		}
+	}
+	return best, bestCount > 0 && !tie
+}
+
+// describeCounts describes how many times each value was seen, e.g.
+// "'1.2' (x2), '1.3' (x2)".
+func describeCounts(counts map[string]int) string {
+	var descriptions []string
+	for value, count := range counts {
+		descriptions = append(descriptions, fmt.Sprintf("'%s' (x%d)", value, count))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ", ")
+}
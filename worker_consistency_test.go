@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+// startBackends starts an HTTP server on the same port of each of the
+// given loopback addresses, e.g. the backends behind a load balancer.
+func startBackends(t *testing.T, handlers map[string]http.HandlerFunc) (int, func()) {
+	first, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	port := first.Addr().(*net.TCPAddr).Port
+
+	var servers []*http.Server
+	for ip, handler := range handlers {
+		listener := first
+		if ip != "127.0.0.1" {
+			if listener, err = net.Listen("tcp", fmt.Sprintf("%s:%d", ip, port)); err != nil {
+				t.Fatalf("failed to listen on %s: %s", ip, err)
+			}
+		}
+		server := &http.Server{Handler: handler}
+		go server.Serve(listener)
+		servers = append(servers, server)
+	}
+
+	return port, func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
+
+func TestConsistentTargets(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	backend := func(version string, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-App-Version", version)
+			w.Write([]byte(body))
+		}
+	}
+	port, stop := startBackends(t, map[string]http.HandlerFunc{
+		"127.0.0.1": backend("1.2", "welcome"),
+		"127.0.0.2": backend("1.2", "welcome"),
+		"127.0.0.3": backend("1.1", "welcome!"),
+	})
+	defer stop()
+
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3")}, nil
+	}
+
+	run := func(options string) map[string]*string {
+		p._r.Del("overseer.results")
+		tst, err := parser.New().ParseLine(fmt.Sprintf("http://lb.example.com:%d/ must run http %s", port, options), nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		if err = p.runTest(0, tst, test.Options{Timeout: 2 * time.Second}); err != nil {
+			t.Fatalf("failed to run test: %s", err)
+		}
+
+		failures := map[string]*string{}
+		for _, j := range testResults(t, p) {
+			result, errJSON := test.ResultFromJSON([]byte(j))
+			if errJSON != nil {
+				t.Fatalf("failed to decode result: %s", errJSON)
+			}
+			failures[result.Target] = result.Error
+		}
+		if len(failures) != 3 {
+			t.Fatalf("expected a result for each backend, got %v", failures)
+		}
+		return failures
+	}
+
+	// The status codes agree
+	for target, err := range run("with consistent status") {
+		if err != nil {
+			t.Errorf("expected %s to pass, got %s", target, *err)
+		}
+	}
+
+	// The bodies, and versions, of the third backend diverge
+	results := run("with capture-header X-App-Version with consistent status,body,x_app_version")
+	if results["127.0.0.1"] != nil || results["127.0.0.2"] != nil {
+		t.Errorf("expected the agreeing backends to pass, got %v, %v", results["127.0.0.1"], results["127.0.0.2"])
+	}
+	diverged := results["127.0.0.3"]
+	if diverged == nil || !strings.HasPrefix(*diverged, "the response of 127.0.0.3 diverged from the other 2 addresses: body '") ||
+		!strings.HasSuffix(*diverged, ", x_app_version '1.1' instead of '1.2'") {
+		t.Errorf("expected the third backend to diverge, got %v", diverged)
+	}
+}
+
+func TestCompareTargets(t *testing.T) {
+	outcome := func(status int, version string) *testOutcome {
+		return &testOutcome{
+			Metadata: map[string]interface{}{"statusCode": status},
+			Captures: map[string]string{"version": version},
+		}
+	}
+
+	// Without a majority, all the diverging targets fail
+	ends := []*targetEnd{
+		{target: "10.0.0.1", outcome: outcome(200, "1.1")},
+		{target: "10.0.0.2", outcome: outcome(200, "1.2")},
+	}
+	if diverged := compareTargets([]string{"status", "version"}, ends); len(diverged) != 2 {
+		t.Errorf("expected both targets to diverge, got %d", len(diverged))
+	}
+	if ends[0].result == nil || !strings.Contains(ends[0].result.Error(), "version '1.1', with no majority among '1.1' (x1), '1.2' (x1)") {
+		t.Errorf("unexpected divergence: %v", ends[0].result)
+	}
+
+	// Failed targets are not compared, being failed already
+	ends = []*targetEnd{
+		{target: "10.0.0.1", outcome: outcome(200, "1.1")},
+		{target: "10.0.0.2", outcome: outcome(200, "1.1")},
+		{target: "10.0.0.3", result: errors.New("connection refused"), outcome: outcome(0, "")},
+	}
+	if diverged := compareTargets([]string{"status", "version"}, ends); len(diverged) != 0 {
+		t.Errorf("expected no divergence, got %d", len(diverged))
+	}
+	if ends[2].result.Error() != "connection refused" {
+		t.Errorf("expected the failure to be kept, got %s", ends[2].result)
+	}
+
+	// Values the test doesn't report can't be compared
+	ends = []*targetEnd{
+		{target: "10.0.0.1", outcome: outcome(200, "1.1")},
+		{target: "10.0.0.2", outcome: outcome(200, "1.1")},
+	}
+	if diverged := compareTargets([]string{"body"}, ends); len(diverged) != 2 || !strings.Contains(ends[0].result.Error(), "no body to compare") {
+		t.Errorf("expected a missing value to fail, got %v", ends[0].result)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/cmaster11/overseer/protocols"
+	"github.com/cmaster11/overseer/test"
+)
+
+// testControlTarget runs the test, with the same arguments, against its
+// control-target, and classifies the failure of the test: if the
+// known-good control fails too, the problem most likely lies with our own
+// network rather than with the target.
+func (p *workerCmd) testControlTarget(workerIdx uint, tst test.Test, opts test.Options) string {
+	// The arguments are needed by the testers requiring some, e.g. the
+	// port of the tcp one
+	arguments := map[string]string{}
+	for name, value := range tst.Arguments {
+		if name != "control-target" {
+			arguments[name] = value
+		}
+	}
+
+	control := test.Test{
+		Target:    *tst.ControlTarget,
+		Type:      tst.Type,
+		Arguments: arguments,
+		Timeout:   tst.Timeout,
+	}
+	control.Input = control.Sanitize()
+
+	p.verbose(fmt.Sprintf("[W%d] Test failed, running control test `%s`\n", workerIdx, control.Input))
+
+	if err := p.probeControl(control, opts); err != nil {
+		p.verbose(fmt.Sprintf("[W%d] Control test failed: %s\n", workerIdx, err.Error()))
+		return classificationNetworkIssue
+	}
+	return classificationFailed
+}
+
+// probeControl runs a single attempt of the control test against each of
+// the addresses of its target, and returns the first failure.
+//
+// Unlike the tests, the control is not retried, silenced, nor held back by
+// a dependency or a pre-test hook: it only runs for as long as the test
+// may, to classify its failure.
+func (p *workerCmd) probeControl(control test.Test, opts test.Options) error {
+	tester := protocols.ProtocolHandler(control.Type)
+	if tester == nil {
+		return fmt.Errorf("unknown test type '%s'", control.Type)
+	}
+
+	if control.Timeout != nil {
+		opts.Timeout = *control.Timeout
+	}
+
+	targets := []string{control.Target}
+	if tester.ShouldResolveHostname() {
+		host := control.Target
+		if strings.Contains(host, "://") {
+			u, err := url.Parse(host)
+			if err != nil {
+				return err
+			}
+			host = u.Hostname()
+		}
+
+		ips, err := p.lookupIP(host)
+		if err != nil {
+			return fmt.Errorf("failed to resolve name %s", host)
+		}
+		targets = p.enabledAddresses(ips)
+	}
+
+	for _, target := range targets {
+		ctx, cancel := testContext(p.workerContext(), tester, control, opts)
+		err := tester.RunTest(ctx, control, target, opts)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestControlTarget(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	broken.Close()
+
+	run := func(line string) *test.Result {
+		p, server := newTestWorker(t)
+		defer server.Close()
+
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		if err = p.runTest(0, tst, test.Options{Timeout: 5 * time.Second}); err != nil {
+			t.Fatalf("failed to run test: %s", err)
+		}
+
+		results := testResults(t, p)
+		if len(results) != 1 {
+			t.Fatalf("expected 1 result, got %d", len(results))
+		}
+		result, err := test.ResultFromJSON([]byte(results[0]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		return result
+	}
+
+	// Primary fails, control passes: the target is down
+	result := run(primary.URL + "/ must run http with control-target " + healthy.URL + "/")
+	if result.Error == nil || result.Classification != classificationFailed {
+		t.Errorf("expected a failed classification, got %q", result.Classification)
+	}
+
+	// Primary fails, control fails too: our network is broken
+	result = run(primary.URL + "/ must run http with control-target " + broken.URL + "/")
+	if result.Error == nil || result.Classification != classificationNetworkIssue {
+		t.Errorf("expected a network-issue classification, got %q", result.Classification)
+	}
+
+	// Primary passes: the control is not involved
+	result = run(healthy.URL + "/ must run http with control-target " + broken.URL + "/")
+	if result.Error != nil || result.Classification != "" {
+		t.Errorf("expected an unclassified success, got %q", result.Classification)
+	}
+}
+
+func TestControlTargetArguments(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	// The control listens on the port of the test, the target doesn't
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+	port := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	// The tcp tester requires the port, which the control needs too
+	tst, err := parser.New().ParseLine("127.0.0.2 must run tcp with port "+port+" with control-target 127.0.0.1", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+	if err = p.runTest(0, tst, test.Options{Timeout: 2 * time.Second}); err != nil {
+		t.Fatalf("failed to run test: %s", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	result, err := test.ResultFromJSON([]byte(results[0]))
+	if err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	if result.Error == nil || result.Classification != classificationFailed {
+		t.Errorf("expected a failed classification, got %q (%s)", result.Classification, deref(result.Error))
+	}
+}
+
+func TestControlTargetSingleAttempt(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.Retry = true
+	p.RetryCount = 5
+	p.RetryDelay = time.Second
+	p._sleep = func(d time.Duration) {}
+
+	// Both the target and the control fail, recording their timeouts
+	var timeouts []time.Duration
+	probes := &fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		if target == "control.example.com" {
+			timeouts = append(timeouts, opts.Timeout)
+		}
+		return errors.New("connection refused")
+	}}
+	name := registerFakeTest(probes)
+
+	tst, err := parser.New().ParseLine("target.example.com must run "+name+" with retries 2 with timeout 3s with control-target control.example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+	if err = p.runTest(0, tst, test.Options{Timeout: 10 * time.Second}); err != nil {
+		t.Fatalf("failed to run test: %s", err)
+	}
+
+	// The control runs once, whatever the retries, with the test's timeout
+	if len(probes.ran()) != 4 {
+		t.Errorf("expected 3 attempts against the target and 1 against the control, got %v", probes.ran())
+	}
+	if len(timeouts) != 1 || timeouts[0] != 3*time.Second {
+		t.Errorf("expected a single control attempt with the timeout of the test, got %v", timeouts)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// deadLetter is a job which could not be executed, as stored in the
+// dead-letter queue.
+type deadLetter struct {
+	// The job, as it was popped from the jobs queue
+	Job string `json:"job"`
+
+	// Why the job could not be executed
+	Error string `json:"error"`
+
+	// When the job was rejected
+	Time int64 `json:"time"`
+}
+
+// deadLetterJob routes a job which could not be executed, e.g. because its
+// test type is unknown to this worker, to the dead-letter queue, if one is
+// configured.
+func (p *workerCmd) deadLetterJob(job string, reason error) {
+	if p.DeadLetterQueue == "" {
+		return
+	}
+
+	j, err := json.Marshal(&deadLetter{
+		Job:   job,
+		Error: reason.Error(),
+		Time:  time.Now().Unix(),
+	})
+	if err != nil {
+		fmt.Printf("Failed to encode dead-letter to JSON: %s\n", err.Error())
+		return
+	}
+
+	if _, err = p._r.RPush(p.DeadLetterQueue, j).Result(); err != nil {
+		fmt.Printf("Failed to route job `%s` to the dead-letter queue: %s\n", job, err.Error())
+	}
+}
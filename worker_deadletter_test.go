@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestRunTestUnknownType(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.DeadLetterQueue = "overseer.dead"
+
+	tst := test.Test{
+		Target:    "example.com",
+		Type:      "unregistered",
+		Input:     "example.com must run unregistered with password 'secret'",
+		Arguments: map[string]string{"password": "secret"},
+	}
+
+	err := p.runTest(0, tst, test.Options{Timeout: 5 * time.Second})
+	if err == nil || !strings.Contains(err.Error(), "unknown test type 'unregistered'") {
+		t.Fatalf("expected an unknown test type error, got: %v", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	result, err := test.ResultFromJSON([]byte(results[0]))
+	if err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	if result.Error == nil || !strings.Contains(*result.Error, "unknown test type") {
+		t.Errorf("expected a clear failure in the result, got: %v", result.Error)
+	}
+	if strings.Contains(result.Input, "secret") {
+		t.Errorf("expected the notified input to be sanitized, got: %s", result.Input)
+	}
+
+	letters, err := p._r.LRange("overseer.dead", 0, -1).Result()
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("expected 1 dead-letter, got %v (%v)", letters, err)
+	}
+	var letter deadLetter
+	if err = json.Unmarshal([]byte(letters[0]), &letter); err != nil {
+		t.Fatalf("failed to decode dead-letter: %s", err)
+	}
+	if letter.Job != tst.Input || !strings.Contains(letter.Error, "unknown test type") {
+		t.Errorf("unexpected dead-letter: %+v", letter)
+	}
+
+	// Without a dead-letter queue the job is only notified
+	p.DeadLetterQueue = ""
+	if err = p.runTest(0, tst, test.Options{Timeout: 5 * time.Second}); err == nil {
+		t.Errorf("expected an unknown test type error")
+	}
+	if count, _ := p._r.LLen("overseer.dead").Result(); count != 1 {
+		t.Errorf("expected no further dead-letters, got %d", count)
+	}
+}
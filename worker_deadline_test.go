@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestJobDeadline(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	// Resolve to multiple addresses, none of which accept connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.3")}, nil
+	}
+
+	// Without a deadline this job would take more than 2 seconds
+	p.Retry = true
+	p.RetryCount = 10
+	p.RetryDelay = 250 * time.Millisecond
+	p.JobDeadline = 500 * time.Millisecond
+
+	tst, err := parser.New().ParseLine("multi.example.com must run tcp with port "+strconv.Itoa(port), nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+
+	start := time.Now()
+	if err = p.runTest(0, tst, test.Options{Timeout: 5 * time.Second}); err != nil {
+		t.Fatalf("failed to run test: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the job to be bounded by its deadline, took %s", elapsed)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 3 {
+		t.Fatalf("expected a result for each address, got %d", len(results))
+	}
+	for _, raw := range results {
+		result, err := test.ResultFromJSON([]byte(raw))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		if result.Error == nil || !strings.Contains(*result.Error, "job deadline of 500ms exceeded") {
+			t.Errorf("expected a deadline failure for %s, got %v", result.Target, result.Error)
+		}
+		if result.Classification != classificationTimeout {
+			t.Errorf("expected a %s classification, got %q", classificationTimeout, result.Classification)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// dependenciesKey is the redis hash holding the latest outcome of each
+// test, for the tests depending on it, keyed by dependencyFields.
+//
+// Unlike the status hash, it is written by all the workers, and keyed by
+// the target as written in the test rather than by its addresses.
+const dependenciesKey = "overseer.dependencies"
+
+// dependencyFields returns the fields of the dependencies hash the outcome
+// of a test is stored in: its type and target (e.g. "postgres
+// db.example.com"), and its test-label, if any.
+func dependencyFields(tst test.Test) []string {
+	fields := []string{tst.Type + " " + tst.Target}
+	if tst.TestLabel != nil {
+		fields = append(fields, *tst.TestLabel)
+	}
+	return fields
+}
+
+// recordDependency stores the outcome of a test for the tests depending on
+// it: failed, against the given target, if failure is not nil.
+func (p *workerCmd) recordDependency(tst test.Test, target string, failure error) {
+	result := &test.Result{
+		Type:   tst.Type,
+		Target: tst.Target,
+		Time:   time.Now().Unix(),
+	}
+	if failure != nil {
+		errorString := failure.Error()
+		result.Target = target
+		result.Error = &errorString
+	}
+
+	j, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Failed to encode test-result to JSON: %s\n", err.Error())
+		return
+	}
+
+	values := map[string]interface{}{}
+	for _, field := range dependencyFields(tst) {
+		values[field] = j
+	}
+	if err = p._r.HMSet(dependenciesKey, values).Err(); err != nil {
+		fmt.Printf("Failed to record the outcome of %s: %s\n", tst.Type+" "+tst.Target, err.Error())
+	}
+}
+
+// dependencyFailure returns an error if the latest recorded outcome of
+// the given dependency is a failure.
+//
+// The dependency is either the test-label of a test, or its type and
+// target as written in the test (e.g. "postgres db.example.com"). If no
+// outcome of the dependency was recorded, it is not regarded as failing.
+func (p *workerCmd) dependencyFailure(dependency string) error {
+	value, err := p._r.HGet(dependenciesKey, dependency).Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Failed to fetch the status of dependency '%s': %s\n", dependency, err.Error())
+		return nil
+	}
+
+	result, err := test.ResultFromJSON([]byte(value))
+	if err != nil || result.Error == nil {
+		return nil
+	}
+
+	return fmt.Errorf("skipped, dependency '%s' is failing against %s: %s", dependency, result.Target, *result.Error)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestDependsOn(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	parse := parser.New()
+	opts := test.Options{Timeout: 5 * time.Second}
+
+	run := func(line string) *test.Result {
+		tst, err := parse.ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, opts)
+
+		results := testResults(t, p)
+		result, err := test.ResultFromJSON([]byte(results[len(results)-1]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		return result
+	}
+
+	const (
+		databasePass = "db.example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with test-label database"
+		databaseFail = "db.example.com must run dumb-test with fail-at 0 with dumb-duration-max 0s with test-label database"
+		app          = "app.example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with depends-on database"
+	)
+
+	// Without any recorded result of the dependency, the test runs
+	if result := run(app); result.Error != nil || result.Classification != "" {
+		t.Errorf("expected the test to run, got %v (%s)", result.Error, result.Classification)
+	}
+
+	// A passing dependency lets the test run, whether the status of the
+	// tests is recorded or not
+	run(databasePass)
+	if result := run(app); result.Error != nil || result.Classification != "" {
+		t.Errorf("expected the test to run, got %v (%s)", result.Error, result.Classification)
+	}
+
+	// A failing dependency skips the test
+	run(databaseFail)
+	result := run(app)
+	if result.Classification != classificationSkippedDependency {
+		t.Errorf("expected the test to be skipped, got classification %q", result.Classification)
+	}
+	if result.Error == nil || !strings.Contains(*result.Error, "dependency 'database' is failing") {
+		t.Errorf("expected the skip reason in the result, got %v", deref(result.Error))
+	}
+	if result.Target != "app.example.com" {
+		t.Errorf("unexpected target of the skipped result: %s", result.Target)
+	}
+
+	// Dependencies can also be referenced by type and target
+	result = run("app.example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with depends-on 'dumb-test db.example.com'")
+	if result.Classification != classificationSkippedDependency {
+		t.Errorf("expected the test to be skipped, got classification %q", result.Classification)
+	}
+
+	// Whose addresses, if resolved, are not part of the reference
+	failing := map[string]bool{"192.0.2.1": true}
+	name := registerFakeTest(&fakeTest{resolve: true, run: failingOn(failing)})
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")}, nil
+	}
+	run("db.example.com must run " + name)
+	result = run("app.example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with depends-on '" + name + " db.example.com'")
+	if result.Error == nil || !strings.Contains(*result.Error, "is failing against 192.0.2.1") {
+		t.Errorf("expected the test to be skipped, got %v", deref(result.Error))
+	}
+	delete(failing, "192.0.2.1")
+	run("db.example.com must run " + name)
+	result = run("app.example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with depends-on '" + name + " db.example.com'")
+	if result.Error != nil {
+		t.Errorf("expected the test to run, got %v", deref(result.Error))
+	}
+
+	// Once the dependency recovers, the test runs again
+	run(databasePass)
+	if result = run(app); result.Error != nil || result.Classification != "" {
+		t.Errorf("expected the test to run, got %v (%s)", result.Error, result.Classification)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsResolveFunc resolves a host, returning the TTL of its records, or zero
+// if it is not known.
+type dnsResolveFunc func(host string) ([]net.IP, time.Duration, error)
+
+// dnsCacheEntry is the cached addresses of a host.
+type dnsCacheEntry struct {
+	host    string
+	ips     []net.IP
+	expires time.Time
+}
+
+// dnsCache caches the addresses of the targets of the tests, shared by all
+// the jobs, so that the many tests of a host don't resolve it each time.
+//
+// The addresses are kept for the TTL of their records, capped by the TTL
+// of the cache, and the least recently used hosts are evicted once the
+// cache is full. Failures are not cached.
+type dnsCache struct {
+	ttl     time.Duration
+	size    int
+	resolve dnsResolveFunc
+	now     func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// newDNSCache returns a cache of up to size hosts, resolved via the given
+// function.
+func newDNSCache(ttl time.Duration, size int, resolve dnsResolveFunc) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		size:    size,
+		resolve: resolve,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// lookup returns the addresses of the host, from the cache if they have
+// not expired.
+func (c *dnsCache) lookup(host string) ([]net.IP, error) {
+	c.lock.Lock()
+	if element, ok := c.entries[host]; ok {
+		entry := element.Value.(*dnsCacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(element)
+			c.lock.Unlock()
+			return entry.ips, nil
+		}
+		c.lru.Remove(element)
+		delete(c.entries, host)
+	}
+	c.lock.Unlock()
+
+	ips, ttl, err := c.resolve(host)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 || ttl > c.ttl {
+		ttl = c.ttl
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[host]; ok {
+		// Resolved concurrently by another job
+		c.lru.Remove(element)
+	}
+	c.entries[host] = c.lru.PushFront(&dnsCacheEntry{host: host, ips: ips, expires: c.now().Add(ttl)})
+
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*dnsCacheEntry).host)
+	}
+
+	return ips, nil
+}
+
+// lookupIPWithTTL returns a function resolving hosts via the nameserver of
+// the system, to learn the TTL of their records, falling back to the
+// system resolver, with an unknown TTL, for the names the nameserver has
+// no addresses for, e.g. the ones of /etc/hosts, or relative ones.
+func lookupIPWithTTL(timeout time.Duration) dnsResolveFunc {
+	return func(host string) ([]net.IP, time.Duration, error) {
+		if config, err := dns.ClientConfigFromFile("/etc/resolv.conf"); err == nil && len(config.Servers) > 0 {
+			nameserver := net.JoinHostPort(config.Servers[0], config.Port)
+			if ips, ttl := queryIPWithTTL(host, nameserver, timeout); len(ips) > 0 {
+				return ips, ttl, nil
+			}
+		}
+
+		ips, err := net.LookupIP(host)
+		return ips, 0, err
+	}
+}
+
+// queryIPWithTTL returns the A/AAAA records of the host, as answered by
+// the nameserver, along with their lowest TTL, including the one of any
+// CNAME leading to them.
+func queryIPWithTTL(host string, nameserver string, timeout time.Duration) ([]net.IP, time.Duration) {
+	client := &dns.Client{Timeout: timeout}
+
+	var ips []net.IP
+	var ttl uint32
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(host), qtype)
+
+		response, _, err := client.Exchange(msg, nameserver)
+		if err != nil || response.Rcode != dns.RcodeSuccess {
+			continue
+		}
+
+		for _, rr := range response.Answer {
+			switch record := rr.(type) {
+			case *dns.A:
+				ips = append(ips, record.A)
+			case *dns.AAAA:
+				ips = append(ips, record.AAAA)
+			}
+			if ttl == 0 || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+	}
+
+	return ips, time.Duration(ttl) * time.Second
+}
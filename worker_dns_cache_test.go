@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestDNSCache(t *testing.T) {
+	var lookups int
+	ttls := map[string]time.Duration{"short.example.com": 10 * time.Second, "long.example.com": time.Hour}
+	cache := newDNSCache(time.Minute, 2, func(host string) ([]net.IP, time.Duration, error) {
+		lookups++
+		if host == "missing.example.com" {
+			return nil, 0, errors.New("no such host")
+		}
+		return []net.IP{net.ParseIP("10.0.0.1")}, ttls[host], nil
+	})
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	lookup := func(host string, expected int) {
+		t.Helper()
+		if _, err := cache.lookup(host); err != nil {
+			t.Fatalf("failed to lookup %s: %s", host, err)
+		}
+		if lookups != expected {
+			t.Errorf("expected %d lookups after %s, got %d", expected, host, lookups)
+		}
+	}
+
+	// Hits within the TTL of the records avoid repeated lookups
+	lookup("short.example.com", 1)
+	lookup("short.example.com", 1)
+	now = now.Add(11 * time.Second)
+	lookup("short.example.com", 2)
+
+	// The TTL of the records is capped by the one of the cache
+	lookup("long.example.com", 3)
+	now = now.Add(59 * time.Second)
+	lookup("long.example.com", 3)
+	now = now.Add(2 * time.Second)
+	lookup("long.example.com", 4)
+
+	// Records without a known TTL are kept for the TTL of the cache
+	lookup("other.example.com", 5)
+	now = now.Add(59 * time.Second)
+	lookup("other.example.com", 5)
+
+	// The least recently used host is evicted, the cache being full
+	lookup("long.example.com", 5)
+	lookup("short.example.com", 6)
+	lookup("long.example.com", 6)
+	lookup("other.example.com", 7)
+
+	// Failures are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := cache.lookup("missing.example.com"); err == nil {
+			t.Errorf("expected the lookup of a missing host to fail")
+		}
+	}
+	if lookups != 9 {
+		t.Errorf("expected failures to be looked up each time, got %d lookups", lookups)
+	}
+}
+
+func TestDNSCacheWorker(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+
+	var lookups int32
+	p._dnsCache = newDNSCache(time.Minute, 10, func(host string) ([]net.IP, time.Duration, error) {
+		atomic.AddInt32(&lookups, 1)
+		return []net.IP{net.ParseIP("127.0.0.1")}, 0, nil
+	})
+
+	// The jobs of the same host share its addresses
+	for _, port := range []string{strconv.Itoa(listener.Addr().(*net.TCPAddr).Port), "1"} {
+		tst, errParse := parser.New().ParseLine("app.example.com must run tcp with port "+port, nil)
+		if errParse != nil {
+			t.Fatalf("failed to parse test: %s", errParse)
+		}
+		p.runTest(0, tst, test.Options{Timeout: 2 * time.Second})
+	}
+
+	if lookups != 1 {
+		t.Errorf("expected a single lookup, got %d", lookups)
+	}
+	if results := testResults(t, p); len(results) != 2 {
+		t.Errorf("expected 2 results, got %d", len(results))
+	}
+}
+
+func TestQueryIPWithTTL(t *testing.T) {
+	resolver, stop := startResolver(t, "10.0.0.1")
+	defer stop()
+
+	ips, ttl := queryIPWithTTL("app.example.com", resolver, 2*time.Second)
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("unexpected addresses: %v", ips)
+	}
+	if ttl != time.Minute {
+		t.Errorf("expected the TTL of the record, got %s", ttl)
+	}
+}
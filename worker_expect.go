@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// expectedResult returns the result of a protocol-test, as compared with
+// the expected one: a test expected to fail passes if the protocol-test
+// failed, and fails if it passed.
+func expectedResult(tst test.Test, err error) error {
+	if !tst.ExpectFailure {
+		return err
+	}
+	if err == nil {
+		return errors.New("test passed, but was expected to fail")
+	}
+	return nil
+}
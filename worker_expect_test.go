@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestExpectResult(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	parse := parser.New()
+	opts := test.Options{Timeout: 5 * time.Second}
+
+	run := func(line string) *test.Result {
+		tst, err := parse.ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, opts)
+
+		results := testResults(t, p)
+		result, err := test.ResultFromJSON([]byte(results[len(results)-1]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		return result
+	}
+
+	// A test expected to fail, which fails, passes
+	if result := run("example.com must run dumb-test with fail-at 0 with dumb-duration-max 0s with expect-result fail"); result.Error != nil {
+		t.Errorf("expected the failure to be expected, got %s", *result.Error)
+	}
+
+	// And is notified if it passes
+	result := run("example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with expect-result fail")
+	if result.Error == nil || !strings.Contains(*result.Error, "expected to fail") {
+		t.Errorf("expected the unexpected pass to be notified, got %v", deref(result.Error))
+	}
+
+	// Tests expected to pass are unchanged
+	if result = run("example.com must run dumb-test with fail-at 0 with dumb-duration-max 0s with expect-result pass"); result.Error == nil {
+		t.Errorf("expected the failure to be notified")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestFailuresBeforeNotify(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.FailuresBeforeNotify = 3
+
+	tst := test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh"}
+	fail := func() { p.notify(tst, nil, errors.New("connection refused"), nil) }
+	pass := func() { p.notify(tst, nil, nil, nil) }
+
+	// Not crossing the threshold
+	fail()
+	fail()
+	if results := testResults(t, p); len(results) != 0 {
+		t.Fatalf("expected no notification below the threshold, got %d", len(results))
+	}
+
+	// Crossing the threshold
+	fail()
+	if results := testResults(t, p); len(results) != 1 {
+		t.Fatalf("expected a notification once the threshold is crossed, got %d", len(results))
+	}
+
+	// A success resets the counter
+	pass()
+	fail()
+	fail()
+	if results := testResults(t, p); len(results) != 2 {
+		t.Fatalf("expected only the success to be notified after the reset, got %d results", len(results))
+	}
+
+	fail()
+	if results := testResults(t, p); len(results) != 3 {
+		t.Fatalf("expected a new failure notification, got %d results", len(results))
+	}
+}
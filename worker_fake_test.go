@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cmaster11/overseer/protocols"
+	"github.com/cmaster11/overseer/test"
+)
+
+// fakeTest is a protocol-test for the worker tests, which records the
+// targets it runs against, and then behaves as its run function says,
+// passing if there is none.
+type fakeTest struct {
+	// Whether the hostnames of the tests are resolved first
+	resolve bool
+
+	// How long the test may take, if longer than its timeout
+	maxDuration time.Duration
+
+	// Runs the test, e.g. to fail it, or block it
+	run func(ctx context.Context, target string, opts test.Options) error
+
+	lock    sync.Mutex
+	targets []string
+}
+
+func (s *fakeTest) Arguments() map[string]string { return map[string]string{} }
+func (s *fakeTest) Example() string              { return "" }
+func (s *fakeTest) ShouldResolveHostname() bool  { return s.resolve }
+func (s *fakeTest) GetUniqueHashForTest(tst test.Test, opts test.Options) *string {
+	return nil
+}
+
+func (s *fakeTest) MaxDuration(tst test.Test, opts test.Options) time.Duration {
+	return s.maxDuration
+}
+
+func (s *fakeTest) RunTest(ctx context.Context, tst test.Test, target string, opts test.Options) error {
+	s.lock.Lock()
+	s.targets = append(s.targets, target)
+	s.lock.Unlock()
+
+	if s.run == nil {
+		return nil
+	}
+	return s.run(ctx, target, opts)
+}
+
+// ran returns the targets the test ran against, in order.
+func (s *fakeTest) ran() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.targets...)
+}
+
+// reset forgets the targets the test ran against.
+func (s *fakeTest) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.targets = nil
+}
+
+// fakeTests is the number of fake protocol-tests registered so far.
+var fakeTests int32
+
+// registerFakeTest registers the fake protocol-test under a name of its
+// own, so that the tests don't share testers through the registry, and
+// returns the name.
+func registerFakeTest(fake *fakeTest) string {
+	name := fmt.Sprintf("fake-%d", atomic.AddInt32(&fakeTests, 1))
+	protocols.Register(name, func() protocols.ProtocolTest {
+		return fake
+	})
+	return name
+}
+
+// failingOn returns a run function failing against the given targets.
+func failingOn(failing map[string]bool) func(context.Context, string, test.Options) error {
+	return func(ctx context.Context, target string, opts test.Options) error {
+		if failing[target] {
+			return errors.New("network unreachable")
+		}
+		return nil
+	}
+}
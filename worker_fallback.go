@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// fallbackQueuesKey is the set, on the fallback redis, of the queues
+// holding results which could not be published to the primary one.
+const fallbackQueuesKey = "overseer.fallback.queues"
+
+// fallbackDrainInterval is how often the results buffered on the fallback
+// redis are moved back to the primary one.
+const fallbackDrainInterval = 10 * time.Second
+
+// publishResult pushes a result to the given queue of the primary redis,
+// falling back to the warm standby one, if configured, when the primary is
+// unreachable.
+func (p *workerCmd) publishResult(queue string, payload []byte) error {
+	err := p._r.RPush(queue, payload).Err()
+	if err == nil || p._fallback == nil {
+		return err
+	}
+
+	fmt.Printf("Result addition failed: %s, buffering it on the fallback redis\n", err)
+
+	if _, err = p._fallback.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(queue, payload)
+		pipe.SAdd(fallbackQueuesKey, queue)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to buffer the result on the fallback redis: %s", err.Error())
+	}
+
+	return nil
+}
+
+// drainFallback moves the results buffered on the fallback redis back to
+// the primary one, in order, once it is reachable again.
+func (p *workerCmd) drainFallback() {
+	queues, err := p._fallback.SMembers(fallbackQueuesKey).Result()
+	if err != nil {
+		fmt.Printf("Failed to list the queues of the fallback redis: %s\n", err.Error())
+		return
+	}
+	if len(queues) == 0 {
+		return
+	}
+
+	if err = p._r.Ping().Err(); err != nil {
+		p.verbose(fmt.Sprintf("Primary redis still unreachable, not draining the fallback: %s\n", err.Error()))
+		return
+	}
+
+	for _, queue := range queues {
+		drained := 0
+		for {
+			payload, err := p._fallback.LPop(queue).Result()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				fmt.Printf("Failed to read the results buffered on the fallback redis: %s\n", err.Error())
+				return
+			}
+
+			if err = p._r.RPush(queue, payload).Err(); err != nil {
+				// Put the result back in front, and retry later
+				p._fallback.LPush(queue, payload)
+				fmt.Printf("Failed to drain the fallback redis: %s\n", err.Error())
+				return
+			}
+			drained++
+		}
+
+		//
+		// A result might have been buffered since the queue was found
+		// empty, in which case the queue must be kept.
+		//
+		p._fallback.SRem(fallbackQueuesKey, queue)
+		if length, _ := p._fallback.LLen(queue).Result(); length > 0 {
+			p._fallback.SAdd(fallbackQueuesKey, queue)
+		}
+
+		if drained > 0 {
+			fmt.Printf("Moved %d results from the fallback redis back to %s\n", drained, queue)
+		}
+	}
+}
+
+// drainFallbackLoop periodically drains the fallback redis.
+func (p *workerCmd) drainFallbackLoop() {
+	for range time.Tick(fallbackDrainInterval) {
+		p.drainFallback()
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+func TestFallbackRedis(t *testing.T) {
+	p, primary := newTestWorker(t)
+	defer primary.Close()
+
+	fallback, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis server: %s", err)
+	}
+	defer fallback.Close()
+	p._fallback = redis.NewClient(&redis.Options{Addr: fallback.Addr()})
+
+	notify := func(target string) {
+		tst := test.Test{Target: target, Type: "ssh", Input: target + " must run ssh"}
+		if err := p.notify(tst, nil, errors.New("connection refused"), nil); err != nil {
+			t.Fatalf("failed to notify: %s", err)
+		}
+	}
+
+	// Results are published to the primary redis while it is up
+	notify("192.0.2.1")
+	if results, _ := primary.List("overseer.results"); len(results) != 1 {
+		t.Fatalf("expected 1 result on the primary redis, got %d", len(results))
+	}
+
+	// And buffered on the fallback one while it is down
+	primary.Close()
+	notify("192.0.2.2")
+	notify("192.0.2.3")
+
+	buffered, _ := fallback.List("overseer.results")
+	if len(buffered) != 2 {
+		t.Fatalf("expected 2 results on the fallback redis, got %d", len(buffered))
+	}
+
+	// Nothing is drained while the primary is down
+	p.drainFallback()
+	if buffered, _ = fallback.List("overseer.results"); len(buffered) != 2 {
+		t.Fatalf("expected the results to stay on the fallback redis, got %d", len(buffered))
+	}
+
+	// Once the primary recovers, the buffered results are moved back, in order
+	if err = primary.Restart(); err != nil {
+		t.Fatalf("failed to restart redis server: %s", err)
+	}
+	p.drainFallback()
+
+	results, _ := primary.List("overseer.results")
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results on the primary redis, got %d", len(results))
+	}
+	for i, target := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		result, err := test.ResultFromJSON([]byte(results[i]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		if result.Target != target {
+			t.Errorf("expected result %d to be for %s, got %s", i, target, result.Target)
+		}
+	}
+
+	if fallback.Exists("overseer.results") || fallback.Exists(fallbackQueuesKey) {
+		t.Errorf("expected the fallback redis to be drained")
+	}
+}
+
+func TestFallbackRedisDown(t *testing.T) {
+	p, primary := newTestWorker(t)
+	primary.Close()
+
+	// Without a fallback, the failure is reported
+	tst := test.Test{Target: "192.0.2.1", Type: "ssh", Input: "192.0.2.1 must run ssh"}
+	if err := p.notify(tst, nil, nil, nil); err == nil {
+		t.Errorf("expected the result addition to fail")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// testEndFunc handles the result of a test against one of its targets.
+type testEndFunc func(startTime time.Time, target string, attempts uint, result error, outcome *testOutcome)
+
+// preferFamily returns the targets with the addresses of the preferred
+// family ("ipv4" or "ipv6") first, otherwise keeping their order.
+func preferFamily(targets []string, prefer string) []string {
+	if prefer == "" {
+		return targets
+	}
+
+	var preferred, others []string
+	for _, target := range targets {
+		ip := net.ParseIP(target)
+		isIPv4 := ip != nil && ip.To4() != nil
+		isIPv6 := ip != nil && ip.To4() == nil
+		if (prefer == "ipv4" && isIPv4) || (prefer == "ipv6" && isIPv6) {
+			preferred = append(preferred, target)
+		} else {
+			others = append(others, target)
+		}
+	}
+	return append(preferred, others...)
+}
+
+// runTargetsUntilPass runs a test against its targets in order, stopping at
+// the first one it passes against, for tests which only need any of the
+// addresses of their target to work.
+//
+// The failures against the previous targets are only notified if the test
+// fails against all of them.
+func (p *workerCmd) runTargetsUntilPass(workerPrefix string, targets []string, runTarget func(target string, end testEndFunc), end testEndFunc) {
+	var failures []func()
+
+	for _, target := range targets {
+		passed := false
+		runTarget(target, func(startTime time.Time, target string, attempts uint, result error, outcome *testOutcome) {
+			if result == nil {
+				passed = true
+				end(startTime, target, attempts, result, outcome)
+				return
+			}
+
+			// Keep the duration of the test, not of the whole run
+			failedAt := time.Now()
+			failures = append(failures, func() {
+				end(startTime.Add(time.Since(failedAt)), target, attempts, result, outcome)
+			})
+		})
+
+		if passed {
+			p.verbose(fmt.Sprintf(workerPrefix+"Test passed against %s, skipping the other addresses\n", target))
+			return
+		}
+	}
+
+	for _, failure := range failures {
+		failure()
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestPreferFamily(t *testing.T) {
+	targets := []string{"192.0.2.1", "2001:db8::1", "192.0.2.2", "2001:db8::2"}
+
+	if got := preferFamily(targets, "ipv6"); !reflect.DeepEqual(got, []string{"2001:db8::1", "2001:db8::2", "192.0.2.1", "192.0.2.2"}) {
+		t.Errorf("expected the IPv6 addresses first, got %v", got)
+	}
+	if got := preferFamily(targets, "ipv4"); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.2", "2001:db8::1", "2001:db8::2"}) {
+		t.Errorf("expected the IPv4 addresses first, got %v", got)
+	}
+	if got := preferFamily(targets, ""); !reflect.DeepEqual(got, targets) {
+		t.Errorf("expected the order to be kept, got %v", got)
+	}
+}
+
+func TestAnyFamily(t *testing.T) {
+	failing := map[string]bool{}
+	family := &fakeTest{resolve: true, run: failingOn(failing)}
+	name := registerFakeTest(family)
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	// A dual-stack target
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}, nil
+	}
+
+	run := func(line string) []*test.Result {
+		family.reset()
+		server.Del("overseer.results")
+
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, test.Options{Timeout: time.Second})
+
+		var results []*test.Result
+		for _, raw := range testResults(t, p) {
+			result, _ := test.ResultFromJSON([]byte(raw))
+			results = append(results, result)
+		}
+		return results
+	}
+
+	// The preferred family passes, so the other one is never tested
+	results := run("example.com must run " + name + " with prefer ipv6 with family-mode any")
+	if !reflect.DeepEqual(family.ran(), []string{"2001:db8::1"}) {
+		t.Errorf("expected only the IPv6 address to be tested, got %v", family.ran())
+	}
+	if len(results) != 1 || results[0].Target != "2001:db8::1" || results[0].Error != nil {
+		t.Errorf("expected a single passing result for the IPv6 address, got %+v", results)
+	}
+
+	// The preferred family fails, so the other one is tested, and passes
+	failing["2001:db8::1"] = true
+	results = run("example.com must run " + name + " with prefer ipv6 with family-mode any")
+	if !reflect.DeepEqual(family.ran(), []string{"2001:db8::1", "192.0.2.1"}) {
+		t.Errorf("expected the IPv6 address to be tested first, got %v", family.ran())
+	}
+	if len(results) != 1 || results[0].Target != "192.0.2.1" || results[0].Error != nil {
+		t.Errorf("expected a single passing result for the IPv4 address, got %+v", results)
+	}
+
+	// Both fail, and are notified
+	failing["192.0.2.1"] = true
+	results = run("example.com must run " + name + " with prefer ipv4 with family-mode any")
+	if !reflect.DeepEqual(family.ran(), []string{"192.0.2.1", "2001:db8::1"}) {
+		t.Errorf("expected the IPv4 address to be tested first, got %v", family.ran())
+	}
+	if len(results) != 2 || results[0].Error == nil || results[1].Error == nil {
+		t.Errorf("expected both failures to be notified, got %+v", results)
+	}
+
+	// By default, all the addresses are tested
+	delete(failing, "192.0.2.1")
+	if results = run("example.com must run " + name + " with prefer ipv6"); len(results) != 2 || len(family.ran()) != 2 {
+		t.Errorf("expected both addresses to be tested, got %v", family.ran())
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runTargetsMinHealthy runs a test against all of its targets, in
+// parallel, and notifies a single result for the original target, which
+// passes if the test passed against at least minHealthy of them, e.g. for
+// anycast or round-robin services which stay available while some of
+// their addresses are down.
+//
+// This implements both `min-healthy-ips` and `threshold`, the latter
+// being turned into a number of targets.
+func (p *workerCmd) runTargetsMinHealthy(workerPrefix string, original string, minHealthy int, targets []string, runTarget func(target string, end testEndFunc), end testEndFunc) {
+	lock := &sync.Mutex{}
+	var ends []*targetEnd
+
+	wg := &sync.WaitGroup{}
+	for _, target := range targets {
+		target := target
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runTarget(target, func(startTime time.Time, target string, attempts uint, result error, outcome *testOutcome) {
+				lock.Lock()
+				defer lock.Unlock()
+				ends = append(ends, &targetEnd{startTime, target, attempts, result, outcome})
+			})
+		}()
+	}
+	wg.Wait()
+
+	summary, result := healthySummary(minHealthy, ends)
+	if result != nil {
+		p.verbose(fmt.Sprintf(workerPrefix+"Test failed: %s\n", result.Error()))
+	}
+
+	// The single result covers the whole run, and its retries
+	startTime := time.Now()
+	var attempts uint
+	for _, e := range ends {
+		if e.startTime.Before(startTime) {
+			startTime = e.startTime
+		}
+		if e.attempts > attempts {
+			attempts = e.attempts
+		}
+	}
+
+	end(startTime, original, attempts, result, &testOutcome{Details: &summary})
+}
+
+// healthySummary returns the result of the test against each of its
+// targets, along with an error if it passed against less than minHealthy
+// of them.
+func healthySummary(minHealthy int, ends []*targetEnd) (string, error) {
+	sort.Slice(ends, func(i, j int) bool { return ends[i].target < ends[j].target })
+
+	healthy := 0
+	var lines []string
+	var failures []string
+	for _, e := range ends {
+		if e.result == nil {
+			healthy++
+			lines = append(lines, fmt.Sprintf("%s: passed", e.target))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", e.target, e.result.Error()))
+		failures = append(failures, fmt.Sprintf("%s (%s)", e.target, e.result.Error()))
+	}
+
+	summary := fmt.Sprintf("%d of %d addresses passed\n%s", healthy, len(ends), strings.Join(lines, "\n"))
+	if healthy >= minHealthy {
+		return summary, nil
+	}
+
+	err := fmt.Errorf("only %d of %d addresses passed, at least %d required", healthy, len(ends), minHealthy)
+	if len(failures) > 0 {
+		err = fmt.Errorf("%s: %s", err.Error(), strings.Join(failures, ", "))
+	}
+	return summary, err
+}
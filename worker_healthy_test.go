@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestMinHealthyIPs(t *testing.T) {
+	failing := map[string]bool{}
+	healthy := &fakeTest{resolve: true, run: failingOn(failing)}
+	name := registerFakeTest(healthy)
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	// Five edges of an anycast service
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{
+			net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3"),
+			net.ParseIP("192.0.2.4"), net.ParseIP("192.0.2.5"),
+		}, nil
+	}
+
+	run := func(line string) []*test.Result {
+		healthy.reset()
+		server.Del("overseer.results")
+
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, test.Options{Timeout: time.Second})
+
+		var results []*test.Result
+		for _, raw := range testResults(t, p) {
+			result, _ := test.ResultFromJSON([]byte(raw))
+			results = append(results, result)
+		}
+		return results
+	}
+
+	// Two edges down, three healthy: enough
+	failing["192.0.2.2"] = true
+	failing["192.0.2.4"] = true
+	results := run("edge.example.com must run " + name + " with min-healthy-ips 3")
+	if len(healthy.ran()) != 5 {
+		t.Errorf("expected all the addresses to be tested, got %v", healthy.ran())
+	}
+	if len(results) != 1 || results[0].Target != "edge.example.com" || results[0].Error != nil {
+		t.Fatalf("expected a single passing result for the target, got %+v", results)
+	}
+	if results[0].Details == nil || !strings.HasPrefix(*results[0].Details, "3 of 5 addresses passed\n") ||
+		!strings.Contains(*results[0].Details, "192.0.2.4: network unreachable") {
+		t.Errorf("expected the result of each address in the details, got %v", results[0].Details)
+	}
+
+	// A third edge down: not enough
+	failing["192.0.2.5"] = true
+	results = run("edge.example.com must run " + name + " with min-healthy-ips 3")
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("expected a single failing result for the target, got %+v", results)
+	}
+	expected := "only 2 of 5 addresses passed, at least 3 required: 192.0.2.2 (network unreachable), 192.0.2.4 (network unreachable), 192.0.2.5 (network unreachable)"
+	if *results[0].Error != expected {
+		t.Errorf("unexpected error:\n got %s\nwant %s", *results[0].Error, expected)
+	}
+
+	// Requiring more addresses than resolved fails, even if all pass
+	for ip := range failing {
+		delete(failing, ip)
+	}
+	results = run("edge.example.com must run " + name + " with min-healthy-ips 6")
+	if len(results) != 1 || results[0].Error == nil || *results[0].Error != "only 5 of 5 addresses passed, at least 6 required" {
+		t.Errorf("expected the test to fail, got %+v", results)
+	}
+
+	// Without the option, each address is notified
+	results = run("edge.example.com must run " + name)
+	var targets []string
+	for _, result := range results {
+		targets = append(targets, result.Target)
+	}
+	sort.Strings(targets)
+	if strings.Join(targets, " ") != "192.0.2.1 192.0.2.2 192.0.2.3 192.0.2.4 192.0.2.5" {
+		t.Errorf("expected a result per address, got %v", targets)
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	failing := map[string]bool{}
+	threshold := &fakeTest{resolve: true, run: failingOn(failing)}
+	name := registerFakeTest(threshold)
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{
+			net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.3"),
+			net.ParseIP("192.0.2.4"), net.ParseIP("192.0.2.5"),
+		}, nil
+	}
+
+	run := func(line string) []*test.Result {
+		server.Del("overseer.results")
+
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, test.Options{Timeout: time.Second})
+
+		var results []*test.Result
+		for _, raw := range testResults(t, p) {
+			result, _ := test.ResultFromJSON([]byte(raw))
+			results = append(results, result)
+		}
+		return results
+	}
+
+	// Degraded but acceptable: 4 of 5 pass, 80% is required
+	failing["192.0.2.3"] = true
+	results := run("service.example.com must run " + name + " with threshold 80%")
+	if len(results) != 1 || results[0].Target != "service.example.com" || results[0].Error != nil {
+		t.Errorf("expected a single passing result, got %+v", results)
+	}
+
+	// Below the threshold
+	failing["192.0.2.5"] = true
+	results = run("service.example.com must run " + name + " with threshold 80%")
+	if len(results) != 1 || results[0].Error == nil || !strings.HasPrefix(*results[0].Error, "only 3 of 5 addresses passed, at least 4 required") {
+		t.Errorf("expected a single failing result, got %+v", results)
+	}
+
+	// But above a lower one, as a fraction or a count
+	if results = run("service.example.com must run " + name + " with threshold 0.6"); len(results) != 1 || results[0].Error != nil {
+		t.Errorf("expected a single passing result, got %+v", results)
+	}
+	if results = run("service.example.com must run " + name + " with threshold 3"); len(results) != 1 || results[0].Error != nil {
+		t.Errorf("expected a single passing result, got %+v", results)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// preTestHookEnv returns the environment variables describing a test to
+// the pre-test hook.
+//
+// Only the sanitized input is exposed, so that secrets never leak into the
+// hook, or into its logs.
+func preTestHookEnv(tst *test.Test) []string {
+	env := []string{
+		"OVERSEER_TEST_TYPE=" + tst.Type,
+		"OVERSEER_TEST_TARGET=" + tst.Target,
+		"OVERSEER_TEST_INPUT=" + tst.Sanitize(),
+	}
+	if tst.TestLabel != nil {
+		env = append(env, "OVERSEER_TEST_LABEL="+*tst.TestLabel)
+	}
+	return env
+}
+
+// runPreTestHook runs the pre-test hook via the shell, e.g. to refresh a
+// token file a test reads, within the global timeout.
+//
+// The test is nil when the hook runs once at startup.
+func (p *workerCmd) runPreTestHook(tst *test.Test) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", p.PreTestHook)
+	cmd.Env = os.Environ()
+	if tst != nil {
+		cmd.Env = append(cmd.Env, preTestHookEnv(tst)...)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("pre-test hook timed out after %s", p.Timeout)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("pre-test hook failed: %s", err.Error())
+		if out := strings.TrimSpace(string(output)); out != "" {
+			msg += ", output: " + out
+		}
+		return fmt.Errorf("%s", msg)
+	}
+
+	p.verbose(fmt.Sprintf("Pre-test hook output: %s\n", strings.TrimSpace(string(output))))
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestPreTestHook(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "overseer-hook")
+	if err != nil {
+		t.Fatalf("failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, "env")
+
+	p.PreTestHook = "env | grep ^OVERSEER_TEST_ | sort > " + envFile
+
+	tst, err := parser.New().ParseLine("example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s with test-label web", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+	opts := test.Options{Timeout: 5 * time.Second}
+
+	p.runTest(0, tst, opts)
+
+	env, err := ioutil.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("expected the hook to run, got %s", err)
+	}
+	expected := []string{
+		"OVERSEER_TEST_INPUT=example.com must run dumb-test with dumb-duration-max '0s' with fail-at '1'",
+		"OVERSEER_TEST_LABEL=web",
+		"OVERSEER_TEST_TARGET=example.com",
+		"OVERSEER_TEST_TYPE=dumb-test",
+	}
+	if got := strings.TrimSpace(string(env)); got != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected hook environment:\n%s", got)
+	}
+
+	// A failing hook is only logged by default
+	p.PreTestHook = "echo 'token refresh failed'; exit 1"
+	p.runTest(0, tst, opts)
+	results := testResults(t, p)
+	if result, _ := test.ResultFromJSON([]byte(results[len(results)-1])); result.Error != nil {
+		t.Fatalf("expected the test to run anyway, got %s", *result.Error)
+	}
+
+	// Unless it must abort the test
+	p.PreTestHookAbort = true
+	p.runTest(0, tst, opts)
+	results = testResults(t, p)
+	result, _ := test.ResultFromJSON([]byte(results[len(results)-1]))
+	if result.Error == nil || !strings.Contains(*result.Error, "token refresh failed") {
+		t.Fatalf("expected the hook failure in the result, got %v", deref(result.Error))
+	}
+}
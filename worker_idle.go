@@ -0,0 +1,38 @@
+package main
+
+import "time"
+
+// The first delay between the polls of an empty queue
+const minIdleBackoff = 50 * time.Millisecond
+
+// idleBackoff is the delay between the polls of an empty queue, doubled
+// after each empty poll up to a cap, and reset once a job is found.
+type idleBackoff struct {
+	min     time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+// newIdleBackoff returns a backoff starting at min, and growing up to max.
+func newIdleBackoff(min time.Duration, max time.Duration) *idleBackoff {
+	if max < min {
+		max = min
+	}
+	return &idleBackoff{min: min, max: max}
+}
+
+// next returns the delay before polling the queue again, after an empty
+// poll.
+func (b *idleBackoff) next() time.Duration {
+	if b.current == 0 {
+		b.current = b.min
+	} else if b.current *= 2; b.current > b.max {
+		b.current = b.max
+	}
+	return b.current
+}
+
+// reset restarts the backoff from its minimum, once a job is found.
+func (b *idleBackoff) reset() {
+	b.current = 0
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleBackoff(t *testing.T) {
+	b := newIdleBackoff(50*time.Millisecond, 300*time.Millisecond)
+
+	// The delay doubles after each empty poll, up to the cap
+	for i, expected := range []time.Duration{50, 100, 200, 300, 300} {
+		if delay := b.next(); delay != expected*time.Millisecond {
+			t.Errorf("poll %d: expected a delay of %s, got %s", i, expected*time.Millisecond, delay)
+		}
+	}
+
+	// A job resets it
+	b.reset()
+	if delay := b.next(); delay != 50*time.Millisecond {
+		t.Errorf("expected the delay to be reset, got %s", delay)
+	}
+
+	// A cap below the first delay is raised to it
+	if delay := newIdleBackoff(50*time.Millisecond, 0).next(); delay != 50*time.Millisecond {
+		t.Errorf("expected the first delay, got %s", delay)
+	}
+}
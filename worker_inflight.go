@@ -0,0 +1,29 @@
+package main
+
+// inflightLimiter caps the number of protocol-tests running at once across
+// the whole worker, whatever the size of the pool, and however many targets
+// each test resolves to, bounding the memory and file descriptors in use.
+//
+// A nil limiter allows any number of tests.
+type inflightLimiter chan struct{}
+
+func newInflightLimiter(max uint) inflightLimiter {
+	if max == 0 {
+		return nil
+	}
+	return make(inflightLimiter, max)
+}
+
+// acquire blocks until a protocol-test is allowed to run.
+func (l inflightLimiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// release frees the slot of a protocol-test which finished running.
+func (l inflightLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
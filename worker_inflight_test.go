@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestMaxInflight(t *testing.T) {
+	// Records how many tests run at once
+	var running, peak int32
+	name := registerFakeTest(&fakeTest{resolve: true, run: func(ctx context.Context, target string, opts test.Options) error {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			highest := atomic.LoadInt32(&peak)
+			if current <= highest || atomic.CompareAndSwapInt32(&peak, highest, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	// Each job runs against three targets in parallel
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}, nil
+	}
+	p._inflight = newInflightLimiter(2)
+
+	tst, err := parser.New().ParseLine("multi.example.com must run "+name, nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+
+	// Simulate a pool of workers running jobs at once
+	var wg sync.WaitGroup
+	for i := uint(0); i < 4; i++ {
+		wg.Add(1)
+		go func(workerIdx uint) {
+			defer wg.Done()
+			if err := p.runTest(workerIdx, tst, test.Options{Timeout: time.Second}); err != nil {
+				t.Errorf("failed to run test: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 tests in flight, got %d", peak)
+	}
+	if peak < 2 {
+		t.Errorf("expected the tests to run concurrently up to the cap, got %d", peak)
+	}
+	if results := testResults(t, p); len(results) != 12 {
+		t.Errorf("expected a result for each target of each job, got %d", len(results))
+	}
+}
+
+func TestInflightLimiterDisabled(t *testing.T) {
+	l := newInflightLimiter(0)
+	if l != nil {
+		t.Fatalf("expected a nil limiter when the cap is disabled")
+	}
+
+	// A disabled limiter never blocks
+	for i := 0; i < 10; i++ {
+		l.acquire()
+	}
+	l.release()
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// jitterDelay returns a random duration between zero and max (included),
+// used to spread in time the work of workers started all at once.
+func jitterDelay(max time.Duration, rnd *rand.Rand) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rnd.Int63n(int64(max) + 1))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestJitterDelay(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	if delay := jitterDelay(0, rnd); delay != 0 {
+		t.Errorf("expected no delay when disabled, got %s", delay)
+	}
+
+	max := 30 * time.Second
+	var total time.Duration
+	for i := 0; i < 1000; i++ {
+		delay := jitterDelay(max, rnd)
+		if delay < 0 || delay > max {
+			t.Fatalf("delay %s out of bounds [0, %s]", delay, max)
+		}
+		total += delay
+	}
+
+	// The delays should be spread, not e.g. always zero
+	if average := total / 1000; average < max/4 || average > max*3/4 {
+		t.Errorf("unexpected average delay %s", average)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// kafkaMaxBatch is the maximum number of results sent in a single
+// produce request.
+const kafkaMaxBatch = 500
+
+// kafkaWriter writes messages to the Kafka topic, i.e. a *kafka.Writer.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// kafkaSink publishes results to a Kafka topic.
+//
+// Results are buffered, up to a bound, and sent in the background, so
+// that a slow or unreachable Kafka never holds back the tests: when the
+// buffer is full new results are dropped.
+type kafkaSink struct {
+	writer  kafkaWriter
+	timeout time.Duration
+
+	queue   chan kafka.Message
+	dropped uint64
+
+	// Closed once run has sent all the queued results
+	done chan struct{}
+}
+
+// newKafkaSink returns a sink publishing to the given topic, via the given
+// comma-separated brokers, buffering up to buffer results.
+//
+// If tlsConfig is not nil the brokers are connected to over TLS, and if a
+// username is given a SASL/PLAIN login is made.
+func newKafkaSink(brokers string, topic string, tlsConfig *tls.Config, username string, password string, buffer uint, timeout time.Duration) (*kafkaSink, error) {
+	var addresses []string
+	for _, broker := range strings.Split(brokers, ",") {
+		broker = strings.TrimSpace(broker)
+		if broker == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			broker = net.JoinHostPort(broker, "9092")
+		}
+		addresses = append(addresses, broker)
+	}
+	if len(addresses) == 0 {
+		return nil, errors.New("no Kafka broker given")
+	}
+	if topic == "" {
+		return nil, errors.New("no Kafka topic given")
+	}
+
+	transport := &kafka.Transport{TLS: tlsConfig, DialTimeout: timeout}
+	if username != "" {
+		transport.SASL = plain.Mechanism{Username: username, Password: password}
+	}
+
+	//
+	// The partitions are chosen like the default partitioner of the Java
+	// client, hashing the keys with murmur2, so that the results of a test
+	// land on the same partition as the records of any other producer.
+	//
+	// On failure the metadata is refreshed, e.g. in case the leaders
+	// moved, before trying again once.
+	//
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(addresses...),
+		Topic:        topic,
+		Balancer:     &kafka.Murmur2Balancer{},
+		Transport:    transport,
+		RequiredAcks: kafka.RequireOne,
+		MaxAttempts:  2,
+		BatchSize:    kafkaMaxBatch,
+		BatchTimeout: 10 * time.Millisecond,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+	}
+
+	return &kafkaSink{
+		writer:  writer,
+		timeout: timeout,
+		queue:   make(chan kafka.Message, buffer),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// publish queues a result for publishing, keyed by its type and target,
+// returning false if it was dropped because the buffer is full.
+func (s *kafkaSink) publish(key string, value []byte) bool {
+	select {
+	case s.queue <- kafka.Message{Key: []byte(key), Value: value, Time: time.Now()}:
+		return true
+	default:
+		if dropped := atomic.AddUint64(&s.dropped, 1); dropped == 1 || dropped%100 == 0 {
+			fmt.Printf("The Kafka buffer is full, %d results dropped so far\n", dropped)
+		}
+		return false
+	}
+}
+
+// run publishes the queued results, in batches of the results waiting,
+// until the queue is closed.
+func (s *kafkaSink) run() {
+	defer close(s.done)
+
+	for message := range s.queue {
+		batch := []kafka.Message{message}
+	drain:
+		for len(batch) < kafkaMaxBatch {
+			select {
+			case message, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, message)
+			default:
+				break drain
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*s.timeout)
+		err := s.writer.WriteMessages(ctx, batch...)
+		cancel()
+		if err != nil {
+			fmt.Printf("Failed to publish %d results to Kafka: %s\n", len(batch), err.Error())
+		}
+	}
+}
+
+// close stops accepting results, waits for run to publish the queued
+// ones, and closes the connections to the brokers.
+func (s *kafkaSink) close() error {
+	close(s.queue)
+	<-s.done
+	return s.writer.Close()
+}
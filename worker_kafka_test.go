@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// fakeKafkaWriter records the messages written, taking delay to write
+// each batch.
+type fakeKafkaWriter struct {
+	lock     sync.Mutex
+	delay    time.Duration
+	messages []kafka.Message
+	closed   bool
+}
+
+func (w *fakeKafkaWriter) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	time.Sleep(w.delay)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return errors.New("the writer is closed")
+	}
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *fakeKafkaWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.closed = true
+	return nil
+}
+
+// newFakeKafkaSink returns a sink writing to a fake writer.
+func newFakeKafkaSink(t *testing.T, buffer uint, delay time.Duration) (*kafkaSink, *fakeKafkaWriter) {
+	sink, err := newKafkaSink("127.0.0.1:9092", "overseer.results", nil, "", "", buffer, time.Second)
+	if err != nil {
+		t.Fatalf("failed to create the Kafka sink: %s", err)
+	}
+	writer := &fakeKafkaWriter{delay: delay}
+	sink.writer = writer
+	return sink, writer
+}
+
+func TestKafkaPublish(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	sink, writer := newFakeKafkaSink(t, 10, 0)
+	go sink.run()
+	p._kafka = sink
+
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "192.0.2.1", Type: "ssh"}, nil, errors.New("connection refused"), nil)
+	if err := sink.close(); err != nil {
+		t.Fatalf("failed to close the Kafka sink: %s", err)
+	}
+
+	if len(writer.messages) != 1 {
+		t.Fatalf("expected the result to be published to Kafka, got %d messages", len(writer.messages))
+	}
+	message := writer.messages[0]
+	if string(message.Key) != "ssh 192.0.2.1" {
+		t.Errorf("expected the message to be keyed by type and target, got %q", message.Key)
+	}
+	result, err := test.ResultFromJSON(message.Value)
+	if err != nil {
+		t.Fatalf("expected the message to be the result JSON: %s", err)
+	}
+	if result.Target != "192.0.2.1" || result.Type != "ssh" || result.Error == nil || *result.Error != "connection refused" {
+		t.Errorf("unexpected result published to Kafka: %s", message.Value)
+	}
+
+	// The results queue is still fed
+	if results := testResults(t, p); len(results) != 1 {
+		t.Errorf("expected 1 result in the queue, got %d", len(results))
+	}
+}
+
+func TestKafkaClose(t *testing.T) {
+	// Kafka is slower than the tests, so results are waiting on exit
+	sink, writer := newFakeKafkaSink(t, 100, 50*time.Millisecond)
+	go sink.run()
+
+	for i := 0; i < 20; i++ {
+		sink.publish("ssh 192.0.2.1", []byte(`{}`))
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := sink.close(); err != nil {
+		t.Fatalf("failed to close the Kafka sink: %s", err)
+	}
+
+	if len(writer.messages) != 20 {
+		t.Errorf("expected all the results to be published before closing, got %d", len(writer.messages))
+	}
+	if !writer.closed {
+		t.Errorf("expected the writer to be closed")
+	}
+}
+
+func TestKafkaWriter(t *testing.T) {
+	sink, err := newKafkaSink("kafka1, kafka2:9093", "overseer.results", nil, "producer", "secret", 10, time.Second)
+	if err != nil {
+		t.Fatalf("failed to create the Kafka sink: %s", err)
+	}
+	writer := sink.writer.(*kafka.Writer)
+
+	if addr := writer.Addr.String(); addr != "kafka1:9092,kafka2:9093" {
+		t.Errorf("expected the default port to be added to the brokers, got %s", addr)
+	}
+
+	// The results of a test land on the same partition as with the Java client
+	if _, ok := writer.Balancer.(*kafka.Murmur2Balancer); !ok {
+		t.Errorf("expected the keys to be hashed with murmur2, got %T", writer.Balancer)
+	}
+
+	mechanism, ok := writer.Transport.(*kafka.Transport).SASL.(plain.Mechanism)
+	if !ok || mechanism.Username != "producer" || mechanism.Password != "secret" {
+		t.Errorf("expected a SASL/PLAIN login, got %v", writer.Transport.(*kafka.Transport).SASL)
+	}
+
+	if _, err = newKafkaSink(" , ", "overseer.results", nil, "", "", 10, time.Second); err == nil {
+		t.Errorf("expected a missing broker to be rejected")
+	}
+	if _, err = newKafkaSink("kafka1", "", nil, "", "", 10, time.Second); err == nil {
+		t.Errorf("expected a missing topic to be rejected")
+	}
+}
+
+func TestKafkaBufferFull(t *testing.T) {
+	// Nothing drains the buffer
+	sink, _ := newFakeKafkaSink(t, 1, 0)
+
+	if !sink.publish("ssh 192.0.2.1", []byte(`{}`)) {
+		t.Errorf("expected the first result to be buffered")
+	}
+
+	done := make(chan bool)
+	go func() { done <- sink.publish("ssh 192.0.2.1", []byte(`{}`)) }()
+	select {
+	case buffered := <-done:
+		if buffered {
+			t.Errorf("expected the result to be dropped when the buffer is full")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected publishing never to block")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadLimiter reduces the number of workers allowed to pull new jobs when
+// the load average of the host exceeds a threshold, so that overseer can
+// run alongside production workloads without starving them.
+type loadLimiter struct {
+	// The load average above which the pool will be shrunk
+	maxLoad float64
+
+	// The full size of the worker pool
+	maxWorkers uint
+
+	// How long a paused worker sleeps before checking the load again
+	checkInterval time.Duration
+
+	// Returns the current load average, replaceable for testing
+	loadFn func() (float64, error)
+}
+
+func newLoadLimiter(maxLoad float64, maxWorkers uint) *loadLimiter {
+	return &loadLimiter{
+		maxLoad:       maxLoad,
+		maxWorkers:    maxWorkers,
+		checkInterval: 5 * time.Second,
+		loadFn:        readLoadAvg,
+	}
+}
+
+// allowedWorkers returns how many workers can be active under the given
+// load. The pool is scaled down proportionally to how much the load
+// exceeds the threshold, but at least one worker is always kept running.
+func (l *loadLimiter) allowedWorkers(load float64) uint {
+	if l.maxLoad <= 0 || load <= l.maxLoad {
+		return l.maxWorkers
+	}
+
+	allowed := uint(float64(l.maxWorkers) * l.maxLoad / load)
+	if allowed < 1 {
+		allowed = 1
+	}
+	return allowed
+}
+
+// allows returns true if the worker with the given (1-based) index can
+// pull a new job right now.
+func (l *loadLimiter) allows(workerIdx uint) bool {
+	if l == nil || l.maxLoad <= 0 {
+		return true
+	}
+
+	load, err := l.loadFn()
+	if err != nil {
+		// If we can't read the load, don't block anything
+		return true
+	}
+
+	return workerIdx <= l.allowedWorkers(load)
+}
+
+// readLoadAvg returns the 1-minute load average of the host.
+func readLoadAvg() (float64, error) {
+	content, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg content: %s", string(content))
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadLimiterAllowedWorkers(t *testing.T) {
+	l := newLoadLimiter(4, 8)
+
+	cases := map[float64]uint{
+		0:   8,
+		4:   8,
+		8:   4,
+		16:  2,
+		100: 1,
+	}
+
+	for load, expected := range cases {
+		if allowed := l.allowedWorkers(load); allowed != expected {
+			t.Errorf("load %.2f: expected %d workers, got %d", load, expected, allowed)
+		}
+	}
+}
+
+func TestLoadLimiterAllows(t *testing.T) {
+	load := 2.0
+	l := newLoadLimiter(4, 8)
+	l.loadFn = func() (float64, error) { return load, nil }
+
+	if !l.allows(8) {
+		t.Errorf("all workers should be allowed under the threshold")
+	}
+
+	load = 8
+	if !l.allows(4) || l.allows(5) {
+		t.Errorf("only the first 4 workers should be allowed with load %.2f", load)
+	}
+
+	l.loadFn = func() (float64, error) { return 0, errors.New("no load") }
+	if !l.allows(8) {
+		t.Errorf("workers should not be blocked if the load is unknown")
+	}
+
+	// A disabled limiter never blocks
+	var disabled *loadLimiter
+	if !disabled.allows(100) {
+		t.Errorf("a nil limiter should allow all workers")
+	}
+}
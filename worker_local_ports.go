@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// parseLocalPortRange parses a range of local ports, e.g. "20000-29999".
+func parseLocalPortRange(spec string) (*test.PortRange, error) {
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid local port range '%s', expected e.g. 20000-29999", spec)
+	}
+
+	min, errMin := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	max, errMax := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if errMin != nil || errMax != nil {
+		return nil, fmt.Errorf("invalid local port range '%s', expected e.g. 20000-29999", spec)
+	}
+	if min < 1 || max > 65535 || min > max {
+		return nil, fmt.Errorf("invalid local port range '%s', the ports must be between 1 and 65535, in order", spec)
+	}
+
+	return &test.PortRange{Min: min, Max: max}, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestParseLocalPortRange(t *testing.T) {
+	ports, err := parseLocalPortRange("20000-29999")
+	if err != nil {
+		t.Fatalf("expected a valid range, got: %s", err)
+	}
+	if ports.Min != 20000 || ports.Max != 29999 || ports.Size() != 10000 {
+		t.Errorf("unexpected range %+v", ports)
+	}
+
+	for _, spec := range []string{"20000", "a-b", "0-100", "30000-20000", "60000-70000"} {
+		if _, err = parseLocalPortRange(spec); err == nil {
+			t.Errorf("expected the range '%s' to be rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// matrixKeyPrefix prefixes the redis hashes holding, for each test, the
+// latest result from each region, as identified by the worker tag.
+const matrixKeyPrefix = "overseer.matrix."
+
+// matrixKey returns the hash the results of a test, from all the regions,
+// are stored in.
+func matrixKey(result *test.Result) string {
+	return matrixKeyPrefix + result.Type + "." + result.Target
+}
+
+// recordMatrix stores the result as the latest one of its test from the
+// region of this worker, so that the results of a test can be seen across
+// all the regions at a glance.
+func (p *workerCmd) recordMatrix(result *test.Result) {
+	j, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Failed to encode test-result to JSON: %s\n", err.Error())
+		return
+	}
+
+	key := matrixKey(result)
+	if _, err = p._r.HSet(key, p.Tag, j).Result(); err != nil {
+		fmt.Printf("Failed to record the result of %s in the matrix: %s\n", statusField(result), err.Error())
+		return
+	}
+
+	// Decommissioned targets are forgotten like their status
+	if p.StatusTTL > 0 {
+		p._r.Expire(key, p.StatusTTL)
+	}
+}
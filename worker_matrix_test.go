@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestRecordMatrix(t *testing.T) {
+	eu, s := newTestWorker(t)
+	defer s.Close()
+	eu.Tag = "eu-west"
+	eu.RecordMatrix = true
+
+	// A worker of another region, sharing the same redis
+	us := &workerCmd{Tag: "us-east", RecordMatrix: true}
+	us._r = eu._r
+
+	tst := test.Test{Target: "example.com", Type: "http", Input: "example.com must run http"}
+	if err := eu.notify(tst, nil, nil, nil); err != nil {
+		t.Fatalf("failed to notify: %s", err)
+	}
+	if err := us.notify(tst, nil, errors.New("connection refused"), nil); err != nil {
+		t.Fatalf("failed to notify: %s", err)
+	}
+
+	matrix, err := eu._r.HGetAll("overseer.matrix.http.example.com").Result()
+	if err != nil {
+		t.Fatalf("failed to read the matrix: %s", err)
+	}
+	if len(matrix) != 2 {
+		t.Fatalf("expected a result from 2 regions, got %v", matrix)
+	}
+
+	up, err := test.ResultFromJSON([]byte(matrix["eu-west"]))
+	if err != nil || up.Error != nil || up.Tag != "eu-west" {
+		t.Fatalf("expected a passing result from eu-west, got %s", matrix["eu-west"])
+	}
+	down, err := test.ResultFromJSON([]byte(matrix["us-east"]))
+	if err != nil || down.Error == nil || *down.Error != "connection refused" {
+		t.Fatalf("expected a failing result from us-east, got %s", matrix["us-east"])
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+// runOnce processes the jobs currently in the queue, and returns as soon
+// as the queue is empty, or once it has been empty for OnceIdleWait.
+//
+// If a canary test has been defined, it is executed first: if it fails
+// the batch is aborted, and a single notification is emitted.
+func (p *workerCmd) runOnce(opts *test.Options, parse *parser.Parser) subcommands.ExitStatus {
+
+	if p.Canary != "" {
+		canary, err := parse.ParseLine(p.Canary, nil)
+		if err != nil {
+			fmt.Printf("Error parsing canary test: %s\n", err.Error())
+			return subcommands.ExitFailure
+		}
+
+		if err = p.runCanary(canary, *opts); err != nil {
+			fmt.Printf("Canary test failed, aborting batch: %s\n", err.Error())
+			canary.Input = canary.Sanitize()
+			p.notify(canary, nil, fmt.Errorf("canary test failed, batch aborted: %s", err.Error()), nil)
+			return subcommands.ExitFailure
+		}
+
+		p.verbose("Canary test passed, processing batch\n")
+	}
+
+	// On interrupt, let the running tests complete but stop pulling jobs
+	var exit int32
+	p.handleShutdownSignals(func() {
+		atomic.StoreInt32(&exit, 1)
+	})
+
+	wg := &sync.WaitGroup{}
+	var idx uint
+	for idx = 1; idx <= p.Parallel; idx++ {
+		workerIdx := idx
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// An empty queue is polled less and less often
+			backoff := newIdleBackoff(minIdleBackoff, p.IdleBackoffMax)
+			var idleSince time.Time
+
+			for atomic.LoadInt32(&exit) == 0 {
+				job, err := p.popJob()
+				if err == redis.Nil {
+					if idleSince.IsZero() {
+						idleSince = time.Now()
+					}
+					idle := time.Since(idleSince)
+					if idle >= p.OnceIdleWait {
+						// The queue is empty, we're done
+						return
+					}
+
+					delay := backoff.next()
+					if delay > p.OnceIdleWait-idle {
+						delay = p.OnceIdleWait - idle
+					}
+					time.Sleep(delay)
+					continue
+				}
+				if err != nil {
+					fmt.Printf("Failed to fetch job from queue: %s\n", err.Error())
+					return
+				}
+				backoff.reset()
+				idleSince = time.Time{}
+
+				tst, err := parse.ParseLine(job, nil)
+				if err == nil {
+					p.runTest(workerIdx, tst, *opts)
+				} else {
+					fmt.Printf("Error parsing job from queue: %s - %s\n", job, err.Error())
+					p.deadLetterJob(job, err)
+				}
+
+				// An aborted job is left in the processing queue, to be
+				// run again by the next batch
+				if p.workerContext().Err() != nil {
+					return
+				}
+				p.completeJob(job)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return subcommands.ExitSuccess
+}
+
+// runCanary executes the canary test, without notifying its result, and
+// returns an error if it failed against any of its targets.
+func (p *workerCmd) runCanary(canary test.Test, opts test.Options) error {
+	return p.executeSilently(0, canary, opts)
+}
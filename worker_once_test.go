@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"github.com/google/subcommands"
+)
+
+const (
+	passingTest = "pass.example.com must run dumb-test with fail-at 1 with dumb-duration-max 0s"
+	failingTest = "fail.example.com must run dumb-test with fail-at 0 with dumb-duration-max 0s"
+)
+
+func TestOnceCanaryPass(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.Canary = passingTest
+	server.RPush("overseer.jobs", passingTest, failingTest)
+
+	if status := p.runOnce(&test.Options{}, parser.New()); status != subcommands.ExitSuccess {
+		t.Fatalf("unexpected exit status %d", status)
+	}
+
+	if jobs, _ := server.List("overseer.jobs"); len(jobs) != 0 {
+		t.Errorf("expected the queue to be drained, found %d jobs", len(jobs))
+	}
+
+	// The canary result is not notified, only the jobs ones are
+	if results := testResults(t, p); len(results) != 2 {
+		t.Errorf("expected 2 results, got %d", len(results))
+	}
+}
+
+func TestOnceCanaryFail(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.Canary = failingTest
+	server.RPush("overseer.jobs", passingTest, failingTest)
+
+	if status := p.runOnce(&test.Options{}, parser.New()); status != subcommands.ExitFailure {
+		t.Fatalf("unexpected exit status %d", status)
+	}
+
+	if jobs, _ := server.List("overseer.jobs"); len(jobs) != 2 {
+		t.Errorf("expected the jobs to be left untouched, found %d jobs", len(jobs))
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected a single notification, got %d", len(results))
+	}
+	if !strings.Contains(results[0], "canary test failed") {
+		t.Errorf("unexpected notification: %s", results[0])
+	}
+}
+
+func TestOnceIdleWait(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.Parallel = 1
+	p.OnceIdleWait = 500 * time.Millisecond
+	p.IdleBackoffMax = 100 * time.Millisecond
+
+	// The job is enqueued while the worker waits for it
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		server.RPush("overseer.jobs", passingTest)
+	}()
+
+	start := time.Now()
+	if status := p.runOnce(&test.Options{}, parser.New()); status != subcommands.ExitSuccess {
+		t.Fatalf("unexpected exit status %d", status)
+	}
+
+	if results := testResults(t, p); len(results) != 1 {
+		t.Errorf("expected the late job to be run, got %d results", len(results))
+	}
+
+	// The idle wait restarts once the job is found
+	if elapsed := time.Since(start); elapsed < 650*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected the worker to exit once idle for 500ms after the job, took %s", elapsed)
+	}
+}
+
+func TestOnceSignals(t *testing.T) {
+	// Runs until its context is done
+	started := make(chan bool, 1)
+	name := registerFakeTest(&fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		started <- true
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.ProcessingQueue = "overseer.processing.test"
+
+	codes := make(chan int, 1)
+	p._exit = func(code int) {
+		codes <- code
+	}
+
+	server.RPush("overseer.jobs", "slow.example.com must run "+name, passingTest)
+
+	exited := make(chan subcommands.ExitStatus)
+	go func() {
+		exited <- p.runOnce(&test.Options{Timeout: 5 * time.Second}, parser.New())
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the job to be run")
+	}
+
+	// The first signal waits for the running test
+	p._signals <- syscall.SIGTERM
+	select {
+	case <-exited:
+		t.Fatalf("expected the worker to wait for the running test")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The second one aborts it, and exits immediately with a failure
+	p._signals <- syscall.SIGINT
+	select {
+	case code := <-codes:
+		if code == 0 {
+			t.Errorf("expected a non-zero exit code")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the worker to exit on the second signal")
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the worker to exit once the test was aborted")
+	}
+
+	// Nothing was notified, no new job pulled, and the aborted one is kept
+	// to be run again
+	if results := testResults(t, p); len(results) != 0 {
+		t.Errorf("expected no result for the aborted test, got: %v", results)
+	}
+	if jobs, _ := server.List("overseer.jobs"); len(jobs) != 1 || jobs[0] != passingTest {
+		t.Errorf("expected the next job to be left in the queue, got: %v", jobs)
+	}
+	if jobs, _ := server.List(p.ProcessingQueue); len(jobs) != 1 || jobs[0] != "slow.example.com must run "+name {
+		t.Errorf("expected the aborted job to be left in the processing queue, got: %v", jobs)
+	}
+}
+
+func TestOnceProcessingQueue(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.ProcessingQueue = "overseer.processing.test"
+
+	// Each job is in the processing queue while it runs
+	var processing []string
+	name := registerFakeTest(&fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		processing, _ = server.List(p.ProcessingQueue)
+		return nil
+	}})
+	server.RPush("overseer.jobs", "example.com must run "+name, "not a test")
+
+	if status := p.runOnce(&test.Options{Timeout: time.Second}, parser.New()); status != subcommands.ExitSuccess {
+		t.Fatalf("unexpected exit status %d", status)
+	}
+
+	if len(processing) != 1 || processing[0] != "example.com must run "+name {
+		t.Errorf("expected the running job to be in the processing queue, got: %v", processing)
+	}
+
+	// And is removed from it once done with, even if it is dead-lettered
+	if server.Exists(p.ProcessingQueue) {
+		jobs, _ := server.List(p.ProcessingQueue)
+		t.Errorf("expected the processing queue to be emptied, got: %v", jobs)
+	}
+	if results := testResults(t, p); len(results) != 1 {
+		t.Errorf("expected the result of the job, got: %v", results)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// claimTimeout is how long claimJob waits for a job, so that the workers
+// regularly check whether they have to exit. Redis doesn't support less
+// than a second.
+const claimTimeout = time.Second
+
+// claimJobScript moves the job at the head of the jobs queue, the oldest
+// one, to the tail of the processing queue, like LMOVE LEFT RIGHT does on
+// the redis versions which have it.
+var claimJobScript = redis.NewScript(`
+local job = redis.call("LPOP", KEYS[1])
+if job then
+	redis.call("RPUSH", KEYS[2], job)
+end
+return job
+`)
+
+// claimJob pops the next job, in the format of BLPop: the name of the
+// queue, then the job. If there is none within claimTimeout it returns
+// nil, without error.
+//
+// With a processing queue, the job is atomically moved to it rather than
+// just removed, so that it can be recovered if the worker dies before the
+// result of the job is notified. The move can't block, so the jobs queue
+// is polled until then, and the jobs are still run in the order they were
+// enqueued.
+func (p *workerCmd) claimJob() ([]string, error) {
+	if p.ProcessingQueue == "" {
+		job, err := p._r.BLPop(claimTimeout, p.jobsQueue()).Result()
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return job, err
+	}
+
+	backoff := newIdleBackoff(minIdleBackoff, claimTimeout)
+	giveUp := time.Now().Add(claimTimeout)
+	for {
+		job, err := p.popJob()
+		if err == nil {
+			return []string{p.jobsQueue(), job}, nil
+		}
+		if err != redis.Nil {
+			return nil, err
+		}
+
+		remaining := time.Until(giveUp)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		delay := backoff.next()
+		if delay > remaining {
+			delay = remaining
+		}
+		time.Sleep(delay)
+	}
+}
+
+// popJob claims the next job without waiting, returning redis.Nil if the
+// jobs queue is empty. With a processing queue, the job is atomically
+// moved to it, as in claimJob.
+func (p *workerCmd) popJob() (string, error) {
+	if p.ProcessingQueue == "" {
+		return p._r.LPop(p.jobsQueue()).Result()
+	}
+	return claimJobScript.Run(p._r, []string{p.jobsQueue(), p.ProcessingQueue}).String()
+}
+
+// completeJob removes a job from the processing queue, once its result
+// has been notified.
+func (p *workerCmd) completeJob(job string) {
+	if p.ProcessingQueue == "" {
+		return
+	}
+
+	if err := p._r.LRem(p.ProcessingQueue, 1, job).Err(); err != nil {
+		fmt.Printf("Failed to remove job `%s` from the processing queue: %s\n", job, err.Error())
+	}
+}
+
+// releaseJob returns a claimed job, which was not run, to the head of the
+// jobs queue, to be claimed next.
+func (p *workerCmd) releaseJob(job string) error {
+	if err := p._r.LPush(p.jobsQueue(), job).Err(); err != nil {
+		return err
+	}
+	p.completeJob(job)
+	return nil
+}
+
+// recoverJobs returns the jobs left in the processing queue, by a previous
+// run of the worker which died while running them, to the jobs queue, and
+// returns how many there were.
+//
+// They are pushed to the head of the jobs queue, which is where they are
+// claimed from next.
+func (p *workerCmd) recoverJobs() (int, error) {
+	if p.ProcessingQueue == "" {
+		return 0, nil
+	}
+
+	jobs, err := p._r.LRange(p.ProcessingQueue, 0, -1).Result()
+	if err != nil || len(jobs) == 0 {
+		return 0, err
+	}
+
+	// The oldest job, at the head of the processing queue, is pushed last
+	// to be claimed first
+	orphans := make([]interface{}, len(jobs))
+	for i, job := range jobs {
+		orphans[len(jobs)-1-i] = job
+	}
+
+	_, err = p._r.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(p.jobsQueue(), orphans...)
+		pipe.LTrim(p.ProcessingQueue, int64(len(jobs)), -1)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(jobs), nil
+}
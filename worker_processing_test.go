@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestProcessingQueueCrash(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.ProcessingQueue = "overseer.processing.test"
+
+	p._r.RPush("overseer.jobs", "example.com must run ssh", "example.com must run ftp")
+
+	// The worker dies between claiming the job and notifying its result
+	job, err := p.claimJob()
+	if err != nil {
+		t.Fatalf("failed to claim a job: %s", err)
+	}
+	if job[1] != "example.com must run ssh" {
+		t.Fatalf("expected the oldest job, got %v", job)
+	}
+	if jobs, _ := p._r.LRange("overseer.jobs", 0, -1).Result(); len(jobs) != 1 {
+		t.Fatalf("expected the job to be removed from the jobs queue, got %v", jobs)
+	}
+
+	// On restart, the job is requeued, to be claimed next
+	restarted := &workerCmd{Parallel: 1, IPv4: true, IPv6: true, Timeout: p.Timeout, ProcessingQueue: p.ProcessingQueue}
+	restarted._r = p._r
+
+	recovered, err := restarted.recoverJobs()
+	if err != nil || recovered != 1 {
+		t.Fatalf("expected 1 job to be recovered, got %d (%v)", recovered, err)
+	}
+	if processing, _ := p._r.LLen(p.ProcessingQueue).Result(); processing != 0 {
+		t.Errorf("expected the processing queue to be emptied, got %d jobs", processing)
+	}
+
+	job, err = restarted.claimJob()
+	if err != nil || job[1] != "example.com must run ssh" {
+		t.Fatalf("expected the recovered job to be claimed, got %v (%v)", job, err)
+	}
+
+	// Once notified, the job is done
+	restarted.notify(test.Test{Input: job[1], Target: "example.com", Type: "ssh"}, nil, errors.New("connection refused"), nil)
+	restarted.completeJob(job[1])
+
+	if processing, _ := p._r.LLen(p.ProcessingQueue).Result(); processing != 0 {
+		t.Errorf("expected the completed job to leave the processing queue, got %d jobs", processing)
+	}
+	if recovered, _ = restarted.recoverJobs(); recovered != 0 {
+		t.Errorf("expected nothing to recover, got %d jobs", recovered)
+	}
+	if results := testResults(t, restarted); len(results) != 1 {
+		t.Errorf("expected 1 result, got %d", len(results))
+	}
+}
+
+func TestProcessingQueueOrder(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.ProcessingQueue = "overseer.processing.test"
+
+	p._r.RPush("overseer.jobs", "example.com must run ssh", "example.com must run ftp", "example.com must run http")
+
+	// Two jobs are claimed, in order, when the worker dies
+	for _, expected := range []string{"example.com must run ssh", "example.com must run ftp"} {
+		job, err := p.claimJob()
+		if err != nil || job[1] != expected {
+			t.Fatalf("expected %q to be claimed, got %v (%v)", expected, job, err)
+		}
+	}
+
+	// They are recovered ahead of the queued job, still in order
+	if recovered, err := p.recoverJobs(); err != nil || recovered != 2 {
+		t.Fatalf("expected 2 jobs to be recovered, got %d (%v)", recovered, err)
+	}
+	jobs, _ := p._r.LRange("overseer.jobs", 0, -1).Result()
+	if strings.Join(jobs, ",") != "example.com must run ssh,example.com must run ftp,example.com must run http" {
+		t.Errorf("expected the recovered jobs first, in order, got %v", jobs)
+	}
+}
+
+func TestProcessingQueueRelease(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.ProcessingQueue = "overseer.processing.test"
+
+	p._r.RPush("overseer.jobs", "example.com must run ssh", "example.com must run ftp")
+
+	job, err := p.claimJob()
+	if err != nil {
+		t.Fatalf("failed to claim a job: %s", err)
+	}
+
+	// A job claimed while shutting down is returned unrun, to be claimed
+	// next
+	if err = p.releaseJob(job[1]); err != nil {
+		t.Fatalf("failed to release the job: %s", err)
+	}
+	if jobs, _ := p._r.LRange("overseer.jobs", 0, -1).Result(); len(jobs) != 2 || jobs[0] != job[1] {
+		t.Errorf("expected the job to be requeued first, got %v", jobs)
+	}
+	if processing, _ := p._r.LLen(p.ProcessingQueue).Result(); processing != 0 {
+		t.Errorf("expected the released job to leave the processing queue, got %d jobs", processing)
+	}
+}
+
+func TestProcessingQueueDisabled(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p._r.RPush("overseer.jobs", "example.com must run ssh", "example.com must run ftp")
+
+	// Jobs are then popped in order, and not tracked
+	job, err := p.claimJob()
+	if err != nil || job[1] != "example.com must run ssh" {
+		t.Fatalf("expected the oldest job, got %v (%v)", job, err)
+	}
+	p.completeJob(job[1])
+
+	if keys := server.Keys(); len(keys) != 1 || keys[0] != "overseer.jobs" {
+		t.Errorf("expected no processing queue, got keys %v", keys)
+	}
+	if recovered, err := p.recoverJobs(); recovered != 0 || err != nil {
+		t.Errorf("expected nothing to recover, got %d (%v)", recovered, err)
+	}
+}
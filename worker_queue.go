@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// The queue jobs are pulled from by default
+const defaultJobsQueue = "overseer.jobs"
+
+// The queue results are published to by default
+const defaultResultQueue = "overseer.results"
+
+// The placeholders supported by the result-queue template
+var resultQueuePlaceholders = map[string]func(result *test.Result) string{
+	"{type}":     func(result *test.Result) string { return result.Type },
+	"{tag}":      func(result *test.Result) string { return result.Tag },
+	"{severity}": func(result *test.Result) string { return result.Severity },
+}
+
+// validateResultQueueTemplate returns an error if the template contains
+// any unknown placeholder.
+func validateResultQueueTemplate(template string) error {
+	for _, placeholder := range regexp.MustCompile(`\{[^}]*\}`).FindAllString(template, -1) {
+		if _, ok := resultQueuePlaceholders[placeholder]; !ok {
+			return fmt.Errorf("unknown placeholder %s in result queue template '%s'", placeholder, template)
+		}
+	}
+	return nil
+}
+
+// jobsQueue returns the name of the queue jobs are pulled from.
+func (p *workerCmd) jobsQueue() string {
+	if p.JobsQueue == "" {
+		return defaultJobsQueue
+	}
+	return p.JobsQueue
+}
+
+// resultQueueTemplate returns the template of the queues results are
+// published to, -results-queue overriding its deprecated alias
+// -result-queue-template.
+func (p *workerCmd) resultQueueTemplate() string {
+	if p.ResultsQueue != "" {
+		return p.ResultsQueue
+	}
+	if p.ResultQueueTemplate == "" {
+		return defaultResultQueue
+	}
+	return p.ResultQueueTemplate
+}
+
+// canRenderTo returns true if the result-queue template renders to the
+// given queue for some results, whatever the values of the placeholders.
+func canRenderTo(template string, queue string) bool {
+	pattern := ""
+	for i, literal := range regexp.MustCompile(`\{[^}]*\}`).Split(template, -1) {
+		if i > 0 {
+			pattern += ".*"
+		}
+		pattern += regexp.QuoteMeta(literal)
+	}
+	return regexp.MustCompile("^" + pattern + "$").MatchString(queue)
+}
+
+// validateQueues returns an error if the queues of the worker would mix
+// jobs and results, e.g. if a result could be published to the jobs queue.
+func (p *workerCmd) validateQueues() error {
+	template := p.resultQueueTemplate()
+	if err := validateResultQueueTemplate(template); err != nil {
+		return err
+	}
+
+	if canRenderTo(template, p.jobsQueue()) {
+		return fmt.Errorf("the result queue '%s' must never be the jobs queue '%s'", template, p.jobsQueue())
+	}
+	if p.ProcessingQueue != "" && (p.ProcessingQueue == p.jobsQueue() || canRenderTo(template, p.ProcessingQueue)) {
+		return fmt.Errorf("the processing queue '%s' must differ from the jobs and result queues", p.ProcessingQueue)
+	}
+	return nil
+}
+
+// resultQueue returns the name of the queue the given result should be
+// published to, by rendering the result-queue template.
+func (p *workerCmd) resultQueue(result *test.Result) string {
+	queue := p.resultQueueTemplate()
+	for placeholder, value := range resultQueuePlaceholders {
+		queue = strings.Replace(queue, placeholder, value(result), -1)
+	}
+	return queue
+}
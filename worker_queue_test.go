@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestResultQueueTemplate(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.ResultQueueTemplate = "overseer.results.{type}"
+	p.notify(test.Test{Input: "example.com must run http", Target: "1.2.3.4", Type: "http"}, nil, nil, nil)
+	p.notify(test.Test{Input: "example.com must run ssh", Target: "1.2.3.4", Type: "ssh"}, nil, nil, nil)
+	p.notify(test.Test{Input: "example.org must run http", Target: "1.2.3.5", Type: "http"}, nil, nil, nil)
+
+	for queue, expected := range map[string]int{
+		"overseer.results.http": 2,
+		"overseer.results.ssh":  1,
+		"overseer.results":      0,
+	} {
+		if results, _ := p._r.LLen(queue).Result(); int(results) != expected {
+			t.Errorf("expected %d results in %s, got %d", expected, queue, results)
+		}
+	}
+}
+
+func TestResultQueueTemplateDefault(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.notify(test.Test{Input: "example.com must run http", Target: "1.2.3.4", Type: "http"}, nil, nil, nil)
+
+	if results := testResults(t, p); len(results) != 1 {
+		t.Errorf("expected the result in the default queue, got %d", len(results))
+	}
+}
+
+func TestValidateResultQueueTemplate(t *testing.T) {
+	for template, valid := range map[string]bool{
+		"overseer.results":                        true,
+		"overseer.results.{type}":                 true,
+		"overseer.results.{tag}.{severity}":       true,
+		"overseer.results.{target}":               false,
+		"overseer.results.{type}.{unknown-field}": false,
+	} {
+		if err := validateResultQueueTemplate(template); (err == nil) != valid {
+			t.Errorf("unexpected validation result for %s: %v", template, err)
+		}
+	}
+}
+
+func TestJobsQueue(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.JobsQueue = "team-a.jobs"
+	server.Lpush("overseer.jobs", "team-b.example.com must run http")
+
+	enqueue := &enqueueCmd{_r: p._r, JobsQueue: "team-a.jobs"}
+	if err := enqueue.enqueueTest(test.Test{Input: "team-a.example.com must run http"}); err != nil {
+		t.Fatalf("failed to enqueue: %s", err)
+	}
+
+	job, err := p.claimJob()
+	if err != nil || len(job) != 2 || job[0] != "team-a.jobs" || job[1] != "team-a.example.com must run http" {
+		t.Errorf("expected to claim the job of the team-a queue, got %v: %v", job, err)
+	}
+	if jobs, _ := server.List("overseer.jobs"); len(jobs) != 1 {
+		t.Errorf("expected the job of the default queue to be left alone, got: %v", jobs)
+	}
+}
+
+func TestValidateQueues(t *testing.T) {
+	for _, c := range []struct {
+		p     workerCmd
+		valid bool
+	}{
+		{workerCmd{ResultQueueTemplate: "overseer.results"}, true},
+		{workerCmd{JobsQueue: "team-a.jobs", ResultQueueTemplate: "team-a.results.{type}", ProcessingQueue: "team-a.processing"}, true},
+		{workerCmd{JobsQueue: "overseer.results", ResultQueueTemplate: "overseer.results"}, false},
+		{workerCmd{ResultQueueTemplate: "overseer.jobs"}, false},
+		{workerCmd{ResultQueueTemplate: "overseer.results", ProcessingQueue: "overseer.jobs"}, false},
+		{workerCmd{ResultQueueTemplate: "overseer.results.{target}"}, false},
+		{workerCmd{ResultQueueTemplate: "overseer.{tag}"}, false},
+		{workerCmd{JobsQueue: "team-a.jobs", ResultQueueTemplate: "{type}.jobs"}, false},
+		{workerCmd{JobsQueue: "team-a.jobs", ResultQueueTemplate: "team-a.results.{type}", ProcessingQueue: "team-a.results.http"}, false},
+		{workerCmd{ResultQueueTemplate: "overseer.results", ResultsQueue: "overseer.jobs"}, false},
+		{workerCmd{ResultQueueTemplate: "overseer.jobs", ResultsQueue: "team-a.results"}, true},
+	} {
+		if err := c.p.validateQueues(); (err == nil) != c.valid {
+			t.Errorf("unexpected validation result for jobs %q, results %q/%q and processing %q: %v", c.p.JobsQueue, c.p.ResultQueueTemplate, c.p.ResultsQueue, c.p.ProcessingQueue, err)
+		}
+	}
+}
+
+func TestResultsQueue(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.ResultsQueue = "team-a.results"
+	p.notify(test.Test{Input: "example.com must run http", Target: "1.2.3.4", Type: "http"}, nil, nil, nil)
+
+	if results, _ := p._r.LLen("team-a.results").Result(); results != 1 {
+		t.Errorf("expected the result in the -results-queue, got %d", results)
+	}
+	if results := testResults(t, p); len(results) != 0 {
+		t.Errorf("expected no result in the default queue, got %d", len(results))
+	}
+}
+
+func TestResultQueueTemplateAlias(t *testing.T) {
+	for _, c := range []struct {
+		p        workerCmd
+		expected string
+	}{
+		{workerCmd{}, "overseer.results"},
+		{workerCmd{ResultQueueTemplate: "overseer.results.{type}"}, "overseer.results.{type}"},
+		{workerCmd{ResultsQueue: "team-a.results"}, "team-a.results"},
+		{workerCmd{ResultQueueTemplate: "overseer.results.{type}", ResultsQueue: "team-a.results"}, "team-a.results"},
+	} {
+		if got := c.p.resultQueueTemplate(); got != c.expected {
+			t.Errorf("expected the results queue of %q/%q to be %q, got %q", c.p.ResultsQueue, c.p.ResultQueueTemplate, c.expected, got)
+		}
+	}
+}
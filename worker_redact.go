@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// The replacement of redacted text, like the one of sensitive arguments
+const redacted = "CENSORED"
+
+// compileRedactPatterns compiles the patterns of the text to redact from
+// results.
+func compileRedactPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern '%s': %s", pattern, err.Error())
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// redactString masks the text matching any of the redact patterns.
+func redactString(text string, patterns []*regexp.Regexp) string {
+	for _, re := range patterns {
+		text = re.ReplaceAllLiteralString(text, redacted)
+	}
+	return text
+}
+
+// redactResult masks the text matching any of the redact patterns in all
+// the free-text fields of the result, including URL targets, before it is
+// sent anywhere.
+func redactResult(result *test.Result, patterns []*regexp.Regexp) {
+	if len(patterns) == 0 {
+		return
+	}
+
+	redact := func(text string) string {
+		return redactString(text, patterns)
+	}
+
+	result.Input = redact(result.Input)
+	result.Target = redact(result.Target)
+	if result.TestLabel != nil {
+		label := redact(*result.TestLabel)
+		result.TestLabel = &label
+	}
+	if result.Tags != nil {
+		tags := make([]string, len(result.Tags))
+		for i, tag := range result.Tags {
+			tags[i] = redact(tag)
+		}
+		result.Tags = tags
+	}
+	if result.Error != nil {
+		errorString := redact(*result.Error)
+		result.Error = &errorString
+	}
+	if result.Details != nil {
+		details := redact(*result.Details)
+		result.Details = &details
+	}
+	if result.Captures != nil {
+		captures := make(map[string]string, len(result.Captures))
+		for name, value := range result.Captures {
+			captures[name] = redact(value)
+		}
+		result.Captures = captures
+	}
+	if result.Metadata != nil {
+		metadata := make(map[string]interface{}, len(result.Metadata))
+		for name, value := range result.Metadata {
+			if text, ok := value.(string); ok {
+				value = redact(text)
+			}
+			metadata[name] = value
+		}
+		result.Metadata = metadata
+	}
+}
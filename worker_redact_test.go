@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestNotifyRedact(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	var err error
+	p._redact, err = compileRedactPatterns([]string{`token=[a-z0-9]+`, `[a-z.]+@example\.com`})
+	if err != nil {
+		t.Fatalf("failed to compile patterns: %s", err)
+	}
+
+	details := "reply sent to jane.doe@example.com"
+	label := "checkout for sam@example.com"
+	tst := test.Test{
+		Target:    "https://example.com/?token=abc123",
+		Type:      "http",
+		Input:     "https://example.com/?token=abc123 must run http",
+		TestLabel: &label,
+		Tags:      []string{"owner:alex@example.com", "team-a"},
+	}
+	outcome := &testOutcome{
+		Details:  &details,
+		Captures: map[string]string{"session": "token=def456", "version": "1.2.3"},
+	}
+
+	if err = p.notify(tst, nil, errors.New("GET /?token=abc123 failed for john@example.com"), outcome); err != nil {
+		t.Fatalf("failed to notify: %s", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	for _, secret := range []string{"abc123", "def456", "example.com/?token", "jane.doe", "john@", "sam@", "alex@"} {
+		if strings.Contains(results[0], secret) {
+			t.Errorf("expected %q to be redacted from %s", secret, results[0])
+		}
+	}
+
+	result, err := test.ResultFromJSON([]byte(results[0]))
+	if err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	if *result.Error != "GET /?CENSORED failed for CENSORED" {
+		t.Errorf("unexpected error: %s", *result.Error)
+	}
+	if result.Captures["version"] != "1.2.3" || result.Captures["session"] != "CENSORED" {
+		t.Errorf("unexpected captures: %v", result.Captures)
+	}
+	if *result.TestLabel != "checkout for CENSORED" || result.Tags[0] != "owner:CENSORED" || result.Tags[1] != "team-a" {
+		t.Errorf("unexpected test-label and tags: %s %v", *result.TestLabel, result.Tags)
+	}
+
+	// The outcome of the test itself is left alone
+	if outcome.Captures["session"] != "token=def456" {
+		t.Errorf("expected the outcome not to be modified, got %v", outcome.Captures)
+	}
+	if label != "checkout for sam@example.com" || tst.Tags[0] != "owner:alex@example.com" {
+		t.Errorf("expected the test not to be modified, got %s %v", label, tst.Tags)
+	}
+
+	if _, err = compileRedactPatterns([]string{"("}); err == nil {
+		t.Errorf("expected an invalid pattern to fail")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// redisFailoverOptions returns the options of the client connecting to
+// the master named RedisMasterName, as resolved by the comma-separated
+// sentinels of RedisHost, which follows the master across failovers.
+func (p *workerCmd) redisFailoverOptions(tlsConfig *tls.Config) (*redis.FailoverOptions, error) {
+	if p.RedisMasterName == "" {
+		return nil, errors.New("-redis-sentinel requires the name of the master, via -redis-master-name")
+	}
+	if p.RedisSocket != "" {
+		return nil, errors.New("-redis-sentinel can't be used along with -redis-socket")
+	}
+
+	var sentinels []string
+	for _, address := range strings.Split(p.RedisHost, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, "26379")
+		}
+		sentinels = append(sentinels, address)
+	}
+	if len(sentinels) == 0 {
+		return nil, errors.New("-redis-sentinel requires the addresses of the sentinels, via -redis-host")
+	}
+
+	return &redis.FailoverOptions{
+		MasterName:    p.RedisMasterName,
+		SentinelAddrs: sentinels,
+		Password:      p.RedisPassword,
+		DB:            p.RedisDB,
+		DialTimeout:   p.RedisDialTimeout,
+		TLSConfig:     tlsConfig,
+	}, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+// stubSentinel is a minimal Sentinel, answering the address of the master
+// it monitors, which can be changed to simulate a failover.
+type stubSentinel struct {
+	lock   sync.Mutex
+	name   string
+	master string
+}
+
+func (s *stubSentinel) setMaster(address string) {
+	s.lock.Lock()
+	s.master = address
+	s.lock.Unlock()
+}
+
+// readCommand reads a command, sent as a RESP array of bulk strings.
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for i := 0; i < count; i++ {
+		if _, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, errArg := reader.ReadString('\n')
+		if errArg != nil {
+			return nil, errArg
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+// serve answers the commands of a client of the sentinel.
+func (s *stubSentinel) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		command := strings.ToLower(strings.Join(args, " "))
+		switch {
+		case command == "ping":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case strings.HasPrefix(command, "sentinel get-master-addr-by-name "):
+			s.lock.Lock()
+			master := s.master
+			s.lock.Unlock()
+
+			host, port, _ := net.SplitHostPort(master)
+			if args[2] != s.name {
+				fmt.Fprint(conn, "*-1\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+		case strings.HasPrefix(command, "sentinel sentinels "):
+			fmt.Fprint(conn, "*0\r\n")
+		case strings.HasPrefix(command, "subscribe "):
+			fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+// startSentinel starts a stub sentinel monitoring the given master.
+func startSentinel(t *testing.T, name string, master string) (*stubSentinel, string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	s := &stubSentinel{name: name, master: master}
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s, listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestRedisSentinel(t *testing.T) {
+	master, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis server: %s", err)
+	}
+	defer master.Close()
+
+	replica, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis server: %s", err)
+	}
+	defer replica.Close()
+
+	sentinel, address, stop := startSentinel(t, "overseer", master.Addr())
+	defer stop()
+
+	// The first sentinel is down, so the second one is asked
+	p := &workerCmd{RedisSentinel: true, RedisHost: "127.0.0.1:1, " + address, RedisMasterName: "overseer", RedisDialTimeout: time.Second}
+	options, err := p.redisFailoverOptions(nil)
+	if err != nil {
+		t.Fatalf("expected the sentinel options to be accepted, got: %s", err)
+	}
+	if len(options.SentinelAddrs) != 2 || options.SentinelAddrs[0] != "127.0.0.1:1" {
+		t.Errorf("unexpected sentinels: %v", options.SentinelAddrs)
+	}
+
+	r := redis.NewFailoverClient(options)
+	defer r.Close()
+
+	if err = r.Ping().Err(); err != nil {
+		t.Fatalf("expected to reach the master through the sentinels, got: %s", err)
+	}
+
+	// Jobs and results go through the master
+	if err = r.RPush("overseer.results", "result").Err(); err != nil {
+		t.Fatalf("failed to push: %s", err)
+	}
+	if values, _ := master.List("overseer.results"); len(values) != 1 {
+		t.Errorf("expected the result to be pushed to the master, got: %v", values)
+	}
+
+	master.Lpush("overseer.jobs", "job")
+	job, err := r.BLPop(time.Second, "overseer.jobs").Result()
+	if err != nil || job[1] != "job" {
+		t.Errorf("expected to pop the job from the master, got %v: %v", job, err)
+	}
+
+	// After a failover, the new master is followed
+	sentinel.setMaster(replica.Addr())
+	master.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.RPush("overseer.results", "failover").Err() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected to follow the new master")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if values, _ := replica.List("overseer.results"); len(values) != 1 || values[0] != "failover" {
+		t.Errorf("expected the result to be pushed to the new master, got: %v", values)
+	}
+
+	// An unknown master can't be resolved
+	p.RedisMasterName = "unknown"
+	options, _ = p.redisFailoverOptions(nil)
+	unknown := redis.NewFailoverClient(options)
+	defer unknown.Close()
+	if err = unknown.Ping().Err(); err == nil {
+		t.Errorf("expected an unknown master to fail")
+	}
+}
+
+func TestRedisSentinelOptions(t *testing.T) {
+	p := &workerCmd{RedisSentinel: true, RedisHost: "sentinel-1, sentinel-2:26380", RedisMasterName: "overseer"}
+	options, err := p.redisFailoverOptions(nil)
+	if err != nil {
+		t.Fatalf("expected the options to be accepted, got: %s", err)
+	}
+	if strings.Join(options.SentinelAddrs, ",") != "sentinel-1:26379,sentinel-2:26380" {
+		t.Errorf("unexpected sentinels: %v", options.SentinelAddrs)
+	}
+
+	// Broken configurations are refused
+	for _, p := range []*workerCmd{
+		{RedisSentinel: true, RedisHost: "sentinel-1"},
+		{RedisSentinel: true, RedisHost: " , ", RedisMasterName: "overseer"},
+		{RedisSentinel: true, RedisHost: "sentinel-1", RedisMasterName: "overseer", RedisSocket: "/var/run/redis.sock"},
+	} {
+		if _, err = p.redisFailoverOptions(nil); err == nil {
+			t.Errorf("expected %+v to be refused", p)
+		}
+	}
+
+	// Before connecting to anything
+	p = &workerCmd{Parallel: 1, RedisSentinel: true, RedisHost: "192.0.2.1:26379", RedisDialTimeout: time.Minute}
+	if status := p.Execute(context.Background(), flag.NewFlagSet("worker", flag.ContinueOnError)); status != subcommands.ExitFailure {
+		t.Errorf("expected the worker to fail, got %v", status)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/cmaster11/overseer/utils"
+)
+
+// redisTLSConfig returns the TLS configuration of the connections to
+// redis, e.g. through a TLS-terminating proxy, or nil without -redis-tls.
+//
+// A client certificate, for mutual TLS, requires both its certificate and
+// its key.
+func (p *workerCmd) redisTLSConfig() (*tls.Config, error) {
+	if !p.RedisTLS {
+		if p.RedisTLSCA != "" || p.RedisTLSCert != "" || p.RedisTLSKey != "" || p.RedisTLSSkipVerify {
+			return nil, errors.New("-redis-tls-ca, -redis-tls-cert, -redis-tls-key and -redis-tls-skip-verify require -redis-tls")
+		}
+		return nil, nil
+	}
+
+	if (p.RedisTLSCert == "") != (p.RedisTLSKey == "") {
+		return nil, errors.New("-redis-tls-cert and -redis-tls-key must be given together")
+	}
+
+	config := &tls.Config{InsecureSkipVerify: p.RedisTLSSkipVerify}
+
+	if p.RedisTLSCA != "" {
+		roots, err := utils.LoadCertPool(p.RedisTLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the redis certificate authorities: %s", err.Error())
+		}
+		config.RootCAs = roots
+	}
+
+	if p.RedisTLSCert != "" {
+		certificate, err := tls.LoadX509KeyPair(p.RedisTLSCert, p.RedisTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the redis client certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
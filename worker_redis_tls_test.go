@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/google/subcommands"
+)
+
+// writeCertificate issues a certificate for 127.0.0.1, signed by the given
+// parent (or self-signed), writing it and its key as PEM files in dir.
+func writeCertificate(t *testing.T, dir string, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return cert, key
+}
+
+// startTLSProxy starts a TLS-terminating proxy to the given address,
+// requiring a client certificate issued by the given authority.
+func startTLSProxy(t *testing.T, dir string, address string, clients *x509.CertPool) string {
+	certificate, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatalf("failed to load the server certificate: %s", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientCAs:    clients,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	go func() {
+		for {
+			conn, errAccept := listener.Accept()
+			if errAccept != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				backend, errDial := net.Dial("tcp", address)
+				if errDial != nil {
+					return
+				}
+				defer backend.Close()
+				go io.Copy(backend, conn)
+				io.Copy(conn, backend)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestRedisTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redis-tls")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca, caKey := writeCertificate(t, dir, "ca", true, nil, nil)
+	writeCertificate(t, dir, "server", false, ca, caKey)
+	writeCertificate(t, dir, "client", false, ca, caKey)
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis server: %s", err)
+	}
+	defer server.Close()
+
+	clients := x509.NewCertPool()
+	clients.AddCert(ca)
+	proxy := startTLSProxy(t, dir, server.Addr(), clients)
+
+	ping := func(p *workerCmd) error {
+		config, err := p.redisTLSConfig()
+		if err != nil {
+			return err
+		}
+		r := redis.NewClient(&redis.Options{Addr: proxy, TLSConfig: config, DialTimeout: time.Second, MaxRetries: 0})
+		defer r.Close()
+		return r.Ping().Err()
+	}
+
+	// Mutual TLS, verified with the CA
+	p := &workerCmd{RedisTLS: true, RedisTLSCA: filepath.Join(dir, "ca.pem"), RedisTLSCert: filepath.Join(dir, "client.pem"), RedisTLSKey: filepath.Join(dir, "client.key")}
+	if err = ping(p); err != nil {
+		t.Errorf("expected to connect over mutual TLS, got: %s", err)
+	}
+
+	// Without the CA the server isn't trusted, unless told so
+	p = &workerCmd{RedisTLS: true, RedisTLSCert: filepath.Join(dir, "client.pem"), RedisTLSKey: filepath.Join(dir, "client.key")}
+	if err = ping(p); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expected the server to be untrusted, got: %v", err)
+	}
+	p.RedisTLSSkipVerify = true
+	if err = ping(p); err != nil {
+		t.Errorf("expected to connect without verifying the server, got: %s", err)
+	}
+
+	// Without a client certificate the proxy refuses us
+	p = &workerCmd{RedisTLS: true, RedisTLSCA: filepath.Join(dir, "ca.pem")}
+	if err = ping(p); err == nil {
+		t.Errorf("expected the connection without client certificate to fail")
+	}
+
+	// Broken configurations are refused
+	for _, p := range []*workerCmd{
+		{RedisTLS: true, RedisTLSCert: filepath.Join(dir, "client.pem")},
+		{RedisTLS: true, RedisTLSKey: filepath.Join(dir, "client.key")},
+		{RedisTLS: true, RedisTLSCA: filepath.Join(dir, "missing.pem")},
+		{RedisTLSSkipVerify: true},
+	} {
+		if _, err = p.redisTLSConfig(); err == nil {
+			t.Errorf("expected %+v to be refused", p)
+		}
+	}
+}
+
+func TestRedisTLSFailsFast(t *testing.T) {
+	// Nothing listens there, so a connection attempt would fail too, but
+	// after the dial timeout
+	p := &workerCmd{Parallel: 1, RedisHost: "192.0.2.1:6379", RedisDialTimeout: time.Minute, RedisTLS: true, RedisTLSCert: "client.pem"}
+
+	start := time.Now()
+	if status := p.Execute(context.Background(), flag.NewFlagSet("worker", flag.ContinueOnError)); status != subcommands.ExitFailure {
+		t.Errorf("expected the worker to fail, got %v", status)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the worker to fail before connecting to redis, took %s", elapsed)
+	}
+}
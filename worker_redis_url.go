@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// redisURLOverrides are the flags overridden by -redis-url.
+var redisURLOverrides = map[string]bool{
+	"redis-host":   true,
+	"redis-db":     true,
+	"redis-pass":   true,
+	"redis-socket": true,
+}
+
+// applyRedisURL replaces the redis-host, redis-database and redis-password
+// with those of -redis-url, if given, warning about the flags it overrides.
+//
+// A rediss:// URL connects over TLS, as -redis-tls does.
+func (p *workerCmd) applyRedisURL(f *flag.FlagSet) error {
+	if p.RedisURL == "" {
+		return nil
+	}
+	if p.RedisSentinel {
+		return errors.New("-redis-url can't be used along with -redis-sentinel")
+	}
+
+	options, err := redis.ParseURL(p.RedisURL)
+	if err != nil {
+		return fmt.Errorf("invalid -redis-url: %s", err.Error())
+	}
+
+	if f != nil {
+		var overridden []string
+		f.Visit(func(set *flag.Flag) {
+			if redisURLOverrides[set.Name] {
+				overridden = append(overridden, "-"+set.Name)
+			}
+		})
+		if len(overridden) > 0 {
+			fmt.Printf("Warning: -redis-url overrides %s\n", strings.Join(overridden, ", "))
+		}
+	}
+
+	p.RedisHost = options.Addr
+	p.RedisDB = options.DB
+	p.RedisPassword = options.Password
+	p.RedisSocket = ""
+	if options.TLSConfig != nil {
+		p.RedisTLS = true
+	}
+	return nil
+}
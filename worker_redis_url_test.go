@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func TestRedisURL(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("failed to start redis server: %s", err)
+	}
+	defer server.Close()
+	server.RequireAuth("secret")
+
+	// The URL wins over the discrete flags
+	p := &workerCmd{}
+	f := flag.NewFlagSet("worker", flag.ContinueOnError)
+	p.SetFlags(f)
+	if err = f.Parse([]string{"-redis-host", "redis.example.com:6379", "-redis-db", "1", "-redis-pass", "wrong", "-redis-url", "redis://:secret@" + server.Addr() + "/3"}); err != nil {
+		t.Fatalf("failed to parse the flags: %s", err)
+	}
+	if err = p.applyRedisURL(f); err != nil {
+		t.Fatalf("expected the URL to be accepted, got: %s", err)
+	}
+	if p.RedisHost != server.Addr() || p.RedisDB != 3 || p.RedisPassword != "secret" || p.RedisTLS {
+		t.Errorf("unexpected connection settings: %s db %d password %q tls %v", p.RedisHost, p.RedisDB, p.RedisPassword, p.RedisTLS)
+	}
+
+	r := redis.NewClient(&redis.Options{Addr: p.RedisHost, DB: p.RedisDB, Password: p.RedisPassword, DialTimeout: time.Second})
+	defer r.Close()
+	if err = r.RPush("overseer.results", "result").Err(); err != nil {
+		t.Fatalf("failed to push: %s", err)
+	}
+	if values, _ := server.DB(3).List("overseer.results"); len(values) != 1 {
+		t.Errorf("expected the result to be pushed to the database of the URL, got: %v", values)
+	}
+
+	// A rediss:// URL connects over TLS, and the port defaults to 6379
+	p = &workerCmd{RedisSocket: "/var/run/redis.sock", RedisURL: "rediss://redis.example.com"}
+	if err = p.applyRedisURL(nil); err != nil {
+		t.Fatalf("expected the URL to be accepted, got: %s", err)
+	}
+	if p.RedisHost != "redis.example.com:6379" || p.RedisDB != 0 || !p.RedisTLS || p.RedisSocket != "" {
+		t.Errorf("unexpected connection settings: %s db %d tls %v socket %q", p.RedisHost, p.RedisDB, p.RedisTLS, p.RedisSocket)
+	}
+
+	// Without a URL nothing changes
+	p = &workerCmd{RedisHost: "localhost:6379", RedisDB: 2}
+	if err = p.applyRedisURL(nil); err != nil || p.RedisHost != "localhost:6379" || p.RedisDB != 2 {
+		t.Errorf("expected the settings to be kept, got %s db %d: %v", p.RedisHost, p.RedisDB, err)
+	}
+
+	// Broken URLs are refused
+	for _, p := range []*workerCmd{
+		{RedisURL: "http://redis.example.com"},
+		{RedisURL: "redis://redis.example.com/db"},
+		{RedisURL: "redis://redis.example.com", RedisSentinel: true},
+	} {
+		if err = p.applyRedisURL(nil); err == nil {
+			t.Errorf("expected %s to be refused", p.RedisURL)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// parseResolvers returns the addresses of the given comma-separated list
+// of resolvers, using the default DNS port if none is specified.
+func parseResolvers(list string) []string {
+	var resolvers []string
+	for _, resolver := range strings.Split(list, ",") {
+		resolver = strings.TrimSpace(resolver)
+		if resolver == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(resolver); err != nil {
+			resolver = net.JoinHostPort(resolver, "53")
+		}
+		resolvers = append(resolvers, resolver)
+	}
+	return resolvers
+}
+
+// resolveVia returns the sorted A/AAAA records of the given host, as
+// answered by the given resolver.
+func resolveVia(host string, resolver string, ipv4 bool, ipv6 bool, timeout time.Duration) ([]string, error) {
+	client := &dns.Client{Timeout: timeout}
+
+	var qtypes []uint16
+	if ipv4 {
+		qtypes = append(qtypes, dns.TypeA)
+	}
+	if ipv6 {
+		qtypes = append(qtypes, dns.TypeAAAA)
+	}
+
+	answers := []string{}
+	for _, qtype := range qtypes {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(host), qtype)
+
+		response, _, err := client.Exchange(msg, resolver)
+		if err != nil {
+			return nil, err
+		}
+		if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+			return nil, fmt.Errorf("query failed with %s", dns.RcodeToString[response.Rcode])
+		}
+
+		for _, rr := range response.Answer {
+			switch record := rr.(type) {
+			case *dns.A:
+				answers = append(answers, record.A.String())
+			case *dns.AAAA:
+				answers = append(answers, record.AAAA.String())
+			}
+		}
+	}
+
+	sort.Strings(answers)
+	return answers, nil
+}
+
+// compareResolvers resolves the given host via each of the resolvers,
+// and returns an error reporting their answers if they disagree.
+func compareResolvers(host string, resolvers []string, ipv4 bool, ipv6 bool, timeout time.Duration) error {
+	var reference []string
+	var report []string
+	agree := true
+
+	for idx, resolver := range resolvers {
+		answers, err := resolveVia(host, resolver, ipv4, ipv6, timeout)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s via %s: %s", host, resolver, err.Error())
+		}
+
+		if idx == 0 {
+			reference = answers
+		} else if strings.Join(answers, ",") != strings.Join(reference, ",") {
+			agree = false
+		}
+
+		report = append(report, fmt.Sprintf("%s => %v", resolver, answers))
+	}
+
+	if !agree {
+		return fmt.Errorf("resolvers disagree on %s: %s", host, strings.Join(report, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"github.com/miekg/dns"
+)
+
+// startResolver starts a stub DNS resolver answering every A query with
+// the given address.
+func startResolver(t *testing.T, address string) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			if r.Question[0].Qtype == dns.TypeA {
+				rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A " + address)
+				m.Answer = append(m.Answer, rr)
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+
+	return conn.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func TestCompareResolvers(t *testing.T) {
+	first, stopFirst := startResolver(t, "10.0.0.1")
+	defer stopFirst()
+	second, stopSecond := startResolver(t, "10.0.0.1")
+	defer stopSecond()
+	stale, stopStale := startResolver(t, "10.0.0.99")
+	defer stopStale()
+
+	if err := compareResolvers("app.example.com", []string{first, second}, true, true, 2*time.Second); err != nil {
+		t.Errorf("expected matching resolvers to agree: %s", err)
+	}
+
+	err := compareResolvers("app.example.com", []string{first, stale}, true, true, 2*time.Second)
+	if err == nil {
+		t.Fatalf("expected mismatching resolvers to disagree")
+	}
+	if !strings.Contains(err.Error(), "10.0.0.1") || !strings.Contains(err.Error(), "10.0.0.99") {
+		t.Errorf("expected the differing answers to be reported, got: %s", err)
+	}
+}
+
+func TestCompareResolversWorker(t *testing.T) {
+	first, stopFirst := startResolver(t, "10.0.0.1")
+	defer stopFirst()
+	stale, stopStale := startResolver(t, "10.0.0.99")
+	defer stopStale()
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.CompareResolvers = first + "," + stale
+
+	tst, err := parser.New().ParseLine("app.example.com must run ssh", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+	if err = p.runTest(0, tst, test.Options{Timeout: 2 * time.Second}); err == nil {
+		t.Errorf("expected the test to fail")
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 || !strings.Contains(results[0], "resolvers disagree") {
+		t.Errorf("expected a single disagreement result, got %v", results)
+	}
+}
+
+func TestParseResolvers(t *testing.T) {
+	resolvers := parseResolvers("8.8.8.8, 10.0.0.2:5353,,2001:4860:4860::8888")
+	expected := []string{"8.8.8.8:53", "10.0.0.2:5353", "[2001:4860:4860::8888]:53"}
+	if strings.Join(resolvers, " ") != strings.Join(expected, " ") {
+		t.Errorf("unexpected resolvers %v", resolvers)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+// resultFieldNames returns the keys of the JSON results, as named by the
+// tags of test.Result.
+func resultFieldNames() []string {
+	var names []string
+	t := reflect.TypeOf(test.Result{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseResultFields parses the comma-separated list of the fields to keep
+// in the results, which must all be known ones.
+func parseResultFields(value string) (map[string]bool, error) {
+	known := map[string]bool{}
+	for _, name := range resultFieldNames() {
+		known[name] = true
+	}
+
+	fields := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown result field '%s', the fields are: %s", name, strings.Join(resultFieldNames(), ", "))
+		}
+		fields[name] = true
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
+}
+
+// filterResultFields drops from the JSON result the fields which are not
+// listed.
+func filterResultFields(j []byte, fields map[string]bool) ([]byte, error) {
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(j, &result); err != nil {
+		return nil, err
+	}
+	for name := range result {
+		if !fields[name] {
+			delete(result, name)
+		}
+	}
+	return json.Marshal(result)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestNotifyResultFields(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	var err error
+	p._resultFields, err = parseResultFields(" input, error ,severity,")
+	if err != nil {
+		t.Fatalf("failed to parse the fields: %s", err)
+	}
+
+	tst := test.Test{Target: "1.2.3.4", Type: "ssh", Input: "example.com must run ssh"}
+	outcome := &testOutcome{Captures: map[string]string{"version": "1.2.3"}}
+	if err = p.notify(tst, nil, errors.New("connection refused"), outcome); err != nil {
+		t.Fatalf("failed to notify: %s", err)
+	}
+
+	results := testResults(t, p)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	var fields map[string]interface{}
+	if err = json.Unmarshal([]byte(results[0]), &fields); err != nil {
+		t.Fatalf("failed to decode result: %s", err)
+	}
+	expected := map[string]interface{}{
+		"input":    "example.com must run ssh",
+		"error":    "connection refused",
+		"severity": test.DefaultSeverity,
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("expected only the allowlisted fields, got %s", results[0])
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("expected %s to be %v, got %v", name, value, fields[name])
+		}
+	}
+}
+
+func TestParseResultFields(t *testing.T) {
+	fields, err := parseResultFields("")
+	if err != nil || fields != nil {
+		t.Errorf("expected no fields to keep all of them, got %v, %v", fields, err)
+	}
+
+	// Fields which are omitted when empty are known too
+	if _, err = parseResultFields("captures,metadata,isDedup"); err != nil {
+		t.Errorf("expected known fields to be accepted, got: %s", err)
+	}
+
+	_, err = parseResultFields("input,errors")
+	if err == nil || !strings.Contains(err.Error(), "unknown result field 'errors'") {
+		t.Errorf("expected an unknown field to be rejected, got: %v", err)
+	}
+}
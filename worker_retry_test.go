@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestRetryOverrides(t *testing.T) {
+	failing := &fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		return errors.New("always failing")
+	}}
+	name := registerFakeTest(failing)
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.Retry = true
+	p.RetryCount = 3
+	p.RetryDelay = time.Millisecond
+
+	for _, c := range []struct {
+		line     string
+		retry    bool
+		expected int
+	}{
+		{"example.com must run " + name, true, 4},
+		{"example.com must run " + name + " with retry false", true, 1},
+		{"example.com must run " + name + " with retry-count 2", true, 3},
+		{"example.com must run " + name + " with retry true", false, 4},
+		{"example.com must run " + name + " with retry-count 3", false, 4},
+		{"example.com must run " + name, false, 1},
+	} {
+		p.Retry = c.retry
+		failing.reset()
+
+		tst, err := parser.New().ParseLine(c.line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, test.Options{Timeout: time.Second})
+
+		if got := len(failing.ran()); got != c.expected {
+			t.Errorf("expected `%s` (global retry %t) to run %d times, got %d", c.line, c.retry, c.expected, got)
+		}
+	}
+}
+
+func TestRetrySleeps(t *testing.T) {
+	failing := registerFakeTest(&fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		return errors.New("always failing")
+	}})
+	passing := registerFakeTest(&fakeTest{})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	p.Retry = true
+	p.RetryCount = 3
+	p.RetryDelay = 5 * time.Second
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.1")}, nil
+	}
+
+	var sleeps []time.Duration
+	p._sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+
+	run := func(line string) {
+		sleeps = nil
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, test.Options{Timeout: time.Second})
+	}
+
+	// Only between the attempts, not after the last one
+	run("example.com must run " + failing)
+	if !reflect.DeepEqual(sleeps, []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second}) {
+		t.Errorf("expected 3 sleeps between 4 attempts, got %v", sleeps)
+	}
+
+	run("example.com must run " + failing + " with retry-count 0")
+	if len(sleeps) != 0 {
+		t.Errorf("expected no sleep with a single attempt, got %v", sleeps)
+	}
+
+	run("example.com must run " + passing)
+	if len(sleeps) != 0 {
+		t.Errorf("expected no sleep for a passing test, got %v", sleeps)
+	}
+
+	p.RetryBackoff = true
+	p.RetryMaxDelay = 15 * time.Second
+	run("example.com must run " + failing)
+	if !reflect.DeepEqual(sleeps, []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second}) {
+		t.Errorf("expected the sleeps to back off up to the cap, got %v", sleeps)
+	}
+
+	p._retryJitter = newRetryJitter(time.Second, rand.New(rand.NewSource(1)))
+	run("example.com must run " + failing)
+	for i, expected := range []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second} {
+		if len(sleeps) != 3 || sleeps[i] < expected || sleeps[i] >= expected+time.Second {
+			t.Errorf("expected the sleeps to back off with up to 1s of jitter, got %v", sleeps)
+			break
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestShadow(t *testing.T) {
+	var hits int32
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer web.Close()
+
+	run := func(shadowFlag bool, line string) []string {
+		p, server := newTestWorker(t)
+		defer server.Close()
+
+		p.Shadow = shadowFlag
+
+		tst, err := parser.New().ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		if err = p.runTest(0, tst, test.Options{Timeout: 5 * time.Second}); err != nil {
+			t.Fatalf("failed to run test: %s", err)
+		}
+		return testResults(t, p)
+	}
+
+	if results := run(true, web.URL+"/ must run http"); len(results) != 0 {
+		t.Errorf("expected no results with -shadow, got %d", len(results))
+	}
+	if results := run(false, web.URL+"/ must run http with shadow true"); len(results) != 0 {
+		t.Errorf("expected no results for a shadow test, got %d", len(results))
+	}
+	if atomic.LoadInt32(&hits) != 2 {
+		t.Errorf("expected the shadow tests to run, got %d requests", hits)
+	}
+
+	if results := run(false, web.URL+"/ must run http"); len(results) != 1 {
+		t.Errorf("expected the failure to be notified outside shadow mode, got %d results", len(results))
+	}
+}
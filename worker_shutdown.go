@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleShutdownSignals handles the SIGINT and SIGTERM asking the worker
+// to exit, in both the long-running and the -once modes.
+//
+// On the first signal drain is called, for the worker to stop pulling new
+// jobs, and exit once the running tests complete and their results are
+// notified. On the second one the running tests are aborted, and the
+// worker exits immediately with a non-zero code.
+func (p *workerCmd) handleShutdownSignals(drain func()) {
+	ctx, abort := context.WithCancel(context.Background())
+	p._ctx = ctx
+
+	signals := p._signals
+	if signals == nil {
+		// We listen for SIGTERM, SIGINT, to please k8s and keyboard users.
+		signals = make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	}
+
+	go func() {
+		<-signals
+		fmt.Printf("Exiting once the running tests complete, interrupt again to exit immediately\n")
+		drain()
+
+		<-signals
+		fmt.Printf("Exiting immediately, without notifying the results of the running tests\n")
+		abort()
+		p.exit(1)
+	}()
+}
+
+// exit terminates the worker with the given code.
+func (p *workerCmd) exit(code int) {
+	if p._exit != nil {
+		p._exit(code)
+		return
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestWorkerLoopShutdown(t *testing.T) {
+	// Runs until it is released
+	started, release := make(chan bool, 1), make(chan bool)
+	name := registerFakeTest(&fakeTest{run: func(ctx context.Context, target string, opts test.Options) error {
+		started <- true
+		<-release
+		return nil
+	}})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	server.Lpush("overseer.jobs", "slow.example.com must run "+name)
+
+	done := make(chan struct{})
+	exited := make(chan bool)
+	go func() {
+		p.workerLoop(1, done, &test.Options{Timeout: 5 * time.Second}, parser.New())
+		close(exited)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the job to be run")
+	}
+
+	// Asked to exit while the test runs
+	server.Lpush("overseer.jobs", "next.example.com must run "+name)
+	close(done)
+
+	select {
+	case <-exited:
+		t.Fatalf("expected the worker to wait for the running test")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the worker to exit once the test completed")
+	}
+
+	// The result of the running test was notified, and no new job claimed
+	if results := testResults(t, p); len(results) != 1 {
+		t.Errorf("expected the result of the running test, got: %v", results)
+	}
+	if jobs, _ := server.List("overseer.jobs"); len(jobs) != 1 || jobs[0] != "next.example.com must run "+name {
+		t.Errorf("expected the next job to be left in the queue, got: %v", jobs)
+	}
+}
+
+func TestWorkerLoopAbort(t *testing.T) {
+	// Runs until its context is done, recording how long it was given, and
+	// may take an hour at most
+	started := make(chan time.Duration, 1)
+	name := registerFakeTest(&fakeTest{maxDuration: time.Hour, run: func(ctx context.Context, target string, opts test.Options) error {
+		deadline, _ := ctx.Deadline()
+		started <- time.Until(deadline)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+	p.ProcessingQueue = "overseer.processing.test"
+
+	codes := make(chan int, 1)
+	p._exit = func(code int) {
+		codes <- code
+	}
+
+	done := make(chan struct{})
+	p.handleShutdownSignals(func() {
+		close(done)
+	})
+
+	server.Lpush("overseer.jobs", "slow.example.com must run "+name)
+
+	exited := make(chan bool)
+	go func() {
+		p.workerLoop(1, done, &test.Options{Timeout: 5 * time.Second}, parser.New())
+		close(exited)
+	}()
+
+	select {
+	case given := <-started:
+		if given <= 5*time.Second {
+			t.Errorf("expected the test to be given its maximum duration, got %s", given)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the job to be run")
+	}
+
+	// The first signal waits for the running test
+	p._signals <- syscall.SIGTERM
+	select {
+	case <-exited:
+		t.Fatalf("expected the worker to wait for the running test")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// The second one aborts it, and exits immediately
+	p._signals <- syscall.SIGINT
+	select {
+	case code := <-codes:
+		if code == 0 {
+			t.Errorf("expected a non-zero exit code")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the worker to exit on the second signal")
+	}
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the worker to exit once the test was aborted")
+	}
+
+	// Nothing was notified, and the job is kept to be run again
+	if results := testResults(t, p); len(results) != 0 {
+		t.Errorf("expected no result for the aborted test, got: %v", results)
+	}
+	if jobs, _ := server.List(p.ProcessingQueue); len(jobs) != 1 {
+		t.Errorf("expected the aborted job to be left in the processing queue, got: %v", jobs)
+	}
+}
+
+func TestWorkerLoopShutdownIdle(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	done := make(chan struct{})
+	exited := make(chan bool)
+	go func() {
+		p.workerLoop(1, done, &test.Options{Timeout: 5 * time.Second}, parser.New())
+		close(exited)
+	}()
+
+	// Waiting for jobs only holds back the exit until the claim times out
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+
+	select {
+	case <-exited:
+	case <-time.After(claimTimeout + time.Second):
+		t.Fatalf("expected the idle worker to exit")
+	}
+}
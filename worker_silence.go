@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// silencedKey is the sorted set of the silenced targets, whose members
+// are "type target" entries, with the target as written in the tests
+// rather than the addresses it resolves to, or glob patterns matching
+// them (e.g. "http https://example.com/*"), and whose scores are the unix
+// times they expire at (+inf for never).
+const silencedKey = "overseer.silenced"
+
+// silenceMatches returns whether the given "type target" of a test, as
+// written in the test, matches the silenced entry, where `*` matches any
+// text and `?` any character.
+func silenceMatches(entry string, field string) bool {
+	if !strings.ContainsAny(entry, "*?") {
+		return entry == field
+	}
+
+	pattern := regexp.QuoteMeta(entry)
+	pattern = strings.Replace(pattern, `\*`, ".*", -1)
+	pattern = strings.Replace(pattern, `\?`, ".", -1)
+	return regexp.MustCompile("^" + pattern + "$").MatchString(field)
+}
+
+// activeSilences returns the silenced entries which are not expired at
+// the given time, along with their expiry (zero for never).
+func activeSilences(r *redis.Client, now time.Time) (map[string]time.Time, error) {
+	members, err := r.ZRangeByScoreWithScores(silencedKey, redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(now.Unix(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	silences := map[string]time.Time{}
+	for _, member := range members {
+		var expiry time.Time
+		if !math.IsInf(member.Score, 1) {
+			expiry = time.Unix(int64(member.Score), 0)
+		}
+		silences[fmt.Sprint(member.Member)] = expiry
+	}
+	return silences, nil
+}
+
+// addSilence silences the given entry, for the given duration or, if
+// zero, until it is removed, and drops the expired entries.
+func addSilence(r *redis.Client, entry string, ttl time.Duration, now time.Time) error {
+	score := math.Inf(1)
+	if ttl > 0 {
+		score = float64(now.Add(ttl).Unix())
+	}
+
+	if err := r.ZAdd(silencedKey, redis.Z{Score: score, Member: entry}).Err(); err != nil {
+		return err
+	}
+	return r.ZRemRangeByScore(silencedKey, "-inf", strconv.FormatInt(now.Unix(), 10)).Err()
+}
+
+// removeSilence removes the given entry, returning an error if it was not
+// silenced.
+func removeSilence(r *redis.Client, entry string) error {
+	removed, err := r.ZRem(silencedKey, entry).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("'%s' is not silenced", entry)
+	}
+	return nil
+}
+
+// silenced returns an error describing the silence matching the test, if
+// any, so that it is reported instead of being run.
+//
+// The test is matched by its type and target as written in the test, not
+// as resolved, so that hostnames and URLs can be silenced.
+func (p *workerCmd) silenced(tst test.Test) error {
+	if p._r == nil {
+		return nil
+	}
+
+	silences, err := activeSilences(p._r, p.now())
+	if err != nil {
+		fmt.Printf("Failed to fetch the silenced targets: %s\n", err.Error())
+		return nil
+	}
+
+	field := tst.Type + " " + tst.Target
+	for entry, expiry := range silences {
+		if !silenceMatches(entry, field) {
+			continue
+		}
+		if expiry.IsZero() {
+			return fmt.Errorf("silenced by '%s'", entry)
+		}
+		return fmt.Errorf("silenced by '%s' until %s", entry, expiry.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
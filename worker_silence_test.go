@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestSilenceMatches(t *testing.T) {
+	tests := []struct {
+		entry string
+		field string
+		match bool
+	}{
+		{"http https://example.com/", "http https://example.com/", true},
+		{"http https://example.com/", "http https://example.com/login", false},
+		{"http https://example.com/*", "http https://example.com/login", true},
+		{"http https://example.com/*", "https https://example.com/login", false},
+		{"* db?.example.com", "postgres db1.example.com", true},
+		{"* db?.example.com", "postgres db10.example.com", false},
+		// Only the wildcards are special
+		{"http https://example.com/?a=(1)", "http https://example.com/xa=(1)", true},
+	}
+
+	for _, tt := range tests {
+		if got := silenceMatches(tt.entry, tt.field); got != tt.match {
+			t.Errorf("silenceMatches(%q, %q) = %t, expected %t", tt.entry, tt.field, got, tt.match)
+		}
+	}
+}
+
+func TestSilenced(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	now := time.Unix(1600000000, 0)
+	p._now = func() time.Time { return now }
+
+	parse := parser.New()
+	opts := test.Options{Timeout: 5 * time.Second}
+
+	run := func(line string) *test.Result {
+		tst, err := parse.ParseLine(line, nil)
+		if err != nil {
+			t.Fatalf("failed to parse test: %s", err)
+		}
+		p.runTest(0, tst, opts)
+
+		results := testResults(t, p)
+		result, err := test.ResultFromJSON([]byte(results[len(results)-1]))
+		if err != nil {
+			t.Fatalf("failed to decode result: %s", err)
+		}
+		return result
+	}
+
+	if err := addSilence(p._r, "dumb-test fail.example.com", time.Hour, now); err != nil {
+		t.Fatalf("failed to silence: %s", err)
+	}
+	if err := addSilence(p._r, "dumb-test *.internal", 0, now); err != nil {
+		t.Fatalf("failed to silence: %s", err)
+	}
+
+	// Silenced targets are skipped, without alerting
+	result := run(failingTest)
+	if result.Classification != classificationSilenced || !result.Informational {
+		t.Errorf("expected the test to be silenced, got classification %q (informational %t)", result.Classification, result.Informational)
+	}
+	if result.Error == nil || !strings.Contains(*result.Error, "silenced by 'dumb-test fail.example.com' until 2020-09-13T13:26:40Z") {
+		t.Errorf("expected the silence in the result, got %v", deref(result.Error))
+	}
+
+	result = run("db.internal must run dumb-test with fail-at 0 with dumb-duration-max 0s")
+	if result.Classification != classificationSilenced || result.Error == nil || *result.Error != "silenced by 'dumb-test *.internal'" {
+		t.Errorf("expected the test to be silenced by the pattern, got %v (%s)", result.Error, result.Classification)
+	}
+
+	// Others run
+	if result = run(passingTest); result.Error != nil || result.Classification != "" {
+		t.Errorf("expected the test to run, got %v (%s)", result.Error, result.Classification)
+	}
+
+	// Once the silence expires, the test runs again
+	now = now.Add(2 * time.Hour)
+	if result = run(failingTest); result.Error == nil || result.Classification == classificationSilenced {
+		t.Errorf("expected the test to run, got %v (%s)", result.Error, result.Classification)
+	}
+
+	// Removed silences stop applying at once
+	if err := removeSilence(p._r, "dumb-test *.internal"); err != nil {
+		t.Errorf("failed to remove the silence: %s", err)
+	}
+	if err := removeSilence(p._r, "dumb-test *.internal"); err == nil {
+		t.Errorf("expected removing a missing silence to fail")
+	}
+	if result = run("db.internal must run dumb-test with fail-at 1 with dumb-duration-max 0s"); result.Error != nil {
+		t.Errorf("expected the test to run, got %v", deref(result.Error))
+	}
+
+	// Adding a silence drops the expired ones
+	if err := addSilence(p._r, "dumb-test other.example.com", time.Minute, now); err != nil {
+		t.Fatalf("failed to silence: %s", err)
+	}
+	silences, err := activeSilences(p._r, now)
+	if err != nil {
+		t.Fatalf("failed to list the silences: %s", err)
+	}
+	var buf bytes.Buffer
+	if err = showSilences(&buf, silences, now); err != nil {
+		t.Fatalf("failed to show the silences: %s", err)
+	}
+	if members, _ := p._r.ZCard(silencedKey).Result(); members != 1 || !strings.Contains(buf.String(), "dumb-test other.example.com  in 1m0s") {
+		t.Errorf("expected only the new silence to be left, got %d:\n%s", members, buf.String())
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// stateKeyPrefix prefixes the redis keys holding the values tests keep
+// across their runs.
+const stateKeyPrefix = "overseer.state."
+
+// redisStateStore keeps the values of tests in redis, so that they are
+// shared by all the workers.
+type redisStateStore struct {
+	r *redis.Client
+
+	// If > 0, values not updated for this long are forgotten
+	ttl time.Duration
+}
+
+// Get returns the value stored under the key, or "" if there is none.
+func (s *redisStateStore) Get(key string) (string, error) {
+	value, err := s.r.Get(stateKeyPrefix + key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+// Set stores the value under the key.
+func (s *redisStateStore) Set(key string, value string) error {
+	return s.r.Set(stateKeyPrefix+key, value, s.ttl).Err()
+}
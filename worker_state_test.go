@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedisStateStore(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	state := &redisStateStore{r: p._r, ttl: time.Hour}
+
+	if value, err := state.Get("soa.example.com."); err != nil || value != "" {
+		t.Errorf("expected no value, got %q, %v", value, err)
+	}
+
+	if err := state.Set("soa.example.com.", "2024051501"); err != nil {
+		t.Fatalf("failed to store the value: %s", err)
+	}
+	if value, err := state.Get("soa.example.com."); err != nil || value != "2024051501" {
+		t.Errorf("expected the stored value, got %q, %v", value, err)
+	}
+
+	// The values are forgotten after the TTL
+	if ttl := server.TTL(stateKeyPrefix + "soa.example.com."); ttl != time.Hour {
+		t.Errorf("expected the value to expire after an hour, got %s", ttl)
+	}
+}
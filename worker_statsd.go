@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// statsdEmitter sends a timing and a counter metric for each result to a
+// StatsD server.
+type statsdEmitter struct {
+	conn   net.Conn
+	prefix string
+}
+
+// newStatsdEmitter returns an emitter sending metrics to the given address
+// over UDP, with the given prefix.
+func newStatsdEmitter(address string, prefix string) (*statsdEmitter, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "8125")
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statsdEmitter{conn: conn, prefix: strings.TrimSuffix(prefix, ".")}, nil
+}
+
+// statsdLines returns the StatsD lines for a result:
+//
+//    $prefix.$type.$target.duration:$ms|ms
+//    $prefix.$type.$target.passed:1|c (or failed)
+//
+func (p *workerCmd) statsdLines(prefix string, testType string, target string, duration time.Duration, failed bool) []string {
+	name := p.statsdName(prefix, testType, target)
+
+	status := "passed"
+	if failed {
+		status = "failed"
+	}
+
+	return []string{
+		fmt.Sprintf("%s.duration:%d|ms", name, duration/time.Millisecond),
+		fmt.Sprintf("%s.%s:1|c", name, status),
+	}
+}
+
+// statsdName returns the name the StatsD metrics of a test start with.
+func (p *workerCmd) statsdName(prefix string, testType string, target string) string {
+	name := p.alphaNumeric(testType) + "." + p.alphaNumeric(target)
+	if prefix != "" {
+		name = prefix + "." + name
+	}
+	return name
+}
+
+// emit sends the metrics of a result, in a single datagram.
+//
+// UDP writes never wait for the server, and failures are only reported,
+// so that metrics never hold back the tests.
+func (s *statsdEmitter) emit(lines []string) {
+	if _, err := s.conn.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+		fmt.Printf("Failed to send StatsD metrics: %s\n", err.Error())
+	}
+}
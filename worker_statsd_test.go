@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestStatsdLines(t *testing.T) {
+	p := &workerCmd{}
+
+	lines := p.statsdLines("overseer", "http", "https://example.com/health", 1234567*time.Microsecond, false)
+	expected := []string{
+		"overseer.http.https_example_com_health.duration:1234|ms",
+		"overseer.http.https_example_com_health.passed:1|c",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], lines[i])
+		}
+	}
+
+	lines = p.statsdLines("", "ssh", "2001:db8::1", 0, true)
+	if lines[0] != "ssh.2001_db8_1.duration:0|ms" || lines[1] != "ssh.2001_db8_1.failed:1|c" {
+		t.Errorf("unexpected lines without a prefix: %v", lines)
+	}
+}
+
+func TestNotifyStatsd(t *testing.T) {
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+
+	p._statsd, err = newStatsdEmitter(conn.LocalAddr().String(), "monitoring.overseer.")
+	if err != nil {
+		t.Fatalf("failed to create the emitter: %s", err)
+	}
+
+	// Metrics are sent even for results which are not notified
+	tst := test.Test{Target: "192.0.2.1", Type: "ssh", Input: "192.0.2.1 must run ssh", Shadow: true}
+	if err = p.notify(tst, nil, errors.New("connection refused"), &testOutcome{Duration: 250 * time.Millisecond}); err != nil {
+		t.Fatalf("failed to notify: %s", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read the metrics: %s", err)
+	}
+
+	expected := "monitoring.overseer.ssh.192_0_2_1.duration:250|ms\nmonitoring.overseer.ssh.192_0_2_1.failed:1|c"
+	if string(buf[:n]) != expected {
+		t.Errorf("expected %q, got %q", expected, string(buf[:n]))
+	}
+}
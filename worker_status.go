@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// statusKey is the redis hash holding the latest result of each target,
+// keyed by statusField.
+const statusKey = "overseer.status"
+
+// statusField returns the field of the status hash a result is stored in.
+func statusField(result *test.Result) string {
+	return result.Type + " " + result.Target
+}
+
+// recordStatus stores the result as the latest status of its target.
+//
+// The status is recorded before any deduplication or smoothing, so it
+// always reflects the outcome of the latest run.
+func (p *workerCmd) recordStatus(result *test.Result) {
+	j, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Failed to encode test-result to JSON: %s\n", err.Error())
+		return
+	}
+
+	if _, err = p._r.HSet(statusKey, statusField(result), j).Result(); err != nil {
+		fmt.Printf("Failed to record the status of %s: %s\n", statusField(result), err.Error())
+	}
+}
+
+// statusReapInterval is how often stale status entries are looked for.
+const statusReapInterval = time.Minute
+
+// reapStatusScript deletes a status entry, unless it was updated since it
+// was found to be stale.
+var reapStatusScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// reapStatus removes the status entries which were not updated within the
+// status TTL, e.g. of decommissioned targets, returning how many were
+// removed.
+func (p *workerCmd) reapStatus(now time.Time) int {
+	statuses, err := p._r.HGetAll(statusKey).Result()
+	if err != nil {
+		fmt.Printf("Failed to fetch the statuses: %s\n", err.Error())
+		return 0
+	}
+
+	reaped := 0
+	for field, value := range statuses {
+		// Entries which cannot be decoded would never be updated either
+		result, err := test.ResultFromJSON([]byte(value))
+		if err == nil && now.Sub(time.Unix(result.Time, 0)) <= p.StatusTTL {
+			continue
+		}
+
+		deleted, err := reapStatusScript.Run(p._r, []string{statusKey}, field, value).Int()
+		if err != nil {
+			fmt.Printf("Failed to remove the stale status of %s: %s\n", field, err.Error())
+			continue
+		}
+		reaped += deleted
+	}
+
+	if reaped > 0 {
+		p.verbose(fmt.Sprintf("Removed %d stale status entries\n", reaped))
+	}
+	return reaped
+}
+
+// reapStatusLoop periodically removes the stale status entries.
+func (p *workerCmd) reapStatusLoop() {
+	for range time.Tick(statusReapInterval) {
+		p.reapStatus(time.Now())
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+)
+
+func TestReapStatus(t *testing.T) {
+	p, s := newTestWorker(t)
+	defer s.Close()
+	p.StatusTTL = time.Hour
+
+	now := time.Now()
+	record := func(field string, updated time.Time) {
+		j, _ := json.Marshal(&test.Result{Time: updated.Unix(), Type: "ssh", Target: field})
+		s.HSet(statusKey, field, string(j))
+	}
+
+	record("ssh fresh.example.com", now.Add(-time.Minute))
+	record("ssh stale.example.com", now.Add(-2*time.Hour))
+	s.HSet(statusKey, "ssh broken.example.com", "not json")
+
+	if reaped := p.reapStatus(now); reaped != 2 {
+		t.Fatalf("expected 2 stale entries to be removed, got %d", reaped)
+	}
+
+	fields, _ := s.HKeys(statusKey)
+	if len(fields) != 1 || fields[0] != "ssh fresh.example.com" {
+		t.Fatalf("expected only the fresh entry to remain, got %v", fields)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/go-redis/redis"
+)
+
+// successRateKeyPrefix prefixes the redis lists holding the outcomes of the
+// latest runs of each test, "1" if it passed, "0" if it failed.
+const successRateKeyPrefix = "overseer.success-rate."
+
+// successRateKey returns the list the outcomes of a test are stored in.
+func successRateKey(result *test.Result) string {
+	return successRateKeyPrefix + result.Type + "." + result.Target
+}
+
+// updateSuccessRate adds the outcome of the result to the sliding window of
+// its test, and sets the success rate of the test over the window in the
+// result, so that chronic flakiness shows up even if each run is only
+// passed or failed. The rate is sent to the metrics hosts too.
+func (p *workerCmd) updateSuccessRate(tst test.Test, result *test.Result) {
+	outcome := "1"
+	if result.Error != nil {
+		outcome = "0"
+	}
+
+	key := successRateKey(result)
+	var outcomes *redis.StringSliceCmd
+	_, err := p._r.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.LPush(key, outcome)
+		pipe.LTrim(key, 0, int64(p.SuccessRateWindow)-1)
+		if p.StatusTTL > 0 {
+			pipe.Expire(key, p.StatusTTL)
+		}
+		outcomes = pipe.LRange(key, 0, -1)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Failed to update the success rate of %s: %s\n", statusField(result), err.Error())
+		return
+	}
+
+	passed := 0
+	for _, outcome := range outcomes.Val() {
+		if outcome == "1" {
+			passed++
+		}
+	}
+
+	rate := float64(passed) * 100 / float64(len(outcomes.Val()))
+	result.SuccessRate = &rate
+	result.SuccessRateRuns = len(outcomes.Val())
+
+	if p._statsd != nil {
+		p._statsd.emit([]string{fmt.Sprintf("%s.success_rate:%.2f|g", p.statsdName(p._statsd.prefix, result.Type, result.Target), rate)})
+	}
+	if p._g != nil {
+		p._g.SimpleSend(p.formatMetrics(tst, "success_rate"), fmt.Sprintf("%.2f", rate))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"github.com/marpaia/graphite-golang"
+)
+
+func TestSuccessRate(t *testing.T) {
+	p, s := newTestWorker(t)
+	defer s.Close()
+	p.SuccessRateWindow = 4
+
+	tst := test.Test{Target: "example.com", Type: "http", Input: "example.com must run http"}
+	run := func(failed bool) *test.Result {
+		var err error
+		if failed {
+			err = errors.New("connection refused")
+		}
+		if errNotify := p.notify(tst, nil, err, nil); errNotify != nil {
+			t.Fatalf("failed to notify: %s", errNotify)
+		}
+		results := testResults(t, p)
+		result, errJSON := test.ResultFromJSON([]byte(results[len(results)-1]))
+		if errJSON != nil {
+			t.Fatalf("failed to decode the result: %s", errJSON)
+		}
+		return result
+	}
+
+	steps := []struct {
+		failed bool
+		rate   float64
+		runs   int
+	}{
+		{false, 100, 1},
+		{true, 50, 2},
+		{false, 200.0 / 3, 3},
+		{false, 75, 4},
+		// The first run falls out of the window
+		{false, 75, 4},
+		// And so does the failure
+		{false, 100, 4},
+	}
+	for i, step := range steps {
+		result := run(step.failed)
+		if result.SuccessRate == nil || *result.SuccessRate != step.rate || result.SuccessRateRuns != step.runs {
+			t.Fatalf("step %d: expected %.2f%% over %d runs, got %v over %d", i, step.rate, step.runs, result.SuccessRate, result.SuccessRateRuns)
+		}
+	}
+
+	// Without a window, no rate is computed
+	p.SuccessRateWindow = 0
+	if result := run(false); result.SuccessRate != nil {
+		t.Fatalf("expected no success rate, got %.2f", *result.SuccessRate)
+	}
+}
+
+func TestSuccessRateGraphite(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer conn.Close()
+
+	p, s := newTestWorker(t)
+	defer s.Close()
+	p.SuccessRateWindow = 4
+	p._g, err = graphite.NewGraphiteUDP("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port)
+	if err != nil {
+		t.Fatalf("failed to connect to graphite: %s", err)
+	}
+
+	tst := test.Test{Target: "example.com", Type: "http", Input: "example.com must run http"}
+	if err = p.notify(tst, nil, errors.New("connection refused"), nil); err != nil {
+		t.Fatalf("failed to notify: %s", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("expected the success rate to be sent: %s", err)
+	}
+	if metric := string(buf[:n]); !strings.HasPrefix(metric, "overseer.test.http.example_com.success_rate 0.00 ") {
+		t.Errorf("unexpected metric: %q", metric)
+	}
+}
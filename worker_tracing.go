@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cmaster11/overseer/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the tracer creating the spans of the tests.
+const tracerName = "github.com/cmaster11/overseer"
+
+// testTrace is the trace of a test: a span covering the whole test, with
+// child spans for the resolution of its target, and each of its attempts.
+//
+// A nil trace, when tracing is disabled, ignores everything.
+type testTrace struct {
+	tracer trace.Tracer
+	ctx    context.Context
+	root   trace.Span
+
+	lock     sync.Mutex
+	attempts int
+	failure  error
+}
+
+// startTrace starts the trace of a test, if tracing is enabled.
+func (p *workerCmd) startTrace(tst test.Test) *testTrace {
+	if p._tracer == nil {
+		return nil
+	}
+
+	ctx, root := p._tracer.Start(context.Background(), "overseer.test", trace.WithAttributes(
+		attribute.String("overseer.test.type", tst.Type),
+		attribute.String("overseer.test.target", redactString(tst.Target, p._redact)),
+	))
+	return &testTrace{tracer: p._tracer, ctx: ctx, root: root}
+}
+
+// child records a finished child span of the test.
+func (t *testTrace) child(name string, start time.Time, err error, attributes ...attribute.KeyValue) {
+	_, span := t.tracer.Start(t.ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attributes...))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// resolved records the resolution of the target of the test.
+func (t *testTrace) resolved(host string, start time.Time, addresses int, err error) {
+	if t == nil {
+		return
+	}
+	t.child("overseer.dns", start, err,
+		attribute.String("overseer.dns.host", host),
+		attribute.Int("overseer.dns.addresses", addresses),
+	)
+}
+
+// attempt records an attempt of the test against one of its targets.
+func (t *testTrace) attempt(target string, attempt uint, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+	t.child("overseer.attempt", start, err,
+		attribute.String("overseer.attempt.target", target),
+		attribute.Int("overseer.attempt.number", int(attempt)),
+	)
+
+	t.lock.Lock()
+	t.attempts++
+	t.lock.Unlock()
+}
+
+// notifier wraps the function notifying the results of the test, so that
+// the test is recorded as failed if any of its results is a failure.
+func (t *testTrace) notifier(notify notifyFunc) notifyFunc {
+	if t == nil {
+		return notify
+	}
+	return func(testDefinition test.Test, uniqueHash *string, resultError error, outcome *testOutcome) error {
+		if resultError != nil {
+			t.lock.Lock()
+			t.failure = resultError
+			t.lock.Unlock()
+		}
+		if outcome != nil && outcome.Classification != "" {
+			t.root.SetAttributes(attribute.String("overseer.test.classification", outcome.Classification))
+		}
+
+		return notify(testDefinition, uniqueHash, resultError, outcome)
+	}
+}
+
+// finish ends the trace of the test, which the tracer provider exports in
+// the background.
+func (t *testTrace) finish() {
+	if t == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.root.SetAttributes(attribute.Int("overseer.test.attempts", t.attempts))
+	if t.failure != nil {
+		t.root.SetAttributes(attribute.String("overseer.test.result", "failed"))
+		t.root.SetStatus(codes.Error, t.failure.Error())
+	} else {
+		t.root.SetAttributes(attribute.String("overseer.test.result", "passed"))
+		t.root.SetStatus(codes.Ok, "")
+	}
+	t.root.End()
+}
+
+// newOTLPTracerProvider returns a tracer provider exporting the spans to
+// an OpenTelemetry collector, via OTLP over HTTP, at the given endpoint,
+// e.g. "http://localhost:4318", to which "/v1/traces" is added if needed.
+//
+// The spans are exported in batches, in the background, so that a slow
+// collector never holds back the tests; the provider must be shutdown to
+// export the last ones.
+func newOTLPTracerProvider(endpoint string, timeout time.Duration) (*sdktrace.TracerProvider, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(endpoint),
+		otlptracehttp.WithTimeout(timeout),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("overseer"),
+			semconv.ServiceVersion(version),
+		)),
+	), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cmaster11/overseer/parser"
+	"github.com/cmaster11/overseer/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttributes returns the attributes of a span, by key.
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]interface{} {
+	attributes := map[attribute.Key]interface{}{}
+	for _, kv := range span.Attributes {
+		attributes[kv.Key] = kv.Value.AsInterface()
+	}
+	return attributes
+}
+
+func TestTracing(t *testing.T) {
+	failing := map[string]bool{"2001:db8::1": true}
+	name := registerFakeTest(&fakeTest{resolve: true, run: failingOn(failing)})
+
+	p, server := newTestWorker(t)
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+	p._tracer = provider.Tracer(tracerName)
+	p._lookupIP = func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}, nil
+	}
+
+	tst, err := parser.New().ParseLine("example.com must run "+name+" with retries 1", nil)
+	if err != nil {
+		t.Fatalf("failed to parse test: %s", err)
+	}
+	p.runTest(0, tst, test.Options{Timeout: time.Second})
+
+	// The children end, and are exported, before the test span
+	spans := exporter.GetSpans()
+	if len(spans) == 0 {
+		t.Fatalf("expected the test to be traced")
+	}
+	root := spans[len(spans)-1]
+
+	expected := map[attribute.Key]interface{}{
+		"overseer.test.type":     name,
+		"overseer.test.target":   "example.com",
+		"overseer.test.result":   "failed",
+		"overseer.test.attempts": int64(3),
+	}
+	attributes := spanAttributes(root)
+	for key, value := range expected {
+		if attributes[key] != value {
+			t.Errorf("expected the attribute %s of the test span to be %v, got %v", key, value, attributes[key])
+		}
+	}
+	if root.Name != "overseer.test" || root.Parent.IsValid() || root.Status.Code != codes.Error {
+		t.Errorf("unexpected test span: %+v", root)
+	}
+
+	// The resolution, a passing attempt, and two failing ones
+	names := map[string]int{}
+	failures := 0
+	for _, span := range spans[:len(spans)-1] {
+		if span.SpanContext.TraceID() != root.SpanContext.TraceID() || span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("expected %s to be a child of the test span", span.Name)
+		}
+		if span.EndTime.Before(span.StartTime) {
+			t.Errorf("expected %s to end after its start", span.Name)
+		}
+		names[span.Name]++
+		if span.Status.Code == codes.Error {
+			failures++
+			if spanAttributes(span)["overseer.attempt.target"] != "2001:db8::1" {
+				t.Errorf("unexpected failing attempt: %v", span.Attributes)
+			}
+			if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+				t.Errorf("expected the error to be recorded in the span, got %v", span.Events)
+			}
+		}
+		if span.Name == "overseer.dns" && spanAttributes(span)["overseer.dns.addresses"] != int64(2) {
+			t.Errorf("expected the number of addresses in the DNS span, got %v", span.Attributes)
+		}
+	}
+	if names["overseer.dns"] != 1 || names["overseer.attempt"] != 3 || failures != 2 {
+		t.Errorf("unexpected child spans: %v, with %d failures", names, failures)
+	}
+
+	// Passing tests are traced too
+	exporter.Reset()
+	delete(failing, "2001:db8::1")
+	p.runTest(0, tst, test.Options{Timeout: time.Second})
+
+	spans = exporter.GetSpans()
+	root = spans[len(spans)-1]
+	if attributes = spanAttributes(root); attributes["overseer.test.result"] != "passed" || attributes["overseer.test.attempts"] != int64(2) || root.Status.Code != codes.Ok {
+		t.Errorf("expected a passing trace, got %v", root.Attributes)
+	}
+}
+
+func TestOTLPTracerProvider(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r
+	}))
+	defer collector.Close()
+
+	// The path is added to the endpoint
+	provider, err := newOTLPTracerProvider(collector.URL, time.Second)
+	if err != nil {
+		t.Fatalf("failed to create the tracer provider: %s", err)
+	}
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "overseer.test")
+	span.End()
+
+	// The spans waiting are exported on shutdown
+	if err = provider.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shutdown the tracer provider: %s", err)
+	}
+
+	select {
+	case r := <-received:
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export request: %s %s (%s)", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+		}
+	default:
+		t.Fatalf("the spans were never exported")
+	}
+}